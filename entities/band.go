@@ -15,6 +15,15 @@ type Band struct {
 	Roles []*Role `bson:"roles,omitempty"`
 
 	NotionCollection *NotionCollection `bson:"notionCollection"`
+
+	// Telegram group of the band, 0 if it is not linked.
+	ChatID int64 `bson:"chatId"`
+
+	// Signed into the API token of the band. A new nonce revokes the token.
+	APITokenNonce string `bson:"apiTokenNonce,omitempty"`
+
+	// Signed into the calendar links of the members. A new nonce revokes them all.
+	CalendarNonce string `bson:"calendarNonce,omitempty"`
 }
 
 // TODO: refactor.
@@ -19,9 +19,71 @@ type Event struct {
 
 	SongIDs []primitive.ObjectID `bson:"songIds,omitempty"`
 	Songs   []*Song              `bson:"songs,omitempty"`
+
+	Setlist []*SetlistEntry `bson:"setlist,omitempty"`
+
+	// The template or the series the event was created from.
+	TemplateID primitive.ObjectID `bson:"templateId,omitempty"`
+
+	// The reminder was posted to the group of the band. It is reset when the time changes.
+	ChatReminded bool `bson:"chatReminded"`
+}
+
+// SetlistEntry is how a song of the event is going to be played. Empty fields mean "as in the doc".
+type SetlistEntry struct {
+	SongID primitive.ObjectID `bson:"songId"`
+
+	Key string `bson:"key,omitempty"`
+	BPM string `bson:"bpm,omitempty"`
+
+	// Lead vocalist.
+	MembershipID primitive.ObjectID `bson:"membershipId,omitempty"`
+
+	Note string `bson:"note,omitempty"`
 }
 
 func (e *Event) Alias() string {
 	timeStr := lctime.Strftime("%A | %d.%m.%Y", e.Time)
 	return fmt.Sprintf("%s | %s", timeStr, e.Name)
 }
+
+// SetlistEntry returns the entry of the song, it is empty if nothing was planned.
+func (e *Event) SetlistEntry(songID primitive.ObjectID) SetlistEntry {
+	for _, entry := range e.Setlist {
+		if entry.SongID == songID {
+			return *entry
+		}
+	}
+	return SetlistEntry{SongID: songID}
+}
+
+// SongKey returns the key the song is going to be played in at the event.
+func (e *Event) SongKey(song *Song) string {
+	if entry := e.SetlistEntry(song.ID); entry.Key != "" {
+		return entry.Key
+	}
+	return song.PDF.Key
+}
+
+// SongBPM returns the BPM the song is going to be played at the event.
+func (e *Event) SongBPM(song *Song) string {
+	if entry := e.SetlistEntry(song.ID); entry.BPM != "" {
+		return entry.BPM
+	}
+	return song.PDF.BPM
+}
+
+// SongCaption is like Song.Caption, but with the key and BPM planned for the event.
+func (e *Event) SongCaption(song *Song) string {
+	return fmt.Sprintf("%s, %s, %s", e.SongKey(song), e.SongBPM(song), song.PDF.Time)
+}
+
+// Vocalist returns the membership of the lead vocalist of the entry or nil.
+func (e *Event) Vocalist(entry SetlistEntry) *Membership {
+	for _, membership := range e.Memberships {
+		if membership.ID == entry.MembershipID {
+			return membership
+		}
+	}
+	return nil
+}
@@ -0,0 +1,84 @@
+package entities
+
+import (
+	"fmt"
+	"github.com/klauspost/lctime"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"time"
+)
+
+// EventTemplate pre-fills new events. A template with a recurrence is a series: its events are created automatically.
+type EventTemplate struct {
+	ID     primitive.ObjectID `bson:"_id,omitempty"`
+	BandID primitive.ObjectID `bson:"bandId,omitempty"`
+	Name   string             `bson:"name,omitempty"`
+
+	Slots []*TemplateSlot `bson:"slots"`
+
+	Recurrence *Recurrence `bson:"recurrence"`
+
+	// Events of the series are created up to this time, so the deleted ones are not created again.
+	GeneratedUntil time.Time `bson:"generatedUntil,omitempty"`
+}
+
+// TemplateSlot is a role that is needed at the event with the members that usually take it.
+type TemplateSlot struct {
+	RoleID  primitive.ObjectID `bson:"roleId,omitempty"`
+	UserIDs []int64            `bson:"userIds,omitempty"`
+}
+
+// Recurrence is a rule like "every Sunday at 10:00" or "first Friday of the month at 19:00".
+type Recurrence struct {
+	Weekday time.Weekday `bson:"weekday"`
+	// 0 is every week, 1-4 is the week of the month and -1 is the last week of the month.
+	Week   int `bson:"week"`
+	Hour   int `bson:"hour"`
+	Minute int `bson:"minute"`
+}
+
+// Occurrences returns the times of the events after from and not after until.
+func (r *Recurrence) Occurrences(from time.Time, until time.Time) []time.Time {
+	times := make([]time.Time, 0)
+
+	for d := time.Date(from.Year(), from.Month(), from.Day(), 0, 0, 0, 0, from.Location()); !d.After(until); d = d.AddDate(0, 0, 1) {
+		t := time.Date(d.Year(), d.Month(), d.Day(), r.Hour, r.Minute, 0, 0, d.Location())
+		if r.Matches(t) && t.After(from) && !t.After(until) {
+			times = append(times, t)
+		}
+	}
+
+	return times
+}
+
+// Matches reports whether an event of the series is at t.
+func (r *Recurrence) Matches(t time.Time) bool {
+	if t.Weekday() != r.Weekday || t.Hour() != r.Hour || t.Minute() != r.Minute {
+		return false
+	}
+
+	switch {
+	case r.Week > 0:
+		return (t.Day()-1)/7+1 == r.Week
+	case r.Week < 0:
+		return t.AddDate(0, 0, 7).Month() != t.Month()
+	default:
+		return true
+	}
+}
+
+func (r *Recurrence) String() string {
+	// Any date with the same weekday.
+	weekday := lctime.Strftime("%A", time.Date(2006, 1, 1+int(r.Weekday), 0, 0, 0, 0, time.UTC))
+
+	var week string
+	switch {
+	case r.Week > 0:
+		week = fmt.Sprintf("%d-я неделя месяца", r.Week)
+	case r.Week < 0:
+		week = "последняя неделя месяца"
+	default:
+		week = "каждую неделю"
+	}
+
+	return fmt.Sprintf("%s, %s, %02d:%02d", weekday, week, r.Hour, r.Minute)
+}
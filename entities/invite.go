@@ -0,0 +1,30 @@
+package entities
+
+import (
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"time"
+)
+
+// Invite is a link that lets users join the band without asking admins.
+type Invite struct {
+	ID     primitive.ObjectID `bson:"_id,omitempty"`
+	Token  string             `bson:"token,omitempty"`
+	BandID primitive.ObjectID `bson:"bandId,omitempty"`
+
+	// Role the user gets on joining, like helpers.Admin. Empty means a regular member.
+	Role string `bson:"role,omitempty"`
+
+	// Zero means the invite doesn't expire.
+	ExpiresAt time.Time `bson:"expiresAt,omitempty"`
+	// Zero means the invite can be used any number of times.
+	MaxUses int `bson:"maxUses,omitempty"`
+	Uses    int `bson:"uses,omitempty"`
+}
+
+// Valid reports whether the invite is not expired and has uses left.
+func (i *Invite) Valid(now time.Time) bool {
+	if !i.ExpiresAt.IsZero() && now.After(i.ExpiresAt) {
+		return false
+	}
+	return i.MaxUses == 0 || i.Uses < i.MaxUses
+}
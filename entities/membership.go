@@ -13,4 +13,24 @@ type Membership struct {
 	Role   *Role              `bson:"role,omitempty"`
 
 	Notified bool `bson:"notified,omitempty"`
+
+	// Answer of the user to the notification. Empty means pending.
+	Status string `bson:"status,omitempty"`
+}
+
+const (
+	Accepted = "accepted"
+	Declined = "declined"
+)
+
+// StatusIcon returns the answer of the user as an emoji.
+func (m *Membership) StatusIcon() string {
+	switch m.Status {
+	case Accepted:
+		return "✅"
+	case Declined:
+		return "❌"
+	default:
+		return "⏳"
+	}
 }
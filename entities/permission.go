@@ -0,0 +1,53 @@
+package entities
+
+import "go.mongodb.org/mongo-driver/bson/primitive"
+
+// Permission allows actions in a band.
+type Permission string
+
+const (
+	// ManageEvents allows creating, changing and deleting events, templates and rotas.
+	ManageEvents Permission = "manageEvents"
+	// ManageMembers allows inviting users and answering join requests. Only admins make admins.
+	ManageMembers Permission = "manageMembers"
+	// EditSongs allows creating and changing song docs.
+	EditSongs Permission = "editSongs"
+	// DeleteSongs allows deleting songs together with their docs.
+	DeleteSongs  Permission = "deleteSongs"
+	UploadVoices Permission = "uploadVoices"
+	ManageRoles  Permission = "manageRoles"
+	// ManageBand allows permission groups, the API access and linking group chats.
+	ManageBand Permission = "manageBand"
+)
+
+// Permissions lists all permissions in the order they are shown.
+var Permissions = []Permission{ManageEvents, ManageMembers, EditSongs, DeleteSongs, UploadVoices, ManageRoles, ManageBand}
+
+// PermissionGroup is a named set of permissions of the band, members are assigned to one.
+type PermissionGroup struct {
+	ID          primitive.ObjectID `bson:"_id,omitempty"`
+	BandID      primitive.ObjectID `bson:"bandId,omitempty"`
+	Name        string             `bson:"name,omitempty"`
+	Permissions []Permission       `bson:"permissions"`
+}
+
+// Has reports whether the group grants the permission.
+func (g *PermissionGroup) Has(permission Permission) bool {
+	for _, p := range g.Permissions {
+		if p == permission {
+			return true
+		}
+	}
+	return false
+}
+
+// Toggle grants the permission if the group doesn't have it and takes it away otherwise.
+func (g *PermissionGroup) Toggle(permission Permission) {
+	for i, p := range g.Permissions {
+		if p == permission {
+			g.Permissions = append(g.Permissions[:i], g.Permissions[i+1:]...)
+			return
+		}
+	}
+	g.Permissions = append(g.Permissions, permission)
+}
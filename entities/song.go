@@ -36,6 +36,18 @@ type PDF struct {
 	Time string `bson:"time,omitempty"`
 
 	WebViewLink string `bson:"webViewLink,omitempty"`
+
+	Transposed []TransposedPDF `bson:"transposed,omitempty"`
+}
+
+// TransposedPDF is a PDF of the song in another key. The doc itself is not changed,
+// so the file is valid only while the doc has the same ModifiedTime.
+type TransposedPDF struct {
+	Key          string `bson:"key,omitempty"`
+	ModifiedTime string `bson:"modifiedTime,omitempty"`
+	// Version of the doc. The modified time has a resolution of a second, so it is not enough to tell edits apart.
+	Version  int64  `bson:"version,omitempty"`
+	TgFileID string `bson:"tgFileId,omitempty"`
 }
 
 func (s *Song) Caption() string {
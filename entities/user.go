@@ -1,6 +1,8 @@
 package entities
 
 import (
+	"fmt"
+	"go.mongodb.org/mongo-driver/bson"
 	"go.mongodb.org/mongo-driver/bson/primitive"
 	"google.golang.org/api/drive/v3"
 	"net/url"
@@ -10,11 +12,159 @@ import (
 type User struct {
 	ID    int64  `bson:"_id,omitempty"`
 	Name  string `bson:"name,omitempty"`
-	Role  string `bson:"role,omitempty"`
+	Role  string `bson:"role"`
 	State *State `bson:"state,omitempty"`
 
+	// BandID is the current band of the user, Role is the role in it.
 	BandID primitive.ObjectID `bson:"bandId,omitempty"`
 	Band   *Band              `bson:"band,omitempty"`
+
+	// Bands the user is a member of, with the role in each.
+	Bands []*UserBand `bson:"bands"`
+
+	// Permissions of the user in the current band, they are loaded for every update.
+	Permissions []Permission `bson:"-"`
+
+	Blackouts []*Blackout `bson:"blackouts"`
+
+	// Signed into the calendar links of the user. A new nonce revokes them.
+	CalendarNonce string `bson:"calendarNonce,omitempty"`
+}
+
+type UserBand struct {
+	BandID primitive.ObjectID `bson:"bandId"`
+	Role   string             `bson:"role,omitempty"`
+
+	// Members without a permission group have the default permissions.
+	PermissionGroupID primitive.ObjectID `bson:"permissionGroupId,omitempty"`
+}
+
+// Can reports whether the user has the permission in the current band.
+func (u *User) Can(permission Permission) bool {
+	for _, p := range u.Permissions {
+		if p == permission {
+			return true
+		}
+	}
+	return false
+}
+
+// UserBands returns bands the user is a member of.
+// Users saved before they could be in several bands only have BandID and Role set, so they are migrated here.
+func (u *User) UserBands() []*UserBand {
+	if u.BandID == primitive.NilObjectID {
+		return u.Bands
+	}
+
+	for _, userBand := range u.Bands {
+		if userBand.BandID == u.BandID {
+			return u.Bands
+		}
+	}
+
+	u.Bands = append(u.Bands, &UserBand{BandID: u.BandID, Role: u.Role})
+	return u.Bands
+}
+
+// UserBand returns the membership of the user in the band, or nil.
+func (u *User) UserBand(bandID primitive.ObjectID) *UserBand {
+	for _, userBand := range u.UserBands() {
+		if userBand.BandID == bandID {
+			return userBand
+		}
+	}
+
+	return nil
+}
+
+// RoleIn returns the role of the user in the band.
+func (u *User) RoleIn(bandID primitive.ObjectID) string {
+	userBand := u.UserBand(bandID)
+	if userBand == nil {
+		return ""
+	}
+
+	return userBand.Role
+}
+
+// JoinBand adds the user to the band with the role, or changes the role if the user is already there,
+// and makes the band current.
+func (u *User) JoinBand(bandID primitive.ObjectID, role string) {
+	userBand := u.UserBand(bandID)
+	if userBand == nil {
+		userBand = &UserBand{BandID: bandID}
+		u.Bands = append(u.Bands, userBand)
+	}
+	userBand.Role = role
+
+	u.SwitchBand(bandID)
+}
+
+// SetRoleIn changes the role of the user in the band, the current band stays the same.
+func (u *User) SetRoleIn(bandID primitive.ObjectID, role string) {
+	userBand := u.UserBand(bandID)
+	if userBand == nil {
+		return
+	}
+	userBand.Role = role
+
+	if u.BandID == bandID {
+		u.Role = role
+		u.Permissions = nil
+	}
+}
+
+// SetPermissionGroupIn assigns the permission group to the user in the band. Nil ID means the default permissions.
+func (u *User) SetPermissionGroupIn(bandID primitive.ObjectID, groupID primitive.ObjectID) {
+	userBand := u.UserBand(bandID)
+	if userBand == nil {
+		return
+	}
+	userBand.PermissionGroupID = groupID
+
+	if u.BandID == bandID {
+		u.Permissions = nil
+	}
+}
+
+// SwitchBand makes the band current. It returns false if the user is not a member of the band.
+func (u *User) SwitchBand(bandID primitive.ObjectID) bool {
+	userBand := u.UserBand(bandID)
+	if userBand == nil {
+		return false
+	}
+
+	u.BandID = userBand.BandID
+	u.Role = userBand.Role
+	u.Permissions = nil
+	return true
+}
+
+// Blackout is a period when the user can't serve. Both days are included.
+type Blackout struct {
+	From time.Time `bson:"from"`
+	To   time.Time `bson:"to"`
+}
+
+// BlackoutOn returns the blackout that covers the day of t, or nil.
+func (u *User) BlackoutOn(t time.Time) *Blackout {
+	day := t.Local().Format("2006-01-02")
+
+	for _, blackout := range u.Blackouts {
+		if blackout.From.Local().Format("2006-01-02") <= day && day <= blackout.To.Local().Format("2006-01-02") {
+			return blackout
+		}
+	}
+
+	return nil
+}
+
+func (b *Blackout) String() string {
+	if b.From.Local().Format("2006-01-02") == b.To.Local().Format("2006-01-02") {
+		return b.From.Local().Format("02.01.2006")
+	}
+
+	return fmt.Sprintf("%s – %s", b.From.Local().Format("02.01.2006"), b.To.Local().Format("02.01.2006"))
 }
 
 type UserExtra struct {
@@ -29,6 +179,14 @@ type State struct {
 	Context      Context  `bson:"context,omitempty"`
 	CallbackData *url.URL `bson:"-"`
 
+	// Conversation state: the current step, the steps behind it and data of the flow.
+	Step  string   `bson:"step,omitempty"`
+	Steps []string `bson:"steps,omitempty"`
+	Data  bson.Raw `bson:"data,omitempty"`
+
+	// EnteredAt is when the user entered the state or its current step. States expire after the timeout of the flow.
+	EnteredAt time.Time `bson:"enteredAt,omitempty"`
+
 	Prev *State `bson:"prev,omitempty"`
 	Next *State `bson:"next,omitempty"`
 }
@@ -45,21 +203,10 @@ type Context struct {
 
 	Voice *Voice `bson:"currentVoice,omitempty"`
 
-	Band  *Band   `bson:"currentBand,omitempty"`
 	Bands []*Band `bson:"bands,omitempty"`
 
-	Role *Role `bson:"role,omitempty"`
-
 	EventID primitive.ObjectID `bson:"eventId,omitempty"`
 
-	CreateSongPayload struct {
-		Name   string `bson:"name,omitempty"`
-		Lyrics string `bson:"lyrics,omitempty"`
-		Key    string `bson:"key,omitempty"`
-		BPM    string `bson:"bpm,omitempty"`
-		Time   string `bson:"time,omitempty"`
-	} `bson:"createSongPayload,omitempty"`
-
 	Map  map[string]string `bson:"map,omitempty"`
 	Time time.Time         `bson:"time,omitempty"`
 
@@ -11,6 +11,7 @@ require (
 	github.com/golang/snappy v0.0.2 // indirect
 	github.com/joeyave/chords-transposer v0.0.6
 	github.com/joeyave/telebot/v3 v3.0.1
+	github.com/jung-kurt/gofpdf v1.16.2
 	github.com/kjk/notionapi v0.0.0-20201230072046-b69038831038
 	github.com/klauspost/compress v1.11.7 // indirect
 	github.com/klauspost/lctime v0.1.0
@@ -0,0 +1,181 @@
+package handlers
+
+import (
+	"github.com/joeyave/telebot/v3"
+	"regexp"
+)
+
+const invalidCallbackMessage = "Эта кнопка устарела. Открой меню заново."
+
+var callbackURLRegex = regexp.MustCompile(`t\.me/callbackData[^"]*`)
+
+// CallbackMiddleware checks signatures of callbacks from private chats, the callback data and the callback URL
+// of the message are replaced with the verified ones. Everything sent back with the context is signed for the user.
+func (h *Handler) CallbackMiddleware(next telebot.HandlerFunc) telebot.HandlerFunc {
+	return func(c telebot.Context) error {
+		// Inline queries come without a chat, group chats have no callback buttons of ours.
+		if c.Chat() == nil || c.Chat().Type != telebot.ChatPrivate {
+			return next(c)
+		}
+
+		if c.Callback() != nil {
+			err := h.verifyCallback(c.Chat().ID, c.Callback())
+			if err != nil {
+				return c.Respond(&telebot.CallbackResponse{Text: invalidCallbackMessage, ShowAlert: true})
+			}
+		}
+
+		return next(&signingContext{Context: c, h: h, userID: c.Chat().ID})
+	}
+}
+
+func (h *Handler) verifyCallback(userID int64, callback *telebot.Callback) error {
+	data, err := h.callbackService.Verify(userID, callback.Data)
+	if err != nil {
+		return err
+	}
+	callback.Data = data
+
+	if callback.Message == nil {
+		return nil
+	}
+
+	for _, entities := range [][]telebot.MessageEntity{callback.Message.Entities, callback.Message.CaptionEntities} {
+		for i := range entities {
+			if entities[i].Type != telebot.EntityTextLink {
+				continue
+			}
+
+			match := callbackURLRegex.FindString(entities[i].URL)
+			if match == "" {
+				continue
+			}
+
+			u, err := h.callbackService.VerifyURL(userID, match)
+			if err != nil {
+				return err
+			}
+			entities[i].URL = u
+		}
+	}
+
+	return nil
+}
+
+// signText signs callback URLs added to the text with helpers.AddCallbackData.
+func (h *Handler) signText(userID int64, text string) string {
+	return callbackURLRegex.ReplaceAllStringFunc(text, func(u string) string {
+		return h.callbackService.SignURL(userID, u)
+	})
+}
+
+// signMarkup returns a copy of the markup with callback data of inline buttons signed.
+func (h *Handler) signMarkup(userID int64, markup *telebot.ReplyMarkup) (*telebot.ReplyMarkup, error) {
+	if markup == nil || len(markup.InlineKeyboard) == 0 {
+		return markup, nil
+	}
+
+	signed := *markup
+	signed.InlineKeyboard = make([][]telebot.InlineButton, len(markup.InlineKeyboard))
+	for i, row := range markup.InlineKeyboard {
+		signed.InlineKeyboard[i] = make([]telebot.InlineButton, len(row))
+		for j, button := range row {
+			if button.Data != "" {
+				data, err := h.callbackService.Sign(userID, button.Data)
+				if err != nil {
+					return nil, err
+				}
+				button.Data = data
+			}
+			signed.InlineKeyboard[i][j] = button
+		}
+	}
+
+	return &signed, nil
+}
+
+// sign signs callback data in what is sent and its options.
+func (h *Handler) sign(userID int64, what interface{}, opts []interface{}) (interface{}, []interface{}, error) {
+	var err error
+	switch v := what.(type) {
+	case string:
+		what = h.signText(userID, v)
+	case *telebot.ReplyMarkup:
+		what, err = h.signMarkup(userID, v)
+		if err != nil {
+			return nil, nil, err
+		}
+	case *telebot.Document:
+		document := *v
+		document.Caption = h.signText(userID, v.Caption)
+		what = &document
+	case *telebot.Audio:
+		audio := *v
+		audio.Caption = h.signText(userID, v.Caption)
+		what = &audio
+	case *telebot.Photo:
+		photo := *v
+		photo.Caption = h.signText(userID, v.Caption)
+		what = &photo
+	}
+
+	signedOpts := make([]interface{}, len(opts))
+	for i, opt := range opts {
+		switch v := opt.(type) {
+		case *telebot.ReplyMarkup:
+			opt, err = h.signMarkup(userID, v)
+			if err != nil {
+				return nil, nil, err
+			}
+		case *telebot.SendOptions:
+			options := *v
+			options.ReplyMarkup, err = h.signMarkup(userID, v.ReplyMarkup)
+			if err != nil {
+				return nil, nil, err
+			}
+			opt = &options
+		}
+		signedOpts[i] = opt
+	}
+
+	return what, signedOpts, nil
+}
+
+// signingContext signs callback data of everything sent to the user with the context.
+type signingContext struct {
+	telebot.Context
+	h      *Handler
+	userID int64
+}
+
+func (c *signingContext) Send(what interface{}, opts ...interface{}) error {
+	what, opts, err := c.h.sign(c.userID, what, opts)
+	if err != nil {
+		return err
+	}
+	return c.Context.Send(what, opts...)
+}
+
+func (c *signingContext) Reply(what interface{}, opts ...interface{}) error {
+	what, opts, err := c.h.sign(c.userID, what, opts)
+	if err != nil {
+		return err
+	}
+	return c.Context.Reply(what, opts...)
+}
+
+func (c *signingContext) Edit(what interface{}, opts ...interface{}) error {
+	what, opts, err := c.h.sign(c.userID, what, opts)
+	if err != nil {
+		return err
+	}
+	return c.Context.Edit(what, opts...)
+}
+
+func (c *signingContext) EditCaption(caption string, opts ...interface{}) error {
+	what, opts, err := c.h.sign(c.userID, caption, opts)
+	if err != nil {
+		return err
+	}
+	return c.Context.EditCaption(what.(string), opts...)
+}
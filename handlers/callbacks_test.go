@@ -0,0 +1,47 @@
+package handlers
+
+import (
+	"math"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/joeyave/scala-chords-bot/helpers"
+	"github.com/joeyave/scala-chords-bot/services"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// TestLongestCallbackData pins the longest callback data the bot builds, signed they must fit into 64 bytes.
+func TestLongestCallbackData(t *testing.T) {
+	service := services.NewCallbackService("secret", 48*time.Hour)
+
+	objectID := primitive.NewObjectID().Hex()
+	// Google Drive IDs are up to 44 characters.
+	driveFileID := strings.Repeat("x", 44)
+	userID := int64(math.MaxInt64)
+
+	// Telegram user IDs have up to 52 significant bits.
+	const telegramID = "4503599627370496"
+
+	cases := []struct {
+		name string
+		data string
+		want int
+	}{
+		{"song of the setlist", helpers.AggregateCallbackData(helpers.ChangeSongOrderState, 0, driveFileID), 63},
+		{"join request", helpers.AggregateCallbackData(helpers.JoinRequestState, 1, telegramID+":"+objectID), 60},
+		{"permission group", helpers.AggregateCallbackData(helpers.PermissionGroupsState, 8, telegramID+":"+objectID), 60},
+		{"replacement", helpers.AggregateCallbackData(helpers.MembershipStatusState, 2, objectID+":"+telegramID), 60},
+	}
+
+	for _, c := range cases {
+		signed, err := service.Sign(userID, c.data)
+		if err != nil {
+			t.Errorf("%s: %v", c.name, err)
+			continue
+		}
+		if len(signed) != c.want {
+			t.Errorf("%s: signed callback data is %d bytes, want %d", c.name, len(signed), c.want)
+		}
+	}
+}
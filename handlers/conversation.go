@@ -0,0 +1,252 @@
+package handlers
+
+import (
+	"fmt"
+	"github.com/joeyave/scala-chords-bot/entities"
+	"github.com/joeyave/scala-chords-bot/helpers"
+	"github.com/joeyave/telebot/v3"
+	"go.mongodb.org/mongo-driver/bson"
+	"reflect"
+	"time"
+)
+
+// End finishes the conversation, the user goes back to the state the conversation was started from.
+const End = "end"
+
+var conversations = make(map[int]*Conversation, 0)
+
+// Conversation is a flow of named steps, the declarative alternative to a slice of HandlerFuncs.
+// The current step, the steps behind it and the data of the flow are kept in the state of the user.
+//
+// Every step asks with Ask and handles the answer with Handle, which returns the next step. The next step
+// has to be one of the transitions of the step, the step itself to ask again or End. A step may also move
+// the user to another state, then the conversation is over. Back returns to the previous step, Cancel leaves
+// the conversation.
+type Conversation struct {
+	State int
+	// Data returns a pointer to empty data of the flow. Steps get it filled with the answers given so far.
+	Data func() interface{}
+	// Steps of the conversation, it starts with the first one.
+	Steps []*Step
+	// Timeout since the step was entered after which the conversation expires. Zero means never.
+	Timeout time.Duration
+}
+
+// Step is a step of the conversation. Ask and Handle take the data returned by Data of the conversation as its own
+// type, so steps don't assert it:
+//
+//	Ask    func(h *Handler, c telebot.Context, user *entities.User, data *createSongData) error
+//	Handle func(h *Handler, c telebot.Context, user *entities.User, data *createSongData) (string, error)
+//
+// They are called with reflection, registerConversations checks them against the data of the conversation.
+type Step struct {
+	Name        string
+	Ask         interface{}
+	Handle      interface{}
+	Transitions []string
+}
+
+var (
+	handlerType = reflect.TypeOf((*Handler)(nil))
+	contextType = reflect.TypeOf((*telebot.Context)(nil)).Elem()
+	userType    = reflect.TypeOf((*entities.User)(nil))
+	stringType  = reflect.TypeOf("")
+	errorType   = reflect.TypeOf((*error)(nil)).Elem()
+)
+
+// callStep calls Ask or Handle of a step with the data of the conversation.
+func callStep(fn interface{}, h *Handler, c telebot.Context, user *entities.User, data interface{}) ([]reflect.Value, error) {
+	f := reflect.ValueOf(fn)
+	if want := f.Type().In(3); reflect.TypeOf(data) != want {
+		return nil, fmt.Errorf("conversation data is %T, want %s", data, want)
+	}
+
+	return f.Call([]reflect.Value{
+		reflect.ValueOf(h),
+		reflect.ValueOf(&c).Elem(),
+		reflect.ValueOf(user),
+		reflect.ValueOf(data),
+	}), nil
+}
+
+func registerConversations(convs ...*Conversation) {
+	for _, conv := range convs {
+		conv.check()
+		conversations[conv.State] = conv
+		handlers[conv.State] = []HandlerFunc{conv.handle}
+	}
+}
+
+func (conv *Conversation) handle(h *Handler, c telebot.Context, user *entities.User) error {
+	state := user.State
+
+	if state.Step == "" {
+		return conv.start(h, c, user)
+	}
+
+	switch c.Text() {
+	case helpers.Cancel:
+		return conv.leave(h, c, user)
+	case helpers.Back:
+		if len(state.Steps) == 0 {
+			return conv.leave(h, c, user)
+		}
+
+		prev := state.Steps[len(state.Steps)-1]
+		state.Steps = state.Steps[:len(state.Steps)-1]
+		return conv.ask(h, c, user, prev)
+	}
+
+	step := conv.step(state.Step)
+	if step == nil {
+		return conv.start(h, c, user)
+	}
+
+	data, err := conv.data(state)
+	if err != nil {
+		return err
+	}
+
+	next, err := step.handle(h, c, user, data)
+	if err != nil {
+		return err
+	}
+
+	// The step has moved the user to another state.
+	if user.State != state {
+		return nil
+	}
+
+	err = conv.setData(state, data)
+	if err != nil {
+		return err
+	}
+
+	switch next {
+	case End:
+		return conv.leave(h, c, user)
+	case step.Name:
+		return conv.ask(h, c, user, next)
+	}
+
+	if !step.allows(next) {
+		return fmt.Errorf("conversation %d: no transition from %s to %s", conv.State, step.Name, next)
+	}
+
+	state.Steps = append(state.Steps, step.Name)
+	return conv.ask(h, c, user, next)
+}
+
+func (conv *Conversation) start(h *Handler, c telebot.Context, user *entities.User) error {
+	user.State.Steps = nil
+	user.State.Data = nil
+	return conv.ask(h, c, user, conv.Steps[0].Name)
+}
+
+func (conv *Conversation) ask(h *Handler, c telebot.Context, user *entities.User, name string) error {
+	step := conv.step(name)
+	if step == nil {
+		return fmt.Errorf("conversation %d: no step %s", conv.State, name)
+	}
+
+	data, err := conv.data(user.State)
+	if err != nil {
+		return err
+	}
+
+	state := user.State
+	state.Step = step.Name
+
+	err = step.ask(h, c, user, data)
+	if err != nil || user.State != state {
+		return err
+	}
+
+	return conv.setData(state, data)
+}
+
+// leave returns the user to the state the conversation was started from.
+func (conv *Conversation) leave(h *Handler, c telebot.Context, user *entities.User) error {
+	if user.State.Prev != nil {
+		user.State = user.State.Prev
+		user.State.Index = 0
+	} else {
+		user.State = &entities.State{Name: helpers.MainMenuState}
+	}
+
+	return h.enter(c, user)
+}
+
+func (conv *Conversation) step(name string) *Step {
+	for _, step := range conv.Steps {
+		if step.Name == name {
+			return step
+		}
+	}
+	return nil
+}
+
+func (conv *Conversation) data(state *entities.State) (interface{}, error) {
+	data := conv.Data()
+	if len(state.Data) == 0 {
+		return data, nil
+	}
+
+	err := bson.Unmarshal(state.Data, data)
+	return data, err
+}
+
+func (conv *Conversation) setData(state *entities.State, data interface{}) error {
+	raw, err := bson.Marshal(data)
+	if err != nil {
+		return err
+	}
+
+	state.Data = raw
+	return nil
+}
+
+// check panics when Ask or Handle of a step doesn't take the data of the conversation.
+func (conv *Conversation) check() {
+	in := []reflect.Type{handlerType, contextType, userType, reflect.TypeOf(conv.Data())}
+	ask := reflect.FuncOf(in, []reflect.Type{errorType}, false)
+	handle := reflect.FuncOf(in, []reflect.Type{stringType, errorType}, false)
+
+	for _, step := range conv.Steps {
+		if reflect.TypeOf(step.Ask) != ask {
+			panic(fmt.Sprintf("conversation %d: step %s asks with %T, want %s", conv.State, step.Name, step.Ask, ask))
+		}
+		if reflect.TypeOf(step.Handle) != handle {
+			panic(fmt.Sprintf("conversation %d: step %s handles with %T, want %s", conv.State, step.Name, step.Handle, handle))
+		}
+	}
+}
+
+func (step *Step) ask(h *Handler, c telebot.Context, user *entities.User, data interface{}) error {
+	out, err := callStep(step.Ask, h, c, user, data)
+	if err != nil {
+		return err
+	}
+
+	err, _ = out[0].Interface().(error)
+	return err
+}
+
+func (step *Step) handle(h *Handler, c telebot.Context, user *entities.User, data interface{}) (string, error) {
+	out, err := callStep(step.Handle, h, c, user, data)
+	if err != nil {
+		return "", err
+	}
+
+	err, _ = out[1].Interface().(error)
+	return out[0].String(), err
+}
+
+func (step *Step) allows(name string) bool {
+	for _, transition := range step.Transitions {
+		if transition == name {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,68 @@
+package handlers
+
+import (
+	"testing"
+
+	"github.com/joeyave/scala-chords-bot/entities"
+	"github.com/joeyave/telebot/v3"
+)
+
+func TestConversationStepData(t *testing.T) {
+	var got *createSongData
+	step := &Step{
+		Name: "name",
+		Ask: func(h *Handler, c telebot.Context, user *entities.User, flow *createSongData) error {
+			got = flow
+			return nil
+		},
+		Handle: func(h *Handler, c telebot.Context, user *entities.User, flow *createSongData) (string, error) {
+			got = flow
+			return End, nil
+		},
+	}
+
+	data := createSongConversation.Data()
+	err := step.ask(nil, nil, nil, data)
+	if err != nil || got != data {
+		t.Errorf("ask(%T) = %v, want the step to get the data", data, err)
+	}
+
+	got = nil
+	next, err := step.handle(nil, nil, nil, data)
+	if err != nil || next != End || got != data {
+		t.Errorf("handle(%T) = %q, %v, want the step to get the data", data, next, err)
+	}
+
+	_, err = step.handle(nil, nil, nil, &createRoleData{})
+	if err == nil || err.Error() != "conversation data is *handlers.createRoleData, want *handlers.createSongData" {
+		t.Errorf("handle(*createRoleData) error = %v", err)
+	}
+}
+
+func TestConversationCheck(t *testing.T) {
+	for _, conv := range []*Conversation{createRoleConversation, createBandConversation, createSongConversation} {
+		conv.check()
+	}
+
+	defer func() {
+		if recover() == nil {
+			t.Error("check() didn't panic on a step taking other data")
+		}
+	}()
+
+	conv := &Conversation{
+		Data: createRoleConversation.Data,
+		Steps: []*Step{
+			{
+				Name: "name",
+				Ask: func(h *Handler, c telebot.Context, user *entities.User, flow *createRoleData) error {
+					return nil
+				},
+				Handle: func(h *Handler, c telebot.Context, user *entities.User, flow *createSongData) (string, error) {
+					return End, nil
+				},
+			},
+		},
+	}
+	conv.check()
+}
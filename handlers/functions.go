@@ -4,8 +4,15 @@ import (
 	"fmt"
 	"github.com/joeyave/scala-chords-bot/entities"
 	"github.com/joeyave/scala-chords-bot/helpers"
+	"github.com/joeyave/scala-chords-bot/services"
 	"github.com/joeyave/telebot/v3"
 	"github.com/klauspost/lctime"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"google.golang.org/api/drive/v3"
+	"html"
+	"net/url"
+	"path/filepath"
+	"strings"
 	"sync"
 	"time"
 )
@@ -30,6 +37,13 @@ func SendDriveFileToUser(h *Handler, c telebot.Context, user *entities.User, dri
 		},
 	}
 
+	// The document is sent with the bot, not the context, so it is signed here.
+	markup, err = h.signMarkup(user.ID, markup)
+	if err != nil {
+		return err
+	}
+	caption := h.signText(user.ID, helpers.AddCallbackData(song.Caption(), user.State.CallbackData.String()))
+
 	sendDocumentByReader := func() (*telebot.Message, error) {
 		reader, err := h.driveFileService.DownloadOneByID(driveFile.Id)
 		if err != nil {
@@ -45,7 +59,7 @@ func SendDriveFileToUser(h *Handler, c telebot.Context, user *entities.User, dri
 					File:     telebot.FromReader(*reader),
 					MIME:     "application/pdf",
 					FileName: fmt.Sprintf("%s.pdf", driveFile.Name),
-					Caption:  helpers.AddCallbackData(song.Caption(), user.State.CallbackData.String()),
+					Caption:  caption,
 				}, markup, telebot.ModeHTML)
 		} else {
 			return h.bot.Send(
@@ -54,7 +68,7 @@ func SendDriveFileToUser(h *Handler, c telebot.Context, user *entities.User, dri
 					File:     telebot.FromReader(*reader),
 					MIME:     "application/pdf",
 					FileName: fmt.Sprintf("%s.pdf", driveFile.Name),
-					Caption:  helpers.AddCallbackData(song.Caption(), user.State.CallbackData.String()),
+					Caption:  caption,
 				}, markup, telebot.ModeHTML)
 		}
 	}
@@ -70,7 +84,7 @@ func SendDriveFileToUser(h *Handler, c telebot.Context, user *entities.User, dri
 					File:     telebot.File{FileID: song.PDF.TgFileID},
 					MIME:     "application/pdf",
 					FileName: fmt.Sprintf("%s.pdf", driveFile.Name),
-					Caption:  helpers.AddCallbackData(song.Caption(), user.State.CallbackData.String()),
+					Caption:  caption,
 				}, markup, telebot.ModeHTML)
 		} else {
 			return h.bot.Send(
@@ -79,7 +93,7 @@ func SendDriveFileToUser(h *Handler, c telebot.Context, user *entities.User, dri
 					File:     telebot.File{FileID: song.PDF.TgFileID},
 					MIME:     "application/pdf",
 					FileName: fmt.Sprintf("%s.pdf", driveFile.Name),
-					Caption:  helpers.AddCallbackData(song.Caption(), user.State.CallbackData.String()),
+					Caption:  caption,
 				}, markup, telebot.ModeHTML)
 		}
 	}
@@ -108,6 +122,279 @@ func SendDriveFileToUser(h *Handler, c telebot.Context, user *entities.User, dri
 	return err
 }
 
+// sendTransposedPDF sends the song in the key as a new message. The PDF is made only once for every version of the doc.
+func sendTransposedPDF(h *Handler, c telebot.Context, driveFileID string, key string) error {
+
+	song, driveFile, err := h.songService.FindOrCreateOneByDriveFileID(driveFileID)
+	if err != nil {
+		return err
+	}
+
+	document := &telebot.Document{
+		MIME:     "application/pdf",
+		FileName: fmt.Sprintf("%s (%s).pdf", driveFile.Name, key),
+		Caption:  fmt.Sprintf("%s, %s, %s", key, song.PDF.BPM, song.PDF.Time),
+	}
+
+	sendDocumentByReader := func() (*telebot.Message, error) {
+		reader, err := h.driveFileService.RenderTransposedOneByID(driveFileID, key)
+		if err != nil {
+			return nil, err
+		}
+
+		document.File = telebot.FromReader(reader)
+		return h.bot.Send(c.Recipient(), document)
+	}
+
+	var msg *telebot.Message
+	transposedPDF, err := h.songService.FindTransposedPDF(song, key, driveFile)
+	if err != nil {
+		msg, err = sendDocumentByReader()
+	} else {
+		document.File = telebot.File{FileID: transposedPDF.TgFileID}
+		msg, err = h.bot.Send(c.Recipient(), document)
+		if err != nil {
+			msg, err = sendDocumentByReader()
+		}
+	}
+	if err != nil {
+		return err
+	}
+
+	_, err = h.songService.UpdateTransposedPDF(song, entities.TransposedPDF{
+		Key:          key,
+		ModifiedTime: driveFile.ModifiedTime,
+		Version:      driveFile.Version,
+		TgFileID:     msg.Document.FileID,
+	})
+
+	return err
+}
+
+// sendSection draws the section and sends it as a new message.
+func sendSection(h *Handler, c telebot.Context, section services.SongSection, fileName string) error {
+	reader, err := h.driveFileService.RenderSection(section)
+	if err != nil {
+		return err
+	}
+
+	_, err = h.bot.Send(c.Recipient(), &telebot.Document{
+		File:     telebot.FromReader(reader),
+		MIME:     "application/pdf",
+		FileName: fileName,
+	})
+	return err
+}
+
+// messageLength is how many characters of text fit into a message, Telegram allows 4096.
+const messageLength = 4000
+
+// sendSectionText sends the section as preformatted text, split into several messages if it is too long.
+func sendSectionText(h *Handler, c telebot.Context, section services.SongSection) error {
+	header := fmt.Sprintf("<b>%s</b>\n\n", html.EscapeString(section.Header))
+
+	parts := splitText(section.Body, messageLength-len([]rune(section.Header))-2)
+	for i, part := range parts {
+		text := fmt.Sprintf("<pre>%s</pre>", html.EscapeString(part))
+		if i == 0 {
+			text = header + text
+		}
+
+		_, err := h.bot.Send(c.Recipient(), text, telebot.ModeHTML)
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// splitText splits the text into parts of at most limit characters. Lines are kept whole where possible.
+func splitText(text string, limit int) []string {
+	parts := make([]string, 0)
+
+	var part []rune
+	for _, line := range strings.SplitAfter(text, "\n") {
+		runes := []rune(line)
+
+		if len(part)+len(runes) > limit && len(part) > 0 {
+			parts = append(parts, strings.TrimRight(string(part), "\n"))
+			part = nil
+		}
+
+		for len(runes) > limit {
+			parts = append(parts, string(runes[:limit]))
+			runes = runes[limit:]
+		}
+		part = append(part, runes...)
+	}
+
+	if len(part) > 0 || len(parts) == 0 {
+		parts = append(parts, strings.TrimRight(string(part), "\n"))
+	}
+
+	return parts
+}
+
+// sendEventCharts sends the songs of the event as albums, every song in the key planned for the event
+// with the vocalist and the note in the caption.
+func sendEventCharts(h *Handler, c telebot.Context, user *entities.User, event *entities.Event) error {
+
+	type chart struct {
+		song      *entities.Song
+		driveFile *drive.File
+		key       string
+		caption   string
+	}
+
+	charts := make([]*chart, len(event.Songs))
+	var waitGroup sync.WaitGroup
+	waitGroup.Add(len(event.Songs))
+	for i := range event.Songs {
+		go func(i int) {
+			defer waitGroup.Done()
+
+			song, driveFile, err := h.songService.FindOrCreateOneByDriveFileID(event.Songs[i].DriveFileID)
+			if err != nil {
+				return
+			}
+
+			key := event.SongKey(event.Songs[i])
+			if key == "?" || key == song.PDF.Key {
+				key = ""
+			}
+
+			caption := event.SongCaption(event.Songs[i])
+			entry := event.SetlistEntry(song.ID)
+			if vocalist := event.Vocalist(entry); vocalist != nil && vocalist.User != nil {
+				caption += "\n🎤 " + vocalist.User.Name
+			}
+			if entry.Note != "" {
+				caption += "\n📝 " + entry.Note
+			}
+
+			charts[i] = &chart{song: song, driveFile: driveFile, key: key, caption: caption}
+		}(i)
+	}
+	waitGroup.Wait()
+
+	// Songs that couldn't be found are skipped.
+	foundCharts := make([]*chart, 0)
+	for _, chart := range charts {
+		if chart != nil {
+			foundCharts = append(foundCharts, chart)
+		}
+	}
+	charts = foundCharts
+
+	document := func(chart *chart, cached bool) *telebot.Document {
+		document := &telebot.Document{
+			MIME:     "application/pdf",
+			FileName: fmt.Sprintf("%s.pdf", chart.driveFile.Name),
+			Caption:  chart.caption,
+		}
+
+		if chart.key == "" {
+			if cached && chart.song.PDF.TgFileID != "" {
+				document.File = telebot.File{FileID: chart.song.PDF.TgFileID}
+				return document
+			}
+
+			reader, err := h.driveFileService.DownloadOneByID(chart.driveFile.Id)
+			if err != nil {
+				return nil
+			}
+			document.File = telebot.FromReader(*reader)
+			return document
+		}
+
+		document.FileName = fmt.Sprintf("%s (%s).pdf", chart.driveFile.Name, chart.key)
+		if cached {
+			transposedPDF, err := h.songService.FindTransposedPDF(chart.song, chart.key, chart.driveFile)
+			if err == nil {
+				document.File = telebot.File{FileID: transposedPDF.TgFileID}
+				return document
+			}
+		}
+
+		reader, err := h.driveFileService.RenderTransposedOneByID(chart.driveFile.Id, chart.key)
+		if err != nil {
+			return nil
+		}
+		document.File = telebot.FromReader(reader)
+		return document
+	}
+
+	const chunkSize = 10
+	for start := 0; start < len(charts); start += chunkSize {
+		end := start + chunkSize
+		if end > len(charts) {
+			end = len(charts)
+		}
+		chunk := charts[start:end]
+
+		album := func(cached bool) telebot.Album {
+			documents := make([]telebot.InputMedia, len(chunk))
+			var waitGroup sync.WaitGroup
+			waitGroup.Add(len(chunk))
+			for i := range chunk {
+				go func(i int) {
+					defer waitGroup.Done()
+					documents[i] = document(chunk[i], cached)
+				}(i)
+			}
+			waitGroup.Wait()
+
+			album := make(telebot.Album, 0)
+			for _, document := range documents {
+				if document != nil {
+					album = append(album, document)
+				}
+			}
+			return album
+		}
+
+		// File IDs may be expired, send the files themselves then.
+		responses, err := h.bot.SendAlbum(c.Recipient(), album(true))
+		if err != nil {
+			responses, err = h.bot.SendAlbum(c.Recipient(), album(false))
+			if err != nil {
+				return err
+			}
+		}
+
+		if len(responses) != len(chunk) {
+			continue
+		}
+
+		for i, chart := range chunk {
+			if responses[i].Document == nil {
+				continue
+			}
+
+			if chart.key != "" {
+				_, _ = h.songService.UpdateTransposedPDF(chart.song, entities.TransposedPDF{
+					Key:          chart.key,
+					ModifiedTime: chart.driveFile.ModifiedTime,
+					Version:      chart.driveFile.Version,
+					TgFileID:     responses[i].Document.FileID,
+				})
+				continue
+			}
+
+			chart.song.PDF.TgFileID = responses[i].Document.FileID
+			err = SendSongToChannel(h, c, user, chart.song)
+			if err != nil {
+				continue
+			}
+
+			_, _ = h.songService.UpdateOne(*chart.song)
+		}
+	}
+
+	return nil
+}
+
 func SendSongToChannel(h *Handler, c telebot.Context, user *entities.User, song *entities.Song) error {
 	send := func() (*telebot.Message, error) {
 		return h.bot.Send(
@@ -260,7 +547,8 @@ func sendDriveFilesAlbum(h *Handler, c telebot.Context, user *entities.User, dri
 	return nil
 }
 
-func GetCalendarMarkup(now, monthFirstDayDate, monthLastDayDate time.Time) *telebot.ReplyMarkup {
+// GetCalendarMarkup returns days of the month that lead to dayIndex of the state and the months that lead to monthIndex.
+func GetCalendarMarkup(state, monthIndex, dayIndex int, now, monthFirstDayDate, monthLastDayDate time.Time) *telebot.ReplyMarkup {
 	markup := &telebot.ReplyMarkup{}
 
 	currCol := 4
@@ -279,7 +567,7 @@ func GetCalendarMarkup(now, monthFirstDayDate, monthLastDayDate time.Time) *tele
 		markup.InlineKeyboard[len(markup.InlineKeyboard)-1] =
 			append(markup.InlineKeyboard[len(markup.InlineKeyboard)-1], telebot.InlineButton{
 				Text: timeStr,
-				Data: helpers.AggregateCallbackData(helpers.CreateEventState, 2, d.Format(time.RFC3339)),
+				Data: helpers.AggregateCallbackData(state, dayIndex, d.Format(time.RFC3339)),
 			})
 		currCol++
 	}
@@ -291,13 +579,604 @@ func GetCalendarMarkup(now, monthFirstDayDate, monthLastDayDate time.Time) *tele
 	markup.InlineKeyboard = append(markup.InlineKeyboard, []telebot.InlineButton{
 		{
 			Text: lctime.Strftime("%B", prevMonthLastDate),
-			Data: helpers.AggregateCallbackData(helpers.CreateEventState, 1, prevMonthFirstDateStr),
+			Data: helpers.AggregateCallbackData(state, monthIndex, prevMonthFirstDateStr),
 		},
 		{
 			Text: lctime.Strftime("%B", nextMonthFirstDate),
-			Data: helpers.AggregateCallbackData(helpers.CreateEventState, 1, nextMonthFirstDateStr),
+			Data: helpers.AggregateCallbackData(state, monthIndex, nextMonthFirstDateStr),
+		},
+	})
+
+	return markup
+}
+
+// findEventAndSong returns the event and its song from the callback data.
+func findEventAndSong(h *Handler, user *entities.User) (*entities.Event, *entities.Song, error) {
+	eventID, err := primitive.ObjectIDFromHex(user.State.CallbackData.Query().Get("eventId"))
+	if err != nil {
+		return nil, nil, err
+	}
+
+	songID, err := primitive.ObjectIDFromHex(user.State.CallbackData.Query().Get("songId"))
+	if err != nil {
+		return nil, nil, err
+	}
+
+	event, err := h.eventService.FindOneByID(eventID)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	for _, song := range event.Songs {
+		if song.ID == songID {
+			return event, song, nil
+		}
+	}
+
+	return nil, nil, fmt.Errorf("song %s is not in the event", songID.Hex())
+}
+
+// findTemplate returns the template from the callback data.
+func findTemplate(h *Handler, user *entities.User) (*entities.EventTemplate, error) {
+	templateID, err := primitive.ObjectIDFromHex(user.State.CallbackData.Query().Get("templateId"))
+	if err != nil {
+		return nil, err
+	}
+
+	return h.templateService.FindOneByID(templateID)
+}
+
+// sendTemplate shows the template with its actions, editing the message if it is a callback.
+func sendTemplate(h *Handler, c telebot.Context, user *entities.User, template *entities.EventTemplate) error {
+	if user.State.CallbackData == nil {
+		user.State.CallbackData, _ = url.Parse("t.me/callbackData")
+	}
+
+	q := user.State.CallbackData.Query()
+	q.Set("templateId", template.ID.Hex())
+	user.State.CallbackData.RawQuery = q.Encode()
+
+	recurrence := helpers.NoRecurrence
+	if template.Recurrence != nil {
+		recurrence = template.Recurrence.String()
+	}
+
+	str := fmt.Sprintf("<b>%s</b>\n%s: %s\n", html.EscapeString(template.Name), helpers.Recurrence, recurrence)
+
+	for _, slot := range template.Slots {
+		roleName := "?"
+		for _, role := range user.Band.Roles {
+			if role.ID == slot.RoleID {
+				roleName = role.Name
+			}
+		}
+
+		names := make([]string, 0)
+		if len(slot.UserIDs) > 0 {
+			users, err := h.userService.FindMultipleByIDs(slot.UserIDs)
+			if err == nil {
+				for _, u := range users {
+					names = append(names, u.Name)
+				}
+			}
+		}
+		if len(names) == 0 {
+			names = append(names, "—")
+		}
+
+		str += fmt.Sprintf("\n<b>%s:</b> %s", roleName, html.EscapeString(strings.Join(names, ", ")))
+	}
+
+	state := helpers.EventTemplatesState
+	markup := &telebot.ReplyMarkup{
+		InlineKeyboard: [][]telebot.InlineButton{
+			{
+				{Text: helpers.Recurrence, Data: helpers.AggregateCallbackData(state, 4, "")},
+				{Text: helpers.Rename, Data: helpers.AggregateCallbackData(state, 1, "rename")},
+			},
+			{
+				{Text: helpers.AddSlot, Data: helpers.AggregateCallbackData(state, 8, "")},
+				{Text: helpers.DeleteSlot, Data: helpers.AggregateCallbackData(state, 11, "")},
+			},
+			{
+				{Text: helpers.CreateEventFromTemplate, Data: helpers.AggregateCallbackData(state, 13, "")},
+			},
+			{
+				{Text: helpers.DeleteTemplate, Data: helpers.AggregateCallbackData(state, 15, "")},
+			},
+			{
+				{Text: helpers.Back, Data: helpers.AggregateCallbackData(state, 0, "")},
+			},
 		},
+	}
+
+	if c.Callback() != nil {
+		c.Edit(helpers.AddCallbackData(str, user.State.CallbackData.String()), markup, telebot.ModeHTML)
+		c.Respond()
+		return nil
+	}
+
+	return c.Send(helpers.AddCallbackData(str, user.State.CallbackData.String()), markup, telebot.ModeHTML)
+}
+
+// sendRangeCalendar shows the month of the date from the callback payload, the current one by default.
+// Cancel leads to the first handler of the state.
+func sendRangeCalendar(c telebot.Context, user *entities.User, state int, msg string, monthIndex int, dayIndex int) error {
+	_, _, dateStr := helpers.ParseCallbackData(c.Callback().Data)
+
+	now := time.Now()
+	date, err := time.Parse(time.RFC3339, dateStr)
+	if err != nil {
+		date = now
+	}
+	monthFirstDayDate := time.Date(date.Year(), date.Month(), 1, 0, 0, 0, 0, date.Location())
+	monthLastDayDate := monthFirstDayDate.AddDate(0, 1, -1)
+
+	markup := GetCalendarMarkup(state, monthIndex, dayIndex, now, monthFirstDayDate, monthLastDayDate)
+	markup.InlineKeyboard = append(markup.InlineKeyboard, []telebot.InlineButton{
+		{Text: helpers.Cancel, Data: helpers.AggregateCallbackData(state, 0, "")},
+	})
+
+	c.Edit(helpers.AddCallbackData(fmt.Sprintf("%s\n\n<b>%s</b>", msg, lctime.Strftime("%B %Y", monthFirstDayDate)), user.State.CallbackData.String()),
+		markup, telebot.ModeHTML)
+	c.Respond()
+	return nil
+}
+
+func findMembershipAndEvent(h *Handler, membershipIDHex string) (*entities.Membership, *entities.Event, error) {
+	membershipID, err := primitive.ObjectIDFromHex(membershipIDHex)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	membership, err := h.membershipService.FindOneByID(membershipID)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	event, err := h.eventService.FindOneByID(membership.EventID)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	return membership, event, nil
+}
+
+// notifyAdminsAboutDecline sends every admin of the band the declined membership with the members who can replace it.
+func notifyAdminsAboutDecline(h *Handler, event *entities.Event, membership *entities.Membership) error {
+	users, err := h.userService.FindMultipleByBandID(event.BandID)
+	if err != nil {
+		return err
+	}
+
+	for _, m := range event.Memberships {
+		if m.ID == membership.ID {
+			membership = m
+		}
+	}
+
+	name, roleName := "", ""
+	if membership.User != nil {
+		name = membership.User.Name
+	}
+	if membership.Role != nil {
+		roleName = membership.Role.Name
+	}
+
+	replacements, _ := h.eventService.FindReplacements(event, membership)
+
+	markup := &telebot.ReplyMarkup{}
+	for i, replacement := range replacements {
+		if i == 3 {
+			break
+		}
+
+		markup.InlineKeyboard = append(markup.InlineKeyboard, []telebot.InlineButton{
+			{
+				Text: fmt.Sprintf("🔄 %s", replacement.Name),
+				Data: helpers.AggregateCallbackData(helpers.MembershipStatusState, 2, fmt.Sprintf("%s:%d", membership.ID.Hex(), replacement.ID)),
+			},
+		})
+	}
+	markup.InlineKeyboard = append(markup.InlineKeyboard, []telebot.InlineButton{
+		{Text: helpers.OpenEvent, Data: helpers.AggregateCallbackData(helpers.EventActionsState, 0, "")},
 	})
 
+	msg := fmt.Sprintf("❌ %s не сможет участвовать в собрании <b>%s</b> (%s).", html.EscapeString(name), event.Alias(), roleName)
+	if len(replacements) > 0 {
+		msg += "\n\nМожно заменить:"
+	} else {
+		msg += "\n\nНекого предложить на замену."
+	}
+
+	callbackData, _ := url.Parse("t.me/callbackData")
+	q := callbackData.Query()
+	q.Set("eventId", event.ID.Hex())
+	callbackData.RawQuery = q.Encode()
+
+	for _, admin := range users {
+		if !h.permissionService.Can(admin, event.BandID, entities.ManageEvents) {
+			continue
+		}
+
+		signed, err := h.signMarkup(admin.ID, markup)
+		if err != nil {
+			return err
+		}
+		h.bot.Send(telebot.ChatID(admin.ID), h.signText(admin.ID, helpers.AddCallbackData(msg, callbackData.String())), signed, telebot.ModeHTML)
+	}
+
+	return nil
+}
+
+// generateRota makes the draft for the period from the callback data.
+func generateRota(h *Handler, user *entities.User) ([]*services.RotaSlot, time.Time, time.Time, error) {
+	from, err := time.Parse(time.RFC3339, user.State.CallbackData.Query().Get("from"))
+	if err != nil {
+		return nil, from, from, err
+	}
+
+	to, err := time.Parse(time.RFC3339, user.State.CallbackData.Query().Get("to"))
+	if err != nil {
+		return nil, from, to, err
+	}
+
+	if to.Before(from) {
+		from, to = to, from
+	}
+
+	slots, err := h.rotaService.Generate(user.BandID, user.Band.Roles, from, to)
+	return slots, from, to, err
+}
+
+func rotaHTML(slots []*services.RotaSlot, from time.Time, to time.Time) string {
+	str := fmt.Sprintf("<b>Расписание %s – %s</b>", from.Format("02.01"), to.Format("02.01"))
+
+	if len(slots) == 0 {
+		return str + "\n\nВсе роли в собраниях этого периода уже заполнены."
+	}
+
+	var currEventID primitive.ObjectID
+	for _, slot := range slots {
+		if slot.Event.ID != currEventID {
+			currEventID = slot.Event.ID
+			str += fmt.Sprintf("\n\n<b>%s</b>", slot.Event.Alias())
+		}
+
+		if slot.User == nil {
+			str += fmt.Sprintf("\n - %s: — некому", slot.Role.Name)
+			continue
+		}
+
+		str += fmt.Sprintf("\n - %s: %s", slot.Role.Name, html.EscapeString(slot.User.Name))
+		if slot.BackToBack {
+			str += " (⚠️ две недели подряд)"
+		}
+	}
+
+	return str
+}
+
+// sendEventsOfAllBands sends upcoming events of the user in all their bands.
+// Only events of the current band get actions, others are managed after switching to their band.
+func sendEventsOfAllBands(h *Handler, c telebot.Context, user *entities.User) error {
+	events, err := h.eventService.FindManyFromTodayByUserID(user.ID)
+	if err != nil {
+		return c.Send("Ближайших собраний, где ты участвуешь, нет.")
+	}
+
+	bandNames := make(map[primitive.ObjectID]string)
+	for _, event := range events {
+		if _, ok := bandNames[event.BandID]; !ok {
+			band, err := h.bandService.FindOneByID(event.BandID)
+			if err != nil {
+				continue
+			}
+			bandNames[event.BandID] = band.Name
+		}
+
+		eventString, _, err := h.eventService.ToHtmlStringByID(event.ID)
+		if err != nil {
+			continue
+		}
+		eventString = fmt.Sprintf("🎸 <b>%s</b>\n\n%s", html.EscapeString(bandNames[event.BandID]), eventString)
+
+		if event.BandID != user.BandID {
+			err = c.Send(eventString, telebot.ModeHTML, telebot.NoPreview)
+			if err != nil {
+				return err
+			}
+			continue
+		}
+
+		q := user.State.CallbackData.Query()
+		q.Set("eventId", event.ID.Hex())
+		user.State.CallbackData.RawQuery = q.Encode()
+
+		err = c.Send(helpers.AddCallbackData(eventString, user.State.CallbackData.String()),
+			&telebot.ReplyMarkup{
+				InlineKeyboard: helpers.GetEventActionsKeyboard(*user, *event),
+			}, telebot.ModeHTML, telebot.NoPreview)
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// sendCalendars sends .ics files with the events of the user and of the band, and the links to subscribe to them.
+func sendCalendars(h *Handler, c telebot.Context, user *entities.User) error {
+	c.Notify(telebot.UploadingDocument)
+
+	err := c.Send(&telebot.Document{
+		File:     telebot.FromReader(strings.NewReader(h.calendarService.UserCalendar(user))),
+		FileName: "my-events.ics",
+		Caption:  "Собрания, где ты участвуешь. Открой файл, чтобы добавить их в календарь.",
+	})
+	if err != nil {
+		return err
+	}
+
+	if user.Band != nil {
+		err = c.Send(&telebot.Document{
+			File:     telebot.FromReader(strings.NewReader(h.calendarService.BandCalendar(user.Band))),
+			FileName: "band-events.ics",
+			Caption:  "Все собрания группы.",
+		})
+		if err != nil {
+			return err
+		}
+	}
+
+	if helpers.PublicURL == "" {
+		return nil
+	}
+
+	msg, markup := calendarLinks(h, user)
+	return c.Send(msg, markup, telebot.ModeHTML)
+}
+
+// calendarLinks returns the message with the links to subscribe to the calendars and the buttons to revoke them.
+func calendarLinks(h *Handler, user *entities.User) (string, *telebot.ReplyMarkup) {
+	msg := fmt.Sprintf("Чтобы календарь обновлялся сам, подпишись на него по ссылке (в Google Calendar: «Другие календари» → «Добавить по URL»):\n\n"+
+		"Мои собрания:\n<code>%s/calendar/users/%d.ics?token=%s</code>",
+		helpers.PublicURL, user.ID, h.calendarService.UserToken(user))
+	if user.Band != nil {
+		msg += fmt.Sprintf("\n\nВсе собрания группы:\n<code>%s/calendar/bands/%s.ics?user=%d&amp;token=%s</code>",
+			helpers.PublicURL, user.BandID.Hex(), user.ID, h.calendarService.BandToken(user.Band, user))
+	}
+	msg += "\n\nНе делись ссылками: по ним видно расписание. Если ссылка попала не в те руки, выпусти новые: старые перестанут работать."
+
+	markup := &telebot.ReplyMarkup{
+		InlineKeyboard: [][]telebot.InlineButton{
+			{{Text: helpers.RevokeCalendarLinks, Data: helpers.AggregateCallbackData(helpers.CalendarState, 1, "user")}},
+		},
+	}
+	if user.Band != nil && user.Can(entities.ManageBand) {
+		markup.InlineKeyboard = append(markup.InlineKeyboard,
+			[]telebot.InlineButton{{Text: helpers.RevokeBandCalendarLinks, Data: helpers.AggregateCallbackData(helpers.CalendarState, 1, "band")}})
+	}
+
+	return msg, markup
+}
+
+// joinByInvite adds the user to the band of the invite with the role of the invite.
+func joinByInvite(h *Handler, c telebot.Context, user *entities.User, token string) error {
+	invite, err := h.inviteService.FindOneValidByToken(token, time.Now())
+	if err != nil {
+		return sendInvalidInvite(h, c, user)
+	}
+
+	band, err := h.bandService.FindOneByID(invite.BandID)
+	if err != nil {
+		return err
+	}
+
+	// Members who open the link again don't take a use of the invite, the band just becomes current.
+	if user.UserBand(band.ID) != nil {
+		user.SwitchBand(band.ID)
+
+		err = c.Send(fmt.Sprintf("Ты уже в группе %s.", band.Name))
+		if err != nil {
+			return err
+		}
+
+		user.State = &entities.State{Name: helpers.MainMenuState}
+		return h.enter(c, user)
+	}
+
+	err = h.inviteService.Use(invite)
+	if err != nil {
+		return sendInvalidInvite(h, c, user)
+	}
+
+	role := invite.Role
+	user.JoinBand(band.ID, role)
+
+	msg := fmt.Sprintf("Теперь ты в группе %s.", band.Name)
+	if role == helpers.Admin {
+		msg = fmt.Sprintf("Теперь ты в группе %s как администратор.", band.Name)
+	}
+	err = c.Send(msg)
+	if err != nil {
+		return err
+	}
+
+	user.State = &entities.State{Name: helpers.MainMenuState}
+	return h.enter(c, user)
+}
+
+func sendInvalidInvite(h *Handler, c telebot.Context, user *entities.User) error {
+	err := c.Send("Ссылка-приглашение недействительна: она устарела или ей уже воспользовались. Попроси у администратора новую.")
+	if err != nil {
+		return err
+	}
+
+	if user.BandID == primitive.NilObjectID {
+		user.State = &entities.State{Name: helpers.ChooseBandState}
+	} else {
+		user.State = &entities.State{Name: helpers.MainMenuState}
+	}
+	return h.enter(c, user)
+}
+
+// sendJoinRequest asks admins of the band to let the user in.
+func sendJoinRequest(h *Handler, c telebot.Context, user *entities.User, band *entities.Band) error {
+	users, err := h.userService.FindMultipleByBandID(band.ID)
+	if err != nil {
+		users = nil
+	}
+
+	markup := &telebot.ReplyMarkup{
+		InlineKeyboard: [][]telebot.InlineButton{
+			{
+				{Text: helpers.RejectRequest, Data: helpers.AggregateCallbackData(helpers.JoinRequestState, 1, fmt.Sprintf("%d:%s", user.ID, band.ID.Hex()))},
+				{Text: helpers.ApproveRequest, Data: helpers.AggregateCallbackData(helpers.JoinRequestState, 0, fmt.Sprintf("%d:%s", user.ID, band.ID.Hex()))},
+			},
+		},
+	}
+
+	sent := 0
+	for _, admin := range users {
+		if !h.permissionService.Can(admin, band.ID, entities.ManageMembers) {
+			continue
+		}
+
+		signed, err := h.signMarkup(admin.ID, markup)
+		if err != nil {
+			return err
+		}
+
+		_, err = h.bot.Send(telebot.ChatID(admin.ID), fmt.Sprintf("%s хочет присоединиться к группе %s.", user.Name, band.Name), signed)
+		if err == nil {
+			sent++
+		}
+	}
+
+	if sent == 0 {
+		return c.Send("Не получилось отправить запрос: у группы нет администраторов. Попроси у участников ссылку-приглашение.")
+	}
+
+	return c.Send(fmt.Sprintf("Запрос отправлен администраторам группы %s. Я напишу, когда его одобрят.", band.Name))
+}
+
+func inviteString(invite *entities.Invite) string {
+	str := "Участник"
+	if invite.Role == helpers.Admin {
+		str = "Администратор"
+	}
+
+	if invite.ExpiresAt.IsZero() {
+		str += ", бессрочно"
+	} else {
+		str += ", до " + invite.ExpiresAt.Local().Format("02.01.2006 15:04")
+	}
+
+	if invite.MaxUses == 0 {
+		str += fmt.Sprintf(", использований: %d", invite.Uses)
+	} else {
+		str += fmt.Sprintf(", использований: %d из %d", invite.Uses, invite.MaxUses)
+	}
+
+	return str
+}
+
+var permissionNames = map[entities.Permission]string{
+	entities.ManageEvents:  "собрания",
+	entities.ManageMembers: "участники",
+	entities.EditSongs:     "песни",
+	entities.DeleteSongs:   "удаление песен",
+	entities.UploadVoices:  "партии",
+	entities.ManageRoles:   "роли",
+	entities.ManageBand:    "настройки группы",
+}
+
+func permissionsString(permissions []entities.Permission) string {
+	if len(permissions) == 0 {
+		return "нет прав"
+	}
+
+	var names []string
+	for _, permission := range entities.Permissions {
+		for _, p := range permissions {
+			if p == permission {
+				names = append(names, permissionNames[permission])
+				break
+			}
+		}
+	}
+	return strings.Join(names, ", ")
+}
+
+func permissionGroupString(group *entities.PermissionGroup) string {
+	return fmt.Sprintf("Группа прав <b>%s</b>: %s\n\nНажми на право, чтобы выдать или забрать его.",
+		html.EscapeString(group.Name), permissionsString(group.Permissions))
+}
+
+func permissionGroupMarkup(group *entities.PermissionGroup) *telebot.ReplyMarkup {
+	markup := &telebot.ReplyMarkup{}
+	for _, permission := range entities.Permissions {
+		mark := "⬜️"
+		if group.Has(permission) {
+			mark = "✅"
+		}
+		markup.InlineKeyboard = append(markup.InlineKeyboard, []telebot.InlineButton{
+			{Text: fmt.Sprintf("%s %s", mark, permissionNames[permission]),
+				Data: helpers.AggregateCallbackData(helpers.PermissionGroupsState, 2, fmt.Sprintf("%s:%s", group.ID.Hex(), permission))},
+		})
+	}
+	markup.InlineKeyboard = append(markup.InlineKeyboard, []telebot.InlineButton{
+		{Text: helpers.DeletePermissionGroup, Data: helpers.AggregateCallbackData(helpers.PermissionGroupsState, 3, group.ID.Hex())},
+	})
+	markup.InlineKeyboard = append(markup.InlineKeyboard, []telebot.InlineButton{
+		{Text: helpers.Back, Data: helpers.AggregateCallbackData(helpers.PermissionGroupsState, 0, "")},
+	})
 	return markup
 }
+
+// findPermissionGroup returns the group of the current band of the user.
+func findPermissionGroup(h *Handler, user *entities.User, groupIDHex string) (*entities.PermissionGroup, error) {
+	groupID, err := primitive.ObjectIDFromHex(groupIDHex)
+	if err != nil {
+		return nil, err
+	}
+
+	group, err := h.permissionService.FindOneGroupByID(groupID)
+	if err != nil {
+		return nil, err
+	}
+
+	if group.BandID != user.BandID {
+		return nil, services.ErrForbidden
+	}
+	return group, nil
+}
+
+func userPermissionGroupName(h *Handler, user *entities.User, bandID primitive.ObjectID) string {
+	userBand := user.UserBand(bandID)
+	if userBand == nil {
+		return ""
+	}
+
+	if userBand.Role == helpers.Admin {
+		return "администратор"
+	}
+
+	if userBand.PermissionGroupID != primitive.NilObjectID {
+		group, err := h.permissionService.FindOneGroupByID(userBand.PermissionGroupID)
+		if err == nil {
+			return group.Name
+		}
+	}
+	return "по умолчанию"
+}
+
+// isChordProFile reports whether the document is a ChordPro file by its extension.
+func isChordProFile(fileName string) bool {
+	switch strings.ToLower(filepath.Ext(fileName)) {
+	case ".cho", ".chordpro", ".chopro", ".crd", ".pro":
+		return true
+	}
+	return false
+}
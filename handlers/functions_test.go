@@ -0,0 +1,43 @@
+package handlers
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestSplitText(t *testing.T) {
+	tests := []struct {
+		name  string
+		text  string
+		limit int
+		want  []string
+	}{
+		{"short", "C G\nline", 100, []string{"C G\nline"}},
+		{"empty", "", 10, []string{""}},
+		{"by lines", "aaaa\nbbbb\ncccc", 10, []string{"aaaa\nbbbb", "cccc"}},
+		{"long line", "aaaaaaaaaaaa\nbb", 5, []string{"aaaaa", "aaaaa", "aa\nbb"}},
+		{"runes", "ааааа\nббббб", 6, []string{"ааааа", "ббббб"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := splitText(tt.text, tt.limit)
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("splitText() = %q, want %q", got, tt.want)
+			}
+
+			for _, part := range got {
+				if len([]rune(part)) > tt.limit {
+					t.Errorf("part %q is longer than %d", part, tt.limit)
+				}
+			}
+		})
+	}
+
+	chart := strings.Repeat("C        G        Am       F\nAmazing grace how sweet the sound\n", 200)
+	parts := splitText(chart, messageLength)
+	if len(parts) < 2 || strings.Join(parts, "\n") != strings.TrimRight(chart, "\n") {
+		t.Errorf("a long chart is split into %d parts or loses lines", len(parts))
+	}
+}
@@ -0,0 +1,281 @@
+package handlers
+
+import (
+	"fmt"
+	"github.com/joeyave/scala-chords-bot/entities"
+	"github.com/joeyave/scala-chords-bot/helpers"
+	"github.com/joeyave/telebot/v3"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"html"
+	"log"
+	"strings"
+	"time"
+)
+
+// Group chats of bands have no users and states, only commands work there.
+// Answers go to the chat, since c.Send would send them to the sender.
+
+const groupHelp = "Команды:\n" +
+	"/next — ближайшее собрание\n" +
+	"/setlist — песни ближайшего собрания\n" +
+	"/song название — аккорды песни\n\n" +
+	"Администратор группы может привязать к ней этот чат командой /link или отвязать командой /unlink."
+
+func (h *Handler) onGroupText(c telebot.Context) error {
+	if !strings.HasPrefix(c.Text(), "/") {
+		return nil
+	}
+
+	command := strings.Fields(c.Text())[0]
+	// Commands in groups may be addressed: /next@bot.
+	if i := strings.Index(command, "@"); i != -1 {
+		if command[i+1:] != h.bot.Me.Username {
+			return nil
+		}
+		command = command[:i]
+	}
+	payload := strings.TrimSpace(strings.TrimPrefix(c.Text(), strings.Fields(c.Text())[0]))
+
+	switch command {
+	case "/link":
+		return h.linkGroup(c)
+	case "/unlink":
+		return h.unlinkGroup(c)
+	case "/start", "/help":
+		return h.sendToGroup(c, groupHelp)
+	}
+
+	band, err := h.bandService.FindOneByChatID(c.Chat().ID)
+	if err != nil {
+		if command == "/next" || command == "/setlist" || command == "/song" {
+			return h.sendToGroup(c, "Этот чат не привязан к группе. Администратор группы может привязать его командой /link.")
+		}
+		return nil
+	}
+
+	switch command {
+	case "/next":
+		event, err := h.nextEvent(band)
+		if err != nil {
+			return h.sendToGroup(c, "Собраний пока нет.")
+		}
+
+		return h.sendToGroup(c, h.eventService.ToHtmlStringByEvent(*event))
+
+	case "/setlist":
+		event, err := h.nextEvent(band)
+		if err != nil {
+			return h.sendToGroup(c, "Собраний пока нет.")
+		}
+
+		songsStr, _, err := h.eventService.GetSongsAsHTMLStringByID(event.ID)
+		if err != nil || songsStr == "" {
+			return h.sendToGroup(c, fmt.Sprintf("<b>%s</b>\n\nПесен пока нет.", html.EscapeString(event.Alias())))
+		}
+
+		return h.sendToGroup(c, fmt.Sprintf("<b>%s</b>%s", html.EscapeString(event.Alias()), songsStr))
+
+	case "/song":
+		query := strings.TrimSpace(helpers.CleanUpQuery(payload))
+		if query == "" {
+			return h.sendToGroup(c, "Напиши название после команды: /song название")
+		}
+
+		h.bot.Notify(c.Chat(), telebot.UploadingDocument)
+
+		driveFiles, _, err := h.driveFileService.FindSomeByFullTextAndFolderID(query, band.DriveFolderID, "")
+		if err != nil || len(driveFiles) == 0 {
+			return h.sendToGroup(c, "Ничего не найдено.")
+		}
+
+		return h.sendSongToGroup(c, driveFiles[0].Id)
+	}
+
+	return nil
+}
+
+func (h *Handler) sendToGroup(c telebot.Context, text string) error {
+	_, err := h.bot.Send(c.Chat(), text, telebot.ModeHTML, telebot.NoPreview)
+	return err
+}
+
+// groupAdmin returns the sender if they are an admin of a band.
+func (h *Handler) groupAdmin(c telebot.Context) (*entities.User, error) {
+	user, err := h.userService.FindOneByID(int64(c.Sender().ID))
+	if err != nil || user.BandID == primitive.NilObjectID {
+		return nil, h.sendToGroup(c, "Сначала напиши боту в личные сообщения и выбери группу.")
+	}
+
+	if !h.permissionService.Can(user, user.BandID, entities.ManageBand) {
+		return nil, h.sendToGroup(c, noPermissionMessage)
+	}
+
+	return user, nil
+}
+
+func (h *Handler) linkGroup(c telebot.Context) error {
+	user, err := h.groupAdmin(c)
+	if user == nil {
+		return err
+	}
+
+	// A chat belongs to one band.
+	linkedBand, err := h.bandService.FindOneByChatID(c.Chat().ID)
+	if err == nil && linkedBand.ID != user.BandID {
+		linkedBand.ChatID = 0
+		_, err = h.bandService.UpdateOne(*linkedBand)
+		if err != nil {
+			return err
+		}
+	}
+
+	band, err := h.bandService.FindOneByID(user.BandID)
+	if err != nil {
+		return err
+	}
+
+	band.ChatID = c.Chat().ID
+	_, err = h.bandService.UpdateOne(*band)
+	if err != nil {
+		return err
+	}
+
+	return h.sendToGroup(c, fmt.Sprintf("Чат привязан к группе <b>%s</b>. Сюда будут приходить новые собрания, изменения списков песен, напоминания и новые песни.\n\n%s",
+		html.EscapeString(band.Name), groupHelp))
+}
+
+func (h *Handler) unlinkGroup(c telebot.Context) error {
+	user, err := h.groupAdmin(c)
+	if user == nil {
+		return err
+	}
+
+	band, err := h.bandService.FindOneByChatID(c.Chat().ID)
+	if err != nil || band.ID != user.BandID {
+		return h.sendToGroup(c, "Этот чат не привязан к твоей группе.")
+	}
+
+	band.ChatID = 0
+	_, err = h.bandService.UpdateOne(*band)
+	if err != nil {
+		return err
+	}
+
+	return h.sendToGroup(c, "Чат отвязан от группы.")
+}
+
+func (h *Handler) nextEvent(band *entities.Band) (*entities.Event, error) {
+	events, err := h.eventService.FindManyFromTodayByBandID(band.ID)
+	if err != nil {
+		return nil, err
+	}
+
+	return events[0], nil
+}
+
+// sendSongToGroup sends the PDF of the song, from Telegram if it is up to date.
+func (h *Handler) sendSongToGroup(c telebot.Context, driveFileID string) error {
+	song, driveFile, err := h.songService.FindOrCreateOneByDriveFileID(driveFileID)
+	if err != nil {
+		return err
+	}
+
+	var msg *telebot.Message
+	if song.PDF.TgFileID != "" {
+		msg, err = h.bot.Send(c.Chat(), &telebot.Document{
+			File:     telebot.File{FileID: song.PDF.TgFileID},
+			MIME:     "application/pdf",
+			FileName: fmt.Sprintf("%s.pdf", driveFile.Name),
+			Caption:  song.Caption(),
+		})
+	}
+	if song.PDF.TgFileID == "" || err != nil {
+		reader, err := h.driveFileService.DownloadOneByID(driveFile.Id)
+		if err != nil {
+			return err
+		}
+
+		msg, err = h.bot.Send(c.Chat(), &telebot.Document{
+			File:     telebot.FromReader(*reader),
+			MIME:     "application/pdf",
+			FileName: fmt.Sprintf("%s.pdf", driveFile.Name),
+			Caption:  song.Caption(),
+		})
+		if err != nil {
+			return err
+		}
+
+		song.PDF.TgFileID = msg.Document.FileID
+		err = SendSongToChannel(h, c, nil, song)
+		if err != nil {
+			return err
+		}
+
+		_, err = h.songService.UpdateOne(*song)
+		return err
+	}
+
+	return nil
+}
+
+// postToBand posts the message to the group of the band, if the band has one.
+func (h *Handler) postToBand(bandID primitive.ObjectID, text string) {
+	band, err := h.bandService.FindOneByID(bandID)
+	if err != nil || band.ChatID == 0 {
+		return
+	}
+
+	_, err = h.bot.Send(telebot.ChatID(band.ChatID), text, telebot.ModeHTML, telebot.NoPreview)
+	if err != nil {
+		log.Printf("posting to the group of band %s: %v", band.ID.Hex(), err)
+	}
+}
+
+func (h *Handler) announceEvent(event *entities.Event) {
+	h.postToBand(event.BandID, "🗓 Новое собрание:\n\n"+h.eventService.ToHtmlStringByEvent(*event))
+}
+
+func (h *Handler) announceSetlist(eventID primitive.ObjectID) {
+	event, err := h.eventService.FindOneByID(eventID)
+	if err != nil {
+		return
+	}
+
+	songsStr, _, err := h.eventService.GetSongsAsHTMLStringByID(eventID)
+	if err != nil || songsStr == "" {
+		songsStr = "\n\nПесен больше нет."
+	}
+
+	h.postToBand(event.BandID, fmt.Sprintf("🎵 Список песен изменен: <b>%s</b>%s", html.EscapeString(event.Alias()), songsStr))
+}
+
+func (h *Handler) announceSong(bandID primitive.ObjectID, driveFileID string) {
+	driveFile, err := h.driveFileService.FindOneByID(driveFileID)
+	if err != nil {
+		return
+	}
+
+	name := html.EscapeString(driveFile.Name)
+	if driveFile.WebViewLink != "" {
+		name = fmt.Sprintf("<a href=\"%s\">%s</a>", driveFile.WebViewLink, name)
+	}
+
+	h.postToBand(bandID, "🎼 Новая песня: "+name)
+}
+
+// remindBands posts events of the next day to the groups of their bands once.
+func (h *Handler) remindBands(events []*entities.Event) {
+	for _, event := range events {
+		if event.ChatReminded || time.Until(event.Time) > 24*time.Hour || time.Until(event.Time) < 0 {
+			continue
+		}
+
+		h.postToBand(event.BandID, "⏰ Скоро собрание:\n\n"+h.eventService.ToHtmlStringByEvent(*event))
+
+		event.ChatReminded = true
+		_, err := h.eventService.UpdateOne(nil, *event)
+		if err != nil {
+			log.Printf("saving reminder of event %s: %v", event.ID.Hex(), err)
+		}
+	}
+}
@@ -1,7 +1,9 @@
 package handlers
 
 import (
+	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"github.com/joeyave/scala-chords-bot/entities"
 	"github.com/joeyave/scala-chords-bot/helpers"
@@ -12,6 +14,7 @@ import (
 	"net/url"
 	"regexp"
 	"strings"
+	"sync"
 	"time"
 )
 
@@ -25,6 +28,16 @@ type Handler struct {
 	membershipService *services.MembershipService
 	eventService      *services.EventService
 	roleService       *services.RoleService
+	templateService   *services.EventTemplateService
+	rotaService       *services.RotaService
+	calendarService   *services.CalendarService
+	apiTokenService   *services.APITokenService
+	inviteService     *services.InviteService
+	permissionService *services.PermissionService
+	callbackService   *services.CallbackService
+
+	// Handlers being run, the shutdown waits for them.
+	running sync.WaitGroup
 }
 
 func NewHandler(
@@ -37,6 +50,13 @@ func NewHandler(
 	membershipService *services.MembershipService,
 	eventService *services.EventService,
 	roleService *services.RoleService,
+	templateService *services.EventTemplateService,
+	rotaService *services.RotaService,
+	calendarService *services.CalendarService,
+	apiTokenService *services.APITokenService,
+	inviteService *services.InviteService,
+	permissionService *services.PermissionService,
+	callbackService *services.CallbackService,
 ) *Handler {
 
 	return &Handler{
@@ -49,19 +69,47 @@ func NewHandler(
 		membershipService: membershipService,
 		eventService:      eventService,
 		roleService:       roleService,
+		templateService:   templateService,
+		rotaService:       rotaService,
+		calendarService:   calendarService,
+		apiTokenService:   apiTokenService,
+		inviteService:     inviteService,
+		permissionService: permissionService,
+		callbackService:   callbackService,
 	}
 }
 
 func (h *Handler) OnText(c telebot.Context) error {
+	if c.Message().FromGroup() {
+		return h.onGroupText(c)
+	}
 
 	user, err := h.userService.FindOneByID(c.Chat().ID)
 	if err != nil {
 		return err
 	}
 
+	// Invite links open the bot with "/start {token}".
+	if payload := strings.TrimPrefix(c.Text(), "/start "); strings.HasPrefix(c.Text(), "/start ") && services.IsInviteToken(payload) {
+		err = joinByInvite(h, c, user, payload)
+		if err != nil {
+			return err
+		}
+
+		_, err = h.userService.UpdateOne(*user)
+		return err
+	}
+
+	before := *user.State
+
 	// Handle buttons.
 	switch c.Text() {
 	case helpers.Cancel, helpers.Back:
+		// Conversations go back step by step themselves.
+		if _, ok := conversations[user.State.Name]; ok {
+			break
+		}
+
 		if user.State.Prev != nil {
 			user.State = user.State.Prev
 			user.State.Index = 0
@@ -77,6 +125,12 @@ func (h *Handler) OnText(c telebot.Context) error {
 			Index: 0,
 			Name:  helpers.MainMenuState,
 		}
+
+	default:
+		err = h.expireState(c, user)
+		if err != nil {
+			return err
+		}
 	}
 
 	err = h.enter(c, user)
@@ -84,18 +138,28 @@ func (h *Handler) OnText(c telebot.Context) error {
 		return err
 	}
 
+	markEntered(user, before)
 	_, err = h.userService.UpdateOne(*user)
 
 	return err
 }
 
 func (h *Handler) OnVoice(c telebot.Context) error {
+	if c.Message().FromGroup() {
+		return nil
+	}
 
 	user, err := h.userService.FindOneByID(c.Chat().ID)
 	if err != nil {
 		return err
 	}
 
+	err = h.expireState(c, user)
+	if err != nil {
+		return err
+	}
+	before := *user.State
+
 	user.State = &entities.State{
 		Index: 0,
 		Name:  helpers.UploadVoiceState,
@@ -112,28 +176,126 @@ func (h *Handler) OnVoice(c telebot.Context) error {
 		return err
 	}
 
+	markEntered(user, before)
+	_, err = h.userService.UpdateOne(*user)
+
+	return err
+}
+
+func (h *Handler) OnDocument(c telebot.Context) error {
+	if c.Message().FromGroup() {
+		return nil
+	}
+
+	user, err := h.userService.FindOneByID(c.Chat().ID)
+	if err != nil {
+		return err
+	}
+
+	err = h.expireState(c, user)
+	if err != nil {
+		return err
+	}
+	before := *user.State
+
+	// ChordPro files are imported from any state, other documents are left to the current one.
+	if isChordProFile(c.Message().Document.FileName) {
+		user.State = &entities.State{
+			Index: 0,
+			Name:  helpers.ImportChordProState,
+			Prev:  user.State,
+		}
+	}
+
+	err = h.enter(c, user)
+	if err != nil {
+		return err
+	}
+
+	markEntered(user, before)
 	_, err = h.userService.UpdateOne(*user)
 
 	return err
 }
 
 func (h *Handler) OnCallback(c telebot.Context) error {
+	if c.Callback().Message != nil && c.Callback().Message.FromGroup() {
+		return c.Respond()
+	}
+
 	user, err := h.userService.FindOneByID(c.Chat().ID)
 	if err != nil {
 		return err
 	}
+	before := *user.State
 
 	err = h.enter(c, user)
 	if err != nil {
 		return err
 	}
 
+	markEntered(user, before)
 	_, err = h.userService.UpdateOne(*user)
 
 	return nil
 }
 
+// OnQuery answers inline queries with charts of the band of the user. Only songs with a PDF
+// in Telegram are shown, since inline results can't be uploaded.
+func (h *Handler) OnQuery(c telebot.Context) error {
+	user, err := h.userService.FindOneByID(int64(c.Sender().ID))
+	if err != nil || user.BandID == primitive.NilObjectID || user.Band == nil {
+		return c.Answer(&telebot.QueryResponse{
+			Results:           telebot.Results{},
+			IsPersonal:        true,
+			SwitchPMText:      "Сначала выбери группу в боте",
+			SwitchPMParameter: "start",
+		})
+	}
+
+	query := strings.TrimSpace(helpers.CleanUpQuery(c.Query().Text))
+	if query == "" {
+		return c.Answer(&telebot.QueryResponse{Results: telebot.Results{}, IsPersonal: true})
+	}
+
+	driveFiles, nextPageToken, err := h.driveFileService.FindSomeByFullTextAndFolderID(query, user.Band.DriveFolderID, c.Query().Offset)
+	if err != nil {
+		return err
+	}
+
+	results := telebot.Results{}
+	for _, driveFile := range driveFiles {
+		song, err := h.songService.FindOneByDriveFileID(driveFile.Id)
+		if err != nil || song.PDF.TgFileID == "" || song.PDF.ModifiedTime != driveFile.ModifiedTime {
+			continue
+		}
+
+		result := &telebot.DocumentResult{
+			Title:       song.PDF.Name,
+			Cache:       song.PDF.TgFileID,
+			MIME:        "application/pdf",
+			Caption:     song.Caption(),
+			Description: song.Caption(),
+		}
+		result.SetResultID(song.ID.Hex())
+		results = append(results, result)
+	}
+
+	return c.Answer(&telebot.QueryResponse{
+		Results:    results,
+		CacheTime:  60,
+		IsPersonal: true,
+		NextOffset: nextPageToken,
+	})
+}
+
 func (h *Handler) OnError(botErr error, c telebot.Context) {
+	// Inline queries have no chat to answer to.
+	if c.Chat() == nil {
+		h.bot.Send(telebot.ChatID(helpers.LogsChannelID), fmt.Sprintf("<code>%v</code>", botErr), telebot.ModeHTML)
+		return
+	}
+
 	c.Send("Произошла ошибка. Поправим.")
 
 	user, err := h.userService.FindOneByID(c.Chat().ID)
@@ -153,8 +315,81 @@ func (h *Handler) OnError(botErr error, c telebot.Context) {
 	}
 }
 
+// Middleware returns the middleware every update goes through, in order.
+func (h *Handler) Middleware() []telebot.MiddlewareFunc {
+	return []telebot.MiddlewareFunc{h.CallbackMiddleware, h.RegisterUserMiddleware}
+}
+
+// Run receives updates and handles them, at most workers at a time, until ctx is done. Then it stops the poller,
+// handles the updates that are already received and returns, Wait waits for the handlers that are still running.
+// The bot must be synchronous: handlers are counted here before their goroutine starts, so Wait can't miss one.
+func (h *Handler) Run(ctx context.Context, workers int) {
+	stop := make(chan struct{})
+	polled := make(chan struct{})
+	go func() {
+		h.bot.Poller.Poll(h.bot, h.bot.Updates, stop)
+		close(polled)
+	}()
+
+	slots := make(chan struct{}, workers)
+	handle := func(update telebot.Update) {
+		h.running.Add(1)
+		slots <- struct{}{}
+		go func() {
+			defer h.running.Done()
+			defer func() { <-slots }()
+
+			h.bot.ProcessUpdate(update)
+		}()
+	}
+
+	done := ctx.Done()
+	for {
+		select {
+		case update := <-h.bot.Updates:
+			handle(update)
+
+		case <-done:
+			// The poller may be blocked sending an update, so updates are read until it returns.
+			done = nil
+			close(stop)
+
+		case <-polled:
+			for {
+				select {
+				case update := <-h.bot.Updates:
+					handle(update)
+				default:
+					return
+				}
+			}
+		}
+	}
+}
+
+// Wait blocks until the running handlers are done or the timeout expires. It returns false on timeout.
+func (h *Handler) Wait(timeout time.Duration) bool {
+	done := make(chan struct{})
+	go func() {
+		h.running.Wait()
+		close(done)
+	}()
+
+	select {
+	case <-done:
+		return true
+	case <-time.After(timeout):
+		return false
+	}
+}
+
 func (h *Handler) RegisterUserMiddleware(next telebot.HandlerFunc) telebot.HandlerFunc {
 	return func(c telebot.Context) error {
+		// Inline queries come without a chat and don't change the state, group chats have no users.
+		if c.Chat() == nil || c.Chat().Type != telebot.ChatPrivate {
+			return next(c)
+		}
+
 		start := time.Now()
 		user, err := h.userService.FindOneOrCreateByID(c.Chat().ID)
 		if err != nil {
@@ -178,13 +413,25 @@ func (h *Handler) RegisterUserMiddleware(next telebot.HandlerFunc) telebot.Handl
 	}
 }
 
-func (h *Handler) NotifyUser() {
-	for range time.Tick(time.Hour * 2) {
+// NotifyUser reminds members about their events until ctx is done.
+func (h *Handler) NotifyUser(ctx context.Context) {
+	ticker := time.NewTicker(time.Hour * 2)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+
 		events, err := h.eventService.FindAllFromToday()
 		if err != nil {
-			return
+			continue
 		}
 
+		h.remindBands(events)
+
 		for _, event := range events {
 			if event.Time.Add(time.Hour*8).Sub(time.Now()).Hours() < 48 {
 				for _, membership := range event.Memberships {
@@ -192,22 +439,54 @@ func (h *Handler) NotifyUser() {
 						continue
 					}
 
-					eventString := h.eventService.ToHtmlStringByEvent(*event)
-					_, err := h.bot.Send(telebot.ChatID(membership.UserID),
-						fmt.Sprintf("Привет. Ты учавствуешь в собрании через несколько дней! "+
-							"Вот план:\n\n%s", eventString), telebot.ModeHTML, telebot.NoPreview)
-					if err != nil {
-						continue
-					}
-
-					membership.Notified = true
-					h.membershipService.UpdateOne(*membership)
+					h.sendNotification(event, membership)
 				}
 			}
 		}
 	}
 }
 
+// sendNotification sends the plan of the event to the member asking to accept or decline it.
+func (h *Handler) sendNotification(event *entities.Event, membership *entities.Membership) error {
+	eventString := h.eventService.ToHtmlStringByEvent(*event)
+	markup, err := h.signMarkup(membership.UserID, &telebot.ReplyMarkup{
+		InlineKeyboard: helpers.GetMembershipStatusKeyboard(*membership),
+	})
+	if err != nil {
+		return err
+	}
+
+	_, err = h.bot.Send(telebot.ChatID(membership.UserID),
+		fmt.Sprintf("Привет. Ты учавствуешь в собрании через несколько дней! "+
+			"Вот план:\n\n%s\n\nСможешь?", eventString), markup, telebot.ModeHTML, telebot.NoPreview)
+	if err != nil {
+		return err
+	}
+
+	membership.Notified = true
+	_, err = h.membershipService.UpdateOne(nil, *membership)
+	return err
+}
+
+// GenerateEvents keeps events of the series created ahead until ctx is done.
+func (h *Handler) GenerateEvents(ctx context.Context) {
+	ticker := time.NewTicker(time.Hour * 6)
+	defer ticker.Stop()
+
+	for {
+		err := h.templateService.GenerateEvents(time.Now())
+		if err != nil {
+			log.Printf("generating events: %v", err)
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
 func (h *Handler) enter(c telebot.Context, user *entities.User) error {
 
 	if user.State.CallbackData == nil {
@@ -257,7 +536,15 @@ func (h *Handler) enterInlineHandler(c telebot.Context, user *entities.User) err
 		}
 	}
 
-	state, index, _ := helpers.ParseCallbackData(c.Callback().Data)
+	state, index, payload := helpers.ParseCallbackData(c.Callback().Data)
+
+	err := h.authorize(user, state, index, payload)
+	if errors.Is(err, services.ErrForbidden) {
+		return h.deny(c, user)
+	}
+	if err != nil {
+		return err
+	}
 
 	// Handle error.
 	handlerFuncs, _ := handlers[state]
@@ -273,5 +560,13 @@ func (h *Handler) enterReplyHandler(c telebot.Context, user *entities.User) erro
 		handlerFuncs = handlers[user.State.Name]
 	}
 
+	err := h.authorize(user, user.State.Name, user.State.Index, "")
+	if errors.Is(err, services.ErrForbidden) {
+		return h.deny(c, user)
+	}
+	if err != nil {
+		return err
+	}
+
 	return handlerFuncs[user.State.Index](h, c, user)
 }
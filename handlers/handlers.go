@@ -5,13 +5,18 @@ import (
 	"fmt"
 	"github.com/joeyave/scala-chords-bot/entities"
 	"github.com/joeyave/scala-chords-bot/helpers"
+	"github.com/joeyave/scala-chords-bot/services"
 	"github.com/joeyave/telebot/v3"
 	"github.com/klauspost/lctime"
 	"go.mongodb.org/mongo-driver/bson/primitive"
 	"go.mongodb.org/mongo-driver/mongo"
 	"google.golang.org/api/drive/v3"
+	"html"
+	"io/ioutil"
 	"log"
+	"path/filepath"
 	"regexp"
+	"sort"
 	"strconv"
 	"strings"
 	"time"
@@ -21,8 +26,21 @@ func mainMenuHandler() (int, []HandlerFunc) {
 	handlerFuncs := make([]HandlerFunc, 0)
 
 	handlerFuncs = append(handlerFuncs, func(h *Handler, c telebot.Context, user *entities.User) error {
-		err := c.Send("Основное меню:", &telebot.ReplyMarkup{
-			ReplyKeyboard:  helpers.MainMenuKeyboard,
+		msg := "Основное меню:"
+		keyboard := helpers.MainMenuKeyboard
+
+		// Users in several bands switch between them right from the menu.
+		if len(user.UserBands()) > 1 {
+			// The user could have just switched, so the band is not the joined one.
+			if band, err := h.bandService.FindOneByID(user.BandID); err == nil {
+				msg = fmt.Sprintf("Основное меню, группа %s:", band.Name)
+			}
+			keyboard = append([][]telebot.ReplyButton{}, keyboard...)
+			keyboard = append(keyboard, []telebot.ReplyButton{{Text: helpers.ChangeBand}})
+		}
+
+		err := c.Send(msg, &telebot.ReplyMarkup{
+			ReplyKeyboard:  keyboard,
 			ResizeKeyboard: true,
 		})
 		if err != nil {
@@ -35,6 +53,11 @@ func mainMenuHandler() (int, []HandlerFunc) {
 	handlerFuncs = append(handlerFuncs, func(h *Handler, c telebot.Context, user *entities.User) error {
 		switch c.Text() {
 
+		case helpers.ChangeBand:
+			user.State = &entities.State{
+				Name: helpers.ChooseBandState,
+			}
+
 		case helpers.Schedule:
 			user.State = &entities.State{
 				Name: helpers.GetEventsState,
@@ -130,14 +153,34 @@ func mainMenuHandler() (int, []HandlerFunc) {
 			})
 
 		case helpers.BandSettings:
+			// Only buttons the user has permissions for, two in a row.
+			var buttons []telebot.ReplyButton
+			if user.Can(entities.ManageRoles) {
+				buttons = append(buttons, telebot.ReplyButton{Text: helpers.CreateRole})
+			}
+			if can(user, statePermissions[helpers.AddBandAdminState]) {
+				buttons = append(buttons, telebot.ReplyButton{Text: helpers.AddAdmin})
+			}
+			if user.Can(entities.ManageMembers) {
+				buttons = append(buttons, telebot.ReplyButton{Text: helpers.Invites})
+			}
+			if user.Can(entities.ManageBand) {
+				buttons = append(buttons, telebot.ReplyButton{Text: helpers.PermissionGroups}, telebot.ReplyButton{Text: helpers.APIAccess})
+			}
+
+			var keyboard [][]telebot.ReplyButton
+			for i := 0; i < len(buttons); i += 2 {
+				if i+1 < len(buttons) {
+					keyboard = append(keyboard, []telebot.ReplyButton{buttons[i], buttons[i+1]})
+				} else {
+					keyboard = append(keyboard, []telebot.ReplyButton{buttons[i]})
+				}
+			}
+			keyboard = append(keyboard, []telebot.ReplyButton{{Text: helpers.Back}})
+
 			err := c.Send(helpers.BandSettings+":", &telebot.ReplyMarkup{
 				ResizeKeyboard: true,
-				ReplyKeyboard: [][]telebot.ReplyButton{
-					{
-						{Text: helpers.CreateRole}, {Text: helpers.AddAdmin},
-					},
-					{{Text: helpers.Back}},
-				},
+				ReplyKeyboard:  keyboard,
 			})
 			if err != nil {
 				return err
@@ -152,6 +195,9 @@ func mainMenuHandler() (int, []HandlerFunc) {
 					{
 						{Text: helpers.ChangeBand},
 					},
+					{
+						{Text: helpers.Availability}, {Text: helpers.Calendar},
+					},
 					{{Text: helpers.Back}},
 				},
 			})
@@ -177,6 +223,29 @@ func mainMenuHandler() (int, []HandlerFunc) {
 				Name: helpers.ChooseBandState,
 			}
 
+		case helpers.Availability:
+			user.State = &entities.State{
+				Name: helpers.AvailabilityState,
+			}
+
+		case helpers.Calendar:
+			return sendCalendars(h, c, user)
+
+		case helpers.Invites:
+			user.State = &entities.State{
+				Name: helpers.InvitesState,
+			}
+
+		case helpers.PermissionGroups:
+			user.State = &entities.State{
+				Name: helpers.PermissionGroupsState,
+			}
+
+		case helpers.APIAccess:
+			user.State = &entities.State{
+				Name: helpers.APITokenState,
+			}
+
 		case helpers.CreateRole:
 			user.State = &entities.State{
 				Name: helpers.CreateRoleState,
@@ -194,100 +263,85 @@ func mainMenuHandler() (int, []HandlerFunc) {
 	return helpers.MainMenuState, handlerFuncs
 }
 
-func createRoleHandler() (int, []HandlerFunc) {
-
-	handlerFuncs := make([]HandlerFunc, 0)
-
-	handlerFuncs = append(handlerFuncs, func(h *Handler, c telebot.Context, user *entities.User) error {
-		err := c.Send("Отправь название новой роли. Например, лид-вокал, проповедник и т. д.", &telebot.ReplyMarkup{
-			ReplyKeyboard:  [][]telebot.ReplyButton{{{Text: helpers.Cancel}}},
-			ResizeKeyboard: true,
-		})
-		if err != nil {
-			return err
-		}
-
-		user.State.Index++
-		return nil
-	})
-
-	handlerFuncs = append(handlerFuncs, func(h *Handler, c telebot.Context, user *entities.User) error {
-
-		user.State.Context.Role = &entities.Role{
-			Name: c.Text(),
-		}
-
-		markup := &telebot.ReplyMarkup{
-			ResizeKeyboard: true,
-		}
-
-		if len(user.Band.Roles) == 0 {
-			user.State.Context.Role.Priority = 1
-			user.State.Index++
-			return nil
-		}
-
-		for _, role := range user.Band.Roles {
-			markup.ReplyKeyboard = append(markup.ReplyKeyboard, []telebot.ReplyButton{{Text: role.Name}})
-		}
-		markup.ReplyKeyboard = append(markup.ReplyKeyboard, []telebot.ReplyButton{{Text: helpers.Cancel}})
-
-		err := c.Send("После какой роли должна быть эта роль?", markup)
-		if err != nil {
-			return err
-		}
-
-		user.State.Index++
-		return nil
-	})
-
-	handlerFuncs = append(handlerFuncs, func(h *Handler, c telebot.Context, user *entities.User) error {
+type createRoleData struct {
+	Name string `bson:"name"`
+}
 
-		if user.State.Context.Role.Priority == 0 {
+var createRoleConversation = &Conversation{
+	State:   helpers.CreateRoleState,
+	Data:    func() interface{} { return &createRoleData{} },
+	Timeout: time.Hour,
+	Steps: []*Step{
+		{
+			Name: "name",
+			Ask: func(h *Handler, c telebot.Context, user *entities.User, flow *createRoleData) error {
+				return c.Send("Отправь название новой роли. Например, лид-вокал, проповедник и т. д.", &telebot.ReplyMarkup{
+					ReplyKeyboard:  [][]telebot.ReplyButton{{{Text: helpers.Cancel}}},
+					ResizeKeyboard: true,
+				})
+			},
+			Handle: func(h *Handler, c telebot.Context, user *entities.User, flow *createRoleData) (string, error) {
+				flow.Name = c.Text()
 
-			var foundRole *entities.Role
-			for _, role := range user.Band.Roles {
-				if c.Text() == role.Name {
-					foundRole = role
-					break
+				if len(user.Band.Roles) == 0 {
+					return End, createRole(h, c, user, flow.Name, 1)
+				}
+				return "position", nil
+			},
+			Transitions: []string{"position"},
+		},
+		{
+			Name: "position",
+			Ask: func(h *Handler, c telebot.Context, user *entities.User, flow *createRoleData) error {
+				markup := &telebot.ReplyMarkup{
+					ResizeKeyboard: true,
 				}
-			}
 
-			if foundRole == nil {
-				user.State.Index--
-				return h.enter(c, user)
-			}
+				for _, role := range user.Band.Roles {
+					markup.ReplyKeyboard = append(markup.ReplyKeyboard, []telebot.ReplyButton{{Text: role.Name}})
+				}
+				markup.ReplyKeyboard = append(markup.ReplyKeyboard, []telebot.ReplyButton{{Text: helpers.Back}, {Text: helpers.Cancel}})
 
-			user.State.Context.Role.Priority = foundRole.Priority + 1
+				return c.Send("После какой роли должна быть эта роль?", markup)
+			},
+			Handle: func(h *Handler, c telebot.Context, user *entities.User, flow *createRoleData) (string, error) {
+				var foundRole *entities.Role
+				for _, role := range user.Band.Roles {
+					if c.Text() == role.Name {
+						foundRole = role
+						break
+					}
+				}
 
-			for _, role := range user.Band.Roles {
-				if role.Priority > foundRole.Priority {
-					role.Priority++
-					h.roleService.UpdateOne(*role)
+				if foundRole == nil {
+					return "position", nil
 				}
-			}
-		}
 
-		role, err := h.roleService.UpdateOne(
-			entities.Role{
-				Name:     user.State.Context.Role.Name,
-				BandID:   user.BandID,
-				Priority: user.State.Context.Role.Priority,
-			})
-		if err != nil {
-			return err
-		}
+				for _, role := range user.Band.Roles {
+					if role.Priority > foundRole.Priority {
+						role.Priority++
+						h.roleService.UpdateOne(*role)
+					}
+				}
 
-		err = c.Send(fmt.Sprintf("Добавлена новая роль: %s.", role.Name))
-		if err != nil {
-			return err
-		}
+				return End, createRole(h, c, user, flow.Name, foundRole.Priority+1)
+			},
+		},
+	},
+}
 
-		user.State = &entities.State{Name: helpers.MainMenuState}
-		return h.enter(c, user)
-	})
+func createRole(h *Handler, c telebot.Context, user *entities.User, name string, priority int) error {
+	role, err := h.roleService.UpdateOne(
+		entities.Role{
+			Name:     name,
+			BandID:   user.BandID,
+			Priority: priority,
+		})
+	if err != nil {
+		return err
+	}
 
-	return helpers.CreateRoleState, handlerFuncs
+	return c.Send(fmt.Sprintf("Добавлена новая роль: %s.", role.Name))
 }
 
 func getEventsHandler() (int, []HandlerFunc) {
@@ -306,7 +360,15 @@ func getEventsHandler() (int, []HandlerFunc) {
 			markup.ReplyKeyboard = append(markup.ReplyKeyboard, []telebot.ReplyButton{{Text: event.Alias()}})
 		}
 		markup.ReplyKeyboard = append(markup.ReplyKeyboard, []telebot.ReplyButton{{Text: helpers.GetEventsWithMe}, {Text: helpers.GetAllEvents}})
-		markup.ReplyKeyboard = append(markup.ReplyKeyboard, []telebot.ReplyButton{{Text: helpers.Back}, {Text: helpers.CreateEvent}})
+		if len(user.UserBands()) > 1 {
+			markup.ReplyKeyboard = append(markup.ReplyKeyboard, []telebot.ReplyButton{{Text: helpers.GetEventsWithMeEverywhere}})
+		}
+		if user.Can(entities.ManageEvents) {
+			markup.ReplyKeyboard = append(markup.ReplyKeyboard, []telebot.ReplyButton{{Text: helpers.Back}, {Text: helpers.CreateEvent}})
+			markup.ReplyKeyboard = append(markup.ReplyKeyboard, []telebot.ReplyButton{{Text: helpers.Templates}, {Text: helpers.GenerateRota}})
+		} else {
+			markup.ReplyKeyboard = append(markup.ReplyKeyboard, []telebot.ReplyButton{{Text: helpers.Back}})
+		}
 
 		err = c.Send("Выбери собрание:", markup)
 		if err != nil {
@@ -327,6 +389,22 @@ func getEventsHandler() (int, []HandlerFunc) {
 			user.State.Prev.Index = 0
 			return h.enter(c, user)
 
+		case helpers.Templates:
+			user.State = &entities.State{
+				Name: helpers.EventTemplatesState,
+				Prev: user.State,
+			}
+			user.State.Prev.Index = 0
+			return h.enter(c, user)
+
+		case helpers.GenerateRota:
+			user.State = &entities.State{
+				Name: helpers.RotaState,
+				Prev: user.State,
+			}
+			user.State.Prev.Index = 0
+			return h.enter(c, user)
+
 		case helpers.GetEventsWithMe:
 			events, err := h.eventService.FindManyFromTodayByBandIDAndUserID(user.BandID, user.ID)
 			if err != nil {
@@ -354,6 +432,9 @@ func getEventsHandler() (int, []HandlerFunc) {
 
 			return nil
 
+		case helpers.GetEventsWithMeEverywhere:
+			return sendEventsOfAllBands(h, c, user)
+
 		case helpers.GetAllEvents:
 			events, err := h.eventService.FindManyFromTodayByBandID(user.BandID)
 			if err != nil {
@@ -517,7 +598,7 @@ func createEventHandler() (int, []HandlerFunc) {
 			return h.enter(c, user)
 		}
 
-		event, err := h.eventService.UpdateOne(entities.Event{
+		event, err := h.eventService.UpdateOne(user, entities.Event{
 			Time:   parsedTime,
 			Name:   user.State.Context.Map["eventName"],
 			BandID: user.BandID,
@@ -526,6 +607,8 @@ func createEventHandler() (int, []HandlerFunc) {
 			return err
 		}
 
+		h.announceEvent(event)
+
 		c.Callback().Data = helpers.AggregateCallbackData(helpers.EventActionsState, 0, "")
 		q := user.State.CallbackData.Query()
 		q.Set("eventId", event.ID.Hex())
@@ -608,12 +691,35 @@ func eventActionsHandler() (int, []HandlerFunc) {
 			return err
 		}
 
-		var driveFileIDs []string
-		for _, song := range event.Songs {
-			driveFileIDs = append(driveFileIDs, song.DriveFileID)
+		err = sendEventCharts(h, c, user, event)
+		if err != nil {
+			return err
+		}
+
+		c.Respond()
+
+		return nil
+	})
+
+	handlerFuncs = append(handlerFuncs, func(h *Handler, c telebot.Context, user *entities.User) error {
+
+		eventID, err := primitive.ObjectIDFromHex(user.State.CallbackData.Query().Get("eventId"))
+		if err != nil {
+			return err
+		}
+
+		c.Notify(telebot.UploadingDocument)
+
+		reader, event, err := h.eventService.RenderBookletByID(eventID)
+		if err != nil {
+			return err
 		}
 
-		err = sendDriveFilesAlbum(h, c, user, driveFileIDs)
+		err = c.Send(&telebot.Document{
+			File:     telebot.FromReader(reader),
+			MIME:     "application/pdf",
+			FileName: fmt.Sprintf("%s.pdf", event.Alias()),
+		})
 		if err != nil {
 			return err
 		}
@@ -674,13 +780,15 @@ func changeSongOrderHandler() (int, []HandlerFunc) {
 				return err
 			}
 
-			err = h.eventService.ChangeSongIDPosition(eventID, song.ID, songIndex)
+			err = h.eventService.ChangeSongIDPosition(user, eventID, song.ID, songIndex)
 			if err != nil {
 				return err
 			}
 		}
 
 		if len(user.State.CallbackData.Query()["driveFileIds"]) == 0 {
+			h.announceSetlist(eventID)
+
 			c.Callback().Data = helpers.AggregateCallbackData(helpers.EventActionsState, 0, "")
 			return h.enter(c, user)
 		}
@@ -795,8 +903,9 @@ func changeEventDateHandler() (int, []HandlerFunc) {
 			return err
 		}
 		event.Time = parsedTime
+		event.ChatReminded = false
 
-		event, err = h.eventService.UpdateOne(*event)
+		event, err = h.eventService.UpdateOne(user, *event)
 		if err != nil {
 			return err
 		}
@@ -869,6 +978,11 @@ func addEventMemberHandler() (int, []HandlerFunc) {
 
 		markup := &telebot.ReplyMarkup{}
 
+		// Those who can't serve on the day of the event go last.
+		sort.SliceStable(usersExtra, func(i, j int) bool {
+			return usersExtra[i].User.BlackoutOn(event.Time) == nil && usersExtra[j].User.BlackoutOn(event.Time) != nil
+		})
+
 		for _, userExtra := range usersExtra {
 			var buttonText string
 			if len(userExtra.Events) == 0 {
@@ -876,6 +990,9 @@ func addEventMemberHandler() (int, []HandlerFunc) {
 			} else {
 				buttonText = fmt.Sprintf("%s | %v | %d", userExtra.User.Name, lctime.Strftime("%d %b", userExtra.Events[0].Time), len(userExtra.Events))
 			}
+			if userExtra.User.BlackoutOn(event.Time) != nil {
+				buttonText = fmt.Sprintf("%s | %s", buttonText, helpers.Unavailable)
+			}
 			markup.InlineKeyboard = append(markup.InlineKeyboard, []telebot.InlineButton{
 				{Text: buttonText, Data: helpers.AggregateCallbackData(state, index+1, fmt.Sprintf("%s:%d", roleIDHex, userExtra.User.ID))},
 			})
@@ -910,7 +1027,7 @@ func addEventMemberHandler() (int, []HandlerFunc) {
 			return err
 		}
 
-		_, err = h.membershipService.UpdateOne(entities.Membership{
+		_, err = h.membershipService.UpdateOne(user, entities.Membership{
 			EventID: eventID,
 			UserID:  userID,
 			RoleID:  roleID,
@@ -938,6 +1055,20 @@ func addEventMemberHandler() (int, []HandlerFunc) {
 		c.Edit(helpers.AddCallbackData(eventString, user.State.CallbackData.String()), &telebot.ReplyMarkup{
 			InlineKeyboard: helpers.GetEventActionsKeyboard(*user, *event),
 		}, telebot.ModeHTML, telebot.NoPreview)
+
+		for _, membership := range event.Memberships {
+			if membership.UserID != userID || membership.User == nil {
+				continue
+			}
+
+			if blackout := membership.User.BlackoutOn(event.Time); blackout != nil {
+				return c.Respond(&telebot.CallbackResponse{
+					Text:      fmt.Sprintf("Внимание: %s не может служить %s.", membership.User.Name, blackout.String()),
+					ShowAlert: true,
+				})
+			}
+		}
+
 		c.Respond()
 		return nil
 	})
@@ -993,7 +1124,7 @@ func deleteEventMemberHandler() (int, []HandlerFunc) {
 			return err
 		}
 
-		err = h.membershipService.DeleteOneByID(membershipID)
+		err = h.membershipService.DeleteOneByID(user, membershipID)
 		if err != nil {
 			return err
 		}
@@ -1133,11 +1264,13 @@ func addEventSongHandler() (int, []HandlerFunc) {
 			return err
 		}
 
-		err = h.eventService.PushSongID(user.State.Context.EventID, song.ID)
+		err = h.eventService.PushSongID(user, user.State.Context.EventID, song.ID)
 		if errors.Is(err, mongo.ErrNoDocuments) {
 			c.Send("Вероятнее всего, эта песня уже есть в списке.")
 		} else if err != nil {
 			return err
+		} else {
+			h.announceSetlist(user.State.Context.EventID)
 		}
 
 		user.State.Index = 0
@@ -1195,11 +1328,13 @@ func deleteEventSongHandler() (int, []HandlerFunc) {
 			return err
 		}
 
-		err = h.eventService.PullSongID(eventID, songID)
+		err = h.eventService.PullSongID(user, eventID, songID)
 		if err != nil {
 			return err
 		}
 
+		h.announceSetlist(eventID)
+
 		//go func() {
 		//	eventString, _ := h.eventService.ToHtmlStringByID(event.ID)
 		//	h.bot.Send(telebot.ChatID(foundUser.ID),
@@ -1244,7 +1379,7 @@ func deleteEventHandler() (int, []HandlerFunc) {
 
 	handlerFuncs = append(handlerFuncs, func(h *Handler, c telebot.Context, user *entities.User) error {
 		if c.Text() == helpers.Yes {
-			err := h.eventService.DeleteOneByID(user.State.Context.EventID)
+			err := h.eventService.DeleteOneByID(user, user.State.Context.EventID)
 			if err != nil {
 				return err
 			}
@@ -1283,12 +1418,37 @@ func chooseBandHandler() (int, []HandlerFunc) {
 			ResizeKeyboard: true,
 		}
 
+		// Bands of the user go first, the current one is marked.
+		var userBandNames []string
+		sort.SliceStable(bands, func(i, j int) bool {
+			return user.UserBand(bands[i].ID) != nil && user.UserBand(bands[j].ID) == nil
+		})
+
 		markup.ReplyKeyboard = append(markup.ReplyKeyboard, []telebot.ReplyButton{{Text: helpers.CreateBand}})
 		for _, band := range bands {
 			markup.ReplyKeyboard = append(markup.ReplyKeyboard, []telebot.ReplyButton{{Text: band.Name}})
+
+			if user.UserBand(band.ID) == nil {
+				continue
+			}
+			if band.ID == user.BandID {
+				userBandNames = append(userBandNames, fmt.Sprintf("<b>%s</b> (текущая)", html.EscapeString(band.Name)))
+			} else {
+				userBandNames = append(userBandNames, html.EscapeString(band.Name))
+			}
+		}
+		if user.BandID != primitive.NilObjectID {
+			markup.ReplyKeyboard = append(markup.ReplyKeyboard, []telebot.ReplyButton{{Text: helpers.Back}})
+		}
+
+		msg := "Чтобы присоединиться к группе, попроси у ее администратора ссылку-приглашение. " +
+			"Или выбери группу, и я отправлю администраторам запрос:"
+		if len(userBandNames) > 0 {
+			msg = fmt.Sprintf("Твои группы: %s. Выбери свою группу, чтобы переключиться на нее.\n\n%s",
+				strings.Join(userBandNames, ", "), msg)
 		}
 
-		err = c.Send("Выбери свою группу:", markup)
+		err = c.Send(msg, markup, telebot.ModeHTML)
 		if err != nil {
 			return err
 		}
@@ -1317,54 +1477,105 @@ func chooseBandHandler() (int, []HandlerFunc) {
 				}
 			}
 
-			if foundBand != nil {
-				err := c.Send(fmt.Sprintf("Ты добавлен в группу %s.", foundBand.Name))
+			if foundBand == nil {
+				user.State.Index--
+				return h.enter(c, user)
+			}
+
+			if user.SwitchBand(foundBand.ID) {
+				err := c.Send(fmt.Sprintf("Текущая группа: %s.", foundBand.Name))
 				if err != nil {
 					return err
 				}
 
-				user.BandID = foundBand.ID
 				user.State = &entities.State{
-					Index: 0,
-					Name:  helpers.MainMenuState,
+					Name: helpers.MainMenuState,
 				}
-			} else {
-				user.State.Index--
+				return h.enter(c, user)
 			}
 
-			return h.enter(c, user)
+			// Joining without an invite needs an approval of admins, the user stays here meanwhile.
+			return sendJoinRequest(h, c, user, foundBand)
 		}
 	})
 
 	return helpers.ChooseBandState, handlerFuncs
 }
 
-func createBandHandler() (int, []HandlerFunc) {
+type createBandData struct {
+	Name string `bson:"name"`
+}
+
+var createBandConversation = &Conversation{
+	State:   helpers.CreateBandState,
+	Data:    func() interface{} { return &createBandData{} },
+	Timeout: time.Hour * 24,
+	Steps: []*Step{
+		{
+			Name: "name",
+			Ask: func(h *Handler, c telebot.Context, user *entities.User, flow *createBandData) error {
+				return c.Send("Введи название своей группы:", &telebot.ReplyMarkup{
+					ReplyKeyboard:  [][]telebot.ReplyButton{{{Text: helpers.Cancel}}},
+					ResizeKeyboard: true,
+				})
+			},
+			Handle: func(h *Handler, c telebot.Context, user *entities.User, flow *createBandData) (string, error) {
+				flow.Name = c.Text()
+				return "folder", nil
+			},
+			Transitions: []string{"folder"},
+		},
+		{
+			Name: "folder",
+			Ask: func(h *Handler, c telebot.Context, user *entities.User, flow *createBandData) error {
+				return c.Send("Теперь добавь имейл scala-drive@scala-chords-bot.iam.gserviceaccount.com в папку на Гугл Диске как редактора. После этого отправь мне ссылку на эту папку.",
+					&telebot.ReplyMarkup{
+						ReplyKeyboard:  [][]telebot.ReplyButton{{{Text: helpers.Back}, {Text: helpers.Cancel}}},
+						ResizeKeyboard: true,
+					})
+			},
+			Handle: func(h *Handler, c telebot.Context, user *entities.User, flow *createBandData) (string, error) {
+				re := regexp.MustCompile(`(/folders/|id=)(.*?)(/|\?|$)`)
+				matches := re.FindStringSubmatch(c.Text())
+				if matches == nil || len(matches) < 3 {
+					return "folder", nil
+				}
+
+				band, err := h.bandService.UpdateOne(entities.Band{
+					Name:          flow.Name,
+					DriveFolderID: matches[2],
+				})
+				if err != nil {
+					return "", err
+				}
+
+				user.JoinBand(band.ID, helpers.Admin)
+
+				return End, c.Send(fmt.Sprintf("Ты добавлен в группу \"%s\" как администратор.", band.Name))
+			},
+		},
+	},
+}
+
+func addBandAdminHandler() (int, []HandlerFunc) {
 	handlerFunc := make([]HandlerFunc, 0)
 
 	handlerFunc = append(handlerFunc, func(h *Handler, c telebot.Context, user *entities.User) error {
-		err := c.Send("Введи название своей группы:", &telebot.ReplyMarkup{
-			ReplyKeyboard:  [][]telebot.ReplyButton{{{Text: helpers.Cancel}}},
+		markup := &telebot.ReplyMarkup{
 			ResizeKeyboard: true,
-		})
+		}
+
+		users, err := h.userService.FindMultipleByBandID(user.BandID)
 		if err != nil {
 			return err
 		}
 
-		user.State.Index++
-		return nil
-	})
-
-	handlerFunc = append(handlerFunc, func(h *Handler, c telebot.Context, user *entities.User) error {
-		user.State.Context.Band = &entities.Band{
-			Name: c.Text(),
+		for _, user := range users {
+			markup.ReplyKeyboard = append(markup.ReplyKeyboard, []telebot.ReplyButton{{Text: user.Name}})
 		}
+		markup.ReplyKeyboard = append(markup.ReplyKeyboard, []telebot.ReplyButton{{Text: helpers.Cancel}})
 
-		err := c.Send("Теперь добавь имейл scala-drive@scala-chords-bot.iam.gserviceaccount.com в папку на Гугл Диске как редактора. После этого отправь мне ссылку на эту папку.",
-			&telebot.ReplyMarkup{
-				ReplyKeyboard:  [][]telebot.ReplyButton{{{Text: helpers.Cancel}}},
-				ResizeKeyboard: true,
-			})
+		err = c.Send("Выбери пользователя, которого ты хочешь сделать администратором:", markup)
 		if err != nil {
 			return err
 		}
@@ -1374,22 +1585,37 @@ func createBandHandler() (int, []HandlerFunc) {
 	})
 
 	handlerFunc = append(handlerFunc, func(h *Handler, c telebot.Context, user *entities.User) error {
-		re := regexp.MustCompile(`(/folders/|id=)(.*?)(/|\?|$)`)
-		matches := re.FindStringSubmatch(c.Text())
-		if matches == nil || len(matches) < 3 {
+		// Only members of the band are in the keyboard, so the name is looked up among them.
+		users, err := h.userService.FindMultipleByBandID(user.BandID)
+		if err != nil {
+			return err
+		}
+
+		var chosenUser *entities.User
+		for _, u := range users {
+			if u.Name == c.Text() {
+				chosenUser = u
+				break
+			}
+		}
+
+		if chosenUser == nil {
+			err = c.Send("В группе нет участника с таким именем, выбери его из списка.")
+			if err != nil {
+				return err
+			}
+
 			user.State.Index--
 			return h.enter(c, user)
 		}
-		user.State.Context.Band.DriveFolderID = matches[2]
-		user.Role = helpers.Admin
-		band, err := h.bandService.UpdateOne(*user.State.Context.Band)
+
+		chosenUser.SetRoleIn(user.BandID, helpers.Admin)
+		_, err = h.userService.UpdateOne(*chosenUser)
 		if err != nil {
 			return err
 		}
 
-		user.BandID = band.ID
-
-		err = c.Send(fmt.Sprintf("Ты добавлен в группу \"%s\" как администратор.", band.Name))
+		err = c.Send(fmt.Sprintf("Пользователь %s повышен до администратора.", chosenUser.Name))
 		if err != nil {
 			return err
 		}
@@ -1397,74 +1623,18 @@ func createBandHandler() (int, []HandlerFunc) {
 		user.State = &entities.State{
 			Name: helpers.MainMenuState,
 		}
+
 		return h.enter(c, user)
 	})
 
-	return helpers.CreateBandState, handlerFunc
+	return helpers.AddBandAdminState, handlerFunc
 }
 
-func addBandAdminHandler() (int, []HandlerFunc) {
-	handlerFunc := make([]HandlerFunc, 0)
+func getSongsFromMongoHandler() (int, []HandlerFunc) {
+	handlerFuncs := make([]HandlerFunc, 0)
 
-	handlerFunc = append(handlerFunc, func(h *Handler, c telebot.Context, user *entities.User) error {
-
-		markup := &telebot.ReplyMarkup{
-			ResizeKeyboard: true,
-		}
-
-		users, err := h.userService.FindMultipleByBandID(user.BandID)
-		if err != nil {
-			return err
-		}
-
-		for _, user := range users {
-			markup.ReplyKeyboard = append(markup.ReplyKeyboard, []telebot.ReplyButton{{Text: user.Name}})
-		}
-		markup.ReplyKeyboard = append(markup.ReplyKeyboard, []telebot.ReplyButton{{Text: helpers.Cancel}})
-
-		err = c.Send("Выбери пользователя, которого ты хочешь сделать администратором:", markup)
-		if err != nil {
-			return err
-		}
-
-		user.State.Index++
-		return nil
-	})
-
-	handlerFunc = append(handlerFunc, func(h *Handler, c telebot.Context, user *entities.User) error {
-
-		chosenUser, err := h.userService.FindOneByName(c.Text())
-		if err != nil {
-			user.State.Index--
-			return h.enter(c, user)
-		}
-
-		chosenUser.Role = helpers.Admin
-		_, err = h.userService.UpdateOne(*chosenUser)
-		if err != nil {
-			return err
-		}
-
-		err = c.Send(fmt.Sprintf("Пользователь %s повышен до администратора.", chosenUser.Name))
-		if err != nil {
-			return err
-		}
-
-		user.State = &entities.State{
-			Name: helpers.MainMenuState,
-		}
-
-		return h.enter(c, user)
-	})
-
-	return helpers.AddBandAdminState, handlerFunc
-}
-
-func getSongsFromMongoHandler() (int, []HandlerFunc) {
-	handlerFuncs := make([]HandlerFunc, 0)
-
-	handlerFuncs = append(handlerFuncs, func(h *Handler, c telebot.Context, user *entities.User) error {
-		c.Notify(telebot.Typing)
+	handlerFuncs = append(handlerFuncs, func(h *Handler, c telebot.Context, user *entities.User) error {
+		c.Notify(telebot.Typing)
 
 		switch c.Text() {
 		case helpers.SongsByNumberOfPerforming, helpers.SongsByLastDateOfPerforming:
@@ -1778,6 +1948,11 @@ func songActionsHandler() (int, []HandlerFunc) {
 		markup := &telebot.ReplyMarkup{}
 		markup.InlineKeyboard = helpers.GetSongActionsKeyboard(*user, *song, *driveFile)
 
+		markup, err = h.signMarkup(user.ID, markup)
+		if err != nil {
+			return err
+		}
+
 		h.bot.EditReplyMarkup(c.Callback().Message, markup)
 		c.Respond()
 		return nil
@@ -1794,45 +1969,15 @@ func transposeSongHandler() (int, []HandlerFunc) {
 
 		state, index, _ := helpers.ParseCallbackData(c.Callback().Data)
 
+		markup := &telebot.ReplyMarkup{
+			InlineKeyboard: helpers.GetKeysKeyboard(state, index+1),
+		}
+		markup.InlineKeyboard = append(markup.InlineKeyboard, []telebot.InlineButton{
+			{Text: helpers.Cancel, Data: helpers.AggregateCallbackData(helpers.SongActionsState, 0, "")},
+		})
+
 		err := c.EditCaption(helpers.AddCallbackData("Выбери новую тональность:", user.State.CallbackData.String()),
-			&telebot.ReplyMarkup{
-				InlineKeyboard: [][]telebot.InlineButton{
-					{
-						{Text: "C | Am", Data: helpers.AggregateCallbackData(state, index+1, "C")},
-						{Text: "C# | A#m", Data: helpers.AggregateCallbackData(state, index+1, "C#")},
-						{Text: "Db | Bbm", Data: helpers.AggregateCallbackData(state, index+1, "Db")},
-					},
-					{
-						{Text: "D | Bm", Data: helpers.AggregateCallbackData(state, index+1, "D")},
-						{Text: "D# | Cm", Data: helpers.AggregateCallbackData(state, index+1, "D#")},
-						{Text: "Eb | Cm", Data: helpers.AggregateCallbackData(state, index+1, "Eb")},
-					},
-					{
-						{Text: "E | C#m", Data: helpers.AggregateCallbackData(state, index+1, "E")},
-					},
-					{
-						{Text: "F | Dm", Data: helpers.AggregateCallbackData(state, index+1, "F")},
-						{Text: "F# | D#m", Data: helpers.AggregateCallbackData(state, index+1, "F#")},
-						{Text: "Gb | Ebm", Data: helpers.AggregateCallbackData(state, index+1, "Gb")},
-					},
-					{
-						{Text: "G | Em", Data: helpers.AggregateCallbackData(state, index+1, "G")},
-						{Text: "G# | Fm", Data: helpers.AggregateCallbackData(state, index+1, "G#")},
-						{Text: "Ab | Fm", Data: helpers.AggregateCallbackData(state, index+1, "Ab")},
-					},
-					{
-						{Text: "A | F#m", Data: helpers.AggregateCallbackData(state, index+1, "A")},
-						{Text: "A# | Gm", Data: helpers.AggregateCallbackData(state, index+1, "A#")},
-						{Text: "Bb | Gm", Data: helpers.AggregateCallbackData(state, index+1, "Bb")},
-					},
-					{
-						{Text: "B | G#m", Data: helpers.AggregateCallbackData(state, index+1, "B")},
-					},
-					{
-						{Text: helpers.Cancel, Data: helpers.AggregateCallbackData(helpers.SongActionsState, 0, "")},
-					},
-				},
-			}, telebot.ModeHTML)
+			markup, telebot.ModeHTML)
 		if err != nil {
 			return err
 		}
@@ -1851,26 +1996,41 @@ func transposeSongHandler() (int, []HandlerFunc) {
 		markup := &telebot.ReplyMarkup{
 			InlineKeyboard: [][]telebot.InlineButton{
 				{
-					{Text: helpers.AppendSection, Data: helpers.AggregateCallbackData(state, index+1, "-1")},
+					{Text: helpers.TransposedPDF, Data: helpers.AggregateCallbackData(state, index+2, "pdf")},
+				},
+				{
+					{Text: helpers.TransposedText, Data: helpers.AggregateCallbackData(state, index+2, "text")},
 				},
 			},
 		}
 
-		sectionsNumber, err := h.driveFileService.GetSectionsNumber(user.State.CallbackData.Query().Get("driveFileId"))
-		if err != nil {
-			return err
-		}
-
-		for i := 0; i < sectionsNumber; i++ {
+		// Changing the doc needs the permission, sending it in the new key doesn't.
+		if user.Can(entities.EditSongs) {
 			markup.InlineKeyboard = append(markup.InlineKeyboard, []telebot.InlineButton{
-				{Text: fmt.Sprintf("Вместо %d-й секции", i+1), Data: helpers.AggregateCallbackData(state, index+1, fmt.Sprintf("%d", i))},
+				{Text: helpers.AppendSection, Data: helpers.AggregateCallbackData(state, index+1, "-1")},
 			})
+
+			sectionsNumber, err := h.driveFileService.GetSectionsNumber(user.State.CallbackData.Query().Get("driveFileId"))
+			if err != nil {
+				return err
+			}
+
+			for i := 0; i < sectionsNumber; i++ {
+				markup.InlineKeyboard = append(markup.InlineKeyboard, []telebot.InlineButton{
+					{Text: fmt.Sprintf("Вместо %d-й секции", i+1), Data: helpers.AggregateCallbackData(state, index+1, fmt.Sprintf("%d", i))},
+				})
+			}
 		}
 		markup.InlineKeyboard = append(markup.InlineKeyboard, []telebot.InlineButton{
 			{Text: helpers.Cancel, Data: helpers.AggregateCallbackData(helpers.SongActionsState, 0, "")},
 		})
 
-		c.EditCaption(helpers.AddCallbackData("Куда ты хочешь вставить новую тональность?", user.State.CallbackData.String()),
+		text := "Как отправить песню в новой тональности?"
+		if user.Can(entities.EditSongs) {
+			text = "Отправить песню в новой тональности или вставить её в документ?"
+		}
+
+		c.EditCaption(helpers.AddCallbackData(text, user.State.CallbackData.String()),
 			markup, telebot.ModeHTML)
 
 		return nil
@@ -1904,6 +2064,39 @@ func transposeSongHandler() (int, []HandlerFunc) {
 		return h.enterInlineHandler(c, user)
 	})
 
+	// Send the song in the new key without changing the doc.
+	handlerFunc = append(handlerFunc, func(h *Handler, c telebot.Context, user *entities.User) error {
+
+		_, _, format := helpers.ParseCallbackData(c.Callback().Data)
+
+		driveFileID := user.State.CallbackData.Query().Get("driveFileId")
+		key := user.State.CallbackData.Query().Get("key")
+
+		c.Notify(telebot.UploadingDocument)
+
+		if format == "text" {
+			sections, err := h.driveFileService.GetTransposedSections(driveFileID, key)
+			if err != nil {
+				return err
+			}
+
+			for _, section := range sections {
+				err = sendSectionText(h, c, section)
+				if err != nil {
+					return err
+				}
+			}
+		} else {
+			err := sendTransposedPDF(h, c, driveFileID, key)
+			if err != nil {
+				return err
+			}
+		}
+
+		c.Callback().Data = helpers.AggregateCallbackData(helpers.SongActionsState, 0, "")
+		return h.enterInlineHandler(c, user)
+	})
+
 	return helpers.TransposeSongState, handlerFunc
 }
 
@@ -1970,124 +2163,200 @@ func copySongHandler() (int, []HandlerFunc) {
 	return helpers.CopySongState, handlerFunc
 }
 
-func createSongHandler() (int, []HandlerFunc) {
-	handlerFunc := make([]HandlerFunc, 0)
+type createSongData struct {
+	Name   string `bson:"name"`
+	Lyrics string `bson:"lyrics,omitempty"`
+	Key    string `bson:"key,omitempty"`
+	BPM    string `bson:"bpm,omitempty"`
+	Time   string `bson:"time,omitempty"`
+}
 
-	handlerFunc = append(handlerFunc, func(h *Handler, c telebot.Context, user *entities.User) error {
-		err := c.Send("Отправь название:", &telebot.ReplyMarkup{
-			ReplyKeyboard:  [][]telebot.ReplyButton{{{Text: helpers.Cancel}}},
-			ResizeKeyboard: true,
-		})
-		if err != nil {
-			return err
-		}
+// skippable returns the answer, or an empty string when the step is skipped.
+func skippable(c telebot.Context) string {
+	if c.Text() == helpers.Skip {
+		return ""
+	}
+	return c.Text()
+}
 
-		user.State.Index++
-		return nil
-	})
+var createSongConversation = &Conversation{
+	State:   helpers.CreateSongState,
+	Data:    func() interface{} { return &createSongData{} },
+	Timeout: time.Hour,
+	Steps: []*Step{
+		{
+			Name: "name",
+			Ask: func(h *Handler, c telebot.Context, user *entities.User, flow *createSongData) error {
+				return c.Send("Отправь название:", &telebot.ReplyMarkup{
+					ReplyKeyboard:  [][]telebot.ReplyButton{{{Text: helpers.Cancel}}},
+					ResizeKeyboard: true,
+				})
+			},
+			Handle: func(h *Handler, c telebot.Context, user *entities.User, flow *createSongData) (string, error) {
+				flow.Name = c.Text()
+				return "lyrics", nil
+			},
+			Transitions: []string{"lyrics"},
+		},
+		{
+			Name: "lyrics",
+			Ask: func(h *Handler, c telebot.Context, user *entities.User, flow *createSongData) error {
+				return c.Send("Отправь слова:", &telebot.ReplyMarkup{
+					ReplyKeyboard:  helpers.CancelOrSkipKeyboard,
+					ResizeKeyboard: true,
+				})
+			},
+			Handle: func(h *Handler, c telebot.Context, user *entities.User, flow *createSongData) (string, error) {
+				flow.Lyrics = skippable(c)
+				return "key", nil
+			},
+			Transitions: []string{"key"},
+		},
+		{
+			Name: "key",
+			Ask: func(h *Handler, c telebot.Context, user *entities.User, flow *createSongData) error {
+				return c.Send("Выбери или отправь тональность:", &telebot.ReplyMarkup{
+					ReplyKeyboard:  append(helpers.KeysKeyboard, helpers.CancelOrSkipKeyboard...),
+					ResizeKeyboard: true,
+				})
+			},
+			Handle: func(h *Handler, c telebot.Context, user *entities.User, flow *createSongData) (string, error) {
+				flow.Key = skippable(c)
+				return "bpm", nil
+			},
+			Transitions: []string{"bpm"},
+		},
+		{
+			Name: "bpm",
+			Ask: func(h *Handler, c telebot.Context, user *entities.User, flow *createSongData) error {
+				return c.Send("Отправь темп:", &telebot.ReplyMarkup{
+					ReplyKeyboard:  helpers.CancelOrSkipKeyboard,
+					ResizeKeyboard: true,
+				})
+			},
+			Handle: func(h *Handler, c telebot.Context, user *entities.User, flow *createSongData) (string, error) {
+				flow.BPM = skippable(c)
+				return "time", nil
+			},
+			Transitions: []string{"time"},
+		},
+		{
+			Name: "time",
+			Ask: func(h *Handler, c telebot.Context, user *entities.User, flow *createSongData) error {
+				return c.Send("Выбери или отправь размер:", &telebot.ReplyMarkup{
+					ReplyKeyboard:  append(helpers.TimesKeyboard, helpers.CancelOrSkipKeyboard...),
+					ResizeKeyboard: true,
+				})
+			},
+			Handle: func(h *Handler, c telebot.Context, user *entities.User, flow *createSongData) (string, error) {
+				flow.Time = skippable(c)
 
-	handlerFunc = append(handlerFunc, func(h *Handler, c telebot.Context, user *entities.User) error {
-		user.State.Context.CreateSongPayload.Name = c.Text()
-		err := c.Send("Отправь слова:", &telebot.ReplyMarkup{
-			ReplyKeyboard:  helpers.CancelOrSkipKeyboard,
-			ResizeKeyboard: true,
-		})
-		if err != nil {
-			return err
-		}
+				c.Notify(telebot.UploadingDocument)
 
-		user.State.Index++
-		return nil
-	})
+				file := &drive.File{
+					Name:     flow.Name,
+					Parents:  []string{user.Band.DriveFolderID},
+					MimeType: "application/vnd.google-apps.document",
+				}
+				newFile, err := h.driveFileService.CreateOne(file, flow.Lyrics, flow.Key, flow.BPM, flow.Time)
+				if err != nil {
+					return "", err
+				}
 
-	handlerFunc = append(handlerFunc, func(h *Handler, c telebot.Context, user *entities.User) error {
-		switch c.Text() {
-		case helpers.Skip:
-		default:
-			user.State.Context.CreateSongPayload.Lyrics = c.Text()
-		}
+				newFile, err = h.driveFileService.StyleOne(newFile.Id)
+				if err != nil {
+					return "", err
+				}
 
-		err := c.Send("Выбери или отправь тональность:", &telebot.ReplyMarkup{
-			ReplyKeyboard:  append(helpers.KeysKeyboard, helpers.CancelOrSkipKeyboard...),
-			ResizeKeyboard: true,
-		})
-		if err != nil {
-			return err
-		}
+				h.announceSong(user.BandID, newFile.Id)
 
-		user.State.Index++
-		return nil
-	})
+				user.State = &entities.State{
+					Index: 0,
+					Name:  helpers.SongActionsState,
+					Context: entities.Context{
+						DriveFileID: newFile.Id,
+					},
+					Next: &entities.State{
+						Name: helpers.MainMenuState,
+					},
+				}
+
+				return End, h.enter(c, user)
+			},
+		},
+	},
+}
+
+func exportChordProHandler() (int, []HandlerFunc) {
+	handlerFunc := make([]HandlerFunc, 0)
 
 	handlerFunc = append(handlerFunc, func(h *Handler, c telebot.Context, user *entities.User) error {
-		switch c.Text() {
-		case helpers.Skip:
-		default:
-			user.State.Context.CreateSongPayload.Key = c.Text()
-		}
+		c.Notify(telebot.UploadingDocument)
 
-		err := c.Send("Отправь темп:", &telebot.ReplyMarkup{
-			ReplyKeyboard:  helpers.CancelOrSkipKeyboard,
-			ResizeKeyboard: true,
-		})
+		driveFileID := user.State.CallbackData.Query().Get("driveFileId")
+
+		driveFile, err := h.driveFileService.FindOneByID(driveFileID)
 		if err != nil {
 			return err
 		}
 
-		user.State.Index++
-		return nil
-	})
-
-	handlerFunc = append(handlerFunc, func(h *Handler, c telebot.Context, user *entities.User) error {
-		switch c.Text() {
-		case helpers.Skip:
-		default:
-			user.State.Context.CreateSongPayload.BPM = c.Text()
+		chordPro, err := h.driveFileService.ExportChordProByID(driveFileID)
+		if err != nil {
+			return err
 		}
 
-		err := c.Send("Выбери или отправь размер:", &telebot.ReplyMarkup{
-			ReplyKeyboard:  append(helpers.TimesKeyboard, helpers.CancelOrSkipKeyboard...),
-			ResizeKeyboard: true,
+		err = c.Send(&telebot.Document{
+			File:     telebot.FromReader(strings.NewReader(chordPro)),
+			MIME:     "text/plain",
+			FileName: fmt.Sprintf("%s.cho", driveFile.Name),
 		})
 		if err != nil {
 			return err
 		}
 
-		user.State.Index++
+		c.Respond()
 		return nil
 	})
 
+	return helpers.ExportChordProState, handlerFunc
+}
+
+func importChordProHandler() (int, []HandlerFunc) {
+	handlerFunc := make([]HandlerFunc, 0)
+
 	handlerFunc = append(handlerFunc, func(h *Handler, c telebot.Context, user *entities.User) error {
-		switch c.Text() {
-		case helpers.Skip:
-		default:
-			user.State.Context.CreateSongPayload.Time = c.Text()
+		document := c.Message().Document
+
+		if !isChordProFile(document.FileName) {
+			user.State = user.State.Prev
+			return c.Send("Я понимаю только файлы ChordPro: .cho, .chordpro, .chopro, .crd, .pro.")
 		}
 
 		c.Notify(telebot.UploadingDocument)
 
-		file := &drive.File{
-			Name:     user.State.Context.CreateSongPayload.Name,
-			Parents:  []string{user.Band.DriveFolderID},
-			MimeType: "application/vnd.google-apps.document",
+		reader, err := h.bot.File(&document.File)
+		if err != nil {
+			return err
 		}
-		newFile, err := h.driveFileService.CreateOne(
-			file,
-			user.State.Context.CreateSongPayload.Lyrics,
-			user.State.Context.CreateSongPayload.Key,
-			user.State.Context.CreateSongPayload.BPM,
-			user.State.Context.CreateSongPayload.Time,
-		)
+		defer reader.Close()
 
+		chordPro, err := ioutil.ReadAll(reader)
 		if err != nil {
 			return err
 		}
 
-		newFile, err = h.driveFileService.StyleOne(newFile.Id)
+		file := &drive.File{
+			Name:     strings.TrimSuffix(document.FileName, filepath.Ext(document.FileName)),
+			Parents:  []string{user.Band.DriveFolderID},
+			MimeType: "application/vnd.google-apps.document",
+		}
+		newFile, err := h.driveFileService.CreateOneFromChordPro(file, string(chordPro))
 		if err != nil {
 			return err
 		}
 
+		h.announceSong(user.BandID, newFile.Id)
+
 		user.State = &entities.State{
 			Index: 0,
 			Name:  helpers.SongActionsState,
@@ -2102,15 +2371,15 @@ func createSongHandler() (int, []HandlerFunc) {
 		return h.enter(c, user)
 	})
 
-	return helpers.CreateSongState, handlerFunc
+	return helpers.ImportChordProState, handlerFunc
 }
 
 func deleteSongHandler() (int, []HandlerFunc) {
 	handlerFunc := make([]HandlerFunc, 0)
 
 	handlerFunc = append(handlerFunc, func(h *Handler, c telebot.Context, user *entities.User) error {
-		if user.Role == helpers.Admin {
-			err := h.songService.DeleteOneByDriveFileID(user.State.CallbackData.Query().Get("driveFileId"))
+		if user.Can(entities.DeleteSongs) {
+			err := h.songService.DeleteOneByDriveFileID(user, user.State.CallbackData.Query().Get("driveFileId"))
 			if err != nil {
 				return err
 			}
@@ -2186,6 +2455,12 @@ func getVoicesHandler() (int, []HandlerFunc) {
 			},
 		}
 
+		// Media is edited with the bot, not the context, so the markup is signed here.
+		markup, err = h.signMarkup(user.ID, markup)
+		if err != nil {
+			return err
+		}
+
 		song, driveFile, err := h.songService.FindOrCreateOneByDriveFileID(user.State.CallbackData.Query().Get("driveFileId"))
 		getPerformer := func() string {
 			if driveFile != nil {
@@ -2214,7 +2489,7 @@ func getVoicesHandler() (int, []HandlerFunc) {
 					File:      telebot.FromReader(file),
 					Title:     voice.Name,
 					Performer: getPerformer(),
-					Caption:   helpers.AddCallbackData(getCaption(), user.State.CallbackData.String()),
+					Caption:   h.signText(user.ID, helpers.AddCallbackData(getCaption(), user.State.CallbackData.String())),
 				},
 				markup, telebot.ModeHTML)
 			if err != nil {
@@ -2229,7 +2504,7 @@ func getVoicesHandler() (int, []HandlerFunc) {
 					File:      telebot.File{FileID: voice.AudioFileID},
 					Title:     voice.Name,
 					Performer: getPerformer(),
-					Caption:   helpers.AddCallbackData(getCaption(), user.State.CallbackData.String()),
+					Caption:   h.signText(user.ID, helpers.AddCallbackData(getCaption(), user.State.CallbackData.String())),
 				},
 				markup, telebot.ModeHTML)
 		}
@@ -2472,3 +2747,1914 @@ func chunkAlbumBy(items telebot.Album, chunkSize int) (chunks []telebot.Album) {
 
 	return append(chunks, items)
 }
+
+func capoHandler() (int, []HandlerFunc) {
+	handlerFunc := make([]HandlerFunc, 0)
+
+	handlerFunc = append(handlerFunc, func(h *Handler, c telebot.Context, user *entities.User) error {
+
+		state, index, _ := helpers.ParseCallbackData(c.Callback().Data)
+
+		song, _, err := h.songService.FindOrCreateOneByDriveFileID(user.State.CallbackData.Query().Get("driveFileId"))
+		if err != nil {
+			return err
+		}
+
+		markup := &telebot.ReplyMarkup{}
+		if song.PDF.Key != "" && song.PDF.Key != "?" {
+			markup.InlineKeyboard = append(markup.InlineKeyboard, []telebot.InlineButton{
+				{Text: fmt.Sprintf("Как в документе (%s)", song.PDF.Key), Data: helpers.AggregateCallbackData(state, index+1, song.PDF.Key)},
+			})
+		}
+		markup.InlineKeyboard = append(markup.InlineKeyboard, helpers.GetKeysKeyboard(state, index+1)...)
+		markup.InlineKeyboard = append(markup.InlineKeyboard, []telebot.InlineButton{
+			{Text: helpers.Cancel, Data: helpers.AggregateCallbackData(helpers.SongActionsState, 0, "")},
+		})
+
+		return c.EditCaption(helpers.AddCallbackData("В какой тональности должна звучать песня?", user.State.CallbackData.String()),
+			markup, telebot.ModeHTML)
+	})
+
+	handlerFunc = append(handlerFunc, func(h *Handler, c telebot.Context, user *entities.User) error {
+
+		state, index, key := helpers.ParseCallbackData(c.Callback().Data)
+
+		q := user.State.CallbackData.Query()
+		q.Set("key", key)
+		user.State.CallbackData.RawQuery = q.Encode()
+
+		// Only frets on which the song can be played with open chords are offered.
+		positions, err := services.CapoPositions(key)
+		if err != nil {
+			return err
+		}
+
+		markup := &telebot.ReplyMarkup{}
+		for _, capo := range positions {
+			shapesKey, err := services.CapoShapesKey(key, capo)
+			if err != nil {
+				return err
+			}
+
+			markup.InlineKeyboard = append(markup.InlineKeyboard, []telebot.InlineButton{
+				{Text: fmt.Sprintf("%d лад: аккорды в %s", capo, shapesKey), Data: helpers.AggregateCallbackData(state, index+1, strconv.Itoa(capo))},
+			})
+		}
+		markup.InlineKeyboard = append(markup.InlineKeyboard, []telebot.InlineButton{
+			{Text: helpers.Cancel, Data: helpers.AggregateCallbackData(helpers.SongActionsState, 0, "")},
+		})
+
+		return c.EditCaption(helpers.AddCallbackData("На какой лад поставить каподастр?", user.State.CallbackData.String()),
+			markup, telebot.ModeHTML)
+	})
+
+	handlerFunc = append(handlerFunc, func(h *Handler, c telebot.Context, user *entities.User) error {
+
+		_, _, capoStr := helpers.ParseCallbackData(c.Callback().Data)
+		capo, _ := strconv.Atoi(capoStr)
+
+		c.Notify(telebot.UploadingDocument)
+
+		driveFileID := user.State.CallbackData.Query().Get("driveFileId")
+
+		driveFile, err := h.driveFileService.FindOneByID(driveFileID)
+		if err != nil {
+			return err
+		}
+
+		section, err := h.driveFileService.GetCapoSection(driveFileID, user.State.CallbackData.Query().Get("key"), capo)
+		if err != nil {
+			return err
+		}
+
+		err = sendSection(h, c, section, fmt.Sprintf("%s (capo %d).pdf", driveFile.Name, capo))
+		if err != nil {
+			return err
+		}
+
+		c.Callback().Data = helpers.AggregateCallbackData(helpers.SongActionsState, 0, "")
+		return h.enterInlineHandler(c, user)
+	})
+
+	return helpers.CapoState, handlerFunc
+}
+
+func nashvilleHandler() (int, []HandlerFunc) {
+	handlerFunc := make([]HandlerFunc, 0)
+
+	handlerFunc = append(handlerFunc, func(h *Handler, c telebot.Context, user *entities.User) error {
+		c.Notify(telebot.UploadingDocument)
+
+		driveFileID := user.State.CallbackData.Query().Get("driveFileId")
+
+		driveFile, err := h.driveFileService.FindOneByID(driveFileID)
+		if err != nil {
+			return err
+		}
+
+		section, err := h.driveFileService.GetNashvilleSection(driveFileID)
+		if err != nil {
+			return err
+		}
+
+		err = sendSection(h, c, section, fmt.Sprintf("%s (Nashville).pdf", driveFile.Name))
+		if err != nil {
+			return err
+		}
+
+		c.Respond()
+		return nil
+	})
+
+	return helpers.NashvilleState, handlerFunc
+}
+
+func setlistEntryHandler() (int, []HandlerFunc) {
+	handlerFuncs := make([]HandlerFunc, 0)
+
+	// Choose the song.
+	handlerFuncs = append(handlerFuncs, func(h *Handler, c telebot.Context, user *entities.User) error {
+
+		state, index, _ := helpers.ParseCallbackData(c.Callback().Data)
+
+		eventID, err := primitive.ObjectIDFromHex(user.State.CallbackData.Query().Get("eventId"))
+		if err != nil {
+			return err
+		}
+
+		songsStr, songs, err := h.eventService.GetSongsAsHTMLStringByID(eventID)
+		if err != nil {
+			return err
+		}
+
+		markup := &telebot.ReplyMarkup{}
+		for i, song := range songs {
+			markup.InlineKeyboard = append(markup.InlineKeyboard, []telebot.InlineButton{
+				{Text: fmt.Sprintf("%d. %s", i+1, song.PDF.Name), Data: helpers.AggregateCallbackData(state, index+1, song.ID.Hex())},
+			})
+		}
+		markup.InlineKeyboard = append(markup.InlineKeyboard, []telebot.InlineButton{
+			{Text: helpers.Back, Data: helpers.AggregateCallbackData(helpers.EventActionsState, 0, "")},
+		})
+
+		c.Edit(helpers.AddCallbackData(fmt.Sprintf("%s\nВыбери песню:", songsStr), user.State.CallbackData.String()),
+			markup, telebot.ModeHTML, telebot.NoPreview)
+		c.Respond()
+		return nil
+	})
+
+	// Show the entry.
+	handlerFuncs = append(handlerFuncs, func(h *Handler, c telebot.Context, user *entities.User) error {
+
+		state, _, songIDHex := helpers.ParseCallbackData(c.Callback().Data)
+
+		if songIDHex != "" {
+			q := user.State.CallbackData.Query()
+			q.Set("songId", songIDHex)
+			user.State.CallbackData.RawQuery = q.Encode()
+		}
+
+		event, song, err := findEventAndSong(h, user)
+		if err != nil {
+			return err
+		}
+
+		entry := event.SetlistEntry(song.ID)
+
+		str := fmt.Sprintf("<b>%s</b>\n\n%s: %s\n%s: %s", html.EscapeString(song.PDF.Name),
+			helpers.Key, event.SongKey(song), helpers.BPM, event.SongBPM(song))
+		if vocalist := event.Vocalist(entry); vocalist != nil && vocalist.User != nil {
+			str += fmt.Sprintf("\n%s: %s", helpers.Vocalist, html.EscapeString(vocalist.User.Name))
+		}
+		if entry.Note != "" {
+			str += fmt.Sprintf("\n%s: %s", helpers.Note, html.EscapeString(entry.Note))
+		}
+
+		markup := &telebot.ReplyMarkup{
+			InlineKeyboard: [][]telebot.InlineButton{
+				{
+					{Text: helpers.Key, Data: helpers.AggregateCallbackData(state, 2, "")},
+					{Text: helpers.BPM, Data: helpers.AggregateCallbackData(state, 4, "bpm")},
+				},
+				{
+					{Text: helpers.Vocalist, Data: helpers.AggregateCallbackData(state, 6, "")},
+					{Text: helpers.Note, Data: helpers.AggregateCallbackData(state, 4, "note")},
+				},
+				{
+					{Text: helpers.Reset, Data: helpers.AggregateCallbackData(state, 8, "")},
+				},
+				{
+					{Text: helpers.Back, Data: helpers.AggregateCallbackData(state, 0, "")},
+				},
+			},
+		}
+
+		c.Edit(helpers.AddCallbackData(str, user.State.CallbackData.String()), markup, telebot.ModeHTML, telebot.NoPreview)
+		c.Respond()
+		return nil
+	})
+
+	// Choose the key.
+	handlerFuncs = append(handlerFuncs, func(h *Handler, c telebot.Context, user *entities.User) error {
+
+		state, index, _ := helpers.ParseCallbackData(c.Callback().Data)
+
+		markup := &telebot.ReplyMarkup{}
+		markup.InlineKeyboard = append(markup.InlineKeyboard, []telebot.InlineButton{
+			{Text: helpers.AsInTheDoc, Data: helpers.AggregateCallbackData(state, index+1, "")},
+		})
+		markup.InlineKeyboard = append(markup.InlineKeyboard, helpers.GetKeysKeyboard(state, index+1)...)
+		markup.InlineKeyboard = append(markup.InlineKeyboard, []telebot.InlineButton{
+			{Text: helpers.Back, Data: helpers.AggregateCallbackData(state, 1, "")},
+		})
+
+		c.Edit(helpers.AddCallbackData("Выбери тональность:", user.State.CallbackData.String()), markup, telebot.ModeHTML)
+		c.Respond()
+		return nil
+	})
+
+	handlerFuncs = append(handlerFuncs, func(h *Handler, c telebot.Context, user *entities.User) error {
+
+		state, _, key := helpers.ParseCallbackData(c.Callback().Data)
+
+		event, song, err := findEventAndSong(h, user)
+		if err != nil {
+			return err
+		}
+
+		entry := event.SetlistEntry(song.ID)
+		entry.Key = key
+
+		_, err = h.eventService.UpdateSetlistEntry(user, event.ID, entry)
+		if err != nil {
+			return err
+		}
+
+		c.Callback().Data = helpers.AggregateCallbackData(state, 1, "")
+		return h.enterInlineHandler(c, user)
+	})
+
+	// Ask for the BPM or the note.
+	handlerFuncs = append(handlerFuncs, func(h *Handler, c telebot.Context, user *entities.User) error {
+
+		_, _, field := helpers.ParseCallbackData(c.Callback().Data)
+
+		event, song, err := findEventAndSong(h, user)
+		if err != nil {
+			return err
+		}
+
+		msg := fmt.Sprintf("Введи BPM для песни %s:", song.PDF.Name)
+		if field == "note" {
+			msg = fmt.Sprintf("Напиши заметку к песне %s, например, «без бриджа»:", song.PDF.Name)
+		}
+
+		err = c.Send(msg, &telebot.ReplyMarkup{
+			ReplyKeyboard:  [][]telebot.ReplyButton{{{Text: helpers.Cancel}}},
+			ResizeKeyboard: true,
+		})
+		if err != nil {
+			return err
+		}
+		c.Respond()
+
+		user.State = &entities.State{
+			Index: 5,
+			Name:  helpers.SetlistEntryState,
+			Context: entities.Context{
+				EventID:   event.ID,
+				Query:     song.ID.Hex(),
+				QueryType: field,
+			},
+			Prev: &entities.State{
+				Name: helpers.EventActionsState,
+				Context: entities.Context{
+					EventID: event.ID,
+				},
+				Next: &entities.State{
+					Name: helpers.GetEventsState,
+				},
+			},
+		}
+		return nil
+	})
+
+	handlerFuncs = append(handlerFuncs, func(h *Handler, c telebot.Context, user *entities.User) error {
+
+		event, err := h.eventService.FindOneByID(user.State.Context.EventID)
+		if err != nil {
+			return err
+		}
+
+		songID, err := primitive.ObjectIDFromHex(user.State.Context.Query)
+		if err != nil {
+			return err
+		}
+
+		entry := event.SetlistEntry(songID)
+		if user.State.Context.QueryType == "note" {
+			entry.Note = strings.TrimSpace(c.Text())
+		} else {
+			bpm := strings.TrimSpace(c.Text())
+			if n, err := strconv.Atoi(bpm); err != nil || n <= 0 {
+				return c.Send("BPM должен быть числом, например, 120. Попробуй еще раз.")
+			}
+			entry.BPM = bpm
+		}
+
+		_, err = h.eventService.UpdateSetlistEntry(user, event.ID, entry)
+		if err != nil {
+			return err
+		}
+
+		user.State = user.State.Prev
+		return h.enter(c, user)
+	})
+
+	// Choose the vocalist.
+	handlerFuncs = append(handlerFuncs, func(h *Handler, c telebot.Context, user *entities.User) error {
+
+		state, index, _ := helpers.ParseCallbackData(c.Callback().Data)
+
+		event, _, err := findEventAndSong(h, user)
+		if err != nil {
+			return err
+		}
+
+		markup := &telebot.ReplyMarkup{}
+		for _, membership := range event.Memberships {
+			if membership.User == nil {
+				continue
+			}
+
+			text := membership.User.Name
+			if membership.Role != nil {
+				text = fmt.Sprintf("%s (%s)", membership.User.Name, membership.Role.Name)
+			}
+
+			markup.InlineKeyboard = append(markup.InlineKeyboard, []telebot.InlineButton{
+				{Text: text, Data: helpers.AggregateCallbackData(state, index+1, membership.ID.Hex())},
+			})
+		}
+		markup.InlineKeyboard = append(markup.InlineKeyboard, []telebot.InlineButton{
+			{Text: helpers.NoVocalist, Data: helpers.AggregateCallbackData(state, index+1, "")},
+		})
+		markup.InlineKeyboard = append(markup.InlineKeyboard, []telebot.InlineButton{
+			{Text: helpers.Back, Data: helpers.AggregateCallbackData(state, 1, "")},
+		})
+
+		c.Edit(helpers.AddCallbackData("Кто поет эту песню?", user.State.CallbackData.String()), markup, telebot.ModeHTML)
+		c.Respond()
+		return nil
+	})
+
+	handlerFuncs = append(handlerFuncs, func(h *Handler, c telebot.Context, user *entities.User) error {
+
+		state, _, membershipIDHex := helpers.ParseCallbackData(c.Callback().Data)
+
+		event, song, err := findEventAndSong(h, user)
+		if err != nil {
+			return err
+		}
+
+		// Empty payload means no vocalist.
+		membershipID, _ := primitive.ObjectIDFromHex(membershipIDHex)
+
+		entry := event.SetlistEntry(song.ID)
+		entry.MembershipID = membershipID
+
+		_, err = h.eventService.UpdateSetlistEntry(user, event.ID, entry)
+		if err != nil {
+			return err
+		}
+
+		c.Callback().Data = helpers.AggregateCallbackData(state, 1, "")
+		return h.enterInlineHandler(c, user)
+	})
+
+	// Reset the entry.
+	handlerFuncs = append(handlerFuncs, func(h *Handler, c telebot.Context, user *entities.User) error {
+
+		state, _, _ := helpers.ParseCallbackData(c.Callback().Data)
+
+		event, song, err := findEventAndSong(h, user)
+		if err != nil {
+			return err
+		}
+
+		_, err = h.eventService.UpdateSetlistEntry(user, event.ID, entities.SetlistEntry{SongID: song.ID})
+		if err != nil {
+			return err
+		}
+
+		c.Callback().Data = helpers.AggregateCallbackData(state, 1, "")
+		return h.enterInlineHandler(c, user)
+	})
+
+	return helpers.SetlistEntryState, handlerFuncs
+}
+
+func eventTemplatesHandler() (int, []HandlerFunc) {
+	handlerFuncs := make([]HandlerFunc, 0)
+
+	// List the templates.
+	handlerFuncs = append(handlerFuncs, func(h *Handler, c telebot.Context, user *entities.User) error {
+
+		templates, _ := h.templateService.FindManyByBandID(user.BandID)
+
+		markup := &telebot.ReplyMarkup{}
+		for _, template := range templates {
+			text := template.Name
+			if template.Recurrence != nil {
+				text = fmt.Sprintf("%s (%s)", template.Name, template.Recurrence.String())
+			}
+
+			markup.InlineKeyboard = append(markup.InlineKeyboard, []telebot.InlineButton{
+				{Text: text, Data: helpers.AggregateCallbackData(helpers.EventTemplatesState, 3, template.ID.Hex())},
+			})
+		}
+		markup.InlineKeyboard = append(markup.InlineKeyboard, []telebot.InlineButton{
+			{Text: helpers.CreateTemplate, Data: helpers.AggregateCallbackData(helpers.EventTemplatesState, 1, "")},
+		})
+
+		msg := "Шаблоны собраний. Собрания шаблона с повторением создаются автоматически на несколько недель вперед:"
+
+		if c.Callback() != nil {
+			c.Edit(msg, markup)
+			c.Respond()
+			return nil
+		}
+
+		err := c.Send(helpers.Templates, &telebot.ReplyMarkup{
+			ReplyKeyboard:  [][]telebot.ReplyButton{{{Text: helpers.Back}}},
+			ResizeKeyboard: true,
+		})
+		if err != nil {
+			return err
+		}
+
+		return c.Send(msg, markup)
+	})
+
+	// Ask for the name.
+	handlerFuncs = append(handlerFuncs, func(h *Handler, c telebot.Context, user *entities.User) error {
+
+		_, _, payload := helpers.ParseCallbackData(c.Callback().Data)
+
+		templateID := ""
+		if payload == "rename" {
+			templateID = user.State.CallbackData.Query().Get("templateId")
+		}
+
+		err := c.Send("Введи название собраний этого шаблона:", &telebot.ReplyMarkup{
+			ReplyKeyboard:  [][]telebot.ReplyButton{{{Text: helpers.Cancel}}},
+			ResizeKeyboard: true,
+		})
+		if err != nil {
+			return err
+		}
+		c.Respond()
+
+		user.State = &entities.State{
+			Index: 2,
+			Name:  helpers.EventTemplatesState,
+			Context: entities.Context{
+				Map: map[string]string{"templateId": templateID},
+			},
+			Prev: &entities.State{
+				Name: helpers.EventTemplatesState,
+				Prev: &entities.State{
+					Name: helpers.GetEventsState,
+				},
+			},
+		}
+		return nil
+	})
+
+	handlerFuncs = append(handlerFuncs, func(h *Handler, c telebot.Context, user *entities.User) error {
+
+		name := strings.TrimSpace(c.Text())
+
+		var template *entities.EventTemplate
+		templateID, err := primitive.ObjectIDFromHex(user.State.Context.Map["templateId"])
+		if err == nil {
+			template, err = h.templateService.FindOneByID(templateID)
+			if err != nil {
+				return err
+			}
+
+			template.Name = name
+			template, err = h.templateService.UpdateSeries(user, *template, time.Now())
+		} else {
+			template, err = h.templateService.UpdateOne(user, entities.EventTemplate{
+				BandID: user.BandID,
+				Name:   name,
+			})
+		}
+		if err != nil {
+			return err
+		}
+
+		user.State = user.State.Prev
+		err = c.Send("Сохранено.", &telebot.ReplyMarkup{
+			ReplyKeyboard:  [][]telebot.ReplyButton{{{Text: helpers.Back}}},
+			ResizeKeyboard: true,
+		})
+		if err != nil {
+			return err
+		}
+
+		return sendTemplate(h, c, user, template)
+	})
+
+	// Show the template.
+	handlerFuncs = append(handlerFuncs, func(h *Handler, c telebot.Context, user *entities.User) error {
+
+		_, _, templateIDHex := helpers.ParseCallbackData(c.Callback().Data)
+
+		if templateIDHex != "" {
+			q := user.State.CallbackData.Query()
+			q.Set("templateId", templateIDHex)
+			user.State.CallbackData.RawQuery = q.Encode()
+		}
+
+		template, err := findTemplate(h, user)
+		if err != nil {
+			return err
+		}
+
+		return sendTemplate(h, c, user, template)
+	})
+
+	// Choose the week of the recurrence.
+	handlerFuncs = append(handlerFuncs, func(h *Handler, c telebot.Context, user *entities.User) error {
+
+		state, index, _ := helpers.ParseCallbackData(c.Callback().Data)
+
+		markup := &telebot.ReplyMarkup{
+			InlineKeyboard: [][]telebot.InlineButton{
+				{{Text: "Каждую неделю", Data: helpers.AggregateCallbackData(state, index+1, "0")}},
+				{
+					{Text: "1-я", Data: helpers.AggregateCallbackData(state, index+1, "1")},
+					{Text: "2-я", Data: helpers.AggregateCallbackData(state, index+1, "2")},
+					{Text: "3-я", Data: helpers.AggregateCallbackData(state, index+1, "3")},
+					{Text: "4-я", Data: helpers.AggregateCallbackData(state, index+1, "4")},
+					{Text: "Последняя", Data: helpers.AggregateCallbackData(state, index+1, "-1")},
+				},
+				{{Text: helpers.NoRecurrence, Data: helpers.AggregateCallbackData(state, index+1, "none")}},
+				{{Text: helpers.Back, Data: helpers.AggregateCallbackData(state, 3, "")}},
+			},
+		}
+
+		c.Edit(helpers.AddCallbackData("Как часто проходят эти собрания? Выбери неделю месяца:", user.State.CallbackData.String()), markup, telebot.ModeHTML)
+		c.Respond()
+		return nil
+	})
+
+	// Choose the weekday.
+	handlerFuncs = append(handlerFuncs, func(h *Handler, c telebot.Context, user *entities.User) error {
+
+		state, index, week := helpers.ParseCallbackData(c.Callback().Data)
+
+		if week == "none" {
+			template, err := findTemplate(h, user)
+			if err != nil {
+				return err
+			}
+
+			// Already created events are kept.
+			template.Recurrence = nil
+			template, err = h.templateService.UpdateSeries(user, *template, time.Now())
+			if err != nil {
+				return err
+			}
+
+			return sendTemplate(h, c, user, template)
+		}
+
+		markup := &telebot.ReplyMarkup{}
+		// 2006-01-02 is Monday.
+		for d := time.Date(2006, 1, 2, 0, 0, 0, 0, time.UTC); d.Day() < 9; d = d.AddDate(0, 0, 1) {
+			if len(markup.InlineKeyboard) == 0 || len(markup.InlineKeyboard[len(markup.InlineKeyboard)-1]) == 4 {
+				markup.InlineKeyboard = append(markup.InlineKeyboard, []telebot.InlineButton{})
+			}
+			markup.InlineKeyboard[len(markup.InlineKeyboard)-1] = append(markup.InlineKeyboard[len(markup.InlineKeyboard)-1], telebot.InlineButton{
+				Text: lctime.Strftime("%a", d),
+				Data: helpers.AggregateCallbackData(state, index+1, fmt.Sprintf("%s:%d", week, d.Weekday())),
+			})
+		}
+		markup.InlineKeyboard = append(markup.InlineKeyboard, []telebot.InlineButton{
+			{Text: helpers.Back, Data: helpers.AggregateCallbackData(state, 4, "")},
+		})
+
+		c.Edit(helpers.AddCallbackData("Выбери день недели:", user.State.CallbackData.String()), markup, telebot.ModeHTML)
+		c.Respond()
+		return nil
+	})
+
+	// Ask for the time.
+	handlerFuncs = append(handlerFuncs, func(h *Handler, c telebot.Context, user *entities.User) error {
+
+		_, _, payload := helpers.ParseCallbackData(c.Callback().Data)
+
+		parsedPayload := strings.Split(payload, ":")
+		if len(parsedPayload) < 2 {
+			return fmt.Errorf("wrong recurrence payload %s", payload)
+		}
+
+		err := c.Send("Во сколько начинаются собрания? Например, 10:00:", &telebot.ReplyMarkup{
+			ReplyKeyboard:  [][]telebot.ReplyButton{{{Text: helpers.Cancel}}},
+			ResizeKeyboard: true,
+		})
+		if err != nil {
+			return err
+		}
+		c.Respond()
+
+		user.State = &entities.State{
+			Index: 7,
+			Name:  helpers.EventTemplatesState,
+			Context: entities.Context{
+				Map: map[string]string{
+					"templateId": user.State.CallbackData.Query().Get("templateId"),
+					"week":       parsedPayload[0],
+					"weekday":    parsedPayload[1],
+				},
+			},
+			Prev: &entities.State{
+				Name: helpers.EventTemplatesState,
+				Prev: &entities.State{
+					Name: helpers.GetEventsState,
+				},
+			},
+		}
+		return nil
+	})
+
+	handlerFuncs = append(handlerFuncs, func(h *Handler, c telebot.Context, user *entities.User) error {
+
+		startTime, err := time.Parse("15:04", strings.TrimSpace(c.Text()))
+		if err != nil {
+			return c.Send("Не понял время. Напиши его в формате 10:00:")
+		}
+
+		templateID, err := primitive.ObjectIDFromHex(user.State.Context.Map["templateId"])
+		if err != nil {
+			return err
+		}
+
+		template, err := h.templateService.FindOneByID(templateID)
+		if err != nil {
+			return err
+		}
+
+		week, _ := strconv.Atoi(user.State.Context.Map["week"])
+		weekday, _ := strconv.Atoi(user.State.Context.Map["weekday"])
+
+		template.Recurrence = &entities.Recurrence{
+			Weekday: time.Weekday(weekday),
+			Week:    week,
+			Hour:    startTime.Hour(),
+			Minute:  startTime.Minute(),
+		}
+
+		template, err = h.templateService.UpdateSeries(user, *template, time.Now())
+		if err != nil {
+			return err
+		}
+
+		user.State = user.State.Prev
+		err = c.Send("Сохранено. Собрания созданы на несколько недель вперед.", &telebot.ReplyMarkup{
+			ReplyKeyboard:  [][]telebot.ReplyButton{{{Text: helpers.Back}}},
+			ResizeKeyboard: true,
+		})
+		if err != nil {
+			return err
+		}
+
+		return sendTemplate(h, c, user, template)
+	})
+
+	// Choose the role of the new slot.
+	handlerFuncs = append(handlerFuncs, func(h *Handler, c telebot.Context, user *entities.User) error {
+
+		state, index, _ := helpers.ParseCallbackData(c.Callback().Data)
+
+		markup := &telebot.ReplyMarkup{}
+		for _, role := range user.Band.Roles {
+			markup.InlineKeyboard = append(markup.InlineKeyboard, []telebot.InlineButton{
+				{Text: role.Name, Data: helpers.AggregateCallbackData(state, index+1, role.ID.Hex())},
+			})
+		}
+		markup.InlineKeyboard = append(markup.InlineKeyboard, []telebot.InlineButton{
+			{Text: helpers.Back, Data: helpers.AggregateCallbackData(state, 3, "")},
+		})
+
+		c.Edit(helpers.AddCallbackData("Выбери роль:", user.State.CallbackData.String()), markup, telebot.ModeHTML)
+		c.Respond()
+		return nil
+	})
+
+	// Choose the default members of the role.
+	handlerFuncs = append(handlerFuncs, func(h *Handler, c telebot.Context, user *entities.User) error {
+
+		state, index, roleIDHex := helpers.ParseCallbackData(c.Callback().Data)
+
+		roleID, err := primitive.ObjectIDFromHex(roleIDHex)
+		if err != nil {
+			return err
+		}
+
+		template, err := findTemplate(h, user)
+		if err != nil {
+			return err
+		}
+
+		// The slot is added even without members: the role is needed anyway.
+		var slot *entities.TemplateSlot
+		for _, s := range template.Slots {
+			if s.RoleID == roleID {
+				slot = s
+			}
+		}
+		if slot == nil {
+			slot = &entities.TemplateSlot{RoleID: roleID}
+			template.Slots = append(template.Slots, slot)
+			template, err = h.templateService.UpdateOne(user, *template)
+			if err != nil {
+				return err
+			}
+		}
+
+		usersExtra, _ := h.userService.FindManyByBandIDAndRoleID(user.BandID, roleID)
+
+		markup := &telebot.ReplyMarkup{}
+		for _, userExtra := range usersExtra {
+			text := userExtra.User.Name
+			for _, userID := range slot.UserIDs {
+				if userID == userExtra.User.ID {
+					text = fmt.Sprintf("✅ %s", text)
+				}
+			}
+
+			markup.InlineKeyboard = append(markup.InlineKeyboard, []telebot.InlineButton{
+				{Text: text, Data: helpers.AggregateCallbackData(state, index+1, fmt.Sprintf("%s:%d", roleIDHex, userExtra.User.ID))},
+			})
+		}
+		markup.InlineKeyboard = append(markup.InlineKeyboard, []telebot.InlineButton{
+			{Text: helpers.Done, Data: helpers.AggregateCallbackData(state, 3, "")},
+		})
+
+		c.Edit(helpers.AddCallbackData("Кто обычно служит в этой роли? Они будут добавлены в новые собрания:", user.State.CallbackData.String()), markup, telebot.ModeHTML)
+		c.Respond()
+		return nil
+	})
+
+	handlerFuncs = append(handlerFuncs, func(h *Handler, c telebot.Context, user *entities.User) error {
+
+		state, _, payload := helpers.ParseCallbackData(c.Callback().Data)
+
+		parsedPayload := strings.Split(payload, ":")
+		if len(parsedPayload) < 2 {
+			return fmt.Errorf("wrong slot payload %s", payload)
+		}
+
+		roleID, err := primitive.ObjectIDFromHex(parsedPayload[0])
+		if err != nil {
+			return err
+		}
+
+		userID, err := strconv.ParseInt(parsedPayload[1], 10, 0)
+		if err != nil {
+			return err
+		}
+
+		template, err := findTemplate(h, user)
+		if err != nil {
+			return err
+		}
+
+		for _, slot := range template.Slots {
+			if slot.RoleID != roleID {
+				continue
+			}
+
+			userIDs := make([]int64, 0)
+			for _, ID := range slot.UserIDs {
+				if ID != userID {
+					userIDs = append(userIDs, ID)
+				}
+			}
+			if len(userIDs) == len(slot.UserIDs) {
+				userIDs = append(userIDs, userID)
+			}
+			slot.UserIDs = userIDs
+		}
+
+		_, err = h.templateService.UpdateOne(user, *template)
+		if err != nil {
+			return err
+		}
+
+		c.Callback().Data = helpers.AggregateCallbackData(state, 9, parsedPayload[0])
+		return h.enterInlineHandler(c, user)
+	})
+
+	// Delete a slot.
+	handlerFuncs = append(handlerFuncs, func(h *Handler, c telebot.Context, user *entities.User) error {
+
+		state, index, _ := helpers.ParseCallbackData(c.Callback().Data)
+
+		template, err := findTemplate(h, user)
+		if err != nil {
+			return err
+		}
+
+		markup := &telebot.ReplyMarkup{}
+		for _, slot := range template.Slots {
+			for _, role := range user.Band.Roles {
+				if role.ID == slot.RoleID {
+					markup.InlineKeyboard = append(markup.InlineKeyboard, []telebot.InlineButton{
+						{Text: role.Name, Data: helpers.AggregateCallbackData(state, index+1, role.ID.Hex())},
+					})
+				}
+			}
+		}
+		markup.InlineKeyboard = append(markup.InlineKeyboard, []telebot.InlineButton{
+			{Text: helpers.Back, Data: helpers.AggregateCallbackData(state, 3, "")},
+		})
+
+		c.Edit(helpers.AddCallbackData("Какую роль удалить из шаблона?", user.State.CallbackData.String()), markup, telebot.ModeHTML)
+		c.Respond()
+		return nil
+	})
+
+	handlerFuncs = append(handlerFuncs, func(h *Handler, c telebot.Context, user *entities.User) error {
+
+		_, _, roleIDHex := helpers.ParseCallbackData(c.Callback().Data)
+
+		template, err := findTemplate(h, user)
+		if err != nil {
+			return err
+		}
+
+		slots := make([]*entities.TemplateSlot, 0)
+		for _, slot := range template.Slots {
+			if slot.RoleID.Hex() != roleIDHex {
+				slots = append(slots, slot)
+			}
+		}
+		template.Slots = slots
+
+		template, err = h.templateService.UpdateOne(user, *template)
+		if err != nil {
+			return err
+		}
+
+		return sendTemplate(h, c, user, template)
+	})
+
+	// Create an event from the template.
+	handlerFuncs = append(handlerFuncs, func(h *Handler, c telebot.Context, user *entities.User) error {
+
+		state, index, monthFirstDateStr := helpers.ParseCallbackData(c.Callback().Data)
+
+		now := time.Now()
+		monthFirstDayDate, err := time.Parse(time.RFC3339, monthFirstDateStr)
+		if err != nil {
+			monthFirstDayDate = time.Date(now.Year(), now.Month(), 1, 0, 0, 0, 0, now.Location())
+		}
+		monthLastDayDate := monthFirstDayDate.AddDate(0, 1, -1)
+
+		markup := GetCalendarMarkup(state, index, index+1, now, monthFirstDayDate, monthLastDayDate)
+		markup.InlineKeyboard = append(markup.InlineKeyboard, []telebot.InlineButton{
+			{Text: helpers.Back, Data: helpers.AggregateCallbackData(state, 3, "")},
+		})
+
+		msg := fmt.Sprintf("Выбери дату:\n\n<b>%s</b>", lctime.Strftime("%B %Y", monthFirstDayDate))
+		c.Edit(helpers.AddCallbackData(msg, user.State.CallbackData.String()), markup, telebot.ModeHTML)
+		c.Respond()
+		return nil
+	})
+
+	handlerFuncs = append(handlerFuncs, func(h *Handler, c telebot.Context, user *entities.User) error {
+
+		_, _, dateStr := helpers.ParseCallbackData(c.Callback().Data)
+
+		date, err := time.Parse(time.RFC3339, dateStr)
+		if err != nil {
+			return err
+		}
+
+		template, err := findTemplate(h, user)
+		if err != nil {
+			return err
+		}
+
+		eventTime := time.Date(date.Year(), date.Month(), date.Day(), 0, 0, 0, 0, date.Location())
+		if template.Recurrence != nil {
+			eventTime = eventTime.Add(time.Duration(template.Recurrence.Hour)*time.Hour + time.Duration(template.Recurrence.Minute)*time.Minute)
+		}
+
+		event, err := h.templateService.CreateEvent(user, template, eventTime)
+		if err != nil {
+			return err
+		}
+
+		h.announceEvent(event)
+
+		c.Callback().Data = helpers.AggregateCallbackData(helpers.EventActionsState, 0, "")
+		q := user.State.CallbackData.Query()
+		q.Set("eventId", event.ID.Hex())
+		user.State.CallbackData.RawQuery = q.Encode()
+
+		return h.enterInlineHandler(c, user)
+	})
+
+	// Delete the template with the future events of the series.
+	handlerFuncs = append(handlerFuncs, func(h *Handler, c telebot.Context, user *entities.User) error {
+
+		state, index, _ := helpers.ParseCallbackData(c.Callback().Data)
+
+		markup := &telebot.ReplyMarkup{
+			InlineKeyboard: [][]telebot.InlineButton{
+				{
+					{Text: helpers.No, Data: helpers.AggregateCallbackData(state, 3, "")},
+					{Text: helpers.Yes, Data: helpers.AggregateCallbackData(state, index+1, "")},
+				},
+			},
+		}
+
+		c.Edit(helpers.AddCallbackData("Удалить шаблон? Все будущие собрания этой серии тоже будут удалены, прошедшие останутся.", user.State.CallbackData.String()), markup, telebot.ModeHTML)
+		c.Respond()
+		return nil
+	})
+
+	handlerFuncs = append(handlerFuncs, func(h *Handler, c telebot.Context, user *entities.User) error {
+
+		state, _, _ := helpers.ParseCallbackData(c.Callback().Data)
+
+		templateID, err := primitive.ObjectIDFromHex(user.State.CallbackData.Query().Get("templateId"))
+		if err != nil {
+			return err
+		}
+
+		err = h.templateService.DeleteSeries(user, templateID, time.Now())
+		if err != nil {
+			return err
+		}
+
+		c.Callback().Data = helpers.AggregateCallbackData(state, 0, "")
+		return h.enterInlineHandler(c, user)
+	})
+
+	return helpers.EventTemplatesState, handlerFuncs
+}
+
+func availabilityHandler() (int, []HandlerFunc) {
+	handlerFuncs := make([]HandlerFunc, 0)
+
+	// List the blackouts.
+	handlerFuncs = append(handlerFuncs, func(h *Handler, c telebot.Context, user *entities.User) error {
+
+		msg := "Даты, когда ты не можешь служить. Нажми на даты, чтобы удалить их:"
+		if len(user.Blackouts) == 0 {
+			msg = "Добавь даты, когда ты не можешь служить, например, отпуск. Админы увидят это, когда будут составлять расписание."
+		}
+
+		markup := &telebot.ReplyMarkup{}
+		for i, blackout := range user.Blackouts {
+			markup.InlineKeyboard = append(markup.InlineKeyboard, []telebot.InlineButton{
+				{Text: fmt.Sprintf("🗑 %s", blackout.String()), Data: helpers.AggregateCallbackData(helpers.AvailabilityState, 5, strconv.Itoa(i))},
+			})
+		}
+		markup.InlineKeyboard = append(markup.InlineKeyboard, []telebot.InlineButton{
+			{Text: helpers.AddBlackout, Data: helpers.AggregateCallbackData(helpers.AvailabilityState, 1, "")},
+		})
+
+		if c.Callback() != nil {
+			c.Edit(msg, markup)
+			c.Respond()
+			return nil
+		}
+
+		return c.Send(msg, markup)
+	})
+
+	// Choose the first day.
+	handlerFuncs = append(handlerFuncs, func(h *Handler, c telebot.Context, user *entities.User) error {
+		return sendRangeCalendar(c, user, helpers.AvailabilityState, "С какого числа?", 1, 2)
+	})
+
+	// Choose the last day.
+	handlerFuncs = append(handlerFuncs, func(h *Handler, c telebot.Context, user *entities.User) error {
+
+		_, _, from := helpers.ParseCallbackData(c.Callback().Data)
+
+		q := user.State.CallbackData.Query()
+		q.Set("from", from)
+		user.State.CallbackData.RawQuery = q.Encode()
+
+		c.Callback().Data = helpers.AggregateCallbackData(helpers.AvailabilityState, 3, from)
+		return h.enterInlineHandler(c, user)
+	})
+
+	handlerFuncs = append(handlerFuncs, func(h *Handler, c telebot.Context, user *entities.User) error {
+		return sendRangeCalendar(c, user, helpers.AvailabilityState, "По какое число? Если это один день, выбери его еще раз.", 3, 4)
+	})
+
+	handlerFuncs = append(handlerFuncs, func(h *Handler, c telebot.Context, user *entities.User) error {
+
+		_, _, to := helpers.ParseCallbackData(c.Callback().Data)
+
+		fromDate, err := time.Parse(time.RFC3339, user.State.CallbackData.Query().Get("from"))
+		if err != nil {
+			return err
+		}
+
+		toDate, err := time.Parse(time.RFC3339, to)
+		if err != nil {
+			return err
+		}
+
+		if toDate.Before(fromDate) {
+			fromDate, toDate = toDate, fromDate
+		}
+
+		user.Blackouts = append(user.Blackouts, &entities.Blackout{
+			From: time.Date(fromDate.Year(), fromDate.Month(), fromDate.Day(), 0, 0, 0, 0, time.Local),
+			To:   time.Date(toDate.Year(), toDate.Month(), toDate.Day(), 0, 0, 0, 0, time.Local),
+		})
+
+		// Past blackouts don't matter anymore.
+		blackouts := make([]*entities.Blackout, 0)
+		for _, blackout := range user.Blackouts {
+			if !blackout.To.AddDate(0, 0, 1).Before(time.Now()) {
+				blackouts = append(blackouts, blackout)
+			}
+		}
+		sort.SliceStable(blackouts, func(i, j int) bool {
+			return blackouts[i].From.Before(blackouts[j].From)
+		})
+		user.Blackouts = blackouts
+
+		c.Callback().Data = helpers.AggregateCallbackData(helpers.AvailabilityState, 0, "")
+		return h.enterInlineHandler(c, user)
+	})
+
+	// Delete the blackout.
+	handlerFuncs = append(handlerFuncs, func(h *Handler, c telebot.Context, user *entities.User) error {
+
+		_, _, indexStr := helpers.ParseCallbackData(c.Callback().Data)
+
+		i, err := strconv.Atoi(indexStr)
+		if err == nil && i >= 0 && i < len(user.Blackouts) {
+			user.Blackouts = append(user.Blackouts[:i], user.Blackouts[i+1:]...)
+		}
+
+		c.Callback().Data = helpers.AggregateCallbackData(helpers.AvailabilityState, 0, "")
+		return h.enterInlineHandler(c, user)
+	})
+
+	return helpers.AvailabilityState, handlerFuncs
+}
+
+func membershipStatusHandler() (int, []HandlerFunc) {
+	handlerFuncs := make([]HandlerFunc, 0)
+
+	answer := func(status string) HandlerFunc {
+		return func(h *Handler, c telebot.Context, user *entities.User) error {
+
+			_, _, membershipIDHex := helpers.ParseCallbackData(c.Callback().Data)
+
+			membership, event, err := findMembershipAndEvent(h, membershipIDHex)
+			if err != nil || membership.UserID != user.ID {
+				return c.Respond(&telebot.CallbackResponse{Text: "Тебя уже нет в этом собрании.", ShowAlert: true})
+			}
+
+			membership, err = h.membershipService.UpdateStatus(user, membership.ID, status)
+			if err != nil {
+				return err
+			}
+
+			event, err = h.eventService.FindOneByID(event.ID)
+			if err != nil {
+				return err
+			}
+
+			msg := "Спасибо, ждем тебя!"
+			if status == entities.Declined {
+				msg = "Понятно, админы найдут замену."
+			}
+
+			c.Edit(fmt.Sprintf("%s\n\n%s", h.eventService.ToHtmlStringByEvent(*event), msg), telebot.ModeHTML, telebot.NoPreview)
+			c.Respond()
+
+			if status == entities.Declined {
+				return notifyAdminsAboutDecline(h, event, membership)
+			}
+			return nil
+		}
+	}
+
+	handlerFuncs = append(handlerFuncs, answer(entities.Accepted))
+	handlerFuncs = append(handlerFuncs, answer(entities.Declined))
+
+	// Replace the member who declined.
+	handlerFuncs = append(handlerFuncs, func(h *Handler, c telebot.Context, user *entities.User) error {
+
+		_, _, payload := helpers.ParseCallbackData(c.Callback().Data)
+
+		parsedPayload := strings.Split(payload, ":")
+		if len(parsedPayload) < 2 {
+			return fmt.Errorf("wrong replacement payload %s", payload)
+		}
+
+		userID, err := strconv.ParseInt(parsedPayload[1], 10, 0)
+		if err != nil {
+			return err
+		}
+
+		membership, event, err := findMembershipAndEvent(h, parsedPayload[0])
+		if err != nil || membership.Status != entities.Declined {
+			return c.Respond(&telebot.CallbackResponse{Text: "Замену уже нашли.", ShowAlert: true})
+		}
+
+		// The state isn't an event state, so the permission is checked here.
+		if h.permissionService.CheckEvent(user, event.ID, false) != nil {
+			return h.deny(c, user)
+		}
+
+		replacement, err := h.userService.FindOneByID(userID)
+		if err != nil || replacement.UserBand(event.BandID) == nil {
+			return c.Respond(&telebot.CallbackResponse{Text: "Этого человека уже нет в группе.", ShowAlert: true})
+		}
+
+		err = h.membershipService.DeleteOneByID(user, membership.ID)
+		if err != nil {
+			return err
+		}
+
+		newMembership, err := h.membershipService.UpdateOne(user, entities.Membership{
+			EventID: event.ID,
+			UserID:  userID,
+			RoleID:  membership.RoleID,
+		})
+		if err != nil {
+			return err
+		}
+
+		event, err = h.eventService.FindOneByID(event.ID)
+		if err != nil {
+			return err
+		}
+
+		for _, m := range event.Memberships {
+			if m.ID == newMembership.ID {
+				newMembership = m
+			}
+		}
+
+		err = h.sendNotification(event, newMembership)
+		if err != nil {
+			c.Respond(&telebot.CallbackResponse{Text: "Не получилось написать новому участнику, сообщи ему сам.", ShowAlert: true})
+		}
+
+		q := user.State.CallbackData.Query()
+		q.Set("eventId", event.ID.Hex())
+		user.State.CallbackData.RawQuery = q.Encode()
+
+		c.Edit(helpers.AddCallbackData(h.eventService.ToHtmlStringByEvent(*event), user.State.CallbackData.String()), &telebot.ReplyMarkup{
+			InlineKeyboard: helpers.GetEventActionsKeyboard(*user, *event),
+		}, telebot.ModeHTML, telebot.NoPreview)
+		c.Respond()
+		return nil
+	})
+
+	return helpers.MembershipStatusState, handlerFuncs
+}
+
+func rotaHandler() (int, []HandlerFunc) {
+	handlerFuncs := make([]HandlerFunc, 0)
+
+	// Choose the period.
+	handlerFuncs = append(handlerFuncs, func(h *Handler, c telebot.Context, user *entities.User) error {
+
+		state := helpers.RotaState
+
+		markup := &telebot.ReplyMarkup{
+			InlineKeyboard: [][]telebot.InlineButton{
+				{
+					{Text: "2 недели", Data: helpers.AggregateCallbackData(state, 5, "14")},
+					{Text: "4 недели", Data: helpers.AggregateCallbackData(state, 5, "28")},
+					{Text: "8 недель", Data: helpers.AggregateCallbackData(state, 5, "56")},
+				},
+				{
+					{Text: helpers.ChooseDates, Data: helpers.AggregateCallbackData(state, 1, "")},
+				},
+			},
+		}
+
+		msg := "За какой период составить расписание? Будут заполнены только пустые роли в уже созданных собраниях."
+
+		if c.Callback() != nil {
+			c.Edit(msg, markup)
+			c.Respond()
+			return nil
+		}
+
+		return c.Send(msg, markup)
+	})
+
+	handlerFuncs = append(handlerFuncs, func(h *Handler, c telebot.Context, user *entities.User) error {
+		return sendRangeCalendar(c, user, helpers.RotaState, "С какого числа?", 1, 2)
+	})
+
+	handlerFuncs = append(handlerFuncs, func(h *Handler, c telebot.Context, user *entities.User) error {
+
+		_, _, from := helpers.ParseCallbackData(c.Callback().Data)
+
+		q := user.State.CallbackData.Query()
+		q.Set("from", from)
+		user.State.CallbackData.RawQuery = q.Encode()
+
+		c.Callback().Data = helpers.AggregateCallbackData(helpers.RotaState, 3, from)
+		return h.enterInlineHandler(c, user)
+	})
+
+	handlerFuncs = append(handlerFuncs, func(h *Handler, c telebot.Context, user *entities.User) error {
+		return sendRangeCalendar(c, user, helpers.RotaState, "По какое число?", 3, 4)
+	})
+
+	handlerFuncs = append(handlerFuncs, func(h *Handler, c telebot.Context, user *entities.User) error {
+
+		_, _, to := helpers.ParseCallbackData(c.Callback().Data)
+
+		q := user.State.CallbackData.Query()
+		q.Set("to", to)
+		user.State.CallbackData.RawQuery = q.Encode()
+
+		c.Callback().Data = helpers.AggregateCallbackData(helpers.RotaState, 5, "")
+		return h.enterInlineHandler(c, user)
+	})
+
+	// Show the draft.
+	handlerFuncs = append(handlerFuncs, func(h *Handler, c telebot.Context, user *entities.User) error {
+
+		state, index, days := helpers.ParseCallbackData(c.Callback().Data)
+
+		if n, err := strconv.Atoi(days); err == nil {
+			now := time.Now()
+			today := time.Date(now.Year(), now.Month(), now.Day(), 0, 0, 0, 0, now.Location())
+
+			q := user.State.CallbackData.Query()
+			q.Set("from", today.Format(time.RFC3339))
+			q.Set("to", today.AddDate(0, 0, n-1).Format(time.RFC3339))
+			user.State.CallbackData.RawQuery = q.Encode()
+		}
+
+		slots, from, to, err := generateRota(h, user)
+		if err != nil {
+			return err
+		}
+
+		markup := &telebot.ReplyMarkup{}
+		if len(slots) > 0 {
+			markup.InlineKeyboard = append(markup.InlineKeyboard, []telebot.InlineButton{
+				{Text: helpers.Cancel, Data: helpers.AggregateCallbackData(state, 0, "")},
+				{Text: helpers.Approve, Data: helpers.AggregateCallbackData(state, index+1, services.RotaHash(slots))},
+			})
+		} else {
+			markup.InlineKeyboard = append(markup.InlineKeyboard, []telebot.InlineButton{
+				{Text: helpers.Back, Data: helpers.AggregateCallbackData(state, 0, "")},
+			})
+		}
+
+		c.Edit(helpers.AddCallbackData(rotaHTML(slots, from, to), user.State.CallbackData.String()), markup, telebot.ModeHTML)
+		c.Respond()
+		return nil
+	})
+
+	// Approve the draft.
+	handlerFuncs = append(handlerFuncs, func(h *Handler, c telebot.Context, user *entities.User) error {
+
+		state, index, hash := helpers.ParseCallbackData(c.Callback().Data)
+
+		slots, from, to, err := generateRota(h, user)
+		if err != nil {
+			return err
+		}
+
+		// Someone changed the events or the availability since the draft was shown.
+		if services.RotaHash(slots) != hash {
+			c.Callback().Data = helpers.AggregateCallbackData(state, index-1, "")
+			err := h.enterInlineHandler(c, user)
+			if err != nil {
+				return err
+			}
+			return c.Send("Пока черновик был открыт, собрания или доступность участников изменились. Проверь новый черновик.")
+		}
+
+		err = h.rotaService.Apply(user, slots)
+		if err != nil {
+			return err
+		}
+
+		c.Edit(fmt.Sprintf("%s\n\n✅ Расписание утверждено. Участники получат уведомления перед собраниями.", rotaHTML(slots, from, to)), telebot.ModeHTML)
+		c.Respond()
+		return nil
+	})
+
+	return helpers.RotaState, handlerFuncs
+}
+
+func invitesHandler() (int, []HandlerFunc) {
+	handlerFuncs := make([]HandlerFunc, 0)
+
+	// List the invites.
+	handlerFuncs = append(handlerFuncs, func(h *Handler, c telebot.Context, user *entities.User) error {
+		// Not found means there are no invites.
+		invites, _ := h.inviteService.FindManyValidByBandID(user.BandID, time.Now())
+
+		msg := "Отправь ссылку тому, кого хочешь пригласить в группу. По ней можно присоединиться без одобрения администраторов."
+		if len(invites) == 0 {
+			msg = "Приглашений пока нет. Создай ссылку и отправь ее тому, кого хочешь пригласить: по ней можно присоединиться без одобрения администраторов."
+		}
+
+		markup := &telebot.ReplyMarkup{}
+		for i, invite := range invites {
+			msg += fmt.Sprintf("\n\n%d. %s\nhttps://t.me/%s?start=%s", i+1, inviteString(invite), h.bot.Me.Username, invite.Token)
+
+			markup.InlineKeyboard = append(markup.InlineKeyboard, []telebot.InlineButton{
+				{Text: fmt.Sprintf("🗑 Отозвать %d", i+1), Data: helpers.AggregateCallbackData(helpers.InvitesState, 5, invite.ID.Hex())},
+			})
+		}
+		markup.InlineKeyboard = append(markup.InlineKeyboard, []telebot.InlineButton{
+			{Text: helpers.CreateInvite, Data: helpers.AggregateCallbackData(helpers.InvitesState, 1, "")},
+		})
+
+		if c.Callback() != nil {
+			c.Edit(msg, markup, telebot.NoPreview)
+			c.Respond()
+			return nil
+		}
+
+		return c.Send(msg, markup, telebot.NoPreview)
+	})
+
+	// Choose the role.
+	handlerFuncs = append(handlerFuncs, func(h *Handler, c telebot.Context, user *entities.User) error {
+		// Only admins make admins, others invite members right away.
+		if user.Role != helpers.Admin {
+			c.Callback().Data = helpers.AggregateCallbackData(helpers.InvitesState, 2, "member")
+			return h.enterInlineHandler(c, user)
+		}
+
+		markup := &telebot.ReplyMarkup{
+			InlineKeyboard: [][]telebot.InlineButton{
+				{
+					{Text: "Участник", Data: helpers.AggregateCallbackData(helpers.InvitesState, 2, "member")},
+					{Text: "Администратор", Data: helpers.AggregateCallbackData(helpers.InvitesState, 2, "admin")},
+				},
+				{{Text: helpers.Back, Data: helpers.AggregateCallbackData(helpers.InvitesState, 0, "")}},
+			},
+		}
+
+		c.Edit("Кем будет новый участник?", markup)
+		c.Respond()
+		return nil
+	})
+
+	// Choose the expiry.
+	handlerFuncs = append(handlerFuncs, func(h *Handler, c telebot.Context, user *entities.User) error {
+		_, _, role := helpers.ParseCallbackData(c.Callback().Data)
+
+		markup := &telebot.ReplyMarkup{}
+		for _, days := range []int{1, 7, 30} {
+			markup.InlineKeyboard = append(markup.InlineKeyboard, []telebot.InlineButton{
+				{Text: fmt.Sprintf("%d дн.", days), Data: helpers.AggregateCallbackData(helpers.InvitesState, 3, fmt.Sprintf("%s:%d", role, days))},
+			})
+		}
+		markup.InlineKeyboard = append(markup.InlineKeyboard, []telebot.InlineButton{
+			{Text: "Бессрочно", Data: helpers.AggregateCallbackData(helpers.InvitesState, 3, role+":0")},
+		})
+
+		c.Edit("Сколько будет действовать ссылка?", markup)
+		c.Respond()
+		return nil
+	})
+
+	// Choose the number of uses.
+	handlerFuncs = append(handlerFuncs, func(h *Handler, c telebot.Context, user *entities.User) error {
+		_, _, payload := helpers.ParseCallbackData(c.Callback().Data)
+
+		markup := &telebot.ReplyMarkup{}
+		for _, uses := range []int{1, 5, 20} {
+			markup.InlineKeyboard = append(markup.InlineKeyboard, []telebot.InlineButton{
+				{Text: strconv.Itoa(uses), Data: helpers.AggregateCallbackData(helpers.InvitesState, 4, fmt.Sprintf("%s:%d", payload, uses))},
+			})
+		}
+		markup.InlineKeyboard = append(markup.InlineKeyboard, []telebot.InlineButton{
+			{Text: "Без ограничений", Data: helpers.AggregateCallbackData(helpers.InvitesState, 4, payload+":0")},
+		})
+
+		c.Edit("Сколько человек смогут присоединиться по ссылке?", markup)
+		c.Respond()
+		return nil
+	})
+
+	// Create the invite.
+	handlerFuncs = append(handlerFuncs, func(h *Handler, c telebot.Context, user *entities.User) error {
+		_, _, payload := helpers.ParseCallbackData(c.Callback().Data)
+
+		parsedPayload := strings.Split(payload, ":")
+		if len(parsedPayload) < 3 {
+			return fmt.Errorf("wrong invite payload %s", payload)
+		}
+
+		role := ""
+		if parsedPayload[0] == "admin" {
+			if user.Role != helpers.Admin {
+				return h.deny(c, user)
+			}
+			role = helpers.Admin
+		}
+
+		days, err := strconv.Atoi(parsedPayload[1])
+		if err != nil {
+			return err
+		}
+
+		maxUses, err := strconv.Atoi(parsedPayload[2])
+		if err != nil {
+			return err
+		}
+
+		_, err = h.inviteService.Create(user.BandID, role, time.Duration(days)*24*time.Hour, maxUses, time.Now())
+		if err != nil {
+			return err
+		}
+
+		c.Callback().Data = helpers.AggregateCallbackData(helpers.InvitesState, 0, "")
+		return h.enterInlineHandler(c, user)
+	})
+
+	// Revoke the invite.
+	handlerFuncs = append(handlerFuncs, func(h *Handler, c telebot.Context, user *entities.User) error {
+		_, _, inviteIDHex := helpers.ParseCallbackData(c.Callback().Data)
+
+		invites, _ := h.inviteService.FindManyValidByBandID(user.BandID, time.Now())
+		for _, invite := range invites {
+			if invite.ID.Hex() == inviteIDHex {
+				err := h.inviteService.DeleteOneByID(invite.ID)
+				if err != nil {
+					return err
+				}
+			}
+		}
+
+		c.Callback().Data = helpers.AggregateCallbackData(helpers.InvitesState, 0, "")
+		return h.enterInlineHandler(c, user)
+	})
+
+	return helpers.InvitesState, handlerFuncs
+}
+
+func joinRequestHandler() (int, []HandlerFunc) {
+	handlerFuncs := make([]HandlerFunc, 0)
+
+	answer := func(approve bool) HandlerFunc {
+		return func(h *Handler, c telebot.Context, user *entities.User) error {
+
+			_, _, payload := helpers.ParseCallbackData(c.Callback().Data)
+
+			parsedPayload := strings.Split(payload, ":")
+			if len(parsedPayload) < 2 {
+				return fmt.Errorf("wrong join request payload %s", payload)
+			}
+
+			userID, err := strconv.ParseInt(parsedPayload[0], 10, 0)
+			if err != nil {
+				return err
+			}
+
+			bandID, err := primitive.ObjectIDFromHex(parsedPayload[1])
+			if err != nil {
+				return err
+			}
+
+			requester, err := h.userService.FindOneByID(userID)
+			if err != nil {
+				return err
+			}
+
+			band, err := h.bandService.FindOneByID(bandID)
+			if err != nil {
+				return err
+			}
+
+			if requester.UserBand(bandID) != nil {
+				c.Edit(fmt.Sprintf("%s\n\nУже в группе.", c.Callback().Message.Text))
+				return c.Respond()
+			}
+
+			if approve {
+				requester.JoinBand(bandID, "")
+				requester.State = &entities.State{Name: helpers.MainMenuState}
+				_, err = h.userService.UpdateOne(*requester)
+				if err != nil {
+					return err
+				}
+
+				h.bot.Send(telebot.ChatID(requester.ID), fmt.Sprintf("Запрос одобрен, теперь ты в группе %s.", band.Name), &telebot.ReplyMarkup{
+					ReplyKeyboard:  helpers.MainMenuKeyboard,
+					ResizeKeyboard: true,
+				})
+				c.Edit(fmt.Sprintf("%s\n\n✅ Одобрено: %s", c.Callback().Message.Text, user.Name))
+			} else {
+				h.bot.Send(telebot.ChatID(requester.ID), fmt.Sprintf("Запрос в группу %s отклонен.", band.Name))
+				c.Edit(fmt.Sprintf("%s\n\n❌ Отклонено: %s", c.Callback().Message.Text, user.Name))
+			}
+
+			return c.Respond()
+		}
+	}
+
+	handlerFuncs = append(handlerFuncs, answer(true))
+	handlerFuncs = append(handlerFuncs, answer(false))
+
+	return helpers.JoinRequestState, handlerFuncs
+}
+
+func permissionGroupsHandler() (int, []HandlerFunc) {
+	handlerFuncs := make([]HandlerFunc, 0)
+
+	// List the groups.
+	handlerFuncs = append(handlerFuncs, func(h *Handler, c telebot.Context, user *entities.User) error {
+		// Not found means there are no groups.
+		groups, _ := h.permissionService.FindManyGroupsByBandID(user.BandID)
+
+		msg := fmt.Sprintf("Группы прав позволяют участникам делать больше, чем по умолчанию. "+
+			"У администраторов есть все права.\n\n<b>По умолчанию:</b> %s", permissionsString(services.DefaultPermissions))
+
+		markup := &telebot.ReplyMarkup{}
+		for _, group := range groups {
+			msg += fmt.Sprintf("\n<b>%s:</b> %s", html.EscapeString(group.Name), permissionsString(group.Permissions))
+			markup.InlineKeyboard = append(markup.InlineKeyboard, []telebot.InlineButton{
+				{Text: group.Name, Data: helpers.AggregateCallbackData(helpers.PermissionGroupsState, 1, group.ID.Hex())},
+			})
+		}
+		markup.InlineKeyboard = append(markup.InlineKeyboard, []telebot.InlineButton{
+			{Text: helpers.CreatePermissionGroup, Data: helpers.AggregateCallbackData(helpers.PermissionGroupsState, 4, "")},
+		})
+		markup.InlineKeyboard = append(markup.InlineKeyboard, []telebot.InlineButton{
+			{Text: helpers.AssignPermissionGroup, Data: helpers.AggregateCallbackData(helpers.PermissionGroupsState, 6, "")},
+		})
+
+		if c.Callback() != nil {
+			c.Edit(msg, markup, telebot.ModeHTML)
+			c.Respond()
+			return nil
+		}
+
+		return c.Send(msg, markup, telebot.ModeHTML)
+	})
+
+	// Show the group.
+	handlerFuncs = append(handlerFuncs, func(h *Handler, c telebot.Context, user *entities.User) error {
+		_, _, groupIDHex := helpers.ParseCallbackData(c.Callback().Data)
+
+		group, err := findPermissionGroup(h, user, groupIDHex)
+		if err != nil {
+			return err
+		}
+
+		c.Edit(permissionGroupString(group), permissionGroupMarkup(group), telebot.ModeHTML)
+		c.Respond()
+		return nil
+	})
+
+	// Toggle the permission.
+	handlerFuncs = append(handlerFuncs, func(h *Handler, c telebot.Context, user *entities.User) error {
+		_, _, payload := helpers.ParseCallbackData(c.Callback().Data)
+
+		parsedPayload := strings.Split(payload, ":")
+		if len(parsedPayload) < 2 {
+			return fmt.Errorf("wrong permission payload %s", payload)
+		}
+
+		group, err := findPermissionGroup(h, user, parsedPayload[0])
+		if err != nil {
+			return err
+		}
+
+		group.Toggle(entities.Permission(parsedPayload[1]))
+		_, err = h.permissionService.UpdateOneGroup(*group)
+		if err != nil {
+			return err
+		}
+
+		c.Callback().Data = helpers.AggregateCallbackData(helpers.PermissionGroupsState, 1, group.ID.Hex())
+		return h.enterInlineHandler(c, user)
+	})
+
+	// Delete the group.
+	handlerFuncs = append(handlerFuncs, func(h *Handler, c telebot.Context, user *entities.User) error {
+		_, _, groupIDHex := helpers.ParseCallbackData(c.Callback().Data)
+
+		group, err := findPermissionGroup(h, user, groupIDHex)
+		if err != nil {
+			return err
+		}
+
+		err = h.permissionService.DeleteOneGroupByID(group.ID)
+		if err != nil {
+			return err
+		}
+
+		c.Callback().Data = helpers.AggregateCallbackData(helpers.PermissionGroupsState, 0, "")
+		return h.enterInlineHandler(c, user)
+	})
+
+	// Ask the name of the new group.
+	handlerFuncs = append(handlerFuncs, func(h *Handler, c telebot.Context, user *entities.User) error {
+		c.Respond()
+
+		err := c.Send("Введи название группы прав. Например, лидеры прославления:", &telebot.ReplyMarkup{
+			ReplyKeyboard:  [][]telebot.ReplyButton{{{Text: helpers.Cancel}}},
+			ResizeKeyboard: true,
+		})
+		if err != nil {
+			return err
+		}
+
+		user.State = &entities.State{
+			Index: 5,
+			Name:  helpers.PermissionGroupsState,
+		}
+		return nil
+	})
+
+	// Create the group with the default permissions.
+	handlerFuncs = append(handlerFuncs, func(h *Handler, c telebot.Context, user *entities.User) error {
+		name := strings.TrimSpace(c.Text())
+		if name == "" {
+			return c.Send("Введи название группы прав текстом.")
+		}
+
+		group, err := h.permissionService.UpdateOneGroup(entities.PermissionGroup{
+			BandID:      user.BandID,
+			Name:        name,
+			Permissions: append([]entities.Permission{}, services.DefaultPermissions...),
+		})
+		if err != nil {
+			return err
+		}
+
+		err = c.Send(permissionGroupString(group), permissionGroupMarkup(group), telebot.ModeHTML)
+		if err != nil {
+			return err
+		}
+
+		user.State = &entities.State{Name: helpers.MainMenuState}
+		return h.enter(c, user)
+	})
+
+	// Choose the member.
+	handlerFuncs = append(handlerFuncs, func(h *Handler, c telebot.Context, user *entities.User) error {
+		users, err := h.userService.FindMultipleByBandID(user.BandID)
+		if err != nil {
+			return err
+		}
+
+		markup := &telebot.ReplyMarkup{}
+		for _, member := range users {
+			markup.InlineKeyboard = append(markup.InlineKeyboard, []telebot.InlineButton{
+				{Text: fmt.Sprintf("%s: %s", member.Name, userPermissionGroupName(h, member, user.BandID)),
+					Data: helpers.AggregateCallbackData(helpers.PermissionGroupsState, 7, strconv.FormatInt(member.ID, 10))},
+			})
+		}
+		markup.InlineKeyboard = append(markup.InlineKeyboard, []telebot.InlineButton{
+			{Text: helpers.Back, Data: helpers.AggregateCallbackData(helpers.PermissionGroupsState, 0, "")},
+		})
+
+		c.Edit("Выбери участника:", markup)
+		c.Respond()
+		return nil
+	})
+
+	// Choose the group for the member.
+	handlerFuncs = append(handlerFuncs, func(h *Handler, c telebot.Context, user *entities.User) error {
+		_, _, memberID := helpers.ParseCallbackData(c.Callback().Data)
+
+		// Not found means there are no groups.
+		groups, _ := h.permissionService.FindManyGroupsByBandID(user.BandID)
+
+		markup := &telebot.ReplyMarkup{
+			InlineKeyboard: [][]telebot.InlineButton{
+				{{Text: "По умолчанию", Data: helpers.AggregateCallbackData(helpers.PermissionGroupsState, 8, memberID+":default")}},
+			},
+		}
+		for _, group := range groups {
+			markup.InlineKeyboard = append(markup.InlineKeyboard, []telebot.InlineButton{
+				{Text: group.Name, Data: helpers.AggregateCallbackData(helpers.PermissionGroupsState, 8, memberID+":"+group.ID.Hex())},
+			})
+		}
+		if user.Role == helpers.Admin {
+			markup.InlineKeyboard = append(markup.InlineKeyboard, []telebot.InlineButton{
+				{Text: "Администратор", Data: helpers.AggregateCallbackData(helpers.PermissionGroupsState, 8, memberID+":admin")},
+			})
+		}
+		markup.InlineKeyboard = append(markup.InlineKeyboard, []telebot.InlineButton{
+			{Text: helpers.Back, Data: helpers.AggregateCallbackData(helpers.PermissionGroupsState, 6, "")},
+		})
+
+		c.Edit("Выбери группу прав:", markup)
+		c.Respond()
+		return nil
+	})
+
+	// Assign the group.
+	handlerFuncs = append(handlerFuncs, func(h *Handler, c telebot.Context, user *entities.User) error {
+		_, _, payload := helpers.ParseCallbackData(c.Callback().Data)
+
+		parsedPayload := strings.Split(payload, ":")
+		if len(parsedPayload) < 2 {
+			return fmt.Errorf("wrong permission payload %s", payload)
+		}
+
+		memberID, err := strconv.ParseInt(parsedPayload[0], 10, 0)
+		if err != nil {
+			return err
+		}
+
+		// The user is saved after the handler, so changes of their own group are made right on them.
+		member := user
+		if memberID != user.ID {
+			member, err = h.userService.FindOneByID(memberID)
+			if err != nil {
+				return err
+			}
+		}
+
+		// Admins have all permissions, so only they make admins or change groups of other admins.
+		if member.UserBand(user.BandID) == nil ||
+			(parsedPayload[1] == "admin" || member.RoleIn(user.BandID) == helpers.Admin) && user.Role != helpers.Admin {
+			return h.deny(c, user)
+		}
+
+		switch parsedPayload[1] {
+		case "admin":
+			member.SetRoleIn(user.BandID, helpers.Admin)
+			member.SetPermissionGroupIn(user.BandID, primitive.NilObjectID)
+		case "default":
+			member.SetRoleIn(user.BandID, "")
+			member.SetPermissionGroupIn(user.BandID, primitive.NilObjectID)
+		default:
+			group, err := findPermissionGroup(h, user, parsedPayload[1])
+			if err != nil {
+				return err
+			}
+			member.SetRoleIn(user.BandID, "")
+			member.SetPermissionGroupIn(user.BandID, group.ID)
+		}
+
+		if member != user {
+			_, err = h.userService.UpdateOne(*member)
+			if err != nil {
+				return err
+			}
+		}
+
+		c.Callback().Data = helpers.AggregateCallbackData(helpers.PermissionGroupsState, 6, "")
+		return h.enterInlineHandler(c, user)
+	})
+
+	return helpers.PermissionGroupsState, handlerFuncs
+}
+
+func apiTokenHandler() (int, []HandlerFunc) {
+	handlerFuncs := make([]HandlerFunc, 0)
+
+	// Show the token.
+	handlerFuncs = append(handlerFuncs, func(h *Handler, c telebot.Context, user *entities.User) error {
+		band, err := h.bandService.FindOneByID(user.BandID)
+		if err != nil {
+			return err
+		}
+
+		msg := fmt.Sprintf("Токен для API группы:\n<code>%s</code>\n\n"+
+			"Передавай его в заголовке <code>Authorization: Bearer …</code>. "+
+			"С ним можно читать и менять песни, собрания и участников группы с правами администратора, поэтому не делись им. "+
+			"Если токен попал не в те руки, выпусти новый: старый перестанет работать.",
+			h.apiTokenService.Token(band))
+		if helpers.PublicURL != "" {
+			msg += fmt.Sprintf("\n\nАдрес API: <code>%s/api</code>", helpers.PublicURL)
+		}
+
+		markup := &telebot.ReplyMarkup{
+			InlineKeyboard: [][]telebot.InlineButton{
+				{{Text: helpers.RevokeAPIToken, Data: helpers.AggregateCallbackData(helpers.APITokenState, 1, "")}},
+			},
+		}
+
+		if c.Callback() != nil {
+			c.Edit(msg, markup, telebot.ModeHTML)
+			c.Respond()
+			return nil
+		}
+
+		return c.Send(msg, markup, telebot.ModeHTML)
+	})
+
+	// Confirm the new token.
+	handlerFuncs = append(handlerFuncs, func(h *Handler, c telebot.Context, user *entities.User) error {
+		markup := &telebot.ReplyMarkup{
+			InlineKeyboard: [][]telebot.InlineButton{
+				{
+					{Text: helpers.Back, Data: helpers.AggregateCallbackData(helpers.APITokenState, 0, "")},
+					{Text: helpers.Yes, Data: helpers.AggregateCallbackData(helpers.APITokenState, 2, "")},
+				},
+			},
+		}
+
+		c.Edit("Старый токен перестанет работать, программы с ним потеряют доступ к группе. Выпустить новый?", markup)
+		c.Respond()
+		return nil
+	})
+
+	// Revoke the token.
+	handlerFuncs = append(handlerFuncs, func(h *Handler, c telebot.Context, user *entities.User) error {
+		_, err := h.apiTokenService.Regenerate(user.BandID)
+		if err != nil {
+			return err
+		}
+
+		c.Callback().Data = helpers.AggregateCallbackData(helpers.APITokenState, 0, "")
+		return h.enterInlineHandler(c, user)
+	})
+
+	return helpers.APITokenState, handlerFuncs
+}
+
+func calendarHandler() (int, []HandlerFunc) {
+	handlerFuncs := make([]HandlerFunc, 0)
+
+	// Show the links.
+	handlerFuncs = append(handlerFuncs, func(h *Handler, c telebot.Context, user *entities.User) error {
+		msg, markup := calendarLinks(h, user)
+		c.Edit(msg, markup, telebot.ModeHTML)
+		c.Respond()
+		return nil
+	})
+
+	// Confirm the new links.
+	handlerFuncs = append(handlerFuncs, func(h *Handler, c telebot.Context, user *entities.User) error {
+		_, _, feed := helpers.ParseCallbackData(c.Callback().Data)
+
+		msg := "Старые ссылки на твои календари перестанут работать. Выпустить новые?"
+		if feed == "band" {
+			msg = "Старые ссылки на календарь группы перестанут работать у всех участников, им придется подписаться заново. Выпустить новую?"
+		}
+
+		markup := &telebot.ReplyMarkup{
+			InlineKeyboard: [][]telebot.InlineButton{
+				{
+					{Text: helpers.Back, Data: helpers.AggregateCallbackData(helpers.CalendarState, 0, "")},
+					{Text: helpers.Yes, Data: helpers.AggregateCallbackData(helpers.CalendarState, 2, feed)},
+				},
+			},
+		}
+
+		c.Edit(msg, markup)
+		c.Respond()
+		return nil
+	})
+
+	// Revoke the links.
+	handlerFuncs = append(handlerFuncs, func(h *Handler, c telebot.Context, user *entities.User) error {
+		_, _, feed := helpers.ParseCallbackData(c.Callback().Data)
+
+		if feed == "band" {
+			if user.Band == nil || !user.Can(entities.ManageBand) {
+				return h.deny(c, user)
+			}
+
+			band, err := h.calendarService.RegenerateBandTokens(user.BandID)
+			if err != nil {
+				return err
+			}
+			user.Band = band
+		} else {
+			err := h.calendarService.RegenerateUserTokens(user)
+			if err != nil {
+				return err
+			}
+		}
+
+		c.Callback().Data = helpers.AggregateCallbackData(helpers.CalendarState, 0, "")
+		return h.enterInlineHandler(c, user)
+	})
+
+	return helpers.CalendarState, handlerFuncs
+}
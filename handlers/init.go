@@ -14,10 +14,8 @@ func init() {
 	registerHandlers(
 		mainMenuHandler,
 		//addBandAdminHandler,
-		createSongHandler,
 		copySongHandler,
 		//deleteSongHandler,
-		createBandHandler,
 		chooseBandHandler,
 		styleSongHandler,
 		searchSongHandler,
@@ -29,7 +27,6 @@ func init() {
 		getEventsHandler,
 		createEventHandler,
 		eventActionsHandler,
-		createRoleHandler,
 		addEventMemberHandler,
 		addEventSongHandler,
 		deleteEventHandler,
@@ -40,6 +37,26 @@ func init() {
 		deleteSongHandler,
 		getSongsFromMongoHandler,
 		changeEventDateHandler,
+		exportChordProHandler,
+		importChordProHandler,
+		capoHandler,
+		nashvilleHandler,
+		setlistEntryHandler,
+		eventTemplatesHandler,
+		availabilityHandler,
+		membershipStatusHandler,
+		rotaHandler,
+		invitesHandler,
+		joinRequestHandler,
+		permissionGroupsHandler,
+		apiTokenHandler,
+		calendarHandler,
+	)
+
+	registerConversations(
+		createRoleConversation,
+		createBandConversation,
+		createSongConversation,
 	)
 }
 
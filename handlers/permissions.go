@@ -0,0 +1,130 @@
+package handlers
+
+import (
+	"strings"
+
+	"github.com/joeyave/scala-chords-bot/entities"
+	"github.com/joeyave/scala-chords-bot/helpers"
+	"github.com/joeyave/scala-chords-bot/services"
+	"github.com/joeyave/telebot/v3"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+const noPermissionMessage = "У тебя нет прав на это. Их может выдать администратор группы."
+
+// adminOnly is only had by admins of the band. Permission groups can't grant it.
+const adminOnly entities.Permission = "adminOnly"
+
+// statePermissions are permissions needed to enter the states. They are checked for every update,
+// so callback data made up by hand doesn't get around them.
+var statePermissions = map[int]entities.Permission{
+	helpers.CreateEventState:      entities.ManageEvents,
+	helpers.EventTemplatesState:   entities.ManageEvents,
+	helpers.RotaState:             entities.ManageEvents,
+	helpers.InvitesState:          entities.ManageMembers,
+	helpers.CreateSongState:       entities.EditSongs,
+	helpers.DeleteSongState:       entities.DeleteSongs,
+	helpers.StyleSongState:        entities.EditSongs,
+	helpers.CopySongState:         entities.EditSongs,
+	helpers.ImportChordProState:   entities.EditSongs,
+	helpers.UploadVoiceState:      entities.UploadVoices,
+	helpers.CreateRoleState:       entities.ManageRoles,
+	helpers.PermissionGroupsState: entities.ManageBand,
+	helpers.APITokenState:         entities.ManageBand,
+	helpers.AddBandAdminState:     adminOnly,
+	helpers.JoinRequestState:      entities.ManageMembers,
+}
+
+// stepPermissions are permissions needed for some steps of states other steps of which anyone may use.
+var stepPermissions = map[int]map[int]entities.Permission{
+	// Sending the song in the new key is for everyone, changing the doc is not.
+	helpers.TransposeSongState: {2: entities.EditSongs},
+}
+
+// payloadBandStates are answered from messages sent to admins of the band, who may have another band chosen.
+// Their permissions are checked in the band from the callback payload "{userID}:{bandID}".
+var payloadBandStates = map[int]bool{
+	helpers.JoinRequestState: true,
+}
+
+// eventStates change the event of the state. The value tells whether members of the event may use the state
+// without the permission to manage events.
+var eventStates = map[int]bool{
+	helpers.DeleteEventState:       false,
+	helpers.AddEventMemberState:    false,
+	helpers.DeleteEventMemberState: false,
+	helpers.ChangeEventDateState:   false,
+	helpers.AddEventSongState:      true,
+	helpers.DeleteEventSongState:   true,
+	helpers.ChangeSongOrderState:   true,
+	helpers.SetlistEntryState:      true,
+}
+
+// can reports whether the user has the permission in the current band.
+func can(user *entities.User, permission entities.Permission) bool {
+	if permission == adminOnly {
+		return user.Role == helpers.Admin
+	}
+	return user.Can(permission)
+}
+
+// authorize returns services.ErrForbidden if the user can't enter the step of the state.
+// The payload is the one of the callback data, it is empty for text messages.
+func (h *Handler) authorize(user *entities.User, state int, index int, payload string) error {
+	h.permissionService.Load(user)
+
+	if memberAllowed, ok := eventStates[state]; ok {
+		eventID, err := primitive.ObjectIDFromHex(user.State.CallbackData.Query().Get("eventId"))
+		if err != nil {
+			eventID = user.State.Context.EventID
+		}
+
+		if eventID.IsZero() {
+			if !user.Can(entities.ManageEvents) {
+				return services.ErrForbidden
+			}
+			return nil
+		}
+
+		return h.permissionService.CheckEvent(user, eventID, memberAllowed)
+	}
+
+	if payloadBandStates[state] {
+		parsedPayload := strings.Split(payload, ":")
+		if len(parsedPayload) < 2 {
+			return services.ErrForbidden
+		}
+
+		bandID, err := primitive.ObjectIDFromHex(parsedPayload[1])
+		if err != nil {
+			return services.ErrForbidden
+		}
+
+		return h.permissionService.Check(user, bandID, statePermissions[state])
+	}
+
+	if permission, ok := statePermissions[state]; ok && !can(user, permission) {
+		return services.ErrForbidden
+	}
+
+	if permission, ok := stepPermissions[state][index]; ok && !can(user, permission) {
+		return services.ErrForbidden
+	}
+
+	return nil
+}
+
+// deny tells the user they don't have the permission. The reply keyboard is reset to the main menu.
+func (h *Handler) deny(c telebot.Context, user *entities.User) error {
+	if c.Callback() != nil {
+		return c.Respond(&telebot.CallbackResponse{Text: noPermissionMessage, ShowAlert: true})
+	}
+
+	err := c.Send(noPermissionMessage)
+	if err != nil {
+		return err
+	}
+
+	user.State = &entities.State{Name: helpers.MainMenuState}
+	return h.enter(c, user)
+}
@@ -0,0 +1,69 @@
+package handlers
+
+import (
+	"github.com/joeyave/scala-chords-bot/entities"
+	"github.com/joeyave/scala-chords-bot/helpers"
+	"github.com/joeyave/telebot/v3"
+	"time"
+)
+
+const stateExpiredMessage = "Предыдущее действие устарело, начни заново."
+
+// stateTimeouts are for how long flows wait for an answer. After that the state expires, so an unrelated message
+// isn't taken for the answer. Other states never expire, conversations have their own timeouts.
+var stateTimeouts = map[int]time.Duration{
+	helpers.SetlistState:          time.Minute * 30,
+	helpers.GetVoicesState:        time.Hour,
+	helpers.UploadVoiceState:      time.Hour,
+	helpers.CopySongState:         time.Hour,
+	helpers.ImportChordProState:   time.Hour,
+	helpers.TransposeSongState:    time.Hour,
+	helpers.CapoState:             time.Hour,
+	helpers.AddBandAdminState:     time.Hour,
+	helpers.CreateEventState:      time.Hour,
+	helpers.ChangeEventDateState:  time.Hour,
+	helpers.AddEventMemberState:   time.Hour,
+	helpers.AddEventSongState:     time.Hour,
+	helpers.DeleteEventState:      time.Hour,
+	helpers.ChangeSongOrderState:  time.Hour,
+	helpers.SetlistEntryState:     time.Hour,
+	helpers.EventTemplatesState:   time.Hour * 2,
+	helpers.AvailabilityState:     time.Hour * 2,
+	helpers.RotaState:             time.Hour * 2,
+	helpers.InvitesState:          time.Hour,
+	helpers.PermissionGroupsState: time.Hour,
+}
+
+func stateTimeout(name int) time.Duration {
+	if conv, ok := conversations[name]; ok {
+		return conv.Timeout
+	}
+	return stateTimeouts[name]
+}
+
+// expireState cleans up the state if the user has left it for longer than the timeout of the flow:
+// messages of the flow are deleted and the user is told about it and sent to the main menu.
+func (h *Handler) expireState(c telebot.Context, user *entities.User) error {
+	timeout := stateTimeout(user.State.Name)
+	if timeout == 0 || user.State.EnteredAt.IsZero() || time.Since(user.State.EnteredAt) < timeout {
+		return nil
+	}
+
+	for _, messageID := range user.State.Context.MessagesToDelete {
+		h.bot.Delete(&telebot.Message{
+			ID:   messageID,
+			Chat: c.Chat(),
+		})
+	}
+
+	user.State = &entities.State{Name: helpers.MainMenuState}
+	return c.Send(stateExpiredMessage)
+}
+
+// markEntered records when the user entered the state, if the update has moved them to another state or step.
+func markEntered(user *entities.User, before entities.State) {
+	if user.State.EnteredAt.IsZero() ||
+		user.State.Name != before.Name || user.State.Index != before.Index || user.State.Step != before.Step {
+		user.State.EnteredAt = time.Now()
+	}
+}
@@ -29,6 +29,20 @@ const (
 	DeleteEventMemberState
 	DeleteEventSongState
 	GetSongsFromMongoHandler
+	ExportChordProState
+	ImportChordProState
+	CapoState
+	NashvilleState
+	SetlistEntryState
+	EventTemplatesState
+	AvailabilityState
+	MembershipStatusState
+	RotaState
+	InvitesState
+	JoinRequestState
+	PermissionGroupsState
+	APITokenState
+	CalendarState
 )
 
 // Buttons constants.
@@ -67,6 +81,7 @@ const (
 	ChangeEventDate             string = "🗓️ Изменить дату"
 	GetAllEvents                string = "Все собрания"
 	GetEventsWithMe             string = "🙋‍♂️ Собрания, где я участвую"
+	GetEventsWithMeEverywhere   string = "🌍 Мои собрания во всех группах"
 	End                         string = "🔴 Закончить"
 	Delete                      string = "Удалить"
 	BandSettings                string = "Настройки группы"
@@ -79,6 +94,52 @@ const (
 	Today                       string = "⏰ Сегодня"
 	LinkToTheDoc                string = "Ссылка на документ"
 	Setlist                     string = "📝 Список"
+	ChordPro                    string = "📄 ChordPro"
+	TransposedPDF               string = "📄 Прислать PDF, не меняя документ"
+	TransposedText              string = "🔤 Прислать текстом, не меняя документ"
+	Capo                        string = "🎸 Каподастр"
+	Nashville                   string = "🔢 Цифровка"
+	Booklet                     string = "📚 Буклет"
+	Arrangement                 string = "🎼 Аранжировка"
+	Key                         string = "🎹 Тональность"
+	BPM                         string = "🥁 BPM"
+	Vocalist                    string = "🎤 Вокал"
+	Note                        string = "📝 Заметка"
+	Reset                       string = "🧹 Сбросить"
+	AsInTheDoc                  string = "Как в документе"
+	NoVocalist                  string = "Без вокала"
+	Templates                   string = "🔁 Шаблоны собраний"
+	CreateTemplate              string = "➕ Создать шаблон"
+	Recurrence                  string = "🔁 Повторение"
+	NoRecurrence                string = "Без повторения"
+	AddSlot                     string = "➕ Роль"
+	DeleteSlot                  string = "➖ Роль"
+	Rename                      string = "✏️ Переименовать"
+	CreateEventFromTemplate     string = "🗓️ Создать собрание"
+	DeleteTemplate              string = "🗑 Удалить"
+	Done                        string = "✅ Готово"
+	Availability                string = "🏖 Когда я не могу"
+	AddBlackout                 string = "➕ Добавить даты"
+	Unavailable                 string = "🏖 не может"
+	Accept                      string = "✅ Смогу"
+	Decline                     string = "❌ Не смогу"
+	OpenEvent                   string = "🗓️ Открыть собрание"
+	GenerateRota                string = "🤖 Составить расписание"
+	ChooseDates                 string = "📅 Выбрать даты"
+	Approve                     string = "✅ Утвердить"
+	Calendar                    string = "📆 Календарь"
+	RevokeCalendarLinks         string = "🔄 Новые ссылки"
+	RevokeBandCalendarLinks     string = "🔄 Новая ссылка группы для всех"
+	APIAccess                   string = "🔑 Доступ к API"
+	RevokeAPIToken              string = "🔄 Выпустить новый токен"
+	Invites                     string = "🔗 Приглашения"
+	CreateInvite                string = "➕ Создать приглашение"
+	ApproveRequest              string = "✅ Принять"
+	RejectRequest               string = "❌ Отклонить"
+	PermissionGroups            string = "🛡 Права доступа"
+	CreatePermissionGroup       string = "➕ Создать группу прав"
+	AssignPermissionGroup       string = "👤 Назначить участнику"
+	DeletePermissionGroup       string = "🗑 Удалить группу"
 )
 
 // Roles.
@@ -88,3 +149,4 @@ const (
 
 var FilesChannelID int64
 var LogsChannelID int64
+var PublicURL string
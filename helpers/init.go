@@ -3,19 +3,27 @@ package helpers
 import (
 	"os"
 	"strconv"
+	"strings"
 )
 
 func init() {
-	filesChannelID, err := strconv.ParseInt(os.Getenv("FILES_CHANNEL_ID"), 10, 0)
-	if err != nil {
-		panic("files channel id is invalid")
+	// The channels may be unset where the bot isn't run, like in tests. main checks them.
+	FilesChannelID = channelID("FILES_CHANNEL_ID", "files channel id is invalid")
+	LogsChannelID = channelID("LOG_CHANNEL", "logs channel id is invalid")
+
+	// Optional: the address the bot is reachable at from the internet, like https://bot.example.com.
+	PublicURL = strings.TrimRight(os.Getenv("PUBLIC_URL"), "/")
+}
+
+func channelID(key string, invalid string) int64 {
+	value := os.Getenv(key)
+	if value == "" {
+		return 0
 	}
-	FilesChannelID = filesChannelID
 
-	logsChannelID, err := strconv.ParseInt(os.Getenv("LOG_CHANNEL"), 10, 0)
+	ID, err := strconv.ParseInt(value, 10, 0)
 	if err != nil {
-		panic("logs channel id is invalid")
+		panic(invalid)
 	}
-
-	LogsChannelID = logsChannelID
+	return ID
 }
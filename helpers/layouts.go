@@ -8,14 +8,28 @@ import (
 
 func GetSongActionsKeyboard(user entities.User, song entities.Song, driveFile drive.File) [][]telebot.InlineButton {
 	if song.BandID == user.BandID {
-		return [][]telebot.InlineButton{
-			{{Text: LinkToTheDoc, URL: driveFile.WebViewLink}},
+		keyboard := [][]telebot.InlineButton{
 			{{Text: Voices, Data: AggregateCallbackData(GetVoicesState, 0, "")}},
 			{
 				{Text: Transpose, Data: AggregateCallbackData(TransposeSongState, 0, "")},
-				{Text: Style, Data: AggregateCallbackData(StyleSongState, 0, "")},
 			},
+			{
+				{Text: Capo, Data: AggregateCallbackData(CapoState, 0, "")},
+				{Text: Nashville, Data: AggregateCallbackData(NashvilleState, 0, "")},
+			},
+			{{Text: ChordPro, Data: AggregateCallbackData(ExportChordProState, 0, "")}},
+		}
+
+		if user.Can(entities.EditSongs) {
+			keyboard[1] = append(keyboard[1], telebot.InlineButton{Text: Style, Data: AggregateCallbackData(StyleSongState, 0, "")})
 		}
+
+		// Documents from the local store don't have a link.
+		if driveFile.WebViewLink != "" {
+			keyboard = append([][]telebot.InlineButton{{{Text: LinkToTheDoc, URL: driveFile.WebViewLink}}}, keyboard...)
+		}
+
+		return keyboard
 	} else {
 		return [][]telebot.InlineButton{
 			{{Text: driveFile.Name, URL: driveFile.WebViewLink}},
@@ -26,11 +40,21 @@ func GetSongActionsKeyboard(user entities.User, song entities.Song, driveFile dr
 
 }
 
+func GetMembershipStatusKeyboard(membership entities.Membership) [][]telebot.InlineButton {
+	return [][]telebot.InlineButton{
+		{
+			{Text: Decline, Data: AggregateCallbackData(MembershipStatusState, 1, membership.ID.Hex())},
+			{Text: Accept, Data: AggregateCallbackData(MembershipStatusState, 0, membership.ID.Hex())},
+		},
+	}
+}
+
 func GetEventActionsKeyboard(user entities.User, event entities.Event) [][]telebot.InlineButton {
-	if user.Role == Admin {
+	if user.Can(entities.ManageEvents) {
 		return [][]telebot.InlineButton{
 			{
 				{Text: FindChords, Data: AggregateCallbackData(EventActionsState, 1, "")},
+				{Text: Booklet, Data: AggregateCallbackData(EventActionsState, 2, "")},
 			},
 			{
 				{Text: DeleteMember, Data: AggregateCallbackData(DeleteEventMemberState, 0, "")},
@@ -44,6 +68,9 @@ func GetEventActionsKeyboard(user entities.User, event entities.Event) [][]teleb
 				{Text: ChangeSongsOrder, Data: AggregateCallbackData(ChangeSongOrderState, 0, "")},
 				{Text: ChangeEventDate, Data: AggregateCallbackData(ChangeEventDateState, 0, "")},
 			},
+			{
+				{Text: Arrangement, Data: AggregateCallbackData(SetlistEntryState, 0, "")},
+			},
 		}
 	}
 
@@ -52,6 +79,7 @@ func GetEventActionsKeyboard(user entities.User, event entities.Event) [][]teleb
 			return [][]telebot.InlineButton{
 				{
 					{Text: FindChords, Data: AggregateCallbackData(EventActionsState, 1, "")},
+					{Text: Booklet, Data: AggregateCallbackData(EventActionsState, 2, "")},
 				},
 				{
 					{Text: DeleteSong, Data: AggregateCallbackData(DeleteEventSongState, 0, "")},
@@ -59,6 +87,7 @@ func GetEventActionsKeyboard(user entities.User, event entities.Event) [][]teleb
 				},
 				{
 					{Text: ChangeSongsOrder, Data: AggregateCallbackData(ChangeSongOrderState, 0, "")},
+					{Text: Arrangement, Data: AggregateCallbackData(SetlistEntryState, 0, "")},
 				},
 			}
 		}
@@ -67,6 +96,7 @@ func GetEventActionsKeyboard(user entities.User, event entities.Event) [][]teleb
 	return [][]telebot.InlineButton{
 		{
 			{Text: FindChords, Data: AggregateCallbackData(EventActionsState, 1, "")},
+			{Text: Booklet, Data: AggregateCallbackData(EventActionsState, 2, "")},
 		},
 	}
 }
@@ -103,3 +133,40 @@ var CancelOrSkipKeyboard = [][]telebot.ReplyButton{
 var SearchEverywhereKeyboard = [][]telebot.ReplyButton{
 	{{Text: Cancel}, {Text: SearchEverywhere}},
 }
+
+// GetKeysKeyboard returns a button for every key, the key is the payload of the button.
+func GetKeysKeyboard(state int, index int) [][]telebot.InlineButton {
+	return [][]telebot.InlineButton{
+		{
+			{Text: "C | Am", Data: AggregateCallbackData(state, index, "C")},
+			{Text: "C# | A#m", Data: AggregateCallbackData(state, index, "C#")},
+			{Text: "Db | Bbm", Data: AggregateCallbackData(state, index, "Db")},
+		},
+		{
+			{Text: "D | Bm", Data: AggregateCallbackData(state, index, "D")},
+			{Text: "D# | Cm", Data: AggregateCallbackData(state, index, "D#")},
+			{Text: "Eb | Cm", Data: AggregateCallbackData(state, index, "Eb")},
+		},
+		{
+			{Text: "E | C#m", Data: AggregateCallbackData(state, index, "E")},
+		},
+		{
+			{Text: "F | Dm", Data: AggregateCallbackData(state, index, "F")},
+			{Text: "F# | D#m", Data: AggregateCallbackData(state, index, "F#")},
+			{Text: "Gb | Ebm", Data: AggregateCallbackData(state, index, "Gb")},
+		},
+		{
+			{Text: "G | Em", Data: AggregateCallbackData(state, index, "G")},
+			{Text: "G# | Fm", Data: AggregateCallbackData(state, index, "G#")},
+			{Text: "Ab | Fm", Data: AggregateCallbackData(state, index, "Ab")},
+		},
+		{
+			{Text: "A | F#m", Data: AggregateCallbackData(state, index, "A")},
+			{Text: "A# | Gm", Data: AggregateCallbackData(state, index, "A#")},
+			{Text: "Bb | Gm", Data: AggregateCallbackData(state, index, "Bb")},
+		},
+		{
+			{Text: "B | G#m", Data: AggregateCallbackData(state, index, "B")},
+		},
+	}
+}
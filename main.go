@@ -4,11 +4,14 @@ import (
 	"context"
 	"fmt"
 	"github.com/joeyave/scala-chords-bot/handlers"
+	"github.com/joeyave/scala-chords-bot/helpers"
 	"github.com/joeyave/scala-chords-bot/repositories"
 	"github.com/joeyave/scala-chords-bot/services"
+	"github.com/joeyave/scala-chords-bot/web"
 	"github.com/joeyave/telebot/v3"
 	"github.com/kjk/notionapi"
 	"github.com/klauspost/lctime"
+	"go.mongodb.org/mongo-driver/bson/primitive"
 	"go.mongodb.org/mongo-driver/mongo"
 	"go.mongodb.org/mongo-driver/mongo/options"
 	"go.mongodb.org/mongo-driver/mongo/readpref"
@@ -16,78 +19,205 @@ import (
 	"google.golang.org/api/drive/v3"
 	"google.golang.org/api/option"
 	"log"
+	"net/http"
 	"os"
+	"os/signal"
+	"sync"
+	"syscall"
 	"time"
 )
 
+// Updates handled at the same time, the others wait in the updates channel.
+const maxRunningHandlers = 64
+
 func main() {
 	err := lctime.SetLocale("ru_RU")
 	if err != nil {
 		fmt.Println(err)
 	}
 
-	mongoClient, err := mongo.NewClient(options.Client().ApplyURI(os.Getenv("MONGODB_URI")))
-	if err != nil {
-		log.Fatal(err)
+	if helpers.FilesChannelID == 0 || helpers.LogsChannelID == 0 {
+		log.Fatal("FILES_CHANNEL_ID and LOG_CHANNEL are required")
 	}
 
-	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
-	defer cancel()
+	var (
+		voiceRepository      repositories.VoiceRepository
+		bandRepository       repositories.BandRepository
+		songRepository       repositories.SongRepository
+		userRepository       repositories.UserRepository
+		membershipRepository repositories.MembershipRepository
+		eventRepository      repositories.EventRepository
+		roleRepository       repositories.RoleRepository
+		templateRepository   repositories.EventTemplateRepository
+		inviteRepository     repositories.InviteRepository
+		permissionRepository repositories.PermissionGroupRepository
 
-	err = mongoClient.Connect(ctx)
-	if err != nil {
-		log.Fatal(err)
-	}
-	defer mongoClient.Disconnect(ctx)
-	err = mongoClient.Ping(ctx, readpref.Primary())
-	if err != nil {
-		log.Fatal(err)
+		mongoClient *mongo.Client
+	)
+
+	// Demo mode: keep everything in memory instead of MongoDB.
+	if os.Getenv("STORAGE") == "memory" {
+		log.Println("using in-memory storage, all data will be lost on restart")
+
+		store := repositories.NewMemoryStore()
+		voiceRepository = repositories.NewVoiceMemoryRepository(store)
+		bandRepository = repositories.NewBandMemoryRepository(store)
+		songRepository = repositories.NewSongMemoryRepository(store)
+		userRepository = repositories.NewUserMemoryRepository(store)
+		membershipRepository = repositories.NewMembershipMemoryRepository(store)
+		eventRepository = repositories.NewEventMemoryRepository(store)
+		roleRepository = repositories.NewRoleMemoryRepository(store)
+		templateRepository = repositories.NewEventTemplateMemoryRepository(store)
+		inviteRepository = repositories.NewInviteMemoryRepository(store)
+		permissionRepository = repositories.NewPermissionGroupMemoryRepository(store)
+	} else {
+		mongoClient, err = mongo.NewClient(options.Client().ApplyURI(os.Getenv("MONGODB_URI")))
+		if err != nil {
+			log.Fatal(err)
+		}
+
+		ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+		defer cancel()
+
+		err = mongoClient.Connect(ctx)
+		if err != nil {
+			log.Fatal(err)
+		}
+		err = mongoClient.Ping(ctx, readpref.Primary())
+		if err != nil {
+			log.Fatal(err)
+		}
+
+		voiceRepository = repositories.NewVoiceMongoRepository(mongoClient)
+		bandRepository = repositories.NewBandMongoRepository(mongoClient)
+		songRepository = repositories.NewSongMongoRepository(mongoClient)
+		userRepository = repositories.NewUserMongoRepository(mongoClient)
+		membershipRepository = repositories.NewMembershipMongoRepository(mongoClient)
+		eventRepository = repositories.NewEventMongoRepository(mongoClient)
+		roleRepository = repositories.NewRoleMongoRepository(mongoClient)
+		templateRepository = repositories.NewEventTemplateMongoRepository(mongoClient)
+		inviteRepository = repositories.NewInviteMongoRepository(mongoClient)
+		permissionRepository = repositories.NewPermissionGroupMongoRepository(mongoClient)
 	}
 
-	driveRepository, err := drive.NewService(context.TODO(), option.WithCredentialsJSON([]byte(os.Getenv("GOOGLEAPIS_CREDENTIALS"))))
-	if err != nil {
-		log.Fatalf("Unable to retrieve Drive client: %v", err)
+	fontsDir := os.Getenv("PDF_FONTS_DIR")
+	if fontsDir == "" {
+		fontsDir = "/usr/share/fonts/truetype/dejavu"
 	}
+	pdfRenderer := services.NewPDFRenderer(fontsDir)
 
-	docsRepository, err := docs.NewService(context.TODO(), option.WithCredentialsJSON([]byte(os.Getenv("GOOGLEAPIS_CREDENTIALS"))))
-	if err != nil {
-		log.Fatalf("Unable to retrieve Docs client: %v", err)
+	var documentStore services.SongDocumentStore
+
+	// Keep songs as files on disk instead of Google Docs, no service account is needed then.
+	if os.Getenv("DOCUMENT_STORE") == "local" {
+		localDocumentStore, err := services.NewLocalDocumentStore(os.Getenv("DOCUMENTS_DIR"), pdfRenderer)
+		if err != nil {
+			log.Fatalf("Unable to open documents directory: %v", err)
+		}
+		documentStore = localDocumentStore
+	} else {
+		driveRepository, err := drive.NewService(context.TODO(), option.WithCredentialsJSON([]byte(os.Getenv("GOOGLEAPIS_CREDENTIALS"))))
+		if err != nil {
+			log.Fatalf("Unable to retrieve Drive client: %v", err)
+		}
+
+		docsRepository, err := docs.NewService(context.TODO(), option.WithCredentialsJSON([]byte(os.Getenv("GOOGLEAPIS_CREDENTIALS"))))
+		if err != nil {
+			log.Fatalf("Unable to retrieve Docs client: %v", err)
+		}
+
+		documentStore = services.NewGoogleDocumentStore(driveRepository, docsRepository)
 	}
 
 	notionClient := &notionapi.Client{}
 
-	voiceRepository := repositories.NewVoiceRepository(mongoClient)
 	voiceService := services.NewVoiceService(voiceRepository)
 
-	bandRepository := repositories.NewBandRepository(mongoClient)
 	bandService := services.NewBandService(bandRepository, notionClient)
 
-	driveFileService := services.NewDriveFileService(driveRepository, docsRepository)
+	driveFileService := services.NewDriveFileService(documentStore, pdfRenderer)
+
+	permissionService := services.NewPermissionService(permissionRepository, eventRepository)
 
-	songRepository := repositories.NewSongRepository(mongoClient)
-	songService := services.NewSongService(songRepository, voiceRepository, bandRepository, driveRepository, notionClient, driveFileService)
+	songService := services.NewSongService(songRepository, voiceRepository, bandRepository, notionClient, driveFileService, permissionService)
 
-	userRepository := repositories.NewUserRepository(mongoClient)
 	userService := services.NewUserService(userRepository)
 
-	membershipRepository := repositories.NewMembershipRepository(mongoClient)
-	membershipService := services.NewMembershipService(membershipRepository)
+	membershipService := services.NewMembershipService(membershipRepository, permissionService)
 
-	eventRepository := repositories.NewEventRepository(mongoClient)
-	eventService := services.NewEventService(eventRepository, userRepository, membershipRepository, driveRepository, driveFileService)
+	eventService := services.NewEventService(eventRepository, userRepository, membershipRepository, driveFileService, permissionService)
 
-	roleRepository := repositories.NewRoleRepository(mongoClient)
 	roleService := services.NewRoleService(roleRepository)
 
+	templateService := services.NewEventTemplateService(templateRepository, eventRepository, membershipRepository, permissionService)
+
+	rotaService := services.NewRotaService(eventRepository, userRepository, membershipRepository, permissionService)
+
+	calendarSecret := os.Getenv("CALENDAR_SECRET")
+	if calendarSecret == "" {
+		calendarSecret = os.Getenv("BOT_TOKEN")
+	}
+	calendarService := services.NewCalendarService(eventRepository, userRepository, bandRepository, calendarSecret)
+
+	apiSecret := os.Getenv("API_SECRET")
+	if apiSecret == "" {
+		apiSecret = os.Getenv("BOT_TOKEN")
+	}
+	apiTokenService := services.NewAPITokenService(apiSecret, bandRepository)
+
+	inviteService := services.NewInviteService(inviteRepository)
+
+	callbackSecret := os.Getenv("CALLBACK_SECRET")
+	if callbackSecret == "" {
+		callbackSecret = os.Getenv("BOT_TOKEN")
+	}
+	callbackService := services.NewCallbackService(callbackSecret, time.Hour*24*14)
+
+	httpAddr := os.Getenv("HTTP_ADDR")
+	if httpAddr == "" && os.Getenv("PORT") != "" {
+		httpAddr = ":" + os.Getenv("PORT")
+	}
+
+	var poller telebot.Poller = &telebot.LongPoller{Timeout: 10 * time.Second}
+
+	// Webhook mode: Telegram pushes updates to PUBLIC_URL/telegram/webhook, the HTTP server must be reachable there.
+	var webhookPoller *web.WebhookPoller
+	if os.Getenv("WEBHOOK") == "true" {
+		if helpers.PublicURL == "" || httpAddr == "" {
+			log.Fatal("webhook mode needs PUBLIC_URL and HTTP_ADDR or PORT")
+		}
+
+		secretToken := os.Getenv("WEBHOOK_SECRET")
+		if secretToken == "" {
+			// The webhook is set again on every start, so a random token is fine.
+			secretToken = primitive.NewObjectID().Hex()
+		}
+
+		webhookPoller = &web.WebhookPoller{
+			PublicURL:   helpers.PublicURL + "/telegram/webhook",
+			SecretToken: secretToken,
+		}
+		poller = webhookPoller
+	}
+
 	bot, err := telebot.NewBot(telebot.Settings{
-		Token:       os.Getenv("BOT_TOKEN"),
-		Poller:      &telebot.LongPoller{Timeout: 10 * time.Second},
-		Synchronous: false,
+		Token:  os.Getenv("BOT_TOKEN"),
+		Poller: poller,
+		// Handler.Run starts the goroutines of the handlers itself.
+		Synchronous: true,
 	})
 	if err != nil {
 		log.Fatal(err)
 	}
 
+	// getUpdates doesn't work while a webhook is set.
+	if webhookPoller == nil {
+		err = bot.RemoveWebhook()
+		if err != nil {
+			log.Fatal(err)
+		}
+	}
+
 	handler := handlers.NewHandler(
 		bot,
 		userService,
@@ -98,17 +228,102 @@ func main() {
 		membershipService,
 		eventService,
 		roleService,
+		templateService,
+		rotaService,
+		calendarService,
+		apiTokenService,
+		inviteService,
+		permissionService,
+		callbackService,
 	)
 
 	bot.OnError = handler.OnError
 
-	bot.Use(handler.RegisterUserMiddleware)
+	bot.Use(handler.Middleware()...)
 
 	bot.Handle(telebot.OnText, handler.OnText)
 	bot.Handle(telebot.OnVoice, handler.OnVoice)
+	bot.Handle(telebot.OnDocument, handler.OnDocument)
 	bot.Handle(telebot.OnCallback, handler.OnCallback)
+	bot.Handle(telebot.OnQuery, handler.OnQuery)
+
+	// The background loops use the database, so they are stopped before it is disconnected.
+	backgroundCtx, stopBackground := context.WithCancel(context.Background())
+	var background sync.WaitGroup
+	for _, loop := range []func(ctx context.Context){handler.NotifyUser, handler.GenerateEvents} {
+		background.Add(1)
+		go func(loop func(ctx context.Context)) {
+			defer background.Done()
+			loop(backgroundCtx)
+		}(loop)
+	}
+
+	healthHandler := web.NewHealthHandler()
+
+	var server *http.Server
+	if httpAddr != "" {
+		mux := http.NewServeMux()
+		mux.Handle("/health", healthHandler)
+		mux.Handle("/calendar/", web.NewCalendarHandler(calendarService, userService, bandService))
+		mux.Handle("/api/", web.NewAPIHandler(apiTokenService, bandService, userService, songService, eventService, membershipService, roleService, permissionService))
+		if webhookPoller != nil {
+			mux.Handle("/telegram/webhook", webhookPoller)
+		}
 
-	go handler.NotifyUser()
+		server = &http.Server{Addr: httpAddr, Handler: mux}
+		go func() {
+			err := server.ListenAndServe()
+			if err != nil && err != http.ErrServerClosed {
+				log.Fatal(err)
+			}
+		}()
+	}
+
+	botCtx, stopBot := context.WithCancel(context.Background())
+	go func() {
+		signals := make(chan os.Signal, 1)
+		signal.Notify(signals, syscall.SIGTERM, os.Interrupt)
+		<-signals
+
+		log.Println("shutting down")
+		healthHandler.ShutDown()
+		stopBot()
+	}()
+
+	handler.Run(botCtx, maxRunningHandlers)
+
+	// Run also returns if the webhook couldn't be set, then everything is stopped the same way and the error is reported.
+	var pollErr error
+	if webhookPoller != nil {
+		pollErr = webhookPoller.Err()
+	}
+
+	if server != nil {
+		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		err := server.Shutdown(ctx)
+		cancel()
+		if err != nil {
+			log.Printf("shutting down http server: %v", err)
+		}
+	}
+
+	if !handler.Wait(30 * time.Second) {
+		log.Println("some handlers are still running, stopping anyway")
+	}
+
+	stopBackground()
+	background.Wait()
 
-	bot.Start()
+	if mongoClient != nil {
+		ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+		err := mongoClient.Disconnect(ctx)
+		cancel()
+		if err != nil {
+			log.Printf("disconnecting from mongo: %v", err)
+		}
+	}
+
+	if pollErr != nil {
+		log.Fatal(pollErr)
+	}
 }
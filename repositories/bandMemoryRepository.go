@@ -0,0 +1,78 @@
+package repositories
+
+import (
+	"fmt"
+	"github.com/joeyave/scala-chords-bot/entities"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+type BandMemoryRepository struct {
+	store *MemoryStore
+}
+
+func NewBandMemoryRepository(store *MemoryStore) *BandMemoryRepository {
+	return &BandMemoryRepository{
+		store: store,
+	}
+}
+
+func (r *BandMemoryRepository) FindAll() ([]*entities.Band, error) {
+	return r.find(func(band *entities.Band) bool { return true })
+}
+
+func (r *BandMemoryRepository) FindOneByID(ID primitive.ObjectID) (*entities.Band, error) {
+	bands, err := r.find(func(band *entities.Band) bool { return band.ID == ID })
+	if err != nil {
+		return nil, err
+	}
+
+	return bands[0], nil
+}
+
+func (r *BandMemoryRepository) FindOneByDriveFolderID(driveFolderID string) (*entities.Band, error) {
+	bands, err := r.find(func(band *entities.Band) bool { return band.DriveFolderID == driveFolderID })
+	if err != nil {
+		return nil, err
+	}
+
+	return bands[0], nil
+}
+
+func (r *BandMemoryRepository) FindOneByChatID(chatID int64) (*entities.Band, error) {
+	bands, err := r.find(func(band *entities.Band) bool { return band.ChatID == chatID })
+	if err != nil {
+		return nil, err
+	}
+
+	return bands[0], nil
+}
+
+func (r *BandMemoryRepository) find(match func(band *entities.Band) bool) ([]*entities.Band, error) {
+	var bands []*entities.Band
+	for _, band := range r.store.bands() {
+		if match(band) {
+			band.Roles = r.store.rolesByBandID(band.ID)
+			bands = append(bands, band)
+		}
+	}
+
+	if len(bands) == 0 {
+		return nil, fmt.Errorf("not found")
+	}
+
+	return bands, nil
+}
+
+func (r *BandMemoryRepository) UpdateOne(band entities.Band) (*entities.Band, error) {
+	if band.ID.IsZero() {
+		band.ID = primitive.NewObjectID()
+	}
+
+	band.Roles = nil
+	err := r.store.set("bands", band.ID, band)
+	if err != nil {
+		return nil, err
+	}
+
+	return r.FindOneByID(band.ID)
+}
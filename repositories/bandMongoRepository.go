@@ -11,17 +11,17 @@ import (
 	"os"
 )
 
-type BandRepository struct {
+type BandMongoRepository struct {
 	mongoClient *mongo.Client
 }
 
-func NewBandRepository(mongoClient *mongo.Client) *BandRepository {
-	return &BandRepository{
+func NewBandMongoRepository(mongoClient *mongo.Client) *BandMongoRepository {
+	return &BandMongoRepository{
 		mongoClient: mongoClient,
 	}
 }
 
-func (r *BandRepository) FindAll() ([]*entities.Band, error) {
+func (r *BandMongoRepository) FindAll() ([]*entities.Band, error) {
 	bands, err := r.find(bson.M{"_id": bson.M{"$ne": ""}})
 	if err != nil {
 		return nil, err
@@ -30,7 +30,7 @@ func (r *BandRepository) FindAll() ([]*entities.Band, error) {
 	return bands, nil
 }
 
-func (r *BandRepository) FindOneByID(ID primitive.ObjectID) (*entities.Band, error) {
+func (r *BandMongoRepository) FindOneByID(ID primitive.ObjectID) (*entities.Band, error) {
 	bands, err := r.find(bson.M{"_id": ID})
 	if err != nil {
 		return nil, err
@@ -39,7 +39,7 @@ func (r *BandRepository) FindOneByID(ID primitive.ObjectID) (*entities.Band, err
 	return bands[0], nil
 }
 
-func (r *BandRepository) FindOneByDriveFolderID(driveFolderID string) (*entities.Band, error) {
+func (r *BandMongoRepository) FindOneByDriveFolderID(driveFolderID string) (*entities.Band, error) {
 	bands, err := r.find(bson.M{"driveFolderId": driveFolderID})
 	if err != nil {
 		return nil, err
@@ -48,7 +48,16 @@ func (r *BandRepository) FindOneByDriveFolderID(driveFolderID string) (*entities
 	return bands[0], nil
 }
 
-func (r *BandRepository) find(m bson.M) ([]*entities.Band, error) {
+func (r *BandMongoRepository) FindOneByChatID(chatID int64) (*entities.Band, error) {
+	bands, err := r.find(bson.M{"chatId": chatID})
+	if err != nil {
+		return nil, err
+	}
+
+	return bands[0], nil
+}
+
+func (r *BandMongoRepository) find(m bson.M) ([]*entities.Band, error) {
 	collection := r.mongoClient.Database(os.Getenv("MONGODB_DATABASE_NAME")).Collection("bands")
 
 	pipeline := bson.A{
@@ -88,7 +97,7 @@ func (r *BandRepository) find(m bson.M) ([]*entities.Band, error) {
 	return bands, nil
 }
 
-func (r *BandRepository) UpdateOne(band entities.Band) (*entities.Band, error) {
+func (r *BandMongoRepository) UpdateOne(band entities.Band) (*entities.Band, error) {
 	if band.ID.IsZero() {
 		band.ID = r.generateUniqueID()
 	}
@@ -123,7 +132,7 @@ func (r *BandRepository) UpdateOne(band entities.Band) (*entities.Band, error) {
 	return r.FindOneByID(newBand.ID)
 }
 
-func (r *BandRepository) generateUniqueID() primitive.ObjectID {
+func (r *BandMongoRepository) generateUniqueID() primitive.ObjectID {
 	ID := primitive.NilObjectID
 
 	for ID.IsZero() {
@@ -0,0 +1,280 @@
+package repositories
+
+import (
+	"github.com/joeyave/scala-chords-bot/entities"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"sort"
+	"time"
+)
+
+type EventMemoryRepository struct {
+	store *MemoryStore
+}
+
+func NewEventMemoryRepository(store *MemoryStore) *EventMemoryRepository {
+	return &EventMemoryRepository{
+		store: store,
+	}
+}
+
+func (r *EventMemoryRepository) FindAll() ([]*entities.Event, error) {
+	return r.find(func(event *entities.Event) bool { return true })
+}
+
+func (r *EventMemoryRepository) FindAllFromToday() ([]*entities.Event, error) {
+	today := startOfToday()
+
+	return r.find(func(event *entities.Event) bool {
+		return !event.Time.Before(today)
+	})
+}
+
+func (r *EventMemoryRepository) FindOneOldestByBandID(bandID primitive.ObjectID) (*entities.Event, error) {
+	events, err := r.find(func(event *entities.Event) bool { return event.BandID == bandID })
+	if err != nil {
+		return nil, err
+	}
+
+	return events[0], nil
+}
+
+func (r *EventMemoryRepository) FindManyFromTodayByBandID(bandID primitive.ObjectID) ([]*entities.Event, error) {
+	today := startOfToday()
+
+	return r.find(func(event *entities.Event) bool {
+		return event.BandID == bandID && !event.Time.Before(today)
+	})
+}
+
+func (r *EventMemoryRepository) FindManyFromTodayByBandIDAndUserID(bandID primitive.ObjectID, userID int64) ([]*entities.Event, error) {
+	today := startOfToday()
+
+	return r.find(func(event *entities.Event) bool {
+		if event.BandID != bandID || event.Time.Before(today) {
+			return false
+		}
+
+		for _, membership := range event.Memberships {
+			if membership.UserID == userID {
+				return true
+			}
+		}
+		return false
+	})
+}
+
+func (r *EventMemoryRepository) FindManyFromTodayByUserID(userID int64) ([]*entities.Event, error) {
+	today := startOfToday()
+
+	return r.find(func(event *entities.Event) bool {
+		if event.Time.Before(today) {
+			return false
+		}
+
+		for _, membership := range event.Memberships {
+			if membership.UserID == userID {
+				return true
+			}
+		}
+		return false
+	})
+}
+
+func (r *EventMemoryRepository) FindManyFromTodayByTemplateID(templateID primitive.ObjectID) ([]*entities.Event, error) {
+	today := startOfToday()
+
+	return r.find(func(event *entities.Event) bool {
+		return event.TemplateID == templateID && !event.Time.Before(today)
+	})
+}
+
+func (r *EventMemoryRepository) FindMultipleByIDs(IDs []primitive.ObjectID) ([]*entities.Event, error) {
+	return r.find(func(event *entities.Event) bool {
+		for _, ID := range IDs {
+			if event.ID == ID {
+				return true
+			}
+		}
+		return false
+	})
+}
+
+func (r *EventMemoryRepository) FindOneByID(ID primitive.ObjectID) (*entities.Event, error) {
+	events, err := r.find(func(event *entities.Event) bool { return event.ID == ID })
+	if err != nil {
+		return nil, err
+	}
+
+	return events[0], nil
+}
+
+func (r *EventMemoryRepository) FindOneByNameAndTime(name string, time time.Time) (*entities.Event, error) {
+	events, err := r.find(func(event *entities.Event) bool {
+		return event.Name == name && !event.Time.Before(time) && event.Time.Before(time.AddDate(0, 0, 1))
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return events[0], nil
+}
+
+func (r *EventMemoryRepository) find(match func(event *entities.Event) bool) ([]*entities.Event, error) {
+	var events []*entities.Event
+	for _, event := range r.store.events() {
+		event.Memberships = r.store.membershipsByEventID(event.ID)
+		if !match(event) {
+			continue
+		}
+
+		events = append(events, r.store.eventWithExtra(event))
+	}
+
+	if len(events) == 0 {
+		return nil, mongo.ErrNoDocuments
+	}
+
+	sort.SliceStable(events, func(i, j int) bool {
+		return events[i].Time.Before(events[j].Time)
+	})
+
+	return events, nil
+}
+
+func (r *EventMemoryRepository) UpdateOne(event entities.Event) (*entities.Event, error) {
+	if event.ID.IsZero() {
+		event.ID = primitive.NewObjectID()
+	}
+
+	event.Memberships = nil
+	event.Band = nil
+	event.Songs = nil
+	err := r.store.set("events", event.ID, event)
+	if err != nil {
+		return nil, err
+	}
+
+	return r.FindOneByID(event.ID)
+}
+
+func (r *EventMemoryRepository) DeleteOneByID(ID primitive.ObjectID) error {
+	r.store.deleteMany("events", "_id", ID)
+	return nil
+}
+
+func (r *EventMemoryRepository) GetSongs(eventID primitive.ObjectID) ([]*entities.Song, error) {
+	for _, event := range r.store.events() {
+		if event.ID == eventID {
+			return r.store.songsByIDs(event.SongIDs, false), nil
+		}
+	}
+
+	return []*entities.Song{}, nil
+}
+
+func (r *EventMemoryRepository) PushSongID(eventID primitive.ObjectID, songID primitive.ObjectID) error {
+	songIDs, ok := r.songIDs(eventID)
+	if !ok {
+		return nil
+	}
+
+	for _, ID := range songIDs {
+		if ID == songID {
+			return nil
+		}
+	}
+
+	return r.setSongIDs(eventID, append(songIDs, songID))
+}
+
+func (r *EventMemoryRepository) ChangeSongIDPosition(eventID primitive.ObjectID, songID primitive.ObjectID, newPosition int) error {
+	songIDs, ok := r.songIDs(eventID)
+	if !ok {
+		return nil
+	}
+
+	songIDs = removeObjectID(songIDs, songID)
+
+	if newPosition < 0 {
+		newPosition = len(songIDs) + newPosition
+		if newPosition < 0 {
+			newPosition = 0
+		}
+	}
+	if newPosition > len(songIDs) {
+		newPosition = len(songIDs)
+	}
+
+	songIDs = append(songIDs[:newPosition], append([]primitive.ObjectID{songID}, songIDs[newPosition:]...)...)
+
+	return r.setSongIDs(eventID, songIDs)
+}
+
+func (r *EventMemoryRepository) PullSongID(eventID primitive.ObjectID, songID primitive.ObjectID) error {
+	songIDs, ok := r.songIDs(eventID)
+	if !ok {
+		return nil
+	}
+
+	err := r.setSongIDs(eventID, removeObjectID(songIDs, songID))
+	if err != nil {
+		return err
+	}
+
+	event, err := r.FindOneByID(eventID)
+	if err != nil {
+		return err
+	}
+
+	setlist := make([]*entities.SetlistEntry, 0)
+	for _, entry := range event.Setlist {
+		if entry.SongID != songID {
+			setlist = append(setlist, entry)
+		}
+	}
+
+	return r.store.set("events", eventID, bson.M{"setlist": setlist})
+}
+
+func (r *EventMemoryRepository) SetSongIDs(eventID primitive.ObjectID, songIDs []primitive.ObjectID, setlist []*entities.SetlistEntry) error {
+	if songIDs == nil {
+		songIDs = []primitive.ObjectID{}
+	}
+	if setlist == nil {
+		setlist = []*entities.SetlistEntry{}
+	}
+	return r.store.set("events", eventID, bson.M{"songIds": songIDs, "setlist": setlist})
+}
+
+func (r *EventMemoryRepository) songIDs(eventID primitive.ObjectID) ([]primitive.ObjectID, bool) {
+	for _, event := range r.store.events() {
+		if event.ID == eventID {
+			return event.SongIDs, true
+		}
+	}
+	return nil, false
+}
+
+func (r *EventMemoryRepository) setSongIDs(eventID primitive.ObjectID, songIDs []primitive.ObjectID) error {
+	if songIDs == nil {
+		songIDs = []primitive.ObjectID{}
+	}
+	return r.store.set("events", eventID, bson.M{"songIds": songIDs})
+}
+
+func removeObjectID(IDs []primitive.ObjectID, ID primitive.ObjectID) []primitive.ObjectID {
+	result := make([]primitive.ObjectID, 0, len(IDs))
+	for _, id := range IDs {
+		if id != ID {
+			result = append(result, id)
+		}
+	}
+	return result
+}
+
+func startOfToday() time.Time {
+	now := time.Now()
+	return time.Date(now.Year(), now.Month(), now.Day(), 0, 0, 0, 0, now.Location())
+}
@@ -2,7 +2,6 @@ package repositories
 
 import (
 	"context"
-	"fmt"
 	"github.com/joeyave/scala-chords-bot/entities"
 	"go.mongodb.org/mongo-driver/bson"
 	"go.mongodb.org/mongo-driver/bson/primitive"
@@ -12,17 +11,17 @@ import (
 	"time"
 )
 
-type EventRepository struct {
+type EventMongoRepository struct {
 	mongoClient *mongo.Client
 }
 
-func NewEventRepository(mongoClient *mongo.Client) *EventRepository {
-	return &EventRepository{
+func NewEventMongoRepository(mongoClient *mongo.Client) *EventMongoRepository {
+	return &EventMongoRepository{
 		mongoClient: mongoClient,
 	}
 }
 
-func (r *EventRepository) FindAll() ([]*entities.Event, error) {
+func (r *EventMongoRepository) FindAll() ([]*entities.Event, error) {
 	events, err := r.find(bson.M{"_id": bson.M{"$ne": ""}})
 	if err != nil {
 		return nil, err
@@ -31,7 +30,7 @@ func (r *EventRepository) FindAll() ([]*entities.Event, error) {
 	return events, nil
 }
 
-func (r *EventRepository) FindAllFromToday() ([]*entities.Event, error) {
+func (r *EventMongoRepository) FindAllFromToday() ([]*entities.Event, error) {
 	now := time.Now()
 
 	return r.find(bson.M{
@@ -41,7 +40,7 @@ func (r *EventRepository) FindAllFromToday() ([]*entities.Event, error) {
 	})
 }
 
-func (r *EventRepository) FindOneOldestByBandID(bandID primitive.ObjectID) (*entities.Event, error) {
+func (r *EventMongoRepository) FindOneOldestByBandID(bandID primitive.ObjectID) (*entities.Event, error) {
 	event, err := r.find(
 		bson.M{
 			"bandId": bandID,
@@ -62,7 +61,7 @@ func (r *EventRepository) FindOneOldestByBandID(bandID primitive.ObjectID) (*ent
 	return event[0], err
 }
 
-func (r *EventRepository) FindManyFromTodayByBandID(bandID primitive.ObjectID) ([]*entities.Event, error) {
+func (r *EventMongoRepository) FindManyFromTodayByBandID(bandID primitive.ObjectID) ([]*entities.Event, error) {
 	now := time.Now()
 
 	return r.find(bson.M{
@@ -73,7 +72,7 @@ func (r *EventRepository) FindManyFromTodayByBandID(bandID primitive.ObjectID) (
 	})
 }
 
-func (r *EventRepository) FindManyFromTodayByBandIDAndUserID(bandID primitive.ObjectID, userID int64) ([]*entities.Event, error) {
+func (r *EventMongoRepository) FindManyFromTodayByBandIDAndUserID(bandID primitive.ObjectID, userID int64) ([]*entities.Event, error) {
 	now := time.Now()
 
 	return r.find(bson.M{
@@ -85,7 +84,29 @@ func (r *EventRepository) FindManyFromTodayByBandIDAndUserID(bandID primitive.Ob
 	})
 }
 
-func (r *EventRepository) FindMultipleByIDs(IDs []primitive.ObjectID) ([]*entities.Event, error) {
+func (r *EventMongoRepository) FindManyFromTodayByUserID(userID int64) ([]*entities.Event, error) {
+	now := time.Now()
+
+	return r.find(bson.M{
+		"memberships.userId": userID,
+		"time": bson.M{
+			"$gte": time.Date(now.Year(), now.Month(), now.Day(), 0, 0, 0, 0, now.Location()),
+		},
+	})
+}
+
+func (r *EventMongoRepository) FindManyFromTodayByTemplateID(templateID primitive.ObjectID) ([]*entities.Event, error) {
+	now := time.Now()
+
+	return r.find(bson.M{
+		"templateId": templateID,
+		"time": bson.M{
+			"$gte": time.Date(now.Year(), now.Month(), now.Day(), 0, 0, 0, 0, now.Location()),
+		},
+	})
+}
+
+func (r *EventMongoRepository) FindMultipleByIDs(IDs []primitive.ObjectID) ([]*entities.Event, error) {
 	return r.find(bson.M{
 		"_id": bson.M{
 			"$in": IDs,
@@ -93,7 +114,7 @@ func (r *EventRepository) FindMultipleByIDs(IDs []primitive.ObjectID) ([]*entiti
 	})
 }
 
-func (r *EventRepository) FindOneByID(ID primitive.ObjectID) (*entities.Event, error) {
+func (r *EventMongoRepository) FindOneByID(ID primitive.ObjectID) (*entities.Event, error) {
 	events, err := r.find(bson.M{"_id": ID})
 	if err != nil {
 		return nil, err
@@ -102,7 +123,7 @@ func (r *EventRepository) FindOneByID(ID primitive.ObjectID) (*entities.Event, e
 	return events[0], nil
 }
 
-func (r *EventRepository) FindOneByNameAndTime(name string, time time.Time) (*entities.Event, error) {
+func (r *EventMongoRepository) FindOneByNameAndTime(name string, time time.Time) (*entities.Event, error) {
 	events, err := r.find(
 		bson.M{
 			"name": name,
@@ -119,7 +140,7 @@ func (r *EventRepository) FindOneByNameAndTime(name string, time time.Time) (*en
 	return events[0], nil
 }
 
-func (r *EventRepository) find(m bson.M, opts ...bson.M) ([]*entities.Event, error) {
+func (r *EventMongoRepository) find(m bson.M, opts ...bson.M) ([]*entities.Event, error) {
 	collection := r.mongoClient.Database(os.Getenv("MONGODB_DATABASE_NAME")).Collection("events")
 
 	pipeline := bson.A{
@@ -151,8 +172,8 @@ func (r *EventRepository) find(m bson.M, opts ...bson.M) ([]*entities.Event, err
 					},
 					bson.M{
 						"$sort": bson.D{
-							{"role._id", 1},
-							{"role.priority", 1},
+							{Key: "role._id", Value: 1},
+							{Key: "role.priority", Value: 1},
 						},
 					},
 					bson.M{
@@ -343,13 +364,13 @@ func (r *EventRepository) find(m bson.M, opts ...bson.M) ([]*entities.Event, err
 	}
 
 	if len(events) == 0 {
-		return nil, fmt.Errorf("not found")
+		return nil, mongo.ErrNoDocuments
 	}
 
 	return events, nil
 }
 
-func (r *EventRepository) UpdateOne(event entities.Event) (*entities.Event, error) {
+func (r *EventMongoRepository) UpdateOne(event entities.Event) (*entities.Event, error) {
 	if event.ID.IsZero() {
 		event.ID = r.generateUniqueID()
 	}
@@ -386,14 +407,14 @@ func (r *EventRepository) UpdateOne(event entities.Event) (*entities.Event, erro
 	return r.FindOneByID(newEvent.ID)
 }
 
-func (r *EventRepository) DeleteOneByID(ID primitive.ObjectID) error {
+func (r *EventMongoRepository) DeleteOneByID(ID primitive.ObjectID) error {
 	collection := r.mongoClient.Database(os.Getenv("MONGODB_DATABASE_NAME")).Collection("events")
 
 	_, err := collection.DeleteOne(context.TODO(), bson.M{"_id": ID})
 	return err
 }
 
-func (r *EventRepository) GetSongs(eventID primitive.ObjectID) ([]*entities.Song, error) {
+func (r *EventMongoRepository) GetSongs(eventID primitive.ObjectID) ([]*entities.Song, error) {
 	collection := r.mongoClient.Database(os.Getenv("MONGODB_DATABASE_NAME")).Collection("events")
 
 	pipeline := bson.A{
@@ -462,7 +483,7 @@ func (r *EventRepository) GetSongs(eventID primitive.ObjectID) ([]*entities.Song
 	return events[0].Songs, nil
 }
 
-func (r *EventRepository) PushSongID(eventID primitive.ObjectID, songID primitive.ObjectID) error {
+func (r *EventMongoRepository) PushSongID(eventID primitive.ObjectID, songID primitive.ObjectID) error {
 	collection := r.mongoClient.Database(os.Getenv("MONGODB_DATABASE_NAME")).Collection("events")
 
 	filter := bson.M{
@@ -480,13 +501,14 @@ func (r *EventRepository) PushSongID(eventID primitive.ObjectID, songID primitiv
 	return err
 }
 
-func (r *EventRepository) ChangeSongIDPosition(eventID primitive.ObjectID, songID primitive.ObjectID, newPosition int) error {
+func (r *EventMongoRepository) ChangeSongIDPosition(eventID primitive.ObjectID, songID primitive.ObjectID, newPosition int) error {
 	collection := r.mongoClient.Database(os.Getenv("MONGODB_DATABASE_NAME")).Collection("events")
 
 	filter := bson.M{
 		"_id": eventID,
 	}
 
+	// The setlist entry of the song stays, only its position changes.
 	update := bson.M{
 		"$pull": bson.M{
 			"songIds": songID,
@@ -494,6 +516,9 @@ func (r *EventRepository) ChangeSongIDPosition(eventID primitive.ObjectID, songI
 	}
 
 	_, err := collection.UpdateOne(context.TODO(), filter, update)
+	if err != nil {
+		return err
+	}
 
 	filter = bson.M{
 		"_id":     eventID,
@@ -513,7 +538,7 @@ func (r *EventRepository) ChangeSongIDPosition(eventID primitive.ObjectID, songI
 	return err
 }
 
-func (r *EventRepository) PullSongID(eventID primitive.ObjectID, songID primitive.ObjectID) error {
+func (r *EventMongoRepository) PullSongID(eventID primitive.ObjectID, songID primitive.ObjectID) error {
 	collection := r.mongoClient.Database(os.Getenv("MONGODB_DATABASE_NAME")).Collection("events")
 
 	filter := bson.M{"_id": eventID}
@@ -521,6 +546,31 @@ func (r *EventRepository) PullSongID(eventID primitive.ObjectID, songID primitiv
 	update := bson.M{
 		"$pull": bson.M{
 			"songIds": songID,
+			"setlist": bson.M{"songId": songID},
+		},
+	}
+
+	_, err := collection.UpdateOne(context.TODO(), filter, update)
+	return err
+}
+
+// SetSongIDs replaces the songs and the setlist of the event at once. Unlike UpdateOne, it saves empty lists too.
+func (r *EventMongoRepository) SetSongIDs(eventID primitive.ObjectID, songIDs []primitive.ObjectID, setlist []*entities.SetlistEntry) error {
+	collection := r.mongoClient.Database(os.Getenv("MONGODB_DATABASE_NAME")).Collection("events")
+
+	if songIDs == nil {
+		songIDs = []primitive.ObjectID{}
+	}
+	if setlist == nil {
+		setlist = []*entities.SetlistEntry{}
+	}
+
+	filter := bson.M{"_id": eventID}
+
+	update := bson.M{
+		"$set": bson.M{
+			"songIds": songIDs,
+			"setlist": setlist,
 		},
 	}
 
@@ -528,7 +578,7 @@ func (r *EventRepository) PullSongID(eventID primitive.ObjectID, songID primitiv
 	return err
 }
 
-func (r *EventRepository) generateUniqueID() primitive.ObjectID {
+func (r *EventMongoRepository) generateUniqueID() primitive.ObjectID {
 	ID := primitive.NilObjectID
 
 	for ID.IsZero() {
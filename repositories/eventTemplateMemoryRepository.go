@@ -0,0 +1,78 @@
+package repositories
+
+import (
+	"github.com/joeyave/scala-chords-bot/entities"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"sort"
+)
+
+type EventTemplateMemoryRepository struct {
+	store *MemoryStore
+}
+
+func NewEventTemplateMemoryRepository(store *MemoryStore) *EventTemplateMemoryRepository {
+	return &EventTemplateMemoryRepository{
+		store: store,
+	}
+}
+
+func (r *EventTemplateMemoryRepository) FindAll() ([]*entities.EventTemplate, error) {
+	return r.find(func(template *entities.EventTemplate) bool { return true })
+}
+
+func (r *EventTemplateMemoryRepository) FindManyByBandID(bandID primitive.ObjectID) ([]*entities.EventTemplate, error) {
+	return r.find(func(template *entities.EventTemplate) bool { return template.BandID == bandID })
+}
+
+func (r *EventTemplateMemoryRepository) FindOneByID(ID primitive.ObjectID) (*entities.EventTemplate, error) {
+	templates, err := r.find(func(template *entities.EventTemplate) bool { return template.ID == ID })
+	if err != nil {
+		return nil, err
+	}
+
+	return templates[0], nil
+}
+
+func (r *EventTemplateMemoryRepository) find(match func(template *entities.EventTemplate) bool) ([]*entities.EventTemplate, error) {
+	var all []*entities.EventTemplate
+	err := r.store.all("eventTemplates", &all)
+	if err != nil {
+		return nil, err
+	}
+
+	var templates []*entities.EventTemplate
+	for _, template := range all {
+		if match(template) {
+			templates = append(templates, template)
+		}
+	}
+
+	if len(templates) == 0 {
+		return nil, mongo.ErrNoDocuments
+	}
+
+	sort.SliceStable(templates, func(i, j int) bool {
+		return templates[i].Name < templates[j].Name
+	})
+
+	return templates, nil
+}
+
+func (r *EventTemplateMemoryRepository) UpdateOne(template entities.EventTemplate) (*entities.EventTemplate, error) {
+	if template.ID.IsZero() {
+		template.ID = primitive.NewObjectID()
+	}
+
+	err := r.store.set("eventTemplates", template.ID, template)
+	if err != nil {
+		return nil, err
+	}
+
+	return r.FindOneByID(template.ID)
+}
+
+func (r *EventTemplateMemoryRepository) DeleteOneByID(ID primitive.ObjectID) error {
+	r.store.deleteMany("eventTemplates", "_id", ID)
+	return nil
+}
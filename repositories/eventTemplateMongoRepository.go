@@ -0,0 +1,125 @@
+package repositories
+
+import (
+	"context"
+	"github.com/joeyave/scala-chords-bot/entities"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+	"os"
+)
+
+type EventTemplateMongoRepository struct {
+	mongoClient *mongo.Client
+}
+
+func NewEventTemplateMongoRepository(mongoClient *mongo.Client) *EventTemplateMongoRepository {
+	return &EventTemplateMongoRepository{
+		mongoClient: mongoClient,
+	}
+}
+
+func (r *EventTemplateMongoRepository) FindAll() ([]*entities.EventTemplate, error) {
+	return r.find(bson.M{"_id": bson.M{"$ne": ""}})
+}
+
+func (r *EventTemplateMongoRepository) FindManyByBandID(bandID primitive.ObjectID) ([]*entities.EventTemplate, error) {
+	return r.find(bson.M{"bandId": bandID})
+}
+
+func (r *EventTemplateMongoRepository) FindOneByID(ID primitive.ObjectID) (*entities.EventTemplate, error) {
+	templates, err := r.find(bson.M{"_id": ID})
+	if err != nil {
+		return nil, err
+	}
+
+	return templates[0], nil
+}
+
+func (r *EventTemplateMongoRepository) find(m bson.M) ([]*entities.EventTemplate, error) {
+	collection := r.mongoClient.Database(os.Getenv("MONGODB_DATABASE_NAME")).Collection("eventTemplates")
+
+	pipeline := bson.A{
+		bson.M{
+			"$match": m,
+		},
+		bson.M{
+			"$sort": bson.M{
+				"name": 1,
+			},
+		},
+	}
+
+	cur, err := collection.Aggregate(context.TODO(), pipeline)
+	if err != nil {
+		return nil, err
+	}
+
+	var templates []*entities.EventTemplate
+	err = cur.All(context.TODO(), &templates)
+	if err != nil {
+		return nil, err
+	}
+
+	if len(templates) == 0 {
+		return nil, mongo.ErrNoDocuments
+	}
+
+	return templates, nil
+}
+
+func (r *EventTemplateMongoRepository) UpdateOne(template entities.EventTemplate) (*entities.EventTemplate, error) {
+	if template.ID.IsZero() {
+		template.ID = r.generateUniqueID()
+	}
+
+	collection := r.mongoClient.Database(os.Getenv("MONGODB_DATABASE_NAME")).Collection("eventTemplates")
+
+	filter := bson.M{"_id": template.ID}
+
+	update := bson.M{
+		"$set": template,
+	}
+
+	after := options.After
+	upsert := true
+	opts := options.FindOneAndUpdateOptions{
+		ReturnDocument: &after,
+		Upsert:         &upsert,
+	}
+
+	result := collection.FindOneAndUpdate(context.TODO(), filter, update, &opts)
+	if result.Err() != nil {
+		return nil, result.Err()
+	}
+
+	var newTemplate *entities.EventTemplate
+	err := result.Decode(&newTemplate)
+	if err != nil {
+		return nil, err
+	}
+
+	return r.FindOneByID(newTemplate.ID)
+}
+
+func (r *EventTemplateMongoRepository) DeleteOneByID(ID primitive.ObjectID) error {
+	collection := r.mongoClient.Database(os.Getenv("MONGODB_DATABASE_NAME")).Collection("eventTemplates")
+
+	_, err := collection.DeleteOne(context.TODO(), bson.M{"_id": ID})
+	return err
+}
+
+func (r *EventTemplateMongoRepository) generateUniqueID() primitive.ObjectID {
+	ID := primitive.NilObjectID
+
+	for ID.IsZero() {
+		ID = primitive.NewObjectID()
+		_, err := r.FindOneByID(ID)
+		if err == nil {
+			ID = primitive.NilObjectID
+		}
+	}
+
+	return ID
+}
@@ -0,0 +1,96 @@
+package repositories
+
+import (
+	"fmt"
+	"github.com/joeyave/scala-chords-bot/entities"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"sync"
+)
+
+type InviteMemoryRepository struct {
+	store *MemoryStore
+
+	// Makes IncrementUses atomic.
+	mu sync.Mutex
+}
+
+func NewInviteMemoryRepository(store *MemoryStore) *InviteMemoryRepository {
+	return &InviteMemoryRepository{
+		store: store,
+	}
+}
+
+func (r *InviteMemoryRepository) FindManyByBandID(bandID primitive.ObjectID) ([]*entities.Invite, error) {
+	return r.find(func(invite *entities.Invite) bool { return invite.BandID == bandID })
+}
+
+func (r *InviteMemoryRepository) FindOneByToken(token string) (*entities.Invite, error) {
+	invites, err := r.find(func(invite *entities.Invite) bool { return invite.Token == token })
+	if err != nil {
+		return nil, err
+	}
+
+	return invites[0], nil
+}
+
+func (r *InviteMemoryRepository) find(match func(invite *entities.Invite) bool) ([]*entities.Invite, error) {
+	var all []*entities.Invite
+	err := r.store.all("invites", &all)
+	if err != nil {
+		return nil, err
+	}
+
+	var invites []*entities.Invite
+	for _, invite := range all {
+		if match(invite) {
+			invites = append(invites, invite)
+		}
+	}
+
+	if len(invites) == 0 {
+		return nil, fmt.Errorf("not found")
+	}
+
+	return invites, nil
+}
+
+func (r *InviteMemoryRepository) UpdateOne(invite entities.Invite) (*entities.Invite, error) {
+	if invite.ID.IsZero() {
+		invite.ID = primitive.NewObjectID()
+	}
+
+	err := r.store.set("invites", invite.ID, invite)
+	if err != nil {
+		return nil, err
+	}
+
+	invites, err := r.find(func(i *entities.Invite) bool { return i.ID == invite.ID })
+	if err != nil {
+		return nil, err
+	}
+
+	return invites[0], nil
+}
+
+func (r *InviteMemoryRepository) IncrementUses(ID primitive.ObjectID) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	invites, err := r.find(func(invite *entities.Invite) bool { return invite.ID == ID })
+	if err != nil {
+		return err
+	}
+
+	invite := invites[0]
+	if invite.MaxUses != 0 && invite.Uses >= invite.MaxUses {
+		return fmt.Errorf("no uses left")
+	}
+
+	invite.Uses++
+	return r.store.set("invites", invite.ID, invite)
+}
+
+func (r *InviteMemoryRepository) DeleteOneByID(ID primitive.ObjectID) error {
+	r.store.deleteMany("invites", "_id", ID)
+	return nil
+}
@@ -0,0 +1,122 @@
+package repositories
+
+import (
+	"context"
+	"fmt"
+	"github.com/joeyave/scala-chords-bot/entities"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+	"os"
+)
+
+type InviteMongoRepository struct {
+	mongoClient *mongo.Client
+}
+
+func NewInviteMongoRepository(mongoClient *mongo.Client) *InviteMongoRepository {
+	return &InviteMongoRepository{
+		mongoClient: mongoClient,
+	}
+}
+
+func (r *InviteMongoRepository) FindManyByBandID(bandID primitive.ObjectID) ([]*entities.Invite, error) {
+	return r.find(bson.M{"bandId": bandID})
+}
+
+func (r *InviteMongoRepository) FindOneByToken(token string) (*entities.Invite, error) {
+	invites, err := r.find(bson.M{"token": token})
+	if err != nil {
+		return nil, err
+	}
+
+	return invites[0], nil
+}
+
+func (r *InviteMongoRepository) find(m bson.M) ([]*entities.Invite, error) {
+	collection := r.mongoClient.Database(os.Getenv("MONGODB_DATABASE_NAME")).Collection("invites")
+
+	opts := options.Find().SetSort(bson.M{"_id": 1})
+	cur, err := collection.Find(context.TODO(), m, opts)
+	if err != nil {
+		return nil, err
+	}
+
+	var invites []*entities.Invite
+	err = cur.All(context.TODO(), &invites)
+	if err != nil {
+		return nil, err
+	}
+
+	if len(invites) == 0 {
+		return nil, fmt.Errorf("not found")
+	}
+
+	return invites, nil
+}
+
+func (r *InviteMongoRepository) UpdateOne(invite entities.Invite) (*entities.Invite, error) {
+	if invite.ID.IsZero() {
+		invite.ID = primitive.NewObjectID()
+	}
+
+	collection := r.mongoClient.Database(os.Getenv("MONGODB_DATABASE_NAME")).Collection("invites")
+
+	filter := bson.M{"_id": invite.ID}
+
+	update := bson.M{
+		"$set": invite,
+	}
+
+	after := options.After
+	upsert := true
+	opts := options.FindOneAndUpdateOptions{
+		ReturnDocument: &after,
+		Upsert:         &upsert,
+	}
+
+	result := collection.FindOneAndUpdate(context.TODO(), filter, update, &opts)
+	if result.Err() != nil {
+		return nil, result.Err()
+	}
+
+	var newInvite *entities.Invite
+	err := result.Decode(&newInvite)
+	if err != nil {
+		return nil, err
+	}
+
+	return newInvite, nil
+}
+
+func (r *InviteMongoRepository) IncrementUses(ID primitive.ObjectID) error {
+	collection := r.mongoClient.Database(os.Getenv("MONGODB_DATABASE_NAME")).Collection("invites")
+
+	// Checked in the same query, so two users can't take the last use.
+	filter := bson.M{
+		"_id": ID,
+		"$or": bson.A{
+			bson.M{"maxUses": bson.M{"$exists": false}},
+			bson.M{"$expr": bson.M{"$lt": bson.A{bson.M{"$ifNull": bson.A{"$uses", 0}}, "$maxUses"}}},
+		},
+	}
+
+	result, err := collection.UpdateOne(context.TODO(), filter, bson.M{"$inc": bson.M{"uses": 1}})
+	if err != nil {
+		return err
+	}
+
+	if result.ModifiedCount == 0 {
+		return fmt.Errorf("no uses left")
+	}
+
+	return nil
+}
+
+func (r *InviteMongoRepository) DeleteOneByID(ID primitive.ObjectID) error {
+	collection := r.mongoClient.Database(os.Getenv("MONGODB_DATABASE_NAME")).Collection("invites")
+
+	_, err := collection.DeleteOne(context.TODO(), bson.M{"_id": ID})
+	return err
+}
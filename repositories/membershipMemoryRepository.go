@@ -0,0 +1,77 @@
+package repositories
+
+import (
+	"fmt"
+	"github.com/joeyave/scala-chords-bot/entities"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+type MembershipMemoryRepository struct {
+	store *MemoryStore
+}
+
+func NewMembershipMemoryRepository(store *MemoryStore) *MembershipMemoryRepository {
+	return &MembershipMemoryRepository{
+		store: store,
+	}
+}
+
+func (r *MembershipMemoryRepository) FindAll() ([]*entities.Membership, error) {
+	return r.find(func(membership *entities.Membership) bool { return true })
+}
+
+func (r *MembershipMemoryRepository) FindOneByID(ID primitive.ObjectID) (*entities.Membership, error) {
+	memberships, err := r.find(func(membership *entities.Membership) bool { return membership.ID == ID })
+	if err != nil {
+		return nil, err
+	}
+
+	return memberships[0], nil
+}
+
+func (r *MembershipMemoryRepository) FindMultipleByUserIDAndEventID(userID int64, eventID primitive.ObjectID) ([]*entities.Membership, error) {
+	return r.find(func(membership *entities.Membership) bool {
+		return membership.UserID == userID && membership.EventID == eventID
+	})
+}
+
+func (r *MembershipMemoryRepository) find(match func(membership *entities.Membership) bool) ([]*entities.Membership, error) {
+	var memberships []*entities.Membership
+	for _, membership := range r.store.memberships() {
+		if match(membership) {
+			membership.User = r.store.userByID(membership.UserID)
+			memberships = append(memberships, membership)
+		}
+	}
+
+	if len(memberships) == 0 {
+		return nil, fmt.Errorf("not found")
+	}
+
+	return memberships, nil
+}
+
+func (r *MembershipMemoryRepository) UpdateOne(membership entities.Membership) (*entities.Membership, error) {
+	if membership.ID.IsZero() {
+		membership.ID = primitive.NewObjectID()
+	}
+
+	membership.User = nil
+	membership.Role = nil
+	err := r.store.set("memberships", membership.ID, membership)
+	if err != nil {
+		return nil, err
+	}
+
+	return r.FindOneByID(membership.ID)
+}
+
+func (r *MembershipMemoryRepository) DeleteOneByID(ID primitive.ObjectID) error {
+	r.store.deleteMany("memberships", "_id", ID)
+	return nil
+}
+
+func (r *MembershipMemoryRepository) DeleteManyByEventID(eventID primitive.ObjectID) error {
+	r.store.deleteMany("memberships", "eventId", eventID)
+	return nil
+}
@@ -11,17 +11,17 @@ import (
 	"os"
 )
 
-type MembershipRepository struct {
+type MembershipMongoRepository struct {
 	mongoClient *mongo.Client
 }
 
-func NewMembershipRepository(mongoClient *mongo.Client) *MembershipRepository {
-	return &MembershipRepository{
+func NewMembershipMongoRepository(mongoClient *mongo.Client) *MembershipMongoRepository {
+	return &MembershipMongoRepository{
 		mongoClient: mongoClient,
 	}
 }
 
-func (r *MembershipRepository) FindAll() ([]*entities.Membership, error) {
+func (r *MembershipMongoRepository) FindAll() ([]*entities.Membership, error) {
 	memberships, err := r.find(bson.M{"_id": bson.M{"$ne": ""}})
 	if err != nil {
 		return nil, err
@@ -30,7 +30,7 @@ func (r *MembershipRepository) FindAll() ([]*entities.Membership, error) {
 	return memberships, nil
 }
 
-func (r *MembershipRepository) FindOneByID(ID primitive.ObjectID) (*entities.Membership, error) {
+func (r *MembershipMongoRepository) FindOneByID(ID primitive.ObjectID) (*entities.Membership, error) {
 	memberships, err := r.find(bson.M{"_id": ID})
 	if err != nil {
 		return nil, err
@@ -39,7 +39,7 @@ func (r *MembershipRepository) FindOneByID(ID primitive.ObjectID) (*entities.Mem
 	return memberships[0], nil
 }
 
-func (r *MembershipRepository) FindMultipleByUserIDAndEventID(userID int64, eventID primitive.ObjectID) ([]*entities.Membership, error) {
+func (r *MembershipMongoRepository) FindMultipleByUserIDAndEventID(userID int64, eventID primitive.ObjectID) ([]*entities.Membership, error) {
 	memberships, err := r.find(bson.M{"userId": userID, "eventId": eventID})
 	if err != nil {
 		return nil, err
@@ -48,7 +48,7 @@ func (r *MembershipRepository) FindMultipleByUserIDAndEventID(userID int64, even
 	return memberships, nil
 }
 
-func (r *MembershipRepository) find(m bson.M) ([]*entities.Membership, error) {
+func (r *MembershipMongoRepository) find(m bson.M) ([]*entities.Membership, error) {
 	collection := r.mongoClient.Database(os.Getenv("MONGODB_DATABASE_NAME")).Collection("memberships")
 
 	pipeline := bson.A{
@@ -128,7 +128,7 @@ func (r *MembershipRepository) find(m bson.M) ([]*entities.Membership, error) {
 	return memberships, nil
 }
 
-func (r *MembershipRepository) UpdateOne(membership entities.Membership) (*entities.Membership, error) {
+func (r *MembershipMongoRepository) UpdateOne(membership entities.Membership) (*entities.Membership, error) {
 	if membership.ID.IsZero() {
 		membership.ID = r.generateUniqueID()
 	}
@@ -164,21 +164,21 @@ func (r *MembershipRepository) UpdateOne(membership entities.Membership) (*entit
 	return r.FindOneByID(newMembership.ID)
 }
 
-func (r *MembershipRepository) DeleteOneByID(ID primitive.ObjectID) error {
+func (r *MembershipMongoRepository) DeleteOneByID(ID primitive.ObjectID) error {
 	collection := r.mongoClient.Database(os.Getenv("MONGODB_DATABASE_NAME")).Collection("memberships")
 
 	_, err := collection.DeleteOne(context.TODO(), bson.M{"_id": ID})
 	return err
 }
 
-func (r *MembershipRepository) DeleteManyByEventID(eventID primitive.ObjectID) error {
+func (r *MembershipMongoRepository) DeleteManyByEventID(eventID primitive.ObjectID) error {
 	collection := r.mongoClient.Database(os.Getenv("MONGODB_DATABASE_NAME")).Collection("memberships")
 
 	_, err := collection.DeleteMany(context.TODO(), bson.M{"eventId": eventID})
 	return err
 }
 
-func (r *MembershipRepository) generateUniqueID() primitive.ObjectID {
+func (r *MembershipMongoRepository) generateUniqueID() primitive.ObjectID {
 	ID := primitive.NilObjectID
 
 	for ID.IsZero() {
@@ -0,0 +1,320 @@
+package repositories
+
+import (
+	"fmt"
+	"github.com/joeyave/scala-chords-bot/entities"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"reflect"
+	"sort"
+	"sync"
+)
+
+// MemoryStore keeps the documents of every collection in memory.
+// Documents are stored as BSON, so updates behave like "$set" with the same omitempty rules as in MongoDB.
+// It is shared by all in-memory repositories to resolve the joins that the aggregation pipelines do.
+type MemoryStore struct {
+	mu          sync.RWMutex
+	collections map[string][]bson.D
+}
+
+func NewMemoryStore() *MemoryStore {
+	return &MemoryStore{
+		collections: make(map[string][]bson.D),
+	}
+}
+
+// all decodes every document of the collection into results, which must be a pointer to a slice of pointers.
+func (s *MemoryStore) all(collection string, results interface{}) error {
+	s.mu.RLock()
+	docs := make([]bson.D, len(s.collections[collection]))
+	copy(docs, s.collections[collection])
+	s.mu.RUnlock()
+
+	sliceValue := reflect.ValueOf(results).Elem()
+	elemType := sliceValue.Type().Elem().Elem()
+
+	for _, doc := range docs {
+		b, err := bson.Marshal(doc)
+		if err != nil {
+			return err
+		}
+
+		elem := reflect.New(elemType)
+		err = bson.Unmarshal(b, elem.Interface())
+		if err != nil {
+			return err
+		}
+
+		sliceValue.Set(reflect.Append(sliceValue, elem))
+	}
+
+	return nil
+}
+
+// set merges the non-empty fields of v into the document with the given ID, inserting it if needed.
+func (s *MemoryStore) set(collection string, ID interface{}, v interface{}) error {
+	doc, err := toDocument(v)
+	if err != nil {
+		return err
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	docs := s.collections[collection]
+	for i := range docs {
+		if getField(docs[i], "_id") != ID {
+			continue
+		}
+
+		for _, e := range doc {
+			if e.Key == "_id" {
+				continue
+			}
+			docs[i] = setField(docs[i], e.Key, e.Value)
+		}
+		return nil
+	}
+
+	newDoc := bson.D{{Key: "_id", Value: ID}}
+	for _, e := range doc {
+		if e.Key != "_id" {
+			newDoc = append(newDoc, e)
+		}
+	}
+	s.collections[collection] = append(docs, newDoc)
+
+	return nil
+}
+
+// replace overwrites the whole document with the given ID. It fails if there is no such document.
+func (s *MemoryStore) replace(collection string, ID interface{}, v interface{}) error {
+	doc, err := toDocument(v)
+	if err != nil {
+		return err
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	docs := s.collections[collection]
+	for i := range docs {
+		if getField(docs[i], "_id") == ID {
+			docs[i] = doc
+			return nil
+		}
+	}
+
+	return fmt.Errorf("not found")
+}
+
+// deleteMany removes all documents whose field is equal to value.
+func (s *MemoryStore) deleteMany(collection string, key string, value interface{}) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	docs := make([]bson.D, 0)
+	for _, doc := range s.collections[collection] {
+		if getField(doc, key) != value {
+			docs = append(docs, doc)
+		}
+	}
+	s.collections[collection] = docs
+}
+
+func toDocument(v interface{}) (bson.D, error) {
+	b, err := bson.Marshal(v)
+	if err != nil {
+		return nil, err
+	}
+
+	var doc bson.D
+	err = bson.Unmarshal(b, &doc)
+	return doc, err
+}
+
+func getField(doc bson.D, key string) interface{} {
+	for _, e := range doc {
+		if e.Key == key {
+			return e.Value
+		}
+	}
+	return nil
+}
+
+func setField(doc bson.D, key string, value interface{}) bson.D {
+	for i := range doc {
+		if doc[i].Key == key {
+			doc[i].Value = value
+			return doc
+		}
+	}
+	return append(doc, bson.E{Key: key, Value: value})
+}
+
+//
+// Joins. -----------------------------------
+//
+
+func (s *MemoryStore) bands() []*entities.Band {
+	var bands []*entities.Band
+	_ = s.all("bands", &bands)
+	return bands
+}
+
+func (s *MemoryStore) roles() []*entities.Role {
+	var roles []*entities.Role
+	_ = s.all("roles", &roles)
+	return roles
+}
+
+func (s *MemoryStore) users() []*entities.User {
+	var users []*entities.User
+	_ = s.all("users", &users)
+	return users
+}
+
+func (s *MemoryStore) memberships() []*entities.Membership {
+	var memberships []*entities.Membership
+	_ = s.all("memberships", &memberships)
+	return memberships
+}
+
+func (s *MemoryStore) songs() []*entities.Song {
+	var songs []*entities.Song
+	_ = s.all("songs", &songs)
+	return songs
+}
+
+func (s *MemoryStore) voices() []*entities.Voice {
+	var voices []*entities.Voice
+	_ = s.all("voices", &voices)
+	return voices
+}
+
+func (s *MemoryStore) events() []*entities.Event {
+	var events []*entities.Event
+	_ = s.all("events", &events)
+	return events
+}
+
+func (s *MemoryStore) rolesByBandID(bandID primitive.ObjectID) []*entities.Role {
+	roles := make([]*entities.Role, 0)
+	for _, role := range s.roles() {
+		if role.BandID == bandID {
+			roles = append(roles, role)
+		}
+	}
+
+	sort.SliceStable(roles, func(i, j int) bool {
+		return roles[i].Priority < roles[j].Priority
+	})
+
+	return roles
+}
+
+func (s *MemoryStore) roleByID(ID primitive.ObjectID) *entities.Role {
+	for _, role := range s.roles() {
+		if role.ID == ID {
+			return role
+		}
+	}
+	return nil
+}
+
+// bandByID returns the band with its roles, or nil.
+func (s *MemoryStore) bandByID(ID primitive.ObjectID) *entities.Band {
+	for _, band := range s.bands() {
+		if band.ID == ID {
+			band.Roles = s.rolesByBandID(band.ID)
+			return band
+		}
+	}
+	return nil
+}
+
+// userByID returns the user with its band and the band roles, or nil.
+func (s *MemoryStore) userByID(ID int64) *entities.User {
+	for _, user := range s.users() {
+		if user.ID == ID {
+			user.Band = s.bandByID(user.BandID)
+			return user
+		}
+	}
+	return nil
+}
+
+// membershipsByEventID returns memberships of the event with their roles and users, sorted by role.
+func (s *MemoryStore) membershipsByEventID(eventID primitive.ObjectID) []*entities.Membership {
+	memberships := make([]*entities.Membership, 0)
+	for _, membership := range s.memberships() {
+		if membership.EventID == eventID {
+			membership.Role = s.roleByID(membership.RoleID)
+			membership.User = s.userByID(membership.UserID)
+			memberships = append(memberships, membership)
+		}
+	}
+
+	sort.SliceStable(memberships, func(i, j int) bool {
+		return roleLess(memberships[i].Role, memberships[j].Role)
+	})
+
+	return memberships
+}
+
+// songsByIDs returns songs in the order of IDs with their bands and voices.
+func (s *MemoryStore) songsByIDs(IDs []primitive.ObjectID, withExtra bool) []*entities.Song {
+	songs := make([]*entities.Song, 0)
+	all := s.songs()
+	for _, ID := range IDs {
+		for _, song := range all {
+			if song.ID == ID {
+				if withExtra {
+					if band := s.bandByID(song.BandID); band != nil {
+						band.Roles = nil
+						song.Band = band
+					}
+					song.Voices = s.voicesBySongID(song.ID)
+				}
+				songs = append(songs, song)
+				break
+			}
+		}
+	}
+	return songs
+}
+
+func (s *MemoryStore) voicesBySongID(songID primitive.ObjectID) []*entities.Voice {
+	voices := make([]*entities.Voice, 0)
+	for _, voice := range s.voices() {
+		if voice.SongID == songID {
+			voices = append(voices, voice)
+		}
+	}
+	return voices
+}
+
+// eventWithExtra resolves memberships, band and songs of the event.
+func (s *MemoryStore) eventWithExtra(event *entities.Event) *entities.Event {
+	event.Memberships = s.membershipsByEventID(event.ID)
+	event.Band = s.bandByID(event.BandID)
+	event.Songs = s.songsByIDs(event.SongIDs, true)
+	return event
+}
+
+// roleLess orders roles the same way as the events pipeline does: by ID, then by priority.
+func roleLess(a, b *entities.Role) bool {
+	if a == nil || b == nil {
+		return a == nil && b != nil
+	}
+
+	if a.ID != b.ID {
+		return a.ID.Hex() < b.ID.Hex()
+	}
+	return a.Priority < b.Priority
+}
+
+func objectIDLess(a, b primitive.ObjectID) bool {
+	return a.Hex() < b.Hex()
+}
@@ -0,0 +1,74 @@
+package repositories
+
+import (
+	"fmt"
+	"github.com/joeyave/scala-chords-bot/entities"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"sort"
+)
+
+type PermissionGroupMemoryRepository struct {
+	store *MemoryStore
+}
+
+func NewPermissionGroupMemoryRepository(store *MemoryStore) *PermissionGroupMemoryRepository {
+	return &PermissionGroupMemoryRepository{
+		store: store,
+	}
+}
+
+func (r *PermissionGroupMemoryRepository) FindManyByBandID(bandID primitive.ObjectID) ([]*entities.PermissionGroup, error) {
+	return r.find(func(group *entities.PermissionGroup) bool { return group.BandID == bandID })
+}
+
+func (r *PermissionGroupMemoryRepository) FindOneByID(ID primitive.ObjectID) (*entities.PermissionGroup, error) {
+	groups, err := r.find(func(group *entities.PermissionGroup) bool { return group.ID == ID })
+	if err != nil {
+		return nil, err
+	}
+
+	return groups[0], nil
+}
+
+func (r *PermissionGroupMemoryRepository) find(match func(group *entities.PermissionGroup) bool) ([]*entities.PermissionGroup, error) {
+	var all []*entities.PermissionGroup
+	err := r.store.all("permissionGroups", &all)
+	if err != nil {
+		return nil, err
+	}
+
+	var groups []*entities.PermissionGroup
+	for _, group := range all {
+		if match(group) {
+			groups = append(groups, group)
+		}
+	}
+
+	if len(groups) == 0 {
+		return nil, fmt.Errorf("not found")
+	}
+
+	sort.SliceStable(groups, func(i, j int) bool {
+		return groups[i].Name < groups[j].Name
+	})
+
+	return groups, nil
+}
+
+func (r *PermissionGroupMemoryRepository) UpdateOne(group entities.PermissionGroup) (*entities.PermissionGroup, error) {
+	if group.ID.IsZero() {
+		group.ID = primitive.NewObjectID()
+	}
+
+	err := r.store.set("permissionGroups", group.ID, group)
+	if err != nil {
+		return nil, err
+	}
+
+	return r.FindOneByID(group.ID)
+}
+
+func (r *PermissionGroupMemoryRepository) DeleteOneByID(ID primitive.ObjectID) error {
+	r.store.deleteMany("permissionGroups", "_id", ID)
+	return nil
+}
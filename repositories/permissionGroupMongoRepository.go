@@ -0,0 +1,122 @@
+package repositories
+
+import (
+	"context"
+	"fmt"
+	"github.com/joeyave/scala-chords-bot/entities"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+	"os"
+)
+
+type PermissionGroupMongoRepository struct {
+	mongoClient *mongo.Client
+}
+
+func NewPermissionGroupMongoRepository(mongoClient *mongo.Client) *PermissionGroupMongoRepository {
+	return &PermissionGroupMongoRepository{
+		mongoClient: mongoClient,
+	}
+}
+
+func (r *PermissionGroupMongoRepository) FindManyByBandID(bandID primitive.ObjectID) ([]*entities.PermissionGroup, error) {
+	return r.find(bson.M{"bandId": bandID})
+}
+
+func (r *PermissionGroupMongoRepository) FindOneByID(ID primitive.ObjectID) (*entities.PermissionGroup, error) {
+	groups, err := r.find(bson.M{"_id": ID})
+	if err != nil {
+		return nil, err
+	}
+
+	return groups[0], nil
+}
+
+func (r *PermissionGroupMongoRepository) find(m bson.M) ([]*entities.PermissionGroup, error) {
+	collection := r.mongoClient.Database(os.Getenv("MONGODB_DATABASE_NAME")).Collection("permissionGroups")
+
+	pipeline := bson.A{
+		bson.M{
+			"$match": m,
+		},
+		bson.M{
+			"$sort": bson.M{
+				"name": 1,
+			},
+		},
+	}
+
+	cur, err := collection.Aggregate(context.TODO(), pipeline)
+	if err != nil {
+		return nil, err
+	}
+
+	var groups []*entities.PermissionGroup
+	err = cur.All(context.TODO(), &groups)
+	if err != nil {
+		return nil, err
+	}
+
+	if len(groups) == 0 {
+		return nil, fmt.Errorf("not found")
+	}
+
+	return groups, nil
+}
+
+func (r *PermissionGroupMongoRepository) UpdateOne(group entities.PermissionGroup) (*entities.PermissionGroup, error) {
+	if group.ID.IsZero() {
+		group.ID = r.generateUniqueID()
+	}
+
+	collection := r.mongoClient.Database(os.Getenv("MONGODB_DATABASE_NAME")).Collection("permissionGroups")
+
+	filter := bson.M{"_id": group.ID}
+
+	update := bson.M{
+		"$set": group,
+	}
+
+	after := options.After
+	upsert := true
+	opts := options.FindOneAndUpdateOptions{
+		ReturnDocument: &after,
+		Upsert:         &upsert,
+	}
+
+	result := collection.FindOneAndUpdate(context.TODO(), filter, update, &opts)
+	if result.Err() != nil {
+		return nil, result.Err()
+	}
+
+	var newGroup *entities.PermissionGroup
+	err := result.Decode(&newGroup)
+	if err != nil {
+		return nil, err
+	}
+
+	return r.FindOneByID(newGroup.ID)
+}
+
+func (r *PermissionGroupMongoRepository) DeleteOneByID(ID primitive.ObjectID) error {
+	collection := r.mongoClient.Database(os.Getenv("MONGODB_DATABASE_NAME")).Collection("permissionGroups")
+
+	_, err := collection.DeleteOne(context.TODO(), bson.M{"_id": ID})
+	return err
+}
+
+func (r *PermissionGroupMongoRepository) generateUniqueID() primitive.ObjectID {
+	ID := primitive.NilObjectID
+
+	for ID.IsZero() {
+		ID = primitive.NewObjectID()
+		_, err := r.FindOneByID(ID)
+		if err == nil {
+			ID = primitive.NilObjectID
+		}
+	}
+
+	return ID
+}
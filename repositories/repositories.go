@@ -0,0 +1,108 @@
+package repositories
+
+import (
+	"github.com/joeyave/scala-chords-bot/entities"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"time"
+)
+
+// Storage interfaces used by the services.
+// Every repository has a MongoDB implementation and an in-memory one backed by MemoryStore.
+
+type BandRepository interface {
+	FindAll() ([]*entities.Band, error)
+	FindOneByID(ID primitive.ObjectID) (*entities.Band, error)
+	FindOneByDriveFolderID(driveFolderID string) (*entities.Band, error)
+	FindOneByChatID(chatID int64) (*entities.Band, error)
+	UpdateOne(band entities.Band) (*entities.Band, error)
+}
+
+type EventRepository interface {
+	FindAll() ([]*entities.Event, error)
+	FindAllFromToday() ([]*entities.Event, error)
+	FindOneOldestByBandID(bandID primitive.ObjectID) (*entities.Event, error)
+	FindManyFromTodayByBandID(bandID primitive.ObjectID) ([]*entities.Event, error)
+	FindManyFromTodayByBandIDAndUserID(bandID primitive.ObjectID, userID int64) ([]*entities.Event, error)
+	FindManyFromTodayByUserID(userID int64) ([]*entities.Event, error)
+	FindManyFromTodayByTemplateID(templateID primitive.ObjectID) ([]*entities.Event, error)
+	FindMultipleByIDs(IDs []primitive.ObjectID) ([]*entities.Event, error)
+	FindOneByID(ID primitive.ObjectID) (*entities.Event, error)
+	FindOneByNameAndTime(name string, time time.Time) (*entities.Event, error)
+	UpdateOne(event entities.Event) (*entities.Event, error)
+	DeleteOneByID(ID primitive.ObjectID) error
+	GetSongs(eventID primitive.ObjectID) ([]*entities.Song, error)
+	PushSongID(eventID primitive.ObjectID, songID primitive.ObjectID) error
+	ChangeSongIDPosition(eventID primitive.ObjectID, songID primitive.ObjectID, newPosition int) error
+	PullSongID(eventID primitive.ObjectID, songID primitive.ObjectID) error
+	SetSongIDs(eventID primitive.ObjectID, songIDs []primitive.ObjectID, setlist []*entities.SetlistEntry) error
+}
+
+type EventTemplateRepository interface {
+	FindAll() ([]*entities.EventTemplate, error)
+	FindManyByBandID(bandID primitive.ObjectID) ([]*entities.EventTemplate, error)
+	FindOneByID(ID primitive.ObjectID) (*entities.EventTemplate, error)
+	UpdateOne(template entities.EventTemplate) (*entities.EventTemplate, error)
+	DeleteOneByID(ID primitive.ObjectID) error
+}
+
+type PermissionGroupRepository interface {
+	FindManyByBandID(bandID primitive.ObjectID) ([]*entities.PermissionGroup, error)
+	FindOneByID(ID primitive.ObjectID) (*entities.PermissionGroup, error)
+	UpdateOne(group entities.PermissionGroup) (*entities.PermissionGroup, error)
+	DeleteOneByID(ID primitive.ObjectID) error
+}
+
+type MembershipRepository interface {
+	FindAll() ([]*entities.Membership, error)
+	FindOneByID(ID primitive.ObjectID) (*entities.Membership, error)
+	FindMultipleByUserIDAndEventID(userID int64, eventID primitive.ObjectID) ([]*entities.Membership, error)
+	UpdateOne(membership entities.Membership) (*entities.Membership, error)
+	DeleteOneByID(ID primitive.ObjectID) error
+	DeleteManyByEventID(eventID primitive.ObjectID) error
+}
+
+type RoleRepository interface {
+	FindAll() ([]*entities.Role, error)
+	FindOneByID(ID primitive.ObjectID) (*entities.Role, error)
+	UpdateOne(role entities.Role) (*entities.Role, error)
+}
+
+type SongRepository interface {
+	FindAll() ([]*entities.Song, error)
+	FindOneByID(ID primitive.ObjectID) (*entities.Song, error)
+	FindManyByBandID(bandID primitive.ObjectID) ([]*entities.Song, error)
+	FindOneByDriveFileID(driveFileID string) (*entities.Song, error)
+	FindOneByName(name string) (*entities.Song, error)
+	UpdateOne(song entities.Song) (*entities.Song, error)
+	DeleteOneByDriveFileID(driveFileID string) error
+	FindAllExtraByPageNumberSortedByEventsNumber(pageNumber int) ([]*entities.SongExtra, error)
+	FindAllExtraByPageNumberSortedByLatestEventDate(pageNumber int) ([]*entities.SongExtra, error)
+	FindManyExtraByDriveFileIDs(driveFileIDs []string) ([]*entities.SongExtra, error)
+}
+
+type UserRepository interface {
+	FindAll() ([]*entities.User, error)
+	FindOneByID(ID int64) (*entities.User, error)
+	FindOneByName(name string) (*entities.User, error)
+	FindManyByIDs(IDs []int64) ([]*entities.User, error)
+	FindManyByBandID(bandID primitive.ObjectID) ([]*entities.User, error)
+	UpdateOne(user entities.User) (*entities.User, error)
+	FindManyExtraByBandIDAndRoleID(bandID primitive.ObjectID, roleID primitive.ObjectID) ([]*entities.UserExtra, error)
+	FindManyExtraByBandID(bandID primitive.ObjectID) ([]*entities.UserExtra, error)
+}
+
+type VoiceRepository interface {
+	FindOneByID(ID primitive.ObjectID) (*entities.Voice, error)
+	FindOneByFileID(fileID string) (*entities.Voice, error)
+	UpdateOne(voice entities.Voice) (*entities.Voice, error)
+	DeleteOneByID(ID primitive.ObjectID) error
+}
+
+type InviteRepository interface {
+	FindManyByBandID(bandID primitive.ObjectID) ([]*entities.Invite, error)
+	FindOneByToken(token string) (*entities.Invite, error)
+	UpdateOne(invite entities.Invite) (*entities.Invite, error)
+	// IncrementUses fails if the invite has no uses left.
+	IncrementUses(ID primitive.ObjectID) error
+	DeleteOneByID(ID primitive.ObjectID) error
+}
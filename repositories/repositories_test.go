@@ -0,0 +1,403 @@
+package repositories
+
+import (
+	"context"
+	"fmt"
+	"github.com/joeyave/scala-chords-bot/entities"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+	"os"
+	"reflect"
+	"testing"
+	"time"
+)
+
+// The same fixtures are run through the in-memory repositories and, if MONGODB_URI is set,
+// through the MongoDB ones against a throwaway database. Both have to give the same joins and order.
+
+type backend struct {
+	name        string
+	bands       BandRepository
+	roles       RoleRepository
+	users       UserRepository
+	songs       SongRepository
+	voices      VoiceRepository
+	events      EventRepository
+	memberships MembershipRepository
+}
+
+func backends(t *testing.T) []*backend {
+	store := NewMemoryStore()
+	result := []*backend{{
+		name:        "memory",
+		bands:       NewBandMemoryRepository(store),
+		roles:       NewRoleMemoryRepository(store),
+		users:       NewUserMemoryRepository(store),
+		songs:       NewSongMemoryRepository(store),
+		voices:      NewVoiceMemoryRepository(store),
+		events:      NewEventMemoryRepository(store),
+		memberships: NewMembershipMemoryRepository(store),
+	}}
+
+	uri := os.Getenv("MONGODB_URI")
+	if uri == "" {
+		t.Log("MONGODB_URI is not set, only the in-memory repositories are tested")
+		return result
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	client, err := mongo.Connect(ctx, options.Client().ApplyURI(uri))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	database := fmt.Sprintf("test_%s", primitive.NewObjectID().Hex())
+	prevDatabase := os.Getenv("MONGODB_DATABASE_NAME")
+	os.Setenv("MONGODB_DATABASE_NAME", database)
+
+	t.Cleanup(func() {
+		client.Database(database).Drop(context.Background())
+		client.Disconnect(context.Background())
+		os.Setenv("MONGODB_DATABASE_NAME", prevDatabase)
+	})
+
+	return append(result, &backend{
+		name:        "mongo",
+		bands:       NewBandMongoRepository(client),
+		roles:       NewRoleMongoRepository(client),
+		users:       NewUserMongoRepository(client),
+		songs:       NewSongMongoRepository(client),
+		voices:      NewVoiceMongoRepository(client),
+		events:      NewEventMongoRepository(client),
+		memberships: NewMembershipMongoRepository(client),
+	})
+}
+
+type fixtures struct {
+	band              *entities.Band
+	vocals, guitar    *entities.Role
+	one, two, three   *entities.Song
+	sunday, rehearsal *entities.Event
+}
+
+// load saves a band with two roles, two users, three songs and two events:
+// "Rehearsal" tomorrow with Two, Boris plays guitar; "Sunday" in three days with Two and One,
+// Boris sings and Anna plays guitar.
+func (b *backend) load(t *testing.T) *fixtures {
+	var f fixtures
+	var err error
+
+	must := func(err error) {
+		if err != nil {
+			t.Fatalf("%s: %v", b.name, err)
+		}
+	}
+
+	f.band, err = b.bands.UpdateOne(entities.Band{Name: "Band"})
+	must(err)
+
+	// Vocals is created first, so its ID is less, but guitar has the higher priority.
+	f.vocals, err = b.roles.UpdateOne(entities.Role{Name: "Vocals", Priority: 2, BandID: f.band.ID})
+	must(err)
+	f.guitar, err = b.roles.UpdateOne(entities.Role{Name: "Guitar", Priority: 1, BandID: f.band.ID})
+	must(err)
+
+	_, err = b.users.UpdateOne(entities.User{ID: 1, Name: "Anna", BandID: f.band.ID})
+	must(err)
+	_, err = b.users.UpdateOne(entities.User{ID: 2, Name: "Boris", BandID: f.band.ID})
+	must(err)
+
+	song := func(name string) *entities.Song {
+		song, err := b.songs.UpdateOne(entities.Song{
+			DriveFileID: name,
+			BandID:      f.band.ID,
+			PDF:         entities.PDF{Name: name},
+		})
+		must(err)
+		return song
+	}
+	f.one, f.two, f.three = song("One"), song("Two"), song("Three")
+
+	_, err = b.voices.UpdateOne(entities.Voice{Name: "Alto", FileID: "alto", SongID: f.two.ID})
+	must(err)
+
+	now := time.Now().UTC().Truncate(time.Hour)
+	event := func(name string, days int, songs ...*entities.Song) *entities.Event {
+		event := entities.Event{Name: name, Time: now.AddDate(0, 0, days), BandID: f.band.ID}
+		for _, song := range songs {
+			event.SongIDs = append(event.SongIDs, song.ID)
+		}
+		saved, err := b.events.UpdateOne(event)
+		must(err)
+		return saved
+	}
+	f.rehearsal = event("Rehearsal", 1, f.two)
+	f.sunday = event("Sunday", 3, f.two, f.one)
+
+	member := func(event *entities.Event, userID int64, role *entities.Role) {
+		_, err := b.memberships.UpdateOne(entities.Membership{EventID: event.ID, UserID: userID, RoleID: role.ID})
+		must(err)
+	}
+	member(f.rehearsal, 2, f.guitar)
+	member(f.sunday, 1, f.guitar)
+	member(f.sunday, 2, f.vocals)
+
+	return &f
+}
+
+func eventNames(events []*entities.Event) []string {
+	names := make([]string, 0)
+	for _, event := range events {
+		names = append(names, event.Name)
+	}
+	return names
+}
+
+func songNames(songs []*entities.Song) []string {
+	names := make([]string, 0)
+	for _, song := range songs {
+		names = append(names, song.PDF.Name)
+	}
+	return names
+}
+
+func roleNames(roles []*entities.Role) []string {
+	names := make([]string, 0)
+	for _, role := range roles {
+		names = append(names, role.Name)
+	}
+	return names
+}
+
+// memberNames returns memberships as "user/role", the user is "-" if it wasn't joined.
+func memberNames(memberships []*entities.Membership) []string {
+	names := make([]string, 0)
+	for _, membership := range memberships {
+		user := "-"
+		if membership.User != nil {
+			user = membership.User.Name
+		}
+		role := "-"
+		if membership.Role != nil {
+			role = membership.Role.Name
+		}
+		names = append(names, user+"/"+role)
+	}
+	return names
+}
+
+func check(t *testing.T, b *backend, what string, got, want interface{}) {
+	t.Helper()
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("%s: %s = %v, want %v", b.name, what, got, want)
+	}
+}
+
+func TestEventJoins(t *testing.T) {
+	for _, b := range backends(t) {
+		f := b.load(t)
+
+		event, err := b.events.FindOneByID(f.sunday.ID)
+		if err != nil {
+			t.Fatalf("%s: %v", b.name, err)
+		}
+
+		check(t, b, "band", event.Band.Name, "Band")
+		check(t, b, "band roles", roleNames(event.Band.Roles), []string{"Guitar", "Vocals"})
+
+		// Memberships are sorted by the ID of the role first, like the pipeline does.
+		check(t, b, "memberships", memberNames(event.Memberships), []string{"Boris/Vocals", "Anna/Guitar"})
+		check(t, b, "member band", event.Memberships[0].User.Band.Name, "Band")
+		check(t, b, "member band roles", roleNames(event.Memberships[0].User.Band.Roles), []string{"Guitar", "Vocals"})
+
+		check(t, b, "songs", songNames(event.Songs), []string{"Two", "One"})
+		check(t, b, "song band", event.Songs[0].Band.Name, "Band")
+		check(t, b, "song voices", len(event.Songs[0].Voices), 1)
+		check(t, b, "other song voices", len(event.Songs[1].Voices), 0)
+
+		songs, err := b.events.GetSongs(f.sunday.ID)
+		if err != nil {
+			t.Fatalf("%s: %v", b.name, err)
+		}
+		check(t, b, "GetSongs", songNames(songs), []string{"Two", "One"})
+	}
+}
+
+func TestEventOrder(t *testing.T) {
+	for _, b := range backends(t) {
+		f := b.load(t)
+
+		events, err := b.events.FindManyFromTodayByBandID(f.band.ID)
+		if err != nil {
+			t.Fatalf("%s: %v", b.name, err)
+		}
+		check(t, b, "by band", eventNames(events), []string{"Rehearsal", "Sunday"})
+
+		events, err = b.events.FindManyFromTodayByUserID(1)
+		if err != nil {
+			t.Fatalf("%s: %v", b.name, err)
+		}
+		check(t, b, "by user 1", eventNames(events), []string{"Sunday"})
+
+		events, err = b.events.FindManyFromTodayByBandIDAndUserID(f.band.ID, 2)
+		if err != nil {
+			t.Fatalf("%s: %v", b.name, err)
+		}
+		check(t, b, "by band and user 2", eventNames(events), []string{"Rehearsal", "Sunday"})
+
+		event, err := b.events.FindOneOldestByBandID(f.band.ID)
+		if err != nil {
+			t.Fatalf("%s: %v", b.name, err)
+		}
+		check(t, b, "oldest", event.Name, "Rehearsal")
+	}
+}
+
+func TestSongExtraOrder(t *testing.T) {
+	for _, b := range backends(t) {
+		b.load(t)
+
+		songs, err := b.songs.FindAllExtraByPageNumberSortedByEventsNumber(0)
+		if err != nil {
+			t.Fatalf("%s: %v", b.name, err)
+		}
+		check(t, b, "by events number", songExtraNames(songs), []string{"Two", "One", "Three"})
+
+		// One and Two were both played last on Sunday, so they are ordered by ID.
+		songs, err = b.songs.FindAllExtraByPageNumberSortedByLatestEventDate(0)
+		if err != nil {
+			t.Fatalf("%s: %v", b.name, err)
+		}
+		check(t, b, "by latest event", songExtraNames(songs), []string{"One", "Two", "Three"})
+
+		songs, err = b.songs.FindManyExtraByDriveFileIDs([]string{"Two"})
+		if err != nil {
+			t.Fatalf("%s: %v", b.name, err)
+		}
+		check(t, b, "by drive file IDs", songExtraNames(songs), []string{"Two"})
+
+		two := songs[0]
+		check(t, b, "song band roles", roleNames(two.Song.Band.Roles), []string{"Guitar", "Vocals"})
+		check(t, b, "events", eventNames(two.Events), []string{"Sunday", "Rehearsal"})
+
+		// Memberships of song events are sorted by role priority and have no users.
+		check(t, b, "event memberships", memberNames(two.Events[0].Memberships), []string{"-/Guitar", "-/Vocals"})
+	}
+}
+
+func songExtraNames(songs []*entities.SongExtra) []string {
+	names := make([]string, 0)
+	for _, song := range songs {
+		names = append(names, song.Song.PDF.Name)
+	}
+	return names
+}
+
+func TestMemoryStoreReplace(t *testing.T) {
+	store := NewMemoryStore()
+
+	ID := primitive.NewObjectID()
+	err := store.replace("roles", ID, entities.Role{ID: ID, Name: "Vocals"})
+	if err == nil {
+		t.Error("replace of a missing document succeeded")
+	}
+
+	err = store.set("roles", ID, entities.Role{Name: "Vocals", Priority: 2})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	err = store.replace("roles", ID, entities.Role{ID: ID, Name: "Guitar"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	role := store.roleByID(ID)
+	if role == nil || role.Name != "Guitar" || role.Priority != 0 {
+		t.Errorf("replaced role = %+v, want Guitar without priority", role)
+	}
+}
+
+func TestEventSetSongIDs(t *testing.T) {
+	for _, b := range backends(t) {
+		f := b.load(t)
+
+		event := *f.sunday
+		event.Setlist = []*entities.SetlistEntry{{SongID: f.two.ID, Key: "D"}}
+		_, err := b.events.UpdateOne(event)
+		if err != nil {
+			t.Fatalf("%s: %v", b.name, err)
+		}
+
+		err = b.events.SetSongIDs(f.sunday.ID, []primitive.ObjectID{f.two.ID}, []*entities.SetlistEntry{{SongID: f.two.ID, Key: "E"}})
+		if err != nil {
+			t.Fatalf("%s: %v", b.name, err)
+		}
+
+		set, err := b.events.FindOneByID(f.sunday.ID)
+		if err != nil {
+			t.Fatalf("%s: %v", b.name, err)
+		}
+		check(t, b, "songs", songNames(set.Songs), []string{"Two"})
+		check(t, b, "entry", set.SetlistEntry(f.two.ID).Key, "E")
+
+		// Empty lists are saved too.
+		err = b.events.SetSongIDs(f.sunday.ID, nil, nil)
+		if err != nil {
+			t.Fatalf("%s: %v", b.name, err)
+		}
+
+		emptied, err := b.events.FindOneByID(f.sunday.ID)
+		if err != nil {
+			t.Fatalf("%s: %v", b.name, err)
+		}
+		check(t, b, "songs after emptying", len(emptied.SongIDs), 0)
+		check(t, b, "setlist after emptying", len(emptied.Setlist), 0)
+	}
+}
+
+func TestEventSongPositionKeepsSetlist(t *testing.T) {
+	for _, b := range backends(t) {
+		f := b.load(t)
+
+		event := *f.sunday
+		event.Setlist = []*entities.SetlistEntry{
+			{SongID: f.two.ID, Key: "D", BPM: "72", Note: "slow intro"},
+			{SongID: f.one.ID, Key: "E"},
+		}
+		_, err := b.events.UpdateOne(event)
+		if err != nil {
+			t.Fatalf("%s: %v", b.name, err)
+		}
+
+		err = b.events.ChangeSongIDPosition(f.sunday.ID, f.two.ID, 1)
+		if err != nil {
+			t.Fatalf("%s: %v", b.name, err)
+		}
+
+		reordered, err := b.events.FindOneByID(f.sunday.ID)
+		if err != nil {
+			t.Fatalf("%s: %v", b.name, err)
+		}
+		check(t, b, "songs", songNames(reordered.Songs), []string{"One", "Two"})
+		check(t, b, "entry of the moved song", reordered.SetlistEntry(f.two.ID),
+			entities.SetlistEntry{SongID: f.two.ID, Key: "D", BPM: "72", Note: "slow intro"})
+		check(t, b, "entry of the other song", reordered.SetlistEntry(f.one.ID).Key, "E")
+
+		err = b.events.PullSongID(f.sunday.ID, f.two.ID)
+		if err != nil {
+			t.Fatalf("%s: %v", b.name, err)
+		}
+
+		pulled, err := b.events.FindOneByID(f.sunday.ID)
+		if err != nil {
+			t.Fatalf("%s: %v", b.name, err)
+		}
+		check(t, b, "songs after pull", songNames(pulled.Songs), []string{"One"})
+		check(t, b, "entry of the pulled song", pulled.SetlistEntry(f.two.ID), entities.SetlistEntry{SongID: f.two.ID})
+		check(t, b, "entry of the kept song", pulled.SetlistEntry(f.one.ID).Key, "E")
+	}
+}
@@ -0,0 +1,63 @@
+package repositories
+
+import (
+	"fmt"
+	"github.com/joeyave/scala-chords-bot/entities"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"sort"
+)
+
+type RoleMemoryRepository struct {
+	store *MemoryStore
+}
+
+func NewRoleMemoryRepository(store *MemoryStore) *RoleMemoryRepository {
+	return &RoleMemoryRepository{
+		store: store,
+	}
+}
+
+func (r *RoleMemoryRepository) FindAll() ([]*entities.Role, error) {
+	return r.find(func(role *entities.Role) bool { return true })
+}
+
+func (r *RoleMemoryRepository) FindOneByID(ID primitive.ObjectID) (*entities.Role, error) {
+	roles, err := r.find(func(role *entities.Role) bool { return role.ID == ID })
+	if err != nil {
+		return nil, err
+	}
+
+	return roles[0], nil
+}
+
+func (r *RoleMemoryRepository) find(match func(role *entities.Role) bool) ([]*entities.Role, error) {
+	var roles []*entities.Role
+	for _, role := range r.store.roles() {
+		if match(role) {
+			roles = append(roles, role)
+		}
+	}
+
+	if len(roles) == 0 {
+		return nil, fmt.Errorf("not found")
+	}
+
+	sort.SliceStable(roles, func(i, j int) bool {
+		return roles[i].Priority < roles[j].Priority
+	})
+
+	return roles, nil
+}
+
+func (r *RoleMemoryRepository) UpdateOne(role entities.Role) (*entities.Role, error) {
+	if role.ID.IsZero() {
+		role.ID = primitive.NewObjectID()
+	}
+
+	err := r.store.set("roles", role.ID, role)
+	if err != nil {
+		return nil, err
+	}
+
+	return r.FindOneByID(role.ID)
+}
@@ -11,17 +11,17 @@ import (
 	"os"
 )
 
-type RoleRepository struct {
+type RoleMongoRepository struct {
 	mongoClient *mongo.Client
 }
 
-func NewRoleRepository(mongoClient *mongo.Client) *RoleRepository {
-	return &RoleRepository{
+func NewRoleMongoRepository(mongoClient *mongo.Client) *RoleMongoRepository {
+	return &RoleMongoRepository{
 		mongoClient: mongoClient,
 	}
 }
 
-func (r *RoleRepository) FindAll() ([]*entities.Role, error) {
+func (r *RoleMongoRepository) FindAll() ([]*entities.Role, error) {
 	roles, err := r.find(bson.M{"_id": bson.M{"$ne": ""}})
 	if err != nil {
 		return nil, err
@@ -30,7 +30,7 @@ func (r *RoleRepository) FindAll() ([]*entities.Role, error) {
 	return roles, nil
 }
 
-func (r *RoleRepository) FindOneByID(ID primitive.ObjectID) (*entities.Role, error) {
+func (r *RoleMongoRepository) FindOneByID(ID primitive.ObjectID) (*entities.Role, error) {
 	roles, err := r.find(bson.M{"_id": ID})
 	if err != nil {
 		return nil, err
@@ -39,7 +39,7 @@ func (r *RoleRepository) FindOneByID(ID primitive.ObjectID) (*entities.Role, err
 	return roles[0], nil
 }
 
-func (r *RoleRepository) find(m bson.M) ([]*entities.Role, error) {
+func (r *RoleMongoRepository) find(m bson.M) ([]*entities.Role, error) {
 	collection := r.mongoClient.Database(os.Getenv("MONGODB_DATABASE_NAME")).Collection("roles")
 
 	pipeline := bson.A{
@@ -71,7 +71,7 @@ func (r *RoleRepository) find(m bson.M) ([]*entities.Role, error) {
 	return roles, nil
 }
 
-func (r *RoleRepository) UpdateOne(role entities.Role) (*entities.Role, error) {
+func (r *RoleMongoRepository) UpdateOne(role entities.Role) (*entities.Role, error) {
 	if role.ID.IsZero() {
 		role.ID = r.generateUniqueID()
 	}
@@ -105,7 +105,7 @@ func (r *RoleRepository) UpdateOne(role entities.Role) (*entities.Role, error) {
 	return r.FindOneByID(newRole.ID)
 }
 
-func (r *RoleRepository) generateUniqueID() primitive.ObjectID {
+func (r *RoleMongoRepository) generateUniqueID() primitive.ObjectID {
 	ID := primitive.NilObjectID
 
 	for ID.IsZero() {
@@ -0,0 +1,202 @@
+package repositories
+
+import (
+	"fmt"
+	"github.com/joeyave/scala-chords-bot/entities"
+	"github.com/joeyave/scala-chords-bot/helpers"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"sort"
+)
+
+type SongMemoryRepository struct {
+	store *MemoryStore
+}
+
+func NewSongMemoryRepository(store *MemoryStore) *SongMemoryRepository {
+	return &SongMemoryRepository{
+		store: store,
+	}
+}
+
+func (r *SongMemoryRepository) FindAll() ([]*entities.Song, error) {
+	return r.find(func(song *entities.Song) bool { return true })
+}
+
+func (r *SongMemoryRepository) FindOneByID(ID primitive.ObjectID) (*entities.Song, error) {
+	songs, err := r.find(func(song *entities.Song) bool { return song.ID == ID })
+	if err != nil {
+		return nil, err
+	}
+	return songs[0], nil
+}
+
+func (r *SongMemoryRepository) FindManyByBandID(bandID primitive.ObjectID) ([]*entities.Song, error) {
+	return r.find(func(song *entities.Song) bool { return song.BandID == bandID })
+}
+
+func (r *SongMemoryRepository) FindOneByDriveFileID(driveFileID string) (*entities.Song, error) {
+	songs, err := r.find(func(song *entities.Song) bool { return song.DriveFileID == driveFileID })
+	if err != nil {
+		return nil, err
+	}
+	return songs[0], nil
+}
+
+func (r *SongMemoryRepository) FindOneByName(name string) (*entities.Song, error) {
+	songs, err := r.find(func(song *entities.Song) bool { return song.PDF.Name == name })
+	if err != nil {
+		return nil, err
+	}
+	return songs[0], nil
+}
+
+func (r *SongMemoryRepository) find(match func(song *entities.Song) bool) ([]*entities.Song, error) {
+	var songs []*entities.Song
+	for _, song := range r.store.songs() {
+		if !match(song) {
+			continue
+		}
+
+		song.Voices = r.store.voicesBySongID(song.ID)
+		if band := r.store.bandByID(song.BandID); band != nil {
+			band.Roles = nil
+			song.Band = band
+		}
+		songs = append(songs, song)
+	}
+
+	if len(songs) == 0 {
+		return nil, fmt.Errorf("not found")
+	}
+
+	return songs, nil
+}
+
+func (r *SongMemoryRepository) UpdateOne(song entities.Song) (*entities.Song, error) {
+	if song.ID.IsZero() {
+		song.ID = primitive.NewObjectID()
+	}
+
+	song.Band = nil
+	song.Voices = nil
+	err := r.store.set("songs", song.ID, song)
+	if err != nil {
+		return nil, err
+	}
+
+	return r.FindOneByID(song.ID)
+}
+
+func (r *SongMemoryRepository) DeleteOneByDriveFileID(driveFileID string) error {
+	r.store.deleteMany("songs", "driveFileId", driveFileID)
+	return nil
+}
+
+func (r *SongMemoryRepository) FindAllExtraByPageNumberSortedByEventsNumber(pageNumber int) ([]*entities.SongExtra, error) {
+	songs := r.findWithExtra(func(song *entities.Song) bool { return true })
+
+	sort.SliceStable(songs, func(i, j int) bool {
+		if len(songs[i].Events) != len(songs[j].Events) {
+			return len(songs[i].Events) > len(songs[j].Events)
+		}
+		return objectIDLess(songs[i].Song.ID, songs[j].Song.ID)
+	})
+
+	return paginateSongs(songs, pageNumber), nil
+}
+
+func (r *SongMemoryRepository) FindAllExtraByPageNumberSortedByLatestEventDate(pageNumber int) ([]*entities.SongExtra, error) {
+	songs := r.findWithExtra(func(song *entities.Song) bool { return true })
+
+	sort.SliceStable(songs, func(i, j int) bool {
+		if len(songs[i].Events) == 0 || len(songs[j].Events) == 0 {
+			if len(songs[i].Events) == len(songs[j].Events) {
+				return objectIDLess(songs[i].Song.ID, songs[j].Song.ID)
+			}
+			return len(songs[j].Events) == 0
+		}
+
+		if !songs[i].Events[0].Time.Equal(songs[j].Events[0].Time) {
+			return songs[i].Events[0].Time.After(songs[j].Events[0].Time)
+		}
+		return objectIDLess(songs[i].Song.ID, songs[j].Song.ID)
+	})
+
+	return paginateSongs(songs, pageNumber), nil
+}
+
+func (r *SongMemoryRepository) FindManyExtraByDriveFileIDs(driveFileIDs []string) ([]*entities.SongExtra, error) {
+	return r.findWithExtra(func(song *entities.Song) bool {
+		for _, driveFileID := range driveFileIDs {
+			if song.DriveFileID == driveFileID {
+				return true
+			}
+		}
+		return false
+	}), nil
+}
+
+func (r *SongMemoryRepository) findWithExtra(match func(song *entities.Song) bool) []*entities.SongExtra {
+	events := r.store.events()
+
+	var songs []*entities.SongExtra
+	for _, song := range r.store.songs() {
+		if !match(song) {
+			continue
+		}
+
+		song.Band = r.store.bandByID(song.BandID)
+
+		songEvents := make([]*entities.Event, 0)
+		for _, event := range events {
+			for _, songID := range event.SongIDs {
+				if songID != song.ID {
+					continue
+				}
+
+				event := *event
+				event.Memberships = r.store.membershipsByEventID(event.ID)
+				sort.SliceStable(event.Memberships, func(i, j int) bool {
+					return rolePriority(event.Memberships[i].Role) < rolePriority(event.Memberships[j].Role)
+				})
+				for _, membership := range event.Memberships {
+					membership.User = nil
+				}
+				songEvents = append(songEvents, &event)
+				break
+			}
+		}
+
+		sort.SliceStable(songEvents, func(i, j int) bool {
+			return songEvents[i].Time.After(songEvents[j].Time)
+		})
+
+		songs = append(songs, &entities.SongExtra{
+			Song:   song,
+			Events: songEvents,
+		})
+	}
+
+	return songs
+}
+
+func paginateSongs(songs []*entities.SongExtra, pageNumber int) []*entities.SongExtra {
+	from := pageNumber * helpers.PageSize
+	if from < 0 || from >= len(songs) {
+		return nil
+	}
+
+	to := from + helpers.PageSize
+	if to > len(songs) {
+		to = len(songs)
+	}
+
+	return songs[from:to]
+}
+
+func rolePriority(role *entities.Role) int {
+	if role == nil {
+		return 0
+	}
+	return role.Priority
+}
@@ -12,21 +12,21 @@ import (
 	"os"
 )
 
-type SongRepository struct {
+type SongMongoRepository struct {
 	mongoClient *mongo.Client
 }
 
-func NewSongRepository(mongoClient *mongo.Client) *SongRepository {
-	return &SongRepository{
+func NewSongMongoRepository(mongoClient *mongo.Client) *SongMongoRepository {
+	return &SongMongoRepository{
 		mongoClient: mongoClient,
 	}
 }
 
-func (r *SongRepository) FindAll() ([]*entities.Song, error) {
+func (r *SongMongoRepository) FindAll() ([]*entities.Song, error) {
 	return r.find(bson.M{})
 }
 
-func (r *SongRepository) FindOneByID(ID primitive.ObjectID) (*entities.Song, error) {
+func (r *SongMongoRepository) FindOneByID(ID primitive.ObjectID) (*entities.Song, error) {
 	songs, err := r.find(bson.M{"_id": ID})
 	if err != nil {
 		return nil, err
@@ -34,7 +34,11 @@ func (r *SongRepository) FindOneByID(ID primitive.ObjectID) (*entities.Song, err
 	return songs[0], nil
 }
 
-func (r *SongRepository) FindOneByDriveFileID(driveFileID string) (*entities.Song, error) {
+func (r *SongMongoRepository) FindManyByBandID(bandID primitive.ObjectID) ([]*entities.Song, error) {
+	return r.find(bson.M{"bandId": bandID})
+}
+
+func (r *SongMongoRepository) FindOneByDriveFileID(driveFileID string) (*entities.Song, error) {
 	songs, err := r.find(bson.M{"driveFileId": driveFileID})
 	if err != nil {
 		return nil, err
@@ -42,7 +46,7 @@ func (r *SongRepository) FindOneByDriveFileID(driveFileID string) (*entities.Son
 	return songs[0], nil
 }
 
-func (r *SongRepository) FindOneByName(name string) (*entities.Song, error) {
+func (r *SongMongoRepository) FindOneByName(name string) (*entities.Song, error) {
 	songs, err := r.find(bson.M{"pdf.name": name})
 	if err != nil {
 		return nil, err
@@ -50,7 +54,7 @@ func (r *SongRepository) FindOneByName(name string) (*entities.Song, error) {
 	return songs[0], nil
 }
 
-func (r *SongRepository) find(m bson.M) ([]*entities.Song, error) {
+func (r *SongMongoRepository) find(m bson.M) ([]*entities.Song, error) {
 	collection := r.mongoClient.Database(os.Getenv("MONGODB_DATABASE_NAME")).Collection("songs")
 
 	pipeline := bson.A{
@@ -104,7 +108,7 @@ func (r *SongRepository) find(m bson.M) ([]*entities.Song, error) {
 	return songs, nil
 }
 
-func (r *SongRepository) UpdateOne(song entities.Song) (*entities.Song, error) {
+func (r *SongMongoRepository) UpdateOne(song entities.Song) (*entities.Song, error) {
 	if song.ID.IsZero() {
 		song.ID = r.generateUniqueID()
 	}
@@ -151,14 +155,14 @@ func (r *SongRepository) UpdateOne(song entities.Song) (*entities.Song, error) {
 	return r.FindOneByID(newSong.ID)
 }
 
-func (r *SongRepository) DeleteOneByDriveFileID(driveFileID string) error {
+func (r *SongMongoRepository) DeleteOneByDriveFileID(driveFileID string) error {
 	collection := r.mongoClient.Database(os.Getenv("MONGODB_DATABASE_NAME")).Collection("songs")
 
 	_, err := collection.DeleteOne(context.TODO(), bson.M{"driveFileId": driveFileID})
 	return err
 }
 
-func (r *SongRepository) generateUniqueID() primitive.ObjectID {
+func (r *SongMongoRepository) generateUniqueID() primitive.ObjectID {
 	ID := primitive.NilObjectID
 
 	for ID.IsZero() {
@@ -172,7 +176,7 @@ func (r *SongRepository) generateUniqueID() primitive.ObjectID {
 	return ID
 }
 
-func (r *SongRepository) FindAllExtraByPageNumberSortedByEventsNumber(pageNumber int) ([]*entities.SongExtra, error) {
+func (r *SongMongoRepository) FindAllExtraByPageNumberSortedByEventsNumber(pageNumber int) ([]*entities.SongExtra, error) {
 
 	return r.findWithExtra(
 		bson.M{},
@@ -183,8 +187,8 @@ func (r *SongRepository) FindAllExtraByPageNumberSortedByEventsNumber(pageNumber
 		},
 		bson.M{
 			"$sort": bson.D{
-				{"eventsSize", -1},
-				{"_id", 1},
+				{Key: "eventsSize", Value: -1},
+				{Key: "_id", Value: 1},
 			},
 		},
 		bson.M{
@@ -196,14 +200,14 @@ func (r *SongRepository) FindAllExtraByPageNumberSortedByEventsNumber(pageNumber
 	)
 }
 
-func (r *SongRepository) FindAllExtraByPageNumberSortedByLatestEventDate(pageNumber int) ([]*entities.SongExtra, error) {
+func (r *SongMongoRepository) FindAllExtraByPageNumberSortedByLatestEventDate(pageNumber int) ([]*entities.SongExtra, error) {
 
 	return r.findWithExtra(
 		bson.M{},
 		bson.M{
 			"$sort": bson.D{
-				{"events.0.time", -1},
-				{"_id", 1},
+				{Key: "events.0.time", Value: -1},
+				{Key: "_id", Value: 1},
 			},
 		},
 		bson.M{
@@ -215,7 +219,7 @@ func (r *SongRepository) FindAllExtraByPageNumberSortedByLatestEventDate(pageNum
 	)
 }
 
-func (r *SongRepository) FindManyExtraByDriveFileIDs(driveFileIDs []string) ([]*entities.SongExtra, error) {
+func (r *SongMongoRepository) FindManyExtraByDriveFileIDs(driveFileIDs []string) ([]*entities.SongExtra, error) {
 	return r.findWithExtra(
 		bson.M{
 			"driveFileId": bson.M{
@@ -225,7 +229,7 @@ func (r *SongRepository) FindManyExtraByDriveFileIDs(driveFileIDs []string) ([]*
 	)
 }
 
-func (r *SongRepository) findWithExtra(m bson.M, opts ...bson.M) ([]*entities.SongExtra, error) {
+func (r *SongMongoRepository) findWithExtra(m bson.M, opts ...bson.M) ([]*entities.SongExtra, error) {
 	collection := r.mongoClient.Database(os.Getenv("MONGODB_DATABASE_NAME")).Collection("songs")
 
 	pipeline := bson.A{
@@ -325,7 +329,7 @@ func (r *SongRepository) findWithExtra(m bson.M, opts ...bson.M) ([]*entities.So
 							"as": "memberships",
 						},
 					},
-                                        bson.M{
+					bson.M{
 						"$sort": bson.M{
 							"time": -1,
 						},
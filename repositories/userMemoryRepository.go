@@ -0,0 +1,195 @@
+package repositories
+
+import (
+	"fmt"
+	"github.com/joeyave/scala-chords-bot/entities"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"sort"
+	"time"
+)
+
+type UserMemoryRepository struct {
+	store *MemoryStore
+}
+
+func NewUserMemoryRepository(store *MemoryStore) *UserMemoryRepository {
+	return &UserMemoryRepository{
+		store: store,
+	}
+}
+
+func (r *UserMemoryRepository) FindAll() ([]*entities.User, error) {
+	return r.store.users(), nil
+}
+
+func (r *UserMemoryRepository) FindOneByID(ID int64) (*entities.User, error) {
+	users, err := r.find(func(user *entities.User) bool { return user.ID == ID })
+	if err != nil {
+		return nil, err
+	}
+
+	return users[0], nil
+}
+
+func (r *UserMemoryRepository) FindOneByName(name string) (*entities.User, error) {
+	users, err := r.find(func(user *entities.User) bool { return user.Name == name })
+	if err != nil {
+		return nil, err
+	}
+
+	return users[0], nil
+}
+
+func (r *UserMemoryRepository) FindManyByIDs(IDs []int64) ([]*entities.User, error) {
+	return r.find(func(user *entities.User) bool {
+		for _, ID := range IDs {
+			if user.ID == ID {
+				return true
+			}
+		}
+		return false
+	})
+}
+
+func (r *UserMemoryRepository) FindManyByBandID(bandID primitive.ObjectID) ([]*entities.User, error) {
+	return r.find(func(user *entities.User) bool { return user.UserBand(bandID) != nil })
+}
+
+func (r *UserMemoryRepository) find(match func(user *entities.User) bool) ([]*entities.User, error) {
+	var users []*entities.User
+	for _, user := range r.store.users() {
+		if match(user) {
+			user.Band = r.store.bandByID(user.BandID)
+			users = append(users, user)
+		}
+	}
+
+	if len(users) == 0 {
+		return nil, fmt.Errorf("not found")
+	}
+
+	return users, nil
+}
+
+func (r *UserMemoryRepository) UpdateOne(user entities.User) (*entities.User, error) {
+	ID := user.ID
+
+	user.ID = 0
+	user.Band = nil
+	err := r.store.set("users", ID, user)
+	if err != nil {
+		return nil, err
+	}
+
+	return r.FindOneByID(ID)
+}
+
+func (r *UserMemoryRepository) FindManyExtraByBandIDAndRoleID(bandID primitive.ObjectID, roleID primitive.ObjectID) ([]*entities.UserExtra, error) {
+	users, err := r.findWithExtra(bandID, func(membership *entities.Membership) bool {
+		return membership.RoleID == roleID
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	lastEventTime := func(user *entities.UserExtra) time.Time {
+		if len(user.Events) == 0 {
+			return time.Now().AddDate(10, 0, 0)
+		}
+		return user.Events[0].Time
+	}
+
+	for _, user := range users {
+		sort.SliceStable(user.Events, func(i, j int) bool {
+			return user.Events[i].Time.After(user.Events[j].Time)
+		})
+		for _, event := range user.Events {
+			for _, membership := range event.Memberships {
+				membership.Role = nil
+			}
+		}
+	}
+
+	sort.SliceStable(users, func(i, j int) bool {
+		return lastEventTime(users[i]).After(lastEventTime(users[j]))
+	})
+
+	return users, nil
+}
+
+func (r *UserMemoryRepository) FindManyExtraByBandID(bandID primitive.ObjectID) ([]*entities.UserExtra, error) {
+	users, err := r.findWithExtra(bandID, func(membership *entities.Membership) bool { return true })
+	if err != nil {
+		return nil, err
+	}
+
+	for _, user := range users {
+		for _, event := range user.Events {
+			sort.SliceStable(event.Memberships, func(i, j int) bool {
+				return rolePriority(event.Memberships[i].Role) < rolePriority(event.Memberships[j].Role)
+			})
+		}
+	}
+
+	sort.SliceStable(users, func(i, j int) bool {
+		return len(users[i].Events) > len(users[j].Events)
+	})
+
+	return users, nil
+}
+
+// findWithExtra returns users of the band with events they have a membership in.
+// Event memberships are filtered with matchMembership.
+func (r *UserMemoryRepository) findWithExtra(bandID primitive.ObjectID, matchMembership func(membership *entities.Membership) bool) ([]*entities.UserExtra, error) {
+	events := r.store.events()
+	memberships := r.store.memberships()
+
+	var users []*entities.UserExtra
+	for _, user := range r.store.users() {
+		if user.UserBand(bandID) == nil {
+			continue
+		}
+
+		user.Band = r.store.bandByID(user.BandID)
+
+		userEvents := make([]*entities.Event, 0)
+		for _, event := range events {
+			if event.BandID != bandID {
+				continue
+			}
+
+			eventMemberships := make([]*entities.Membership, 0)
+			isMember := false
+			for _, membership := range memberships {
+				if membership.EventID != event.ID || !matchMembership(membership) {
+					continue
+				}
+
+				membership := *membership
+				membership.Role = r.store.roleByID(membership.RoleID)
+				eventMemberships = append(eventMemberships, &membership)
+
+				if membership.UserID == user.ID {
+					isMember = true
+				}
+			}
+
+			if isMember {
+				event := *event
+				event.Memberships = eventMemberships
+				userEvents = append(userEvents, &event)
+			}
+		}
+
+		users = append(users, &entities.UserExtra{
+			User:   user,
+			Events: userEvents,
+		})
+	}
+
+	if len(users) == 0 {
+		return nil, fmt.Errorf("not found")
+	}
+
+	return users, nil
+}
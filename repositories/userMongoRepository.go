@@ -12,17 +12,17 @@ import (
 	"time"
 )
 
-type UserRepository struct {
+type UserMongoRepository struct {
 	mongoClient *mongo.Client
 }
 
-func NewUserRepository(mongoClient *mongo.Client) *UserRepository {
-	return &UserRepository{
+func NewUserMongoRepository(mongoClient *mongo.Client) *UserMongoRepository {
+	return &UserMongoRepository{
 		mongoClient: mongoClient,
 	}
 }
 
-func (r *UserRepository) FindAll() ([]*entities.User, error) {
+func (r *UserMongoRepository) FindAll() ([]*entities.User, error) {
 	collection := r.mongoClient.Database(os.Getenv("MONGODB_DATABASE_NAME")).Collection("users")
 	cursor, err := collection.Find(context.TODO(), bson.D{})
 	if err != nil {
@@ -34,7 +34,7 @@ func (r *UserRepository) FindAll() ([]*entities.User, error) {
 	return users, err
 }
 
-func (r *UserRepository) FindOneByID(ID int64) (*entities.User, error) {
+func (r *UserMongoRepository) FindOneByID(ID int64) (*entities.User, error) {
 	users, err := r.find(bson.M{
 		"_id": ID,
 	})
@@ -45,7 +45,7 @@ func (r *UserRepository) FindOneByID(ID int64) (*entities.User, error) {
 	return users[0], nil
 }
 
-func (r *UserRepository) FindOneByName(name string) (*entities.User, error) {
+func (r *UserMongoRepository) FindOneByName(name string) (*entities.User, error) {
 	users, err := r.find(
 		bson.M{
 			"name": name,
@@ -61,7 +61,7 @@ func (r *UserRepository) FindOneByName(name string) (*entities.User, error) {
 	return users[0], err
 }
 
-func (r *UserRepository) FindManyByIDs(IDs []int64) ([]*entities.User, error) {
+func (r *UserMongoRepository) FindManyByIDs(IDs []int64) ([]*entities.User, error) {
 	return r.find(bson.M{
 		"_id": bson.M{
 			"$in": IDs,
@@ -69,13 +69,11 @@ func (r *UserRepository) FindManyByIDs(IDs []int64) ([]*entities.User, error) {
 	})
 }
 
-func (r *UserRepository) FindManyByBandID(bandID primitive.ObjectID) ([]*entities.User, error) {
-	return r.find(bson.M{
-		"bandId": bandID,
-	})
+func (r *UserMongoRepository) FindManyByBandID(bandID primitive.ObjectID) ([]*entities.User, error) {
+	return r.find(bandMembersFilter(bandID))
 }
 
-func (r *UserRepository) find(m bson.M, opts ...bson.M) ([]*entities.User, error) {
+func (r *UserMongoRepository) find(m bson.M, opts ...bson.M) ([]*entities.User, error) {
 	collection := r.mongoClient.Database(os.Getenv("MONGODB_DATABASE_NAME")).Collection("users")
 
 	pipeline := bson.A{
@@ -141,7 +139,7 @@ func (r *UserRepository) find(m bson.M, opts ...bson.M) ([]*entities.User, error
 	return users, nil
 }
 
-func (r *UserRepository) UpdateOne(user entities.User) (*entities.User, error) {
+func (r *UserMongoRepository) UpdateOne(user entities.User) (*entities.User, error) {
 	collection := r.mongoClient.Database(os.Getenv("MONGODB_DATABASE_NAME")).Collection("users")
 
 	filter := bson.M{"_id": user.ID}
@@ -173,12 +171,10 @@ func (r *UserRepository) UpdateOne(user entities.User) (*entities.User, error) {
 	return r.FindOneByID(newUser.ID)
 }
 
-func (r *UserRepository) FindManyExtraByBandIDAndRoleID(bandID primitive.ObjectID, roleID primitive.ObjectID) ([]*entities.UserExtra, error) {
+func (r *UserMongoRepository) FindManyExtraByBandIDAndRoleID(bandID primitive.ObjectID, roleID primitive.ObjectID) ([]*entities.UserExtra, error) {
 	pipeline := bson.A{
 		bson.M{
-			"$match": bson.M{
-				"bandId": bandID,
-			},
+			"$match": bandMembersFilter(bandID),
 		},
 		bson.M{
 			"$lookup": bson.M{
@@ -220,6 +216,9 @@ func (r *UserRepository) FindManyExtraByBandIDAndRoleID(bandID primitive.ObjectI
 				"from": "events",
 				"let":  bson.M{"userId": "$_id"},
 				"pipeline": bson.A{
+					bson.M{
+						"$match": bson.M{"bandId": bandID},
+					},
 					bson.M{
 						"$lookup": bson.M{
 							"from": "memberships",
@@ -274,12 +273,10 @@ func (r *UserRepository) FindManyExtraByBandIDAndRoleID(bandID primitive.ObjectI
 	return r.findWithExtra(pipeline)
 }
 
-func (r *UserRepository) FindManyExtraByBandID(bandID primitive.ObjectID) ([]*entities.UserExtra, error) {
+func (r *UserMongoRepository) FindManyExtraByBandID(bandID primitive.ObjectID) ([]*entities.UserExtra, error) {
 	pipeline := bson.A{
 		bson.M{
-			"$match": bson.M{
-				"bandId": bandID,
-			},
+			"$match": bandMembersFilter(bandID),
 		},
 		bson.M{
 			"$lookup": bson.M{
@@ -321,6 +318,9 @@ func (r *UserRepository) FindManyExtraByBandID(bandID primitive.ObjectID) ([]*en
 				"from": "events",
 				"let":  bson.M{"userId": "$_id"},
 				"pipeline": bson.A{
+					bson.M{
+						"$match": bson.M{"bandId": bandID},
+					},
 					bson.M{
 						"$lookup": bson.M{
 							"from": "memberships",
@@ -382,7 +382,7 @@ func (r *UserRepository) FindManyExtraByBandID(bandID primitive.ObjectID) ([]*en
 	return r.findWithExtra(pipeline)
 }
 
-func (r *UserRepository) findWithExtra(pipeline bson.A) ([]*entities.UserExtra, error) {
+func (r *UserMongoRepository) findWithExtra(pipeline bson.A) ([]*entities.UserExtra, error) {
 	collection := r.mongoClient.Database(os.Getenv("MONGODB_DATABASE_NAME")).Collection("users")
 
 	cur, err := collection.Aggregate(context.TODO(), pipeline)
@@ -402,3 +402,13 @@ func (r *UserRepository) findWithExtra(pipeline bson.A) ([]*entities.UserExtra,
 
 	return users, nil
 }
+
+// bandMembersFilter matches users in the band, including users who are currently in another one.
+func bandMembersFilter(bandID primitive.ObjectID) bson.M {
+	return bson.M{
+		"$or": bson.A{
+			bson.M{"bandId": bandID},
+			bson.M{"bands.bandId": bandID},
+		},
+	}
+}
@@ -0,0 +1,53 @@
+package repositories
+
+import (
+	"github.com/joeyave/scala-chords-bot/entities"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+type VoiceMemoryRepository struct {
+	store *MemoryStore
+}
+
+func NewVoiceMemoryRepository(store *MemoryStore) *VoiceMemoryRepository {
+	return &VoiceMemoryRepository{
+		store: store,
+	}
+}
+
+func (r *VoiceMemoryRepository) FindOneByID(ID primitive.ObjectID) (*entities.Voice, error) {
+	return r.findOne(func(voice *entities.Voice) bool { return voice.ID == ID })
+}
+
+func (r *VoiceMemoryRepository) FindOneByFileID(fileID string) (*entities.Voice, error) {
+	return r.findOne(func(voice *entities.Voice) bool { return voice.FileID == fileID })
+}
+
+func (r *VoiceMemoryRepository) UpdateOne(voice entities.Voice) (*entities.Voice, error) {
+	if voice.ID.IsZero() {
+		voice.ID = primitive.NewObjectID()
+	}
+
+	err := r.store.set("voices", voice.ID, voice)
+	if err != nil {
+		return nil, err
+	}
+
+	return r.FindOneByID(voice.ID)
+}
+
+func (r *VoiceMemoryRepository) DeleteOneByID(ID primitive.ObjectID) error {
+	r.store.deleteMany("voices", "_id", ID)
+	return nil
+}
+
+func (r *VoiceMemoryRepository) findOne(match func(voice *entities.Voice) bool) (*entities.Voice, error) {
+	for _, voice := range r.store.voices() {
+		if match(voice) {
+			return voice, nil
+		}
+	}
+
+	return nil, mongo.ErrNoDocuments
+}
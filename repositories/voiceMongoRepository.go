@@ -10,25 +10,25 @@ import (
 	"os"
 )
 
-type VoiceRepository struct {
+type VoiceMongoRepository struct {
 	mongoClient *mongo.Client
 }
 
-func NewVoiceRepository(mongoClient *mongo.Client) *VoiceRepository {
-	return &VoiceRepository{
+func NewVoiceMongoRepository(mongoClient *mongo.Client) *VoiceMongoRepository {
+	return &VoiceMongoRepository{
 		mongoClient: mongoClient,
 	}
 }
 
-func (r *VoiceRepository) FindOneByID(ID primitive.ObjectID) (*entities.Voice, error) {
+func (r *VoiceMongoRepository) FindOneByID(ID primitive.ObjectID) (*entities.Voice, error) {
 	return r.findOne(bson.M{"_id": ID})
 }
 
-func (r *VoiceRepository) FindOneByFileID(fileID string) (*entities.Voice, error) {
+func (r *VoiceMongoRepository) FindOneByFileID(fileID string) (*entities.Voice, error) {
 	return r.findOne(bson.M{"fileId": fileID})
 }
 
-func (r *VoiceRepository) UpdateOne(voice entities.Voice) (*entities.Voice, error) {
+func (r *VoiceMongoRepository) UpdateOne(voice entities.Voice) (*entities.Voice, error) {
 	if voice.ID.IsZero() {
 		voice.ID = r.generateUniqueID()
 	}
@@ -60,14 +60,14 @@ func (r *VoiceRepository) UpdateOne(voice entities.Voice) (*entities.Voice, erro
 	return newVoice, err
 }
 
-func (r *VoiceRepository) DeleteOneByID(ID primitive.ObjectID) error {
+func (r *VoiceMongoRepository) DeleteOneByID(ID primitive.ObjectID) error {
 	collection := r.mongoClient.Database(os.Getenv("MONGODB_DATABASE_NAME")).Collection("voices")
 
 	_, err := collection.DeleteOne(context.TODO(), bson.M{"_id": ID})
 	return err
 }
 
-func (r *VoiceRepository) findOne(m bson.M) (*entities.Voice, error) {
+func (r *VoiceMongoRepository) findOne(m bson.M) (*entities.Voice, error) {
 	collection := r.mongoClient.Database(os.Getenv("MONGODB_DATABASE_NAME")).Collection("voices")
 
 	result := collection.FindOne(context.TODO(), m)
@@ -80,7 +80,7 @@ func (r *VoiceRepository) findOne(m bson.M) (*entities.Voice, error) {
 	return voice, err
 }
 
-func (r *VoiceRepository) generateUniqueID() primitive.ObjectID {
+func (r *VoiceMongoRepository) generateUniqueID() primitive.ObjectID {
 	ID := primitive.NilObjectID
 
 	for ID.IsZero() {
@@ -0,0 +1,101 @@
+package services
+
+import (
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"fmt"
+	"github.com/joeyave/scala-chords-bot/entities"
+	"github.com/joeyave/scala-chords-bot/helpers"
+	"github.com/joeyave/scala-chords-bot/repositories"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"strings"
+)
+
+// APITokenService issues tokens for the HTTP API. A token gives access to everything of one band.
+// It is "{bandId}.{signature}", the signature covers the nonce of the band, so a new nonce revokes the token.
+type APITokenService struct {
+	secret         []byte
+	bandRepository repositories.BandRepository
+}
+
+func NewAPITokenService(secret string, bandRepository repositories.BandRepository) *APITokenService {
+	return &APITokenService{
+		secret:         []byte(secret),
+		bandRepository: bandRepository,
+	}
+}
+
+// Token returns the API token of the band.
+func (s *APITokenService) Token(band *entities.Band) string {
+	return band.ID.Hex() + "." + s.signature(band)
+}
+
+// Regenerate revokes the API token of the band and returns the band with the new one.
+func (s *APITokenService) Regenerate(bandID primitive.ObjectID) (*entities.Band, error) {
+	band, err := s.bandRepository.FindOneByID(bandID)
+	if err != nil {
+		return nil, err
+	}
+
+	band.APITokenNonce, err = newNonce()
+	if err != nil {
+		return nil, err
+	}
+
+	return s.bandRepository.UpdateOne(*band)
+}
+
+// Band checks the token and returns the band it was issued for.
+func (s *APITokenService) Band(token string) (*entities.Band, error) {
+	parts := strings.Split(token, ".")
+	if len(parts) != 2 {
+		return nil, fmt.Errorf("invalid token")
+	}
+
+	bandID, err := primitive.ObjectIDFromHex(parts[0])
+	if err != nil {
+		return nil, fmt.Errorf("invalid token")
+	}
+
+	band, err := s.bandRepository.FindOneByID(bandID)
+	if err != nil {
+		return nil, fmt.Errorf("invalid token")
+	}
+
+	if !hmac.Equal([]byte(parts[1]), []byte(s.signature(band))) {
+		return nil, fmt.Errorf("invalid token")
+	}
+
+	return band, nil
+}
+
+// Actor returns the user the token of the band acts as in the services: an admin of the band and nothing else.
+func (s *APITokenService) Actor(band *entities.Band) *entities.User {
+	return &entities.User{
+		Name:  "API",
+		Bands: []*entities.UserBand{{BandID: band.ID, Role: helpers.Admin}},
+	}
+}
+
+// Bands from before tokens could be revoked have no nonce, their tokens stay the same until the first revoke.
+func (s *APITokenService) signature(band *entities.Band) string {
+	mac := hmac.New(sha256.New, s.secret)
+	mac.Write([]byte("api:band:" + band.ID.Hex()))
+	if band.APITokenNonce != "" {
+		mac.Write([]byte(":" + band.APITokenNonce))
+	}
+	return hex.EncodeToString(mac.Sum(nil))[:32]
+}
+
+// newNonce returns a random string to sign into tokens, so they can be revoked by changing it.
+func newNonce() (string, error) {
+	b := make([]byte, 12)
+	_, err := rand.Read(b)
+	if err != nil {
+		return "", err
+	}
+	return base64.RawURLEncoding.EncodeToString(b), nil
+}
@@ -0,0 +1,45 @@
+package services
+
+import (
+	"testing"
+
+	"github.com/joeyave/scala-chords-bot/entities"
+	"github.com/joeyave/scala-chords-bot/repositories"
+)
+
+func TestAPITokenRegenerate(t *testing.T) {
+	bandRepository := repositories.NewBandMemoryRepository(repositories.NewMemoryStore())
+	service := NewAPITokenService("secret", bandRepository)
+
+	band, err := bandRepository.UpdateOne(entities.Band{Name: "Band"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	oldToken := service.Token(band)
+	got, err := service.Band(oldToken)
+	if err != nil || got.ID != band.ID {
+		t.Fatalf("Band(token) = %v, %v, want the band", got, err)
+	}
+
+	band, err = service.Regenerate(band.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	newToken := service.Token(band)
+	if newToken == oldToken {
+		t.Fatal("new token is the same as the old one")
+	}
+	if _, err := service.Band(oldToken); err == nil {
+		t.Error("old token still works")
+	}
+	if got, err := service.Band(newToken); err != nil || got.ID != band.ID {
+		t.Errorf("Band(new token) = %v, %v, want the band", got, err)
+	}
+
+	// Tokens are signed with the secret.
+	if _, err := NewAPITokenService("other", bandRepository).Band(newToken); err == nil {
+		t.Error("token works with another secret")
+	}
+}
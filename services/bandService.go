@@ -10,11 +10,11 @@ import (
 )
 
 type BandService struct {
-	bandRepository *repositories.BandRepository
+	bandRepository repositories.BandRepository
 	notionClient   *notionapi.Client
 }
 
-func NewBandService(bandRepository *repositories.BandRepository, notionClient *notionapi.Client) *BandService {
+func NewBandService(bandRepository repositories.BandRepository, notionClient *notionapi.Client) *BandService {
 	return &BandService{
 		bandRepository: bandRepository,
 		notionClient:   notionClient,
@@ -33,6 +33,10 @@ func (s *BandService) FindOneByDriveFolderID(driveFolderID string) (*entities.Ba
 	return s.bandRepository.FindOneByDriveFolderID(driveFolderID)
 }
 
+func (s *BandService) FindOneByChatID(chatID int64) (*entities.Band, error) {
+	return s.bandRepository.FindOneByChatID(chatID)
+}
+
 func (s *BandService) UpdateOne(band entities.Band) (*entities.Band, error) {
 	return s.bandRepository.UpdateOne(band)
 }
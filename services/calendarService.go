@@ -0,0 +1,213 @@
+package services
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"github.com/joeyave/scala-chords-bot/entities"
+	"github.com/joeyave/scala-chords-bot/repositories"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"strings"
+	"time"
+)
+
+// Events have no end time, so they last this long in calendars.
+const calendarEventDuration = 2 * time.Hour
+
+// CalendarService exports events as iCalendar (RFC 5545).
+// Feeds are protected by tokens signed with the secret, so a link can't be guessed from the user or band ID.
+// The signatures cover the nonces of the user and of the band, so a new nonce revokes the links.
+type CalendarService struct {
+	eventRepository repositories.EventRepository
+	userRepository  repositories.UserRepository
+	bandRepository  repositories.BandRepository
+	secret          []byte
+}
+
+func NewCalendarService(eventRepository repositories.EventRepository, userRepository repositories.UserRepository, bandRepository repositories.BandRepository, secret string) *CalendarService {
+	return &CalendarService{
+		eventRepository: eventRepository,
+		userRepository:  userRepository,
+		bandRepository:  bandRepository,
+		secret:          []byte(secret),
+	}
+}
+
+// UserCalendar returns upcoming events of all bands where the user serves, with the roles of the user in the summary.
+func (s *CalendarService) UserCalendar(user *entities.User) string {
+	// Not found means there are no events.
+	events, _ := s.eventRepository.FindManyFromTodayByUserID(user.ID)
+
+	return s.ToICalendar(user.Name, events, user.ID)
+}
+
+// BandCalendar returns all upcoming events of the band.
+func (s *CalendarService) BandCalendar(band *entities.Band) string {
+	events, _ := s.eventRepository.FindManyFromTodayByBandID(band.ID)
+
+	return s.ToICalendar(band.Name, events, 0)
+}
+
+// UserToken returns the token of the user feed.
+func (s *CalendarService) UserToken(user *entities.User) string {
+	return s.token(fmt.Sprintf("user:%d", user.ID), user.CalendarNonce)
+}
+
+// BandToken returns the token of the band feed for the member. The link works while they are in the band.
+func (s *CalendarService) BandToken(band *entities.Band, user *entities.User) string {
+	return s.token(fmt.Sprintf("band:%s:user:%d", band.ID.Hex(), user.ID), band.CalendarNonce, user.CalendarNonce)
+}
+
+// RegenerateUserTokens revokes the links of the user to both feeds.
+func (s *CalendarService) RegenerateUserTokens(user *entities.User) error {
+	nonce, err := newNonce()
+	if err != nil {
+		return err
+	}
+	user.CalendarNonce = nonce
+
+	_, err = s.userRepository.UpdateOne(*user)
+	return err
+}
+
+// RegenerateBandTokens revokes the links of all members to the band feed and returns the band with the new nonce.
+func (s *CalendarService) RegenerateBandTokens(bandID primitive.ObjectID) (*entities.Band, error) {
+	band, err := s.bandRepository.FindOneByID(bandID)
+	if err != nil {
+		return nil, err
+	}
+
+	band.CalendarNonce, err = newNonce()
+	if err != nil {
+		return nil, err
+	}
+
+	return s.bandRepository.UpdateOne(*band)
+}
+
+// Users from before links could be revoked have no nonce, their links stay the same until the first revoke.
+func (s *CalendarService) token(feed string, nonces ...string) string {
+	mac := hmac.New(sha256.New, s.secret)
+	mac.Write([]byte("calendar:" + feed))
+	for _, nonce := range nonces {
+		if nonce != "" {
+			mac.Write([]byte(":" + nonce))
+		}
+	}
+	return hex.EncodeToString(mac.Sum(nil))[:32]
+}
+
+// ToICalendar writes the events. If userID is not 0, roles of the user are added to the summaries.
+func (s *CalendarService) ToICalendar(name string, events []*entities.Event, userID int64) string {
+	var b strings.Builder
+
+	writeCalendarLine(&b, "BEGIN:VCALENDAR")
+	writeCalendarLine(&b, "VERSION:2.0")
+	writeCalendarLine(&b, "PRODID:-//scala-chords-bot//RU")
+	writeCalendarLine(&b, "CALSCALE:GREGORIAN")
+	writeCalendarLine(&b, "METHOD:PUBLISH")
+	writeCalendarLine(&b, "X-WR-CALNAME:"+escapeCalendarText(name))
+
+	now := time.Now()
+	for _, event := range events {
+		summary := event.Name
+		roles := make([]string, 0)
+		for _, membership := range event.Memberships {
+			if userID != 0 && membership.UserID == userID && membership.Role != nil {
+				roles = append(roles, membership.Role.Name)
+			}
+		}
+		if len(roles) > 0 {
+			summary = fmt.Sprintf("%s (%s)", summary, strings.Join(roles, ", "))
+		}
+
+		writeCalendarLine(&b, "BEGIN:VEVENT")
+		writeCalendarLine(&b, fmt.Sprintf("UID:%s@scala-chords-bot", event.ID.Hex()))
+		writeCalendarLine(&b, "DTSTAMP:"+calendarTime(now))
+		writeCalendarLine(&b, "DTSTART:"+calendarTime(event.Time))
+		writeCalendarLine(&b, "DTEND:"+calendarTime(event.Time.Add(calendarEventDuration)))
+		writeCalendarLine(&b, "SUMMARY:"+escapeCalendarText(summary))
+		writeCalendarLine(&b, "DESCRIPTION:"+escapeCalendarText(calendarDescription(event)))
+		writeCalendarLine(&b, "END:VEVENT")
+	}
+
+	writeCalendarLine(&b, "END:VCALENDAR")
+
+	return b.String()
+}
+
+// calendarDescription lists the roles with their members and the setlist.
+func calendarDescription(event *entities.Event) string {
+	lines := make([]string, 0)
+
+	var currRoleID primitive.ObjectID
+	for _, membership := range event.Memberships {
+		if membership.User == nil || membership.Role == nil {
+			continue
+		}
+
+		if currRoleID != membership.RoleID || len(lines) == 0 {
+			currRoleID = membership.RoleID
+			lines = append(lines, fmt.Sprintf("%s: %s", membership.Role.Name, membership.User.Name))
+		} else {
+			lines[len(lines)-1] += ", " + membership.User.Name
+		}
+	}
+
+	if len(event.Songs) > 0 {
+		if len(lines) > 0 {
+			lines = append(lines, "")
+		}
+		lines = append(lines, "Список:")
+
+		for i, song := range event.Songs {
+			line := fmt.Sprintf("%d. %s (%s)", i+1, song.PDF.Name, event.SongCaption(song))
+
+			entry := event.SetlistEntry(song.ID)
+			if vocalist := event.Vocalist(entry); vocalist != nil && vocalist.User != nil {
+				line += " — " + vocalist.User.Name
+			}
+			if entry.Note != "" {
+				line += " — " + entry.Note
+			}
+
+			lines = append(lines, line)
+		}
+	}
+
+	return strings.Join(lines, "\n")
+}
+
+func calendarTime(t time.Time) string {
+	return t.UTC().Format("20060102T150405Z")
+}
+
+func escapeCalendarText(text string) string {
+	return strings.NewReplacer(`\`, `\\`, ";", `\;`, ",", `\,`, "\r\n", `\n`, "\n", `\n`).Replace(text)
+}
+
+// writeCalendarLine folds the line to 75 octets without breaking UTF-8 characters and ends it with CRLF.
+func writeCalendarLine(b *strings.Builder, line string) {
+	limit := 75
+	for len(line) > limit {
+		cut := limit
+		for cut > 0 && !isRuneStart(line[cut]) {
+			cut--
+		}
+
+		b.WriteString(line[:cut])
+		b.WriteString("\r\n ")
+		line = line[cut:]
+
+		// The leading space of the continuation line counts too.
+		limit = 74
+	}
+
+	b.WriteString(line)
+	b.WriteString("\r\n")
+}
+
+func isRuneStart(b byte) bool {
+	return b&0xC0 != 0x80
+}
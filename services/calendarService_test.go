@@ -0,0 +1,61 @@
+package services
+
+import (
+	"testing"
+
+	"github.com/joeyave/scala-chords-bot/entities"
+	"github.com/joeyave/scala-chords-bot/repositories"
+)
+
+func TestCalendarRegenerateTokens(t *testing.T) {
+	store := repositories.NewMemoryStore()
+	userRepository := repositories.NewUserMemoryRepository(store)
+	bandRepository := repositories.NewBandMemoryRepository(store)
+	service := NewCalendarService(repositories.NewEventMemoryRepository(store), userRepository, bandRepository, "secret")
+
+	band, err := bandRepository.UpdateOne(entities.Band{Name: "Band"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	sam, err := userRepository.UpdateOne(entities.User{ID: 1, Name: "Sam", BandID: band.ID})
+	if err != nil {
+		t.Fatal(err)
+	}
+	pat, err := userRepository.UpdateOne(entities.User{ID: 2, Name: "Pat", BandID: band.ID})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if service.BandToken(band, sam) == service.BandToken(band, pat) {
+		t.Fatal("members have the same link to the band feed")
+	}
+
+	userToken, samBandToken, patBandToken := service.UserToken(sam), service.BandToken(band, sam), service.BandToken(band, pat)
+
+	err = service.RegenerateUserTokens(sam)
+	if err != nil {
+		t.Fatal(err)
+	}
+	sam, err = userRepository.FindOneByID(sam.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if service.UserToken(sam) == userToken || service.BandToken(band, sam) == samBandToken {
+		t.Error("links of the user are the same after they were revoked")
+	}
+	if service.BandToken(band, pat) != patBandToken {
+		t.Error("links of another member changed")
+	}
+
+	samBandToken = service.BandToken(band, sam)
+	band, err = service.RegenerateBandTokens(band.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if service.BandToken(band, sam) == samBandToken || service.BandToken(band, pat) == patBandToken {
+		t.Error("links to the band feed are the same after they were revoked")
+	}
+	if service.UserToken(sam) == userToken {
+		t.Error("revoking the band links brought the old user link back")
+	}
+}
@@ -0,0 +1,133 @@
+package services
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+)
+
+var (
+	ErrInvalidCallback = errors.New("invalid callback data")
+	ErrCallbackTooLong = errors.New("signed callback data is longer than 64 bytes")
+)
+
+// Telegram rejects messages with longer callback data of buttons.
+const maxCallbackDataLength = 64
+
+// CallbackService signs callback data of inline buttons and callback URLs hidden in messages, so users can't
+// make them up. A signature is bound to the user the message is sent to and expires after ttl.
+//
+// Telegram allows 64 bytes of callback data, so the signed data is kept short: "{signature}.{expiry}.{data}",
+// where the expiry is in hours since the epoch.
+type CallbackService struct {
+	secret []byte
+	ttl    time.Duration
+}
+
+func NewCallbackService(secret string, ttl time.Duration) *CallbackService {
+	return &CallbackService{
+		secret: []byte(secret),
+		ttl:    ttl,
+	}
+}
+
+// Sign returns the callback data signed for the user. The signature adds about 14 bytes,
+// ErrCallbackTooLong is returned if the result doesn't fit into the limit of Telegram.
+func (s *CallbackService) Sign(userID int64, data string) (string, error) {
+	expiry := s.expiry()
+	signed := s.signature("data", userID, expiry, data) + "." + expiry + "." + data
+	if len(signed) > maxCallbackDataLength {
+		return "", fmt.Errorf("%w: %q is %d bytes", ErrCallbackTooLong, data, len(signed))
+	}
+	return signed, nil
+}
+
+// Verify checks the signed callback data and returns the data itself.
+func (s *CallbackService) Verify(userID int64, signed string) (string, error) {
+	parts := strings.SplitN(signed, ".", 3)
+	if len(parts) != 3 {
+		return "", ErrInvalidCallback
+	}
+
+	err := s.check(parts[0], "data", userID, parts[1], parts[2])
+	if err != nil {
+		return "", err
+	}
+
+	return parts[2], nil
+}
+
+// SignURL adds the expiry and the signature to the query of the callback URL.
+func (s *CallbackService) SignURL(userID int64, rawURL string) string {
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		return rawURL
+	}
+
+	q := u.Query()
+	q.Del("exp")
+	q.Del("sig")
+
+	expiry := s.expiry()
+	sig := s.signature("url", userID, expiry, u.Path+"?"+q.Encode())
+
+	q.Set("exp", expiry)
+	q.Set("sig", sig)
+	u.RawQuery = q.Encode()
+
+	return u.String()
+}
+
+// VerifyURL checks the signed callback URL and returns it without the expiry and the signature.
+func (s *CallbackService) VerifyURL(userID int64, rawURL string) (string, error) {
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		return "", ErrInvalidCallback
+	}
+
+	q := u.Query()
+	expiry, sig := q.Get("exp"), q.Get("sig")
+	q.Del("exp")
+	q.Del("sig")
+
+	err = s.check(sig, "url", userID, expiry, u.Path+"?"+q.Encode())
+	if err != nil {
+		return "", err
+	}
+
+	u.RawQuery = q.Encode()
+	return u.String(), nil
+}
+
+func (s *CallbackService) check(sig string, kind string, userID int64, expiry string, data string) error {
+	hours, err := strconv.ParseInt(expiry, 36, 64)
+	if err != nil {
+		return ErrInvalidCallback
+	}
+
+	if !hmac.Equal([]byte(sig), []byte(s.signature(kind, userID, expiry, data))) {
+		return ErrInvalidCallback
+	}
+
+	if time.Now().After(time.Unix(hours*3600, 0)) {
+		return ErrInvalidCallback
+	}
+
+	return nil
+}
+
+func (s *CallbackService) expiry() string {
+	return strconv.FormatInt(time.Now().Add(s.ttl).Unix()/3600+1, 36)
+}
+
+func (s *CallbackService) signature(kind string, userID int64, expiry string, data string) string {
+	mac := hmac.New(sha256.New, s.secret)
+	mac.Write([]byte(fmt.Sprintf("callback:%s:%d:%s:%s", kind, userID, expiry, data)))
+	return base64.RawURLEncoding.EncodeToString(mac.Sum(nil)[:6])
+}
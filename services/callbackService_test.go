@@ -0,0 +1,103 @@
+package services
+
+import (
+	"errors"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestCallbackSignVerify(t *testing.T) {
+	service := NewCallbackService("secret", time.Hour)
+
+	signed, err := service.Sign(1, "26:0:payload")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	expired, err := NewCallbackService("secret", -2*time.Hour).Sign(1, "26:0:payload")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	cases := []struct {
+		name   string
+		userID int64
+		signed string
+		want   string
+		err    error
+	}{
+		{name: "valid", userID: 1, signed: signed, want: "26:0:payload"},
+		{name: "tampered data", userID: 1, signed: strings.Replace(signed, "payload", "paylaod", 1), err: ErrInvalidCallback},
+		{name: "tampered expiry", userID: 1, signed: strings.Replace(signed, ".", ".1", 1), err: ErrInvalidCallback},
+		{name: "wrong user", userID: 2, signed: signed, err: ErrInvalidCallback},
+		{name: "expired", userID: 1, signed: expired, err: ErrInvalidCallback},
+		{name: "unsigned", userID: 1, signed: "26:0:payload", err: ErrInvalidCallback},
+		{name: "another secret", userID: 1, signed: mustSign(t, NewCallbackService("other", time.Hour), 1, "26:0:payload"), err: ErrInvalidCallback},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			got, err := service.Verify(c.userID, c.signed)
+			if !errors.Is(err, c.err) || got != c.want {
+				t.Errorf("Verify(%d, %q) = %q, %v, want %q, %v", c.userID, c.signed, got, err, c.want, c.err)
+			}
+		})
+	}
+}
+
+func TestCallbackSignURL(t *testing.T) {
+	service := NewCallbackService("secret", time.Hour)
+
+	const rawURL = "https://t.me/callbackData?driveFileId=abc&eventId=def"
+	signed := service.SignURL(1, rawURL)
+	if signed == rawURL {
+		t.Fatal("URL is not signed")
+	}
+
+	got, err := service.VerifyURL(1, signed)
+	if err != nil || got != rawURL {
+		t.Errorf("VerifyURL(signed) = %q, %v, want %q", got, err, rawURL)
+	}
+
+	// Signing again replaces the old signature.
+	got, err = service.VerifyURL(1, service.SignURL(1, signed))
+	if err != nil || got != rawURL {
+		t.Errorf("VerifyURL(signed twice) = %q, %v, want %q", got, err, rawURL)
+	}
+
+	for name, u := range map[string]string{
+		"tampered query": strings.Replace(signed, "driveFileId=abc", "driveFileId=abd", 1),
+		"added param":    signed + "&index=1",
+		"unsigned":       rawURL,
+	} {
+		if _, err := service.VerifyURL(1, u); !errors.Is(err, ErrInvalidCallback) {
+			t.Errorf("%s: VerifyURL(%q) = %v, want ErrInvalidCallback", name, u, err)
+		}
+	}
+	if _, err := service.VerifyURL(2, signed); !errors.Is(err, ErrInvalidCallback) {
+		t.Errorf("VerifyURL of another user = %v, want ErrInvalidCallback", err)
+	}
+	if _, err := NewCallbackService("secret", -2*time.Hour).VerifyURL(1, NewCallbackService("secret", -2*time.Hour).SignURL(1, rawURL)); !errors.Is(err, ErrInvalidCallback) {
+		t.Errorf("VerifyURL of expired URL = %v, want ErrInvalidCallback", err)
+	}
+}
+
+func TestCallbackSignTooLong(t *testing.T) {
+	service := NewCallbackService("secret", time.Hour)
+
+	_, err := service.Sign(1, strings.Repeat("x", 64))
+	if !errors.Is(err, ErrCallbackTooLong) {
+		t.Errorf("Sign of 64 bytes = %v, want ErrCallbackTooLong", err)
+	}
+}
+
+func mustSign(t *testing.T, service *CallbackService, userID int64, data string) string {
+	t.Helper()
+
+	signed, err := service.Sign(userID, data)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return signed
+}
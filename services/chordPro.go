@@ -0,0 +1,276 @@
+package services
+
+import (
+	"fmt"
+	"github.com/joeyave/chords-transposer/transposer"
+	"regexp"
+	"strings"
+)
+
+// ChordProSong is a song in the ChordPro format (https://www.chordpro.org) converted to our layout:
+// Lyrics keep chords on separate lines above the words, the same way they are written in the docs.
+type ChordProSong struct {
+	Name   string
+	Key    string
+	BPM    string
+	Time   string
+	Lyrics string
+}
+
+var (
+	chordProDirectiveRegex = regexp.MustCompile(`^\{\s*([a-zA-Z_]+)\s*(?::\s*(.*?))?\s*}$`)
+	chordProChordRegex     = regexp.MustCompile(`\[([^\]]*)]`)
+	sectionNameRegex       = regexp.MustCompile(`^\s*(\p{L}+(\s\d*)?):\s*$`)
+	hChordRegex            = regexp.MustCompile(`(^|[\s|/(-])H`)
+)
+
+// ParseChordPro converts ChordPro text with inline [C] chords into chords-over-lyrics text.
+func ParseChordPro(text string) *ChordProSong {
+	song := &ChordProSong{}
+
+	var title, artist string
+	lines := make([]string, 0)
+
+	text = strings.ReplaceAll(strings.TrimPrefix(text, "\ufeff"), "\r\n", "\n")
+	for _, line := range strings.Split(text, "\n") {
+		trimmed := strings.TrimSpace(line)
+
+		if strings.HasPrefix(trimmed, "#") {
+			continue
+		}
+
+		matches := chordProDirectiveRegex.FindStringSubmatch(trimmed)
+		if matches == nil {
+			lines = append(lines, chordProLineToChordsOverLyrics(strings.TrimRight(line, " \t"))...)
+			continue
+		}
+
+		name, value := strings.ToLower(matches[1]), matches[2]
+		switch name {
+		case "title", "t":
+			title = value
+		case "subtitle", "st", "artist":
+			if artist == "" {
+				artist = value
+			}
+		case "key":
+			song.Key = value
+		case "tempo":
+			song.BPM = value
+		case "time":
+			song.Time = value
+		case "comment", "c", "comment_italic", "ci", "comment_box", "cb":
+			// Section names are exported as comments, turn them back into labels.
+			if sectionNameRegex.MatchString(value + ":") {
+				value += ":"
+			}
+			lines = append(lines, value)
+		case "start_of_verse", "sov":
+			lines = append(lines, sectionLabel(value, "Verse"))
+		case "start_of_chorus", "soc":
+			lines = append(lines, sectionLabel(value, "Chorus"))
+		case "start_of_bridge", "sob":
+			lines = append(lines, sectionLabel(value, "Bridge"))
+		}
+	}
+
+	song.Name = title
+	if artist != "" {
+		song.Name = fmt.Sprintf("%s - %s", title, artist)
+	}
+	song.Lyrics = strings.Trim(strings.Join(lines, "\n"), "\n")
+
+	return song
+}
+
+// ComposeChordPro converts chords-over-lyrics text into ChordPro with inline [C] chords.
+func ComposeChordPro(name string, key string, BPM string, time string, lyrics string) string {
+	var b strings.Builder
+
+	title, artist := name, ""
+	if i := strings.LastIndex(name, " - "); i >= 0 {
+		title, artist = name[:i], name[i+len(" - "):]
+	}
+
+	fmt.Fprintf(&b, "{title: %s}\n", title)
+	if artist != "" {
+		fmt.Fprintf(&b, "{artist: %s}\n", artist)
+	}
+	for _, directive := range [][2]string{{"key", key}, {"tempo", BPM}, {"time", time}} {
+		if directive[1] != "" && directive[1] != "?" {
+			fmt.Fprintf(&b, "{%s: %s}\n", directive[0], directive[1])
+		}
+	}
+	b.WriteString("\n")
+
+	lines := strings.Split(strings.ReplaceAll(lyrics, "\r\n", "\n"), "\n")
+	for i := 0; i < len(lines); i++ {
+		line := strings.TrimRight(lines[i], " \t")
+
+		if matches := sectionNameRegex.FindStringSubmatch(line); matches != nil {
+			fmt.Fprintf(&b, "{comment: %s}\n", matches[1])
+			continue
+		}
+
+		tokens := tokenizeLine(line)
+		if !isChordLine(tokens) {
+			b.WriteString(line + "\n")
+			continue
+		}
+
+		if i+1 < len(lines) {
+			next := strings.TrimRight(lines[i+1], " \t")
+			if strings.TrimSpace(next) != "" && !sectionNameRegex.MatchString(next) && !isChordLine(tokenizeLine(next)) {
+				b.WriteString(mergeChordsIntoLyrics(tokens, next) + "\n")
+				i++
+				continue
+			}
+		}
+
+		b.WriteString(mergeChordsIntoLyrics(tokens, "") + "\n")
+	}
+
+	return strings.TrimRight(b.String(), "\n") + "\n"
+}
+
+func sectionLabel(label string, defaultLabel string) string {
+	if label == "" {
+		label = defaultLabel
+	}
+	return label + ":"
+}
+
+// tokenizeLine splits the line into chords and text. The transposer doesn't know H, the B of the German notation,
+// so H is read as B and put back into the tokens: B and H have the same length, the offsets don't change.
+func tokenizeLine(line string) []transposer.Token {
+	lines := transposer.Tokenize(hChordRegex.ReplaceAllString(line, "${1}B"))
+	if len(lines) == 0 {
+		return nil
+	}
+
+	runes := []rune(line)
+	tokens := lines[0]
+	for i, token := range tokens {
+		if token.Chord == nil {
+			tokens[i].Text = string(runes[token.Offset : token.Offset+int64(len([]rune(token.Text)))])
+			continue
+		}
+
+		original := string(runes[token.Offset : token.Offset+int64(len([]rune(token.Chord.String())))])
+		if strings.HasPrefix(original, "H") {
+			token.Chord.Root = "H" + strings.TrimPrefix(token.Chord.Root, "B")
+		}
+		if strings.HasSuffix(original, "/H") {
+			token.Chord.Bass = "H"
+		}
+	}
+	return tokens
+}
+
+// isChordLine reports whether the line has chords and nothing but separators between them.
+func isChordLine(tokens []transposer.Token) bool {
+	hasChords := false
+	for _, token := range tokens {
+		if token.Chord != nil {
+			hasChords = true
+			continue
+		}
+		if strings.Trim(token.Text, " \t|-") != "" {
+			return false
+		}
+	}
+	return hasChords
+}
+
+// mergeChordsIntoLyrics puts every chord of the chord line into the lyrics at the same column.
+func mergeChordsIntoLyrics(tokens []transposer.Token, lyrics string) string {
+	// Lines without lyrics keep their spacing and bar lines.
+	if lyrics == "" {
+		var b strings.Builder
+		for _, token := range tokens {
+			if token.Chord != nil {
+				b.WriteString("[" + token.Chord.String() + "]")
+			} else {
+				b.WriteString(token.Text)
+			}
+		}
+		return strings.TrimRight(b.String(), " ")
+	}
+
+	runes := []rune(lyrics)
+
+	var b strings.Builder
+	column, pos := 0, 0
+	for _, token := range tokens {
+		if token.Chord == nil {
+			column += len([]rune(token.Text))
+			continue
+		}
+
+		for column > len(runes) {
+			runes = append(runes, ' ')
+		}
+		b.WriteString(string(runes[pos:column]))
+		b.WriteString("[" + token.Chord.String() + "]")
+		pos = column
+
+		column += len([]rune(token.Chord.String()))
+	}
+
+	if pos < len(runes) {
+		b.WriteString(string(runes[pos:]))
+	}
+
+	return strings.TrimRight(b.String(), " ")
+}
+
+// chordProLineToChordsOverLyrics splits a line with inline chords into a chord line and a lyrics line.
+func chordProLineToChordsOverLyrics(line string) []string {
+	matches := chordProChordRegex.FindAllStringSubmatchIndex(line, -1)
+	if matches == nil {
+		return []string{line}
+	}
+
+	// Chord lines keep their spacing, chords written next to each other like [Am][Bb] get a space between them.
+	if strings.Trim(chordProChordRegex.ReplaceAllString(line, ""), " \t|-") == "" {
+		var b strings.Builder
+		prev := 0
+		for i, match := range matches {
+			b.WriteString(line[prev:match[0]])
+			if i > 0 && match[0] == prev {
+				b.WriteString(" ")
+			}
+			b.WriteString(line[match[2]:match[3]])
+			prev = match[1]
+		}
+		b.WriteString(line[prev:])
+		return []string{b.String()}
+	}
+
+	var chords, lyrics []rune
+	prev := 0
+	for _, match := range matches {
+		lyrics = append(lyrics, []rune(line[prev:match[0]])...)
+		prev = match[1]
+
+		// Chords that would overlap are shifted right and the lyrics are padded to keep them aligned.
+		column := len(lyrics)
+		if len(chords) > 0 && len(chords) >= column {
+			column = len(chords) + 1
+		}
+		for len(chords) < column {
+			chords = append(chords, ' ')
+		}
+		for len(lyrics) < column {
+			lyrics = append(lyrics, ' ')
+		}
+		chords = append(chords, []rune(line[match[2]:match[3]])...)
+	}
+	lyrics = append(lyrics, []rune(line[prev:])...)
+
+	lyricsLine := strings.TrimRight(string(lyrics), " \t")
+	if lyricsLine == "" {
+		return []string{string(chords)}
+	}
+	return []string{string(chords), lyricsLine}
+}
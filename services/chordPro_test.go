@@ -0,0 +1,148 @@
+package services
+
+import (
+	"testing"
+)
+
+func TestParseChordPro(t *testing.T) {
+	tests := []struct {
+		name     string
+		chordPro string
+		want     ChordProSong
+	}{
+		{
+			name:     "metadata",
+			chordPro: "{title: Amazing Grace}\n{artist: John Newton}\n{key: G}\n{tempo: 72}\n{time: 3/4}\n\n[G]Amazing grace",
+			want: ChordProSong{
+				Name: "Amazing Grace - John Newton", Key: "G", BPM: "72", Time: "3/4",
+				Lyrics: "G\nAmazing grace",
+			},
+		},
+		{
+			name:     "chords over lyrics",
+			chordPro: "{title: Song}\n[C]Amazing [G/B]grace how [Am]sweet",
+			want:     ChordProSong{Name: "Song", Lyrics: "C       G/B       Am\nAmazing grace how sweet"},
+		},
+		{
+			name:     "overlapping chords",
+			chordPro: "{title: Song}\n[C][G]Amazing",
+			want:     ChordProSong{Name: "Song", Lyrics: "C G\n  Amazing"},
+		},
+		{
+			name:     "adjacent chords without lyrics",
+			chordPro: "{title: Song}\n[Am][Bb]",
+			want:     ChordProSong{Name: "Song", Lyrics: "Am Bb"},
+		},
+		{
+			name:     "chord line keeps spacing and bars",
+			chordPro: "{title: Song}\n| [Am]  [F] | [C][G] |",
+			want:     ChordProSong{Name: "Song", Lyrics: "| Am  F | C G |"},
+		},
+		{
+			name:     "sections",
+			chordPro: "{title: Song}\n{start_of_verse}\n[C]Line\n{end_of_verse}\n{soc: Chorus 2}\n{comment: Bridge}\n{c: play softly}",
+			want:     ChordProSong{Name: "Song", Lyrics: "Verse:\nC\nLine\nChorus 2:\nBridge:\nplay softly"},
+		},
+		{
+			name:     "comments and BOM",
+			chordPro: "\ufeff# exported\r\n{t: Song}\r\n[H7]Line",
+			want:     ChordProSong{Name: "Song", Lyrics: "H7\nLine"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := ParseChordPro(tt.chordPro)
+			if *got != tt.want {
+				t.Errorf("ParseChordPro() = %+v, want %+v", *got, tt.want)
+			}
+		})
+	}
+}
+
+func TestComposeChordPro(t *testing.T) {
+	tests := []struct {
+		name   string
+		lyrics string
+		want   string
+	}{
+		{
+			name:   "chords over lyrics",
+			lyrics: "C       G/B       Am\nAmazing grace how sweet",
+			want:   "[C]Amazing [G/B]grace how [Am]sweet\n",
+		},
+		{
+			name:   "chords past the end of lyrics",
+			lyrics: "C     G\nShort",
+			want:   "[C]Short [G]\n",
+		},
+		{
+			name:   "chord line without lyrics",
+			lyrics: "| Am  F | C G |",
+			want:   "| [Am]  [F] | [C] [G] |\n",
+		},
+		{
+			name:   "H notation",
+			lyrics: "Hmaj7 Esus4 Hm/H\n\nE/H    H7\nLyrics here",
+			want:   "[Hmaj7] [Esus4] [Hm/H]\n\n[E/H]Lyrics [H7]here\n",
+		},
+		{
+			name:   "words starting with H are lyrics",
+			lyrics: "Hallelujah Hosanna",
+			want:   "Hallelujah Hosanna\n",
+		},
+		{
+			name:   "sections",
+			lyrics: "Verse 1:\nC\nLine\n\nChorus:\nG\nLine",
+			want:   "{comment: Verse 1}\n[C]Line\n\n{comment: Chorus}\n[G]Line\n",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			want := "{title: Song}\n{artist: Artist}\n{key: C}\n\n" + tt.want
+
+			got := ComposeChordPro("Song - Artist", "C", "?", "", tt.lyrics)
+			if got != want {
+				t.Errorf("ComposeChordPro() =\n%s\nwant\n%s", got, want)
+			}
+		})
+	}
+}
+
+// Songs go both ways between the docs and apps like OnSong or SongbookPro, nothing may be lost on the way.
+func TestChordProRoundTrip(t *testing.T) {
+	tests := []struct {
+		name   string
+		lyrics string
+	}{
+		{
+			name:   "verse and chorus",
+			lyrics: "Verse 1:\nC       G/B       Am\nAmazing grace how sweet\nF          C\nThe sound that saved\n\nChorus:\nF  C  G\nWas blind",
+		},
+		{
+			name:   "chord lines",
+			lyrics: "Intro:\n| Am  F | C G |\nAm Bb",
+		},
+		{
+			name:   "H notation",
+			lyrics: "Hmaj7 Esus4\nLyrics here\nH/D#\nAnd here",
+		},
+		{
+			name:   "lyrics without chords",
+			lyrics: "Just words\n\nMore words",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			chordPro := ComposeChordPro("Song - Artist", "C", "120", "4/4", tt.lyrics)
+
+			song := ParseChordPro(chordPro)
+			want := ChordProSong{Name: "Song - Artist", Key: "C", BPM: "120", Time: "4/4", Lyrics: tt.lyrics}
+			if *song != want {
+				t.Errorf("round trip through\n%s\ngave %+v, want %+v", chordPro, *song, want)
+			}
+		})
+	}
+}
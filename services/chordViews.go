@@ -0,0 +1,136 @@
+package services
+
+import (
+	"fmt"
+	"github.com/joeyave/chords-transposer/transposer"
+	"strings"
+)
+
+// Names of the chord shapes for every semitone from C, the way guitarists spell them.
+var (
+	capoShapes      = []string{"C", "Db", "D", "Eb", "E", "F", "F#", "G", "Ab", "A", "Bb", "B"}
+	minorCapoShapes = []string{"Cm", "C#m", "Dm", "Ebm", "Em", "Fm", "F#m", "Gm", "G#m", "Am", "Bbm", "Bm"}
+)
+
+// Keys that are played mostly with open chords, a capo is put on to play in them.
+var openShapeKeys = map[string]bool{"C": true, "D": true, "E": true, "G": true, "A": true, "Am": true, "Dm": true, "Em": true}
+
+// maxCapo is the highest fret the capo is offered on.
+const maxCapo = 7
+
+// Nashville numbers for every semitone from the tonic.
+var nashvilleNumbers = []string{"1", "b2", "2", "b3", "3", "4", "#4", "5", "b6", "6", "b7", "7"}
+
+var noteRanks = map[string]int{
+	"B#": 0, "C": 0, "C#": 1, "Db": 1, "D": 2, "D#": 3, "Eb": 3, "E": 4, "Fb": 4, "E#": 5, "F": 5,
+	"F#": 6, "Gb": 6, "G": 7, "G#": 8, "Ab": 8, "A": 9, "A#": 10, "Bb": 10, "Cb": 11, "B": 11, "H": 11,
+}
+
+// CapoShapesKey returns the key of the chord shapes that sound in soundingKey with a capo on the fret.
+// The key is minor if soundingKey is minor.
+func CapoShapesKey(soundingKey string, capo int) (string, error) {
+	tonic, minor, err := parseKey(soundingKey)
+	if err != nil {
+		return "", err
+	}
+
+	rank := ((tonic-capo)%12 + 12) % 12
+	if minor {
+		return minorCapoShapes[rank], nil
+	}
+	return capoShapes[rank], nil
+}
+
+// CapoPositions returns the frets, lowest first, on which the capo lets the song in soundingKey
+// be played with open chords.
+func CapoPositions(soundingKey string) ([]int, error) {
+	positions := make([]int, 0)
+	for capo := 1; capo <= maxCapo; capo++ {
+		shapesKey, err := CapoShapesKey(soundingKey, capo)
+		if err != nil {
+			return nil, err
+		}
+
+		if openShapeKeys[shapesKey] {
+			positions = append(positions, capo)
+		}
+	}
+	return positions, nil
+}
+
+// toNashvilleNumbers replaces chords with numbers relative to the tonic of the key: Am in C is 6m, G/B is 5/7.
+// Minor keys are numbered from their own tonic, not from the relative major: Am in Am is 1m, C is b3.
+func toNashvilleNumbers(text string, key string) (string, error) {
+	tonic, _, err := parseKey(key)
+	if err != nil {
+		return "", err
+	}
+
+	number := func(note string) string {
+		rank, ok := noteRanks[note]
+		if !ok {
+			return note
+		}
+		return nashvilleNumbers[((rank-tonic)%12+12)%12]
+	}
+
+	return mapChords(text, func(chord *transposer.Chord) string {
+		s := number(chord.Root) + chord.Suffix
+		if chord.Bass != "" {
+			s += "/" + number(chord.Bass)
+		}
+		return s
+	}), nil
+}
+
+// mapChords replaces every chord of the chord lines keeping the chords at their columns where possible.
+func mapChords(text string, f func(chord *transposer.Chord) string) string {
+	lines := strings.Split(text, "\n")
+	for i, line := range lines {
+		tokens := tokenizeLine(line)
+		if !isChordLine(tokens) {
+			continue
+		}
+
+		var b strings.Builder
+		// How many runes the new line is ahead of the old one.
+		shift := 0
+		for _, token := range tokens {
+			if token.Chord == nil {
+				text := token.Text
+				for shift > 0 && len(text) > 1 && text[0] == ' ' {
+					text = text[1:]
+					shift--
+				}
+				b.WriteString(text)
+				continue
+			}
+
+			s := f(token.Chord)
+			shift += len([]rune(s)) - len([]rune(token.Chord.String()))
+			for ; shift < 0; shift++ {
+				s += " "
+			}
+			b.WriteString(s)
+		}
+
+		lines[i] = strings.TrimRight(b.String(), " ")
+	}
+
+	return strings.Join(lines, "\n")
+}
+
+// parseKey returns the number of semitones from C to the tonic of the key and whether the key is minor.
+func parseKey(key string) (int, bool, error) {
+	chord, err := transposer.ParseChord(strings.Replace(key, "H", "B", 1))
+	if err != nil || (chord.Suffix != "" && !chord.IsMinor()) || chord.Bass != "" {
+		return 0, false, fmt.Errorf("%s is not a valid key", key)
+	}
+
+	rank, ok := noteRanks[chord.Root]
+	if !ok {
+		return 0, false, fmt.Errorf("%s is not a valid key", key)
+	}
+
+	return rank, chord.IsMinor(), nil
+}
@@ -0,0 +1,100 @@
+package services
+
+import (
+	"reflect"
+	"testing"
+)
+
+// Numbers take the columns of the chords, wider numbers take the spaces after them.
+func TestToNashvilleNumbers(t *testing.T) {
+	tests := []struct {
+		name string
+		text string
+		key  string
+		want string
+	}{
+		{"major", "C  Am  F  G/B\nLyrics", "C", "1  6m  4  5/7\nLyrics"},
+		{"major with accidentals", "D  Bb  E7", "D", "1  b6  27"},
+		{"minor from its tonic", "Am  C  Dm  E7  F  G", "Am", "1m  b3 4m  57  b6 b7"},
+		{"sharp minor", "F#m  A  Bm  C#", "F#m", "1m   b3 4m  5"},
+		{"H notation", "Hm  G  D  A/C#", "Hm", "1m  b6 b3 b7/2"},
+		{"lyrics are kept", "Amazing grace", "C", "Amazing grace"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := toNashvilleNumbers(tt.text, tt.key)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got != tt.want {
+				t.Errorf("toNashvilleNumbers() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+
+	_, err := toNashvilleNumbers("C", "X")
+	if err == nil {
+		t.Error("an invalid key is accepted")
+	}
+}
+
+func TestCapoShapesKey(t *testing.T) {
+	tests := []struct {
+		soundingKey string
+		capo        int
+		want        string
+	}{
+		{"A", 2, "G"},
+		{"Bb", 1, "A"},
+		{"Eb", 3, "C"},
+		{"F#m", 2, "Em"},
+		{"F#m", 3, "Ebm"},
+		{"Bbm", 1, "Am"},
+		{"C", 0, "C"},
+	}
+
+	for _, tt := range tests {
+		got, err := CapoShapesKey(tt.soundingKey, tt.capo)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got != tt.want {
+			t.Errorf("CapoShapesKey(%s, %d) = %s, want %s", tt.soundingKey, tt.capo, got, tt.want)
+		}
+	}
+}
+
+func TestCapoPositions(t *testing.T) {
+	tests := []struct {
+		soundingKey string
+		want        []int
+	}{
+		{"F", []int{1, 3, 5}},
+		{"Bb", []int{1, 3, 6}},
+		{"F#m", []int{2, 4}},
+		{"Am", []int{5, 7}},
+		{"Cm", []int{3}},
+	}
+
+	for _, tt := range tests {
+		got, err := CapoPositions(tt.soundingKey)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("CapoPositions(%s) = %v, want %v", tt.soundingKey, got, tt.want)
+		}
+	}
+
+	// A capo is worth it on some fret in any key.
+	for _, key := range append(capoShapes, minorCapoShapes...) {
+		positions, err := CapoPositions(key)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(positions) == 0 {
+			t.Errorf("no capo positions for %s", key)
+		}
+	}
+}
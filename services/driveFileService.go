@@ -1,12 +1,9 @@
 package services
 
 import (
-	"errors"
 	"fmt"
 	"github.com/flowchartsman/retry"
 	"github.com/joeyave/chords-transposer/transposer"
-	"github.com/joeyave/scala-chords-bot/helpers"
-	"google.golang.org/api/docs/v1"
 	"google.golang.org/api/drive/v3"
 	"io"
 	"io/ioutil"
@@ -17,99 +14,31 @@ import (
 )
 
 type DriveFileService struct {
-	driveRepository *drive.Service
-	docsRepository  *docs.Service
+	documentStore SongDocumentStore
+	pdfRenderer   *PDFRenderer
 }
 
-func NewDriveFileService(driveRepository *drive.Service, docsRepository *docs.Service) *DriveFileService {
+func NewDriveFileService(documentStore SongDocumentStore, pdfRenderer *PDFRenderer) *DriveFileService {
 	return &DriveFileService{
-		driveRepository: driveRepository,
-		docsRepository:  docsRepository,
+		documentStore: documentStore,
+		pdfRenderer:   pdfRenderer,
 	}
 }
 
 func (s *DriveFileService) FindAllByFolderID(folderID string, nextPageToken string) ([]*drive.File, string, error) {
-
-	q := fmt.Sprintf(`trashed = false and mimeType = 'application/vnd.google-apps.document' and '%s' in parents`, folderID)
-
-	res, err := s.driveRepository.Files.List().
-		Q(q).
-		Fields("nextPageToken, files(id, name, modifiedTime, webViewLink, parents)").
-		PageSize(helpers.PageSize).PageToken(nextPageToken).Do()
-
-	if err != nil {
-		return nil, "", err
-	}
-
-	return res.Files, res.NextPageToken, nil
+	return s.documentStore.FindAllByFolderID(folderID, nextPageToken)
 }
 
 func (s *DriveFileService) FindSomeByFullTextAndFolderID(name string, folderID string, pageToken string) ([]*drive.File, string, error) {
-	name = helpers.JsonEscape(name)
-
-	q := fmt.Sprintf(`fullText contains '%s'`+
-		` and trashed = false`+
-		` and mimeType = 'application/vnd.google-apps.document'`, name)
-
-	if folderID != "" {
-		q += fmt.Sprintf(` and '%s' in parents`, folderID)
-	}
-
-	res, err := s.driveRepository.Files.List().
-		// Use this for precise search.
-		//Q(fmt.Sprintf("fullText contains '\"%s\"'", name)).
-		Q(q).
-		Fields("nextPageToken, files(id, name, modifiedTime, webViewLink, parents)").
-		PageSize(helpers.PageSize).PageToken(pageToken).Do()
-
-	if err != nil {
-		return nil, "", err
-	}
-
-	return res.Files, res.NextPageToken, nil
+	return s.documentStore.FindSomeByFullTextAndFolderID(name, folderID, pageToken)
 }
 
 func (s *DriveFileService) FindOneByNameAndFolderID(name string, folderID string) (*drive.File, error) {
-	name = helpers.JsonEscape(name)
-
-	q := fmt.Sprintf(`name = '%s'`+
-		` and trashed = false`+
-		` and mimeType = 'application/vnd.google-apps.document'`, name)
-
-	if folderID != "" {
-		q += fmt.Sprintf(` and '%s' in parents`, folderID)
-	}
-
-	res, err := s.driveRepository.Files.List().
-		Q(q).
-		Fields("nextPageToken, files(id, name, modifiedTime, webViewLink, parents)").
-		PageSize(1).Do()
-	if err != nil {
-		return nil, err
-	}
-
-	if len(res.Files) == 0 {
-		return nil, errors.New("not found")
-	}
-
-	return res.Files[0], nil
+	return s.documentStore.FindOneByNameAndFolderID(name, folderID)
 }
 
 func (s *DriveFileService) FindOneByID(ID string) (*drive.File, error) {
-	retrier := retry.NewRetrier(5, 100*time.Millisecond, time.Second)
-
-	var driveFile *drive.File
-	err := retrier.Run(func() error {
-		_driveFile, err := s.driveRepository.Files.Get(ID).Fields("id, name, modifiedTime, webViewLink, parents").Do()
-		if err != nil {
-			return err
-		}
-
-		driveFile = _driveFile
-		return nil
-	})
-
-	return driveFile, err
+	return s.documentStore.FindOneByID(ID)
 }
 
 func (s *DriveFileService) FindManyByIDs(IDs []string) ([]*drive.File, error) {
@@ -135,397 +64,217 @@ func (s *DriveFileService) FindManyByIDs(IDs []string) ([]*drive.File, error) {
 }
 
 func (s *DriveFileService) CreateOne(newFile *drive.File, lyrics string, key string, BPM string, time string) (*drive.File, error) {
-	newFile, err := s.driveRepository.Files.
-		Create(newFile).
-		Fields("id, name, modifiedTime, webViewLink, parents").
-		Do()
-	if err != nil {
-		return nil, err
-	}
-
-	if len(newFile.Parents) > 0 {
-		// TODO: use pagination here.
-		folderPermissionsList, err := s.driveRepository.Permissions.
-			List(newFile.Parents[0]).
-			Fields("*").
-			PageSize(100).Do()
-		if err != nil {
-			return nil, err
-		}
-
-		var folderOwnerPermission *drive.Permission
-		for _, permission := range folderPermissionsList.Permissions {
-			if permission.Role == "owner" {
-				folderOwnerPermission = permission
-			}
-		}
-
-		if folderOwnerPermission != nil {
-			permission := &drive.Permission{
-				EmailAddress: folderOwnerPermission.EmailAddress,
-				Role:         "owner",
-				Type:         "user",
-			}
-			_, err = s.driveRepository.Permissions.
-				Create(newFile.Id, permission).
-				TransferOwnership(true).Do()
-			if err != nil {
-				return nil, err
-			}
-		}
-	}
+	return s.documentStore.CreateOne(newFile, lyrics, key, BPM, time)
+}
 
-	requests := make([]*docs.Request, 0)
+func (s *DriveFileService) CloneOne(fileToCloneID string, newFile *drive.File) (*drive.File, error) {
+	return s.documentStore.CloneOne(fileToCloneID, newFile)
+}
 
-	requests = append(requests, &docs.Request{
-		CreateHeader: &docs.CreateHeaderRequest{
-			Type: "DEFAULT",
-		},
-	})
+func (s *DriveFileService) DeleteOneByID(ID string) error {
+	return s.documentStore.DeleteOneByID(ID)
+}
 
-	if lyrics != "" {
-		requests = append(requests, &docs.Request{
-			InsertText: &docs.InsertTextRequest{
-				EndOfSegmentLocation: &docs.EndOfSegmentLocation{
-					SegmentId: "",
-				},
-				Text: lyrics,
-			},
-		})
+func (s *DriveFileService) DownloadOneByID(ID string) (*io.Reader, error) {
+	reader, err := s.export(ID, "application/pdf")
+	if err != nil {
+		// Export quota may be exceeded, draw the PDF ourselves then.
+		reader, err = s.RenderOneByID(ID)
 	}
+	return &reader, err
+}
 
-	res, err := s.docsRepository.Documents.BatchUpdate(newFile.Id,
-		&docs.BatchUpdateDocumentRequest{Requests: requests}).Do()
+// RenderOneByID draws the PDF from the document text without exporting it.
+func (s *DriveFileService) RenderOneByID(ID string) (io.Reader, error) {
+	text, err := s.GetText(ID)
 	if err != nil {
 		return nil, err
 	}
 
-	if res.Replies[0].CreateHeader.HeaderId != "" {
-		_, _ = s.docsRepository.Documents.BatchUpdate(newFile.Id,
-			&docs.BatchUpdateDocumentRequest{
-				Requests: []*docs.Request{
-					getDefaultHeaderRequest(res.Replies[0].CreateHeader.HeaderId, newFile.Name, key, BPM, time),
-				},
-			}).Do()
-	}
+	return s.pdfRenderer.Render(splitSections(text))
+}
 
-	doc, err := s.docsRepository.Documents.Get(newFile.Id).Do()
+// GetSections returns all sections of the document.
+func (s *DriveFileService) GetSections(ID string) ([]SongSection, error) {
+	text, err := s.GetText(ID)
 	if err != nil {
 		return nil, err
 	}
 
-	requests = nil
-	for _, paragraph := range doc.Body.Content {
-		if paragraph.Paragraph == nil {
-			continue
-		}
-
-		for _, element := range paragraph.Paragraph.Elements {
-			if element.TextRun == nil || element.TextRun.TextStyle == nil {
-				continue
-			}
-
-			element.TextRun.TextStyle.FontSize = &docs.Dimension{
-				Magnitude: 14,
-				Unit:      "PT",
-			}
+	return splitSections(text), nil
+}
 
-			requests = append(requests, &docs.Request{
-				UpdateTextStyle: &docs.UpdateTextStyleRequest{
-					Fields: "*",
-					Range: &docs.Range{
-						SegmentId:       "",
-						StartIndex:      element.StartIndex,
-						EndIndex:        element.EndIndex,
-						ForceSendFields: []string{"StartIndex"},
-					},
-					TextStyle: element.TextRun.TextStyle,
-				},
-			})
-		}
+// GetTransposedSection returns the first section of the document transposed to toKey without changing the document.
+func (s *DriveFileService) GetTransposedSection(ID string, toKey string) (SongSection, error) {
+	text, err := s.GetText(ID)
+	if err != nil {
+		return SongSection{}, err
 	}
 
-	_, _ = s.docsRepository.Documents.BatchUpdate(newFile.Id,
-		&docs.BatchUpdateDocumentRequest{Requests: requests}).Do()
-
-	return s.FindOneByID(newFile.Id)
+	return transposeSection(firstSection(text), toKey), nil
 }
 
-func (s *DriveFileService) CloneOne(fileToCloneID string, newFile *drive.File) (*drive.File, error) {
-	newFile, err := s.driveRepository.Files.
-		Copy(fileToCloneID, newFile).
-		Fields("id, name, modifiedTime, webViewLink, parents").
-		Do()
+// GetTransposedSections returns all sections of the document transposed to toKey without changing the document.
+func (s *DriveFileService) GetTransposedSections(ID string, toKey string) ([]SongSection, error) {
+	text, err := s.GetText(ID)
 	if err != nil {
 		return nil, err
 	}
 
-	if len(newFile.Parents) < 1 {
-		return newFile, nil
+	sections := splitSections(text)
+	for i := range sections {
+		sections[i] = transposeSection(sections[i], toKey)
 	}
 
-	// TODO: use pagination here.
-	folderPermissionsList, err := s.driveRepository.Permissions.
-		List(newFile.Parents[0]).
-		Fields("*").
-		PageSize(100).Do()
+	return sections, nil
+}
+
+// GetCapoSection returns the first section of the document with the chord shapes
+// that sound in soundingKey with a capo on the fret.
+func (s *DriveFileService) GetCapoSection(ID string, soundingKey string, capo int) (SongSection, error) {
+	shapesKey, err := CapoShapesKey(soundingKey, capo)
 	if err != nil {
-		return nil, err
+		return SongSection{}, err
 	}
 
-	var folderOwnerPermission *drive.Permission
-	for _, permission := range folderPermissionsList.Permissions {
-		if permission.Role == "owner" {
-			folderOwnerPermission = permission
-		}
+	section, err := s.GetTransposedSection(ID, shapesKey)
+	if err != nil {
+		return SongSection{}, err
 	}
 
-	if folderOwnerPermission != nil {
-		permission := &drive.Permission{
-			EmailAddress: folderOwnerPermission.EmailAddress,
-			Role:         "owner",
-			Type:         "user",
-		}
-		_, err = s.driveRepository.Permissions.
-			Create(newFile.Id, permission).
-			TransferOwnership(true).Do()
-		if err != nil {
-			return nil, err
-		}
-	}
+	section.Header = setHeaderMetadata(section.Header, "key", fmt.Sprintf("%s (capo %d: %s)", soundingKey, capo, shapesKey))
 
-	return newFile, nil
+	return section, nil
 }
 
-func (s *DriveFileService) DownloadOneByID(ID string) (*io.Reader, error) {
-	retrier := retry.NewRetrier(5, 100*time.Millisecond, time.Second)
+// GetNashvilleSection returns the first section of the document with chords in the Nashville Number System.
+func (s *DriveFileService) GetNashvilleSection(ID string) (SongSection, error) {
+	text, err := s.GetText(ID)
+	if err != nil {
+		return SongSection{}, err
+	}
 
-	var reader io.Reader
-	err := retrier.Run(func() error {
-		res, err := s.driveRepository.Files.Export(ID, "application/pdf").Download()
+	section := firstSection(text)
+
+	key, _, _ := parseMetadata(section.Header)
+	if key == "?" {
+		guessedKey, err := transposer.GuessKeyFromText(section.Body)
 		if err != nil {
-			return err
+			return SongSection{}, err
 		}
+		key = guessedKey.String()
+	}
 
-		reader = res.Body
+	section.Body, err = toNashvilleNumbers(section.Body, key)
+	if err != nil {
+		return SongSection{}, err
+	}
 
-		return nil
-	})
+	return section, nil
+}
 
-	return &reader, err
+// RenderSection draws the PDF of a single section.
+func (s *DriveFileService) RenderSection(section SongSection) (io.Reader, error) {
+	return s.pdfRenderer.Render([]SongSection{section})
 }
 
-func (s *DriveFileService) TransposeOne(ID string, toKey string, sectionIndex int) (*drive.File, error) {
-	doc, err := s.docsRepository.Documents.Get(ID).Do()
+func (s *DriveFileService) RenderBooklet(title string, roster []string, songs []BookletSong) (io.Reader, error) {
+	return s.pdfRenderer.RenderBooklet(title, roster, songs)
+}
+
+// RenderTransposedOneByID draws the PDF of the document in toKey without changing the document.
+func (s *DriveFileService) RenderTransposedOneByID(ID string, toKey string) (io.Reader, error) {
+	sections, err := s.GetTransposedSections(ID, toKey)
 	if err != nil {
 		return nil, err
 	}
 
-	sections := s.getSections(doc)
-
-	if len(sections) <= sectionIndex || sectionIndex < 0 {
-		sections, err = s.appendSectionByID(ID)
-		if err != nil {
-			return nil, err
-		}
-
-		doc, err = s.docsRepository.Documents.Get(ID).Do()
-		if err != nil {
-			return nil, err
-		}
-
-		sectionIndex = len(sections) - 1
-	}
+	return s.pdfRenderer.Render(sections)
+}
 
-	requests, key := s.transposeHeader(doc, sections, sectionIndex, toKey)
-	requests = append(requests, s.transposeBody(doc, sections, sectionIndex, key, toKey)...)
+func (s *DriveFileService) TransposeOne(ID string, toKey string, sectionIndex int) (*drive.File, error) {
+	return s.documentStore.TransposeOne(ID, toKey, sectionIndex)
+}
 
-	_, err = s.docsRepository.Documents.BatchUpdate(doc.DocumentId,
-		&docs.BatchUpdateDocumentRequest{Requests: requests}).Do()
+func (s *DriveFileService) StyleOne(ID string) (*drive.File, error) {
+	return s.documentStore.StyleOne(ID)
+}
 
-	return s.FindOneByID(ID)
+func (s *DriveFileService) GetSectionsNumber(ID string) (int, error) {
+	return s.documentStore.GetSectionsNumber(ID)
 }
 
-func (s *DriveFileService) StyleOne(ID string) (*drive.File, error) {
-	requests := make([]*docs.Request, 0)
+func (s *DriveFileService) GetMetadata(ID string) (string, string, string) {
+	text, _ := s.GetText(ID)
+	return parseMetadata(text)
+}
 
-	doc, err := s.docsRepository.Documents.Get(ID).Do()
+// GetText returns the document as plain text, including headers.
+func (s *DriveFileService) GetText(ID string) (string, error) {
+	reader, err := s.export(ID, "text/plain")
 	if err != nil {
-		return nil, err
+		return "", err
 	}
 
-	if doc.DocumentStyle.DefaultHeaderId == "" {
-		res, err := s.docsRepository.Documents.BatchUpdate(ID, &docs.BatchUpdateDocumentRequest{
-			Requests: []*docs.Request{
-				{
-					CreateHeader: &docs.CreateHeaderRequest{
-						Type: "DEFAULT",
-					},
-				},
-			},
-		}).Do()
-
-		if err == nil && res.Replies[0].CreateHeader.HeaderId != "" {
-			doc.DocumentStyle.DefaultHeaderId = res.Replies[0].CreateHeader.HeaderId
-			_, _ = s.docsRepository.Documents.BatchUpdate(ID, &docs.BatchUpdateDocumentRequest{
-				Requests: []*docs.Request{
-					getDefaultHeaderRequest(doc.DocumentStyle.DefaultHeaderId, doc.Title, "", "", ""),
-				},
-			}).Do()
-		}
-	}
-
-	doc, err = s.docsRepository.Documents.Get(ID).Do()
+	b, err := ioutil.ReadAll(reader)
 	if err != nil {
-		return nil, err
+		return "", err
 	}
 
-	for _, header := range doc.Headers {
-		for j, paragraph := range header.Content {
-			if paragraph.Paragraph == nil {
-				continue
-			}
-
-			style := *paragraph.Paragraph.ParagraphStyle
-
-			if j == 0 || j == 2 {
-				paragraph.Paragraph.ParagraphStyle.Alignment = "CENTER"
-			}
-			if j == 1 {
-				paragraph.Paragraph.ParagraphStyle.Alignment = "END"
-			}
-
-			requests = append(requests, &docs.Request{
-				UpdateParagraphStyle: &docs.UpdateParagraphStyleRequest{
-					Fields:         "*",
-					ParagraphStyle: &style,
-					Range: &docs.Range{
-						StartIndex:      paragraph.StartIndex,
-						EndIndex:        paragraph.EndIndex,
-						SegmentId:       header.HeaderId,
-						ForceSendFields: []string{"StartIndex"},
-					},
-				},
-			})
-
-			for _, element := range paragraph.Paragraph.Elements {
-
-				element.TextRun.TextStyle.WeightedFontFamily = &docs.WeightedFontFamily{
-					FontFamily: "Roboto Mono",
-				}
-
-				if j == 0 {
-					element.TextRun.TextStyle.Bold = true
-					element.TextRun.TextStyle.FontSize = &docs.Dimension{
-						Magnitude: 20,
-						Unit:      "PT",
-					}
-				}
-				if j == 1 {
-					element.TextRun.TextStyle.Bold = true
-					element.TextRun.TextStyle.FontSize = &docs.Dimension{
-						Magnitude: 14,
-						Unit:      "PT",
-					}
-				}
-				if j == 2 {
-					element.TextRun.TextStyle.Bold = true
-					element.TextRun.TextStyle.FontSize = &docs.Dimension{
-						Magnitude: 11,
-						Unit:      "PT",
-					}
-				}
-
-				requests = append(requests, &docs.Request{
-					UpdateTextStyle: &docs.UpdateTextStyleRequest{
-						Fields: "*",
-						Range: &docs.Range{
-							StartIndex:      element.StartIndex,
-							EndIndex:        element.EndIndex,
-							SegmentId:       header.HeaderId,
-							ForceSendFields: []string{"StartIndex"},
-						},
-						TextStyle: element.TextRun.TextStyle,
-					},
-				})
-			}
-		}
+	return strings.ReplaceAll(strings.TrimPrefix(string(b), "\ufeff"), "\r\n", "\n"), nil
+}
 
-		requests = append(requests, composeStyleRequests(header.Content, header.HeaderId)...)
+func (s *DriveFileService) ExportChordProByID(ID string) (string, error) {
+	driveFile, err := s.FindOneByID(ID)
+	if err != nil {
+		return "", err
 	}
 
-	requests = append(requests, composeStyleRequests(doc.Body.Content, "")...)
-
-	requests = append(requests, &docs.Request{
-		UpdateDocumentStyle: &docs.UpdateDocumentStyleRequest{
-			DocumentStyle: &docs.DocumentStyle{
-				MarginBottom: &docs.Dimension{
-					Magnitude: 14,
-					Unit:      "PT",
-				},
-				MarginHeader: &docs.Dimension{
-					Magnitude: 18,
-					Unit:      "PT",
-				},
-				MarginLeft: &docs.Dimension{
-					Magnitude: 30,
-					Unit:      "PT",
-				},
-				MarginRight: &docs.Dimension{
-					Magnitude: 30,
-					Unit:      "PT",
-				},
-				MarginTop: &docs.Dimension{
-					Magnitude: 14,
-					Unit:      "PT",
-				},
-				UseFirstPageHeaderFooter: false,
-			},
-			Fields: "marginBottom, marginLeft, marginRight, marginTop, marginHeader",
-		},
-	})
-
-	_, err = s.docsRepository.Documents.BatchUpdate(ID, &docs.BatchUpdateDocumentRequest{Requests: requests}).Do()
+	text, err := s.GetText(ID)
 	if err != nil {
-		return nil, err
+		return "", err
 	}
 
-	return s.FindOneByID(ID)
+	key, BPM, time := parseMetadata(text)
+
+	return ComposeChordPro(driveFile.Name, key, BPM, time, extractLyrics(text)), nil
 }
 
-func (s *DriveFileService) GetSectionsNumber(ID string) (int, error) {
-	doc, err := s.docsRepository.Documents.Get(ID).Do()
+func (s *DriveFileService) CreateOneFromChordPro(newFile *drive.File, chordPro string) (*drive.File, error) {
+	song := ParseChordPro(chordPro)
+	if song.Name != "" {
+		newFile.Name = song.Name
+	}
+
+	driveFile, err := s.CreateOne(newFile, song.Lyrics, song.Key, song.BPM, song.Time)
 	if err != nil {
-		return 0, err
+		return nil, err
 	}
 
-	return len(s.getSections(doc)), nil
+	return s.StyleOne(driveFile.Id)
 }
 
-func (s *DriveFileService) GetMetadata(ID string) (string, string, string) {
+func (s *DriveFileService) export(ID string, mimeType string) (io.Reader, error) {
 	retrier := retry.NewRetrier(5, 100*time.Millisecond, time.Second)
 
 	var reader io.Reader
 	err := retrier.Run(func() error {
-		res, err := s.driveRepository.Files.Export(ID, "text/plain").Download()
+		_reader, err := s.documentStore.Export(ID, mimeType)
 		if err != nil {
 			return err
 		}
 
-		reader = res.Body
-
+		reader = _reader
 		return nil
 	})
 
-	var driveFileText string
-	b, err := ioutil.ReadAll(reader)
-	if err == nil {
-		driveFileText = string(b)
-	}
+	return reader, err
+}
 
+func parseMetadata(text string) (string, string, string) {
 	key := "?"
 	keyRegex := regexp.MustCompile(`(?i)key:(.*?);`)
-	keyMatches := keyRegex.FindStringSubmatch(driveFileText)
+	keyMatches := keyRegex.FindStringSubmatch(text)
 	if len(keyMatches) > 1 {
 		keyTrimmed := strings.TrimSpace(keyMatches[1])
 		if keyTrimmed != "" {
@@ -535,7 +284,7 @@ func (s *DriveFileService) GetMetadata(ID string) (string, string, string) {
 
 	BPM := "?"
 	BPMRegex := regexp.MustCompile(`(?i)bpm:(.*?);`)
-	BPMMatches := BPMRegex.FindStringSubmatch(driveFileText)
+	BPMMatches := BPMRegex.FindStringSubmatch(text)
 	if len(BPMMatches) > 1 {
 		BPMTrimmed := strings.TrimSpace(BPMMatches[1])
 		if BPMTrimmed != "" {
@@ -545,7 +294,7 @@ func (s *DriveFileService) GetMetadata(ID string) (string, string, string) {
 
 	time := "?"
 	timeRegex := regexp.MustCompile(`(?i)time:(.*?);`)
-	timeMatches := timeRegex.FindStringSubmatch(driveFileText)
+	timeMatches := timeRegex.FindStringSubmatch(text)
 	if len(timeMatches) > 1 {
 		timeTrimmed := strings.TrimSpace(timeMatches[1])
 		if timeTrimmed != "" {
@@ -556,478 +305,96 @@ func (s *DriveFileService) GetMetadata(ID string) (string, string, string) {
 	return key, BPM, time
 }
 
-//
-// Helper functions. -----------------------------------
-//
-func (s *DriveFileService) getSections(doc *docs.Document) []docs.StructuralElement {
-	sections := make([]docs.StructuralElement, 0)
-
-	for i, section := range doc.Body.Content {
-		if section.SectionBreak != nil &&
-			section.SectionBreak.SectionStyle != nil &&
-			section.SectionBreak.SectionStyle.SectionType == "NEXT_PAGE" ||
-			i == 0 {
-			if i == 0 {
-				section.StartIndex = 0
-				section.SectionBreak.SectionStyle.DefaultHeaderId = doc.DocumentStyle.DefaultHeaderId
-			}
-
-			sections = append(sections, *section)
-		}
-	}
-
-	return sections
+// setHeaderMetadata replaces the value of the "NAME: value;" field of the header.
+func setHeaderMetadata(header string, name string, value string) string {
+	re := regexp.MustCompile(`(?i)` + regexp.QuoteMeta(name) + `:.*?;`)
+	return re.ReplaceAllStringFunc(header, func(field string) string {
+		return field[:len(name)+1] + " " + value + ";"
+	})
 }
 
-func (s *DriveFileService) appendSectionByID(ID string) ([]docs.StructuralElement, error) {
-	requests := &docs.BatchUpdateDocumentRequest{
-		Requests: []*docs.Request{
-			{
-				InsertSectionBreak: &docs.InsertSectionBreakRequest{
-					EndOfSegmentLocation: &docs.EndOfSegmentLocation{
-						SegmentId: "",
-					},
-					SectionType: "NEXT_PAGE",
-				},
-			},
-		},
-	}
-
-	_, err := s.docsRepository.Documents.BatchUpdate(ID, requests).Do()
-	if err != nil {
-		return nil, err
-	}
-
-	doc, err := s.docsRepository.Documents.Get(ID).Do()
-	if err != nil {
-		return nil, err
-	}
-
-	sections := s.getSections(doc)
-
-	requests = &docs.BatchUpdateDocumentRequest{
-		Requests: []*docs.Request{
-			{
-				CreateHeader: &docs.CreateHeaderRequest{
-					SectionBreakLocation: &docs.Location{
-						Index:     sections[len(sections)-1].StartIndex,
-						SegmentId: "",
-					},
-					Type: "DEFAULT",
-				},
-			},
-		},
-	}
-
-	_, err = s.docsRepository.Documents.BatchUpdate(ID, requests).Do()
-	if err != nil {
-		return nil, err
-	}
-
-	doc, err = s.docsRepository.Documents.Get(ID).Do()
-	if err != nil {
-		return nil, err
-	}
-	return s.getSections(doc), nil
+// SongSection is a page of a song: the first one holds the original, the others are usually transposed copies.
+type SongSection struct {
+	Header string `json:"header"`
+	Body   string `json:"body"`
 }
 
-func (s *DriveFileService) transposeHeader(doc *docs.Document, sections []docs.StructuralElement, sectionIndex int, toKey string) ([]*docs.Request, string) {
-	if doc.DocumentStyle.DefaultHeaderId == "" {
-		return nil, ""
-	}
-
-	requests := make([]*docs.Request, 0)
-
-	// Create header if section doesn't have it.
-	if sections[sectionIndex].SectionBreak.SectionStyle.DefaultHeaderId == "" {
-		requests = append(requests, &docs.Request{
-			CreateHeader: &docs.CreateHeaderRequest{
-				SectionBreakLocation: &docs.Location{
-					SegmentId: "",
-					Index:     sections[sectionIndex].StartIndex,
-				},
-				Type: "DEFAULT",
-			},
-		})
-	} else {
-		header := doc.Headers[sections[sectionIndex].SectionBreak.SectionStyle.DefaultHeaderId]
-		if header.Content[len(header.Content)-1].EndIndex-1 > 0 {
-			requests = append(requests, &docs.Request{
-				DeleteContentRange: &docs.DeleteContentRangeRequest{
-					Range: &docs.Range{
-						StartIndex:      0,
-						EndIndex:        header.Content[len(header.Content)-1].EndIndex - 1,
-						SegmentId:       header.HeaderId,
-						ForceSendFields: []string{"StartIndex"},
-					},
-				},
-			})
-
+// splitSections splits the document text by headers.
+// A header is the song name, the "KEY: …; BPM: …; TIME: …;" line and the structure line after it.
+func splitSections(text string) []SongSection {
+	lines := strings.Split(strings.ReplaceAll(text, "\r\n", "\n"), "\n")
+	headerRegex := regexp.MustCompile(`(?i)key:.*;`)
+
+	// Indexes of the first and of the last header line.
+	type header struct{ start, end int }
+	headers := make([]header, 0)
+	for i := range lines {
+		if !headerRegex.MatchString(lines[i]) {
+			continue
 		}
-	}
-
-	transposeRequests, key := composeTransposeRequests(doc.Headers[doc.DocumentStyle.DefaultHeaderId].Content,
-		0, "", toKey, doc.Headers[sections[sectionIndex].SectionBreak.SectionStyle.DefaultHeaderId].HeaderId)
-	requests = append(requests, transposeRequests...)
-
-	return requests, key
-}
-
-func (s *DriveFileService) transposeBody(doc *docs.Document, sections []docs.StructuralElement, sectionIndex int, key string, toKey string) []*docs.Request {
-	requests := make([]*docs.Request, 0)
 
-	sectionToInsertStartIndex := sections[sectionIndex].StartIndex + 1
-	var sectionToInsertEndIndex int64
-
-	if len(sections) > sectionIndex+1 {
-		sectionToInsertEndIndex = sections[sectionIndex+1].StartIndex - 1
-	} else {
-		sectionToInsertEndIndex = doc.Body.Content[len(doc.Body.Content)-1].EndIndex - 1
-	}
-
-	var content []*docs.StructuralElement
-	if len(sections) > 1 {
-		index := len(doc.Body.Content)
-		for i := range doc.Body.Content {
-			if doc.Body.Content[i].StartIndex == sections[1].StartIndex {
-				index = i
-				break
-			}
+		h := header{start: i, end: i + 1}
+		if i > 0 && strings.TrimSpace(lines[i-1]) != "" && (len(headers) == 0 || headers[len(headers)-1].end < i-1) {
+			h.start = i - 1
 		}
-		content = doc.Body.Content[:index]
-	} else {
-		content = doc.Body.Content
+		if h.end < len(lines) && strings.TrimSpace(lines[h.end]) != "" && !sectionNameRegex.MatchString(lines[h.end]) {
+			h.end++
+		}
+		headers = append(headers, h)
 	}
 
-	if sectionToInsertEndIndex-sectionToInsertStartIndex > 0 {
-		requests = append(requests, &docs.Request{
-			DeleteContentRange: &docs.DeleteContentRangeRequest{
-				Range: &docs.Range{
-					StartIndex:      sectionToInsertStartIndex,
-					EndIndex:        sectionToInsertEndIndex,
-					SegmentId:       "",
-					ForceSendFields: []string{"StartIndex"},
-				},
-			},
-		})
+	if len(headers) == 0 {
+		return []SongSection{{Body: strings.Trim(text, "\n")}}
 	}
 
-	transposeRequests, _ := composeTransposeRequests(content, sectionToInsertStartIndex, key, toKey, "")
-	requests = append(requests, transposeRequests...)
-
-	return requests
-}
-
-func composeTransposeRequests(content []*docs.StructuralElement, index int64, key string, toKey string, segmentId string) ([]*docs.Request, string) {
-	requests := make([]*docs.Request, 0)
-
-	for i, item := range content {
-		if item.Paragraph != nil && item.Paragraph.Elements != nil {
-			for _, element := range item.Paragraph.Elements {
-				if element.TextRun != nil && element.TextRun.Content != "" {
-					if key == "" {
-						guessedKey, err := transposer.GuessKeyFromText(element.TextRun.Content)
-						if err == nil {
-							key = guessedKey.String()
-						}
-					}
-
-					transposedText, err := transposer.TransposeToKey(element.TextRun.Content, key, toKey)
-					if err == nil {
-						element.TextRun.Content = transposedText
-					}
-
-					if i == len(content)-1 {
-						re := regexp.MustCompile("\\s*[\\r\\n]$")
-						element.TextRun.Content = re.ReplaceAllString(element.TextRun.Content, " ")
-					}
-
-					if len([]rune(element.TextRun.Content)) == 0 {
-						continue
-					}
-
-					if element.TextRun.TextStyle.ForegroundColor == nil {
-						element.TextRun.TextStyle.ForegroundColor = &docs.OptionalColor{
-							Color: &docs.Color{
-								RgbColor: &docs.RgbColor{
-									Blue:  0,
-									Green: 0,
-									Red:   0,
-								},
-							},
-						}
-					}
-
-					requests = append(requests,
-						&docs.Request{
-							InsertText: &docs.InsertTextRequest{
-								Location: &docs.Location{
-									Index:     index,
-									SegmentId: segmentId,
-								},
-								Text: element.TextRun.Content,
-							},
-						},
-						&docs.Request{
-							UpdateTextStyle: &docs.UpdateTextStyleRequest{
-								Fields: "*",
-								Range: &docs.Range{
-									StartIndex: index,
-									EndIndex:   index + int64(len([]rune(element.TextRun.Content))),
-									SegmentId:  segmentId,
-									ForceSendFields: func() []string {
-										if index == 0 {
-											return []string{"StartIndex"}
-										} else {
-											return nil
-										}
-									}(),
-								},
-								TextStyle: element.TextRun.TextStyle,
-							},
-						},
-						&docs.Request{
-							UpdateParagraphStyle: &docs.UpdateParagraphStyleRequest{
-								Fields:         "alignment, lineSpacing, direction, spaceAbove, spaceBelow",
-								ParagraphStyle: item.Paragraph.ParagraphStyle,
-								Range: &docs.Range{
-									StartIndex: index,
-									EndIndex:   index + int64(len([]rune(element.TextRun.Content))),
-									SegmentId:  segmentId,
-									ForceSendFields: func() []string {
-										if index == 0 {
-											return []string{"StartIndex"}
-										} else {
-											return nil
-										}
-									}(),
-								},
-							},
-						},
-					)
-
-					index += int64(len([]rune(element.TextRun.Content)))
-				}
-			}
-		}
+	sections := make([]SongSection, 0)
+	if leading := strings.Trim(strings.Join(lines[:headers[0].start], "\n"), "\n"); leading != "" {
+		sections = append(sections, SongSection{Body: leading})
 	}
 
-	return requests, key
-}
-
-func composeStyleRequests(content []*docs.StructuralElement, segmentID string) []*docs.Request {
-	requests := make([]*docs.Request, 0)
-	//makeBoldAndRedRegex := regexp.MustCompile(`(x|х)\d+`)
-	//sectionNamesRegex := regexp.MustCompile(`\p{L}+(\s\d*)?:|\|`)
-
-	for _, paragraph := range content {
-		if paragraph.Paragraph == nil {
-			continue
+	for i, h := range headers {
+		end := len(lines)
+		if i+1 < len(headers) {
+			end = headers[i+1].start
 		}
 
-		style := *paragraph.Paragraph.ParagraphStyle
-
-		style.SpaceAbove = &docs.Dimension{
-			Magnitude:       0,
-			Unit:            "PT",
-			ForceSendFields: []string{"Magnitude"},
-		}
-		style.SpaceBelow = &docs.Dimension{
-			Magnitude:       0,
-			Unit:            "PT",
-			ForceSendFields: []string{"Magnitude"},
-		}
-		style.LineSpacing = 90
-
-		requests = append(requests, &docs.Request{
-			UpdateParagraphStyle: &docs.UpdateParagraphStyleRequest{
-				Fields:         "*",
-				ParagraphStyle: &style,
-				Range: &docs.Range{
-					EndIndex:        paragraph.EndIndex,
-					SegmentId:       segmentID,
-					StartIndex:      paragraph.StartIndex,
-					ForceSendFields: []string{"StartIndex"},
-				},
-			},
+		sections = append(sections, SongSection{
+			Header: strings.Join(lines[h.start:h.end], "\n"),
+			Body:   strings.Trim(strings.Join(lines[h.end:end], "\n"), "\n"),
 		})
-
-		for _, element := range paragraph.Paragraph.Elements {
-			if element.TextRun == nil {
-				continue
-			}
-
-			element.TextRun.TextStyle.WeightedFontFamily = &docs.WeightedFontFamily{
-				FontFamily: "Roboto Mono",
-			}
-
-			requests = append(requests, &docs.Request{
-				UpdateTextStyle: &docs.UpdateTextStyleRequest{
-					Fields: "*",
-					Range: &docs.Range{
-						StartIndex:      element.StartIndex,
-						EndIndex:        element.EndIndex,
-						SegmentId:       segmentID,
-						ForceSendFields: []string{"StartIndex"},
-					},
-					TextStyle: element.TextRun.TextStyle,
-				},
-			})
-
-			tokens := transposer.Tokenize(element.TextRun.Content)
-			for _, line := range tokens {
-				for _, token := range line {
-					if token.Chord != nil {
-						style := *element.TextRun.TextStyle
-
-						style.Bold = true
-						style.ForegroundColor = &docs.OptionalColor{
-							Color: &docs.Color{
-								RgbColor: &docs.RgbColor{
-									Blue:            0,
-									Green:           0,
-									Red:             0.8,
-									ForceSendFields: []string{"blue", "green"},
-								},
-							},
-						}
-
-						requests = append(requests, &docs.Request{
-							UpdateTextStyle: &docs.UpdateTextStyleRequest{
-								Fields: "*",
-								Range: &docs.Range{
-									StartIndex:      element.StartIndex + token.Offset,
-									EndIndex:        element.StartIndex + token.Offset + int64(len([]rune(token.Chord.String()))),
-									SegmentId:       segmentID,
-									ForceSendFields: []string{"StartIndex"},
-								},
-								TextStyle: &style,
-							},
-						})
-					}
-				}
-			}
-
-			style := *element.TextRun.TextStyle
-
-			style.Bold = true
-			style.ForegroundColor = &docs.OptionalColor{
-				Color: &docs.Color{
-					RgbColor: &docs.RgbColor{Blue: 0, Green: 0, Red: 0, ForceSendFields: []string{"blue", "green", "red"}},
-				},
-			}
-
-			requests = append(requests, changeStyleByRegex(regexp.MustCompile(`[|]`), *element, style, nil, segmentID)...)
-
-			style = *element.TextRun.TextStyle
-
-			style.Bold = true
-			style.ForegroundColor = &docs.OptionalColor{
-				Color: &docs.Color{
-					RgbColor: &docs.RgbColor{Blue: 0, Green: 0, Red: 0.8, ForceSendFields: []string{"blue", "green"}},
-				},
-			}
-
-			requests = append(requests, changeStyleByRegex(regexp.MustCompile(`(x|х)\d+`), *element, style, nil, segmentID)...)
-
-			style = *element.TextRun.TextStyle
-
-			style.Bold = true
-			style.ForegroundColor = &docs.OptionalColor{
-				Color: &docs.Color{
-					RgbColor: &docs.RgbColor{Blue: 0, Green: 0, Red: 0, ForceSendFields: []string{"blue", "green", "red"}},
-				},
-			}
-			style.Underline = false
-			style.Italic = false
-			style.Strikethrough = false
-
-			requests = append(requests, changeStyleByRegex(regexp.MustCompile(`\p{L}+(\s\d*)?:`), *element, style, strings.ToUpper, segmentID)...)
-		}
 	}
 
-	return requests
+	return sections
 }
 
-func changeStyleByRegex(re *regexp.Regexp, element docs.ParagraphElement, style docs.TextStyle, textFunc func(string) string, segmentID string) []*docs.Request {
-	requests := make([]*docs.Request, 0)
-
-	matches := re.FindAllStringIndex(element.TextRun.Content, -1)
-	if matches == nil {
-		return requests
-	}
-
-	for _, match := range matches {
-		requests = append(requests,
-			&docs.Request{
-				UpdateTextStyle: &docs.UpdateTextStyleRequest{
-					Fields: "*",
-					Range: &docs.Range{
-						StartIndex:      element.StartIndex + int64(len([]rune(element.TextRun.Content[:match[0]]))),
-						EndIndex:        element.StartIndex + int64(len([]rune(element.TextRun.Content[:match[1]]))),
-						SegmentId:       segmentID,
-						ForceSendFields: []string{"StartIndex"},
-					},
-					TextStyle: &style,
-				},
-			},
-		)
-
-		if textFunc != nil {
-			requests = append(requests,
-				&docs.Request{
-					DeleteContentRange: &docs.DeleteContentRangeRequest{
-						Range: &docs.Range{
-							StartIndex:      element.StartIndex + int64(len([]rune(element.TextRun.Content[:match[0]]))),
-							EndIndex:        element.StartIndex + int64(len([]rune(element.TextRun.Content[:match[1]]))),
-							SegmentId:       segmentID,
-							ForceSendFields: []string{"StartIndex"},
-						},
-					},
-				},
-				&docs.Request{
-					InsertText: &docs.InsertTextRequest{
-						Location: &docs.Location{
-							Index:           element.StartIndex + int64(len([]rune(element.TextRun.Content[:match[0]]))),
-							SegmentId:       segmentID,
-							ForceSendFields: []string{"StartIndex"},
-						},
-						Text: textFunc(element.TextRun.Content[match[0]:match[1]]),
-					},
-				})
+// firstSection returns the first section with a header, that is the original of the song.
+func firstSection(text string) SongSection {
+	sections := splitSections(text)
+	for _, section := range sections {
+		if section.Header != "" {
+			return section
 		}
 	}
-
-	return requests
+	return sections[0]
 }
 
-func getDefaultHeaderRequest(headerID string, name string, key string, BPM string, time string) *docs.Request {
-
-	if name == "" {
-		name = "Название - Исполнитель"
-	}
-
-	if key == "" {
-		key = "?"
-	}
-
-	if BPM == "" {
-		BPM = "?"
-	}
-
-	if time == "" {
-		time = "?"
+// transposeSection transposes the section from the key of its header to toKey.
+// Sections without a header have no key, it is guessed from the chords.
+func transposeSection(section SongSection, toKey string) SongSection {
+	key := ""
+	if section.Header != "" {
+		key, _, _ = parseMetadata(section.Header)
+		if key == "?" {
+			key = ""
+		}
+		section.Header = setHeaderMetadata(section.Header, "key", toKey)
 	}
 
-	text := fmt.Sprintf("%s\nKEY: %s; BPM: %s; TIME: %s;\nструктура\n",
-		name, key, BPM, time)
+	section.Body, _ = transposeText(section.Body, key, toKey)
+	return section
+}
 
-	return &docs.Request{
-		InsertText: &docs.InsertTextRequest{
-			EndOfSegmentLocation: &docs.EndOfSegmentLocation{
-				SegmentId: headerID,
-			},
-			Text: text,
-		},
-	}
+// extractLyrics returns the body of the first section of the document text.
+func extractLyrics(text string) string {
+	return firstSection(text).Body
 }
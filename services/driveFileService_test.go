@@ -0,0 +1,44 @@
+package services
+
+import (
+	"strings"
+	"testing"
+
+	"google.golang.org/api/drive/v3"
+)
+
+func TestGetTransposedSections(t *testing.T) {
+	store, err := NewLocalDocumentStore(t.TempDir(), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	service := NewDriveFileService(store, nil)
+
+	file, err := service.CreateOne(&drive.File{Name: "Song"}, "C G Am F\nla la", "C", "70", "4/4")
+	if err != nil {
+		t.Fatal(err)
+	}
+	version := file.Version
+
+	// The doc gets a second section in D.
+	file, err = service.TransposeOne(file.Id, "D", 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if file.Version <= version {
+		t.Errorf("version is %d after the edit, want more than %d", file.Version, version)
+	}
+
+	sections, err := service.GetTransposedSections(file.Id, "E")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(sections) != 2 {
+		t.Fatalf("got %d sections, want 2", len(sections))
+	}
+	for i, section := range sections {
+		if !strings.Contains(section.Header, "KEY: E;") || !strings.Contains(section.Body, "E B C#m A") {
+			t.Errorf("section %d is %+v, want it in E", i, section)
+		}
+	}
+}
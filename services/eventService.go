@@ -1,32 +1,36 @@
 package services
 
 import (
+	"errors"
 	"fmt"
 	"github.com/joeyave/scala-chords-bot/entities"
 	"github.com/joeyave/scala-chords-bot/helpers"
 	"github.com/joeyave/scala-chords-bot/repositories"
 	"go.mongodb.org/mongo-driver/bson/primitive"
-	"google.golang.org/api/drive/v3"
+	"go.mongodb.org/mongo-driver/mongo"
+	"html"
+	"io"
+	"sort"
 	"strings"
 	"sync"
 	"time"
 )
 
 type EventService struct {
-	eventRepository      *repositories.EventRepository
-	userRepository       *repositories.UserRepository
-	membershipRepository *repositories.MembershipRepository
-	driveRepository      *drive.Service
+	eventRepository      repositories.EventRepository
+	userRepository       repositories.UserRepository
+	membershipRepository repositories.MembershipRepository
 	driveFileService     *DriveFileService
+	permissionService    *PermissionService
 }
 
-func NewEventService(eventRepository *repositories.EventRepository, userRepository *repositories.UserRepository, membershipRepository *repositories.MembershipRepository, driveRepository *drive.Service, driveFileService *DriveFileService) *EventService {
+func NewEventService(eventRepository repositories.EventRepository, userRepository repositories.UserRepository, membershipRepository repositories.MembershipRepository, driveFileService *DriveFileService, permissionService *PermissionService) *EventService {
 	return &EventService{
 		eventRepository:      eventRepository,
 		userRepository:       userRepository,
 		membershipRepository: membershipRepository,
-		driveRepository:      driveRepository,
 		driveFileService:     driveFileService,
+		permissionService:    permissionService,
 	}
 }
 
@@ -42,6 +46,11 @@ func (s *EventService) FindManyFromTodayByBandIDAndUserID(bandID primitive.Objec
 	return s.eventRepository.FindManyFromTodayByBandIDAndUserID(bandID, userID)
 }
 
+// FindManyFromTodayByUserID returns upcoming events of the user in all bands.
+func (s *EventService) FindManyFromTodayByUserID(userID int64) ([]*entities.Event, error) {
+	return s.eventRepository.FindManyFromTodayByUserID(userID)
+}
+
 func (s *EventService) FindOneOldestByBandID(bandID primitive.ObjectID) (*entities.Event, error) {
 	return s.eventRepository.FindOneOldestByBandID(bandID)
 }
@@ -54,23 +63,91 @@ func (s *EventService) FindOneByNameAndTime(name string, time time.Time) (*entit
 	return s.eventRepository.FindOneByNameAndTime(name, time)
 }
 
-func (s *EventService) UpdateOne(event entities.Event) (*entities.Event, error) {
+// UpdateOne saves the event. The actor needs the permission to manage events of the band.
+func (s *EventService) UpdateOne(actor *entities.User, event entities.Event) (*entities.Event, error) {
+	if !event.ID.IsZero() {
+		err := s.permissionService.CheckEvent(actor, event.ID, false)
+		if err != nil && !errors.Is(err, mongo.ErrNoDocuments) {
+			return nil, err
+		}
+	}
+
+	err := s.permissionService.Check(actor, event.BandID, entities.ManageEvents)
+	if err != nil {
+		return nil, err
+	}
+
 	return s.eventRepository.UpdateOne(event)
 }
 
-func (s *EventService) PushSongID(eventID primitive.ObjectID, songID primitive.ObjectID) error {
+// PushSongID adds the song to the event. Members of the event may change its setlist.
+func (s *EventService) PushSongID(actor *entities.User, eventID primitive.ObjectID, songID primitive.ObjectID) error {
+	err := s.permissionService.CheckEvent(actor, eventID, true)
+	if err != nil {
+		return err
+	}
+
 	return s.eventRepository.PushSongID(eventID, songID)
 }
 
-func (s *EventService) PullSongID(eventID primitive.ObjectID, songID primitive.ObjectID) error {
+func (s *EventService) PullSongID(actor *entities.User, eventID primitive.ObjectID, songID primitive.ObjectID) error {
+	err := s.permissionService.CheckEvent(actor, eventID, true)
+	if err != nil {
+		return err
+	}
+
 	return s.eventRepository.PullSongID(eventID, songID)
 }
-func (s *EventService) ChangeSongIDPosition(eventID primitive.ObjectID, songID primitive.ObjectID, newPosition int) error {
+
+func (s *EventService) ChangeSongIDPosition(actor *entities.User, eventID primitive.ObjectID, songID primitive.ObjectID, newPosition int) error {
+	err := s.permissionService.CheckEvent(actor, eventID, true)
+	if err != nil {
+		return err
+	}
+
 	return s.eventRepository.ChangeSongIDPosition(eventID, songID, newPosition)
 }
 
-func (s *EventService) DeleteOneByID(ID primitive.ObjectID) error {
-	err := s.eventRepository.DeleteOneByID(ID)
+// ReplaceSongIDs makes songIDs the songs of the event in that order.
+// Songs that stay keep their setlist entries, only the entries of removed songs are deleted.
+func (s *EventService) ReplaceSongIDs(actor *entities.User, eventID primitive.ObjectID, songIDs []primitive.ObjectID) error {
+	err := s.permissionService.CheckEvent(actor, eventID, true)
+	if err != nil {
+		return err
+	}
+
+	event, err := s.eventRepository.FindOneByID(eventID)
+	if err != nil {
+		return err
+	}
+
+	// A song is in the event once, where it comes first.
+	stays := make(map[primitive.ObjectID]bool, len(songIDs))
+	uniqueIDs := make([]primitive.ObjectID, 0, len(songIDs))
+	for _, ID := range songIDs {
+		if !stays[ID] {
+			stays[ID] = true
+			uniqueIDs = append(uniqueIDs, ID)
+		}
+	}
+
+	setlist := make([]*entities.SetlistEntry, 0, len(event.Setlist))
+	for _, entry := range event.Setlist {
+		if stays[entry.SongID] {
+			setlist = append(setlist, entry)
+		}
+	}
+
+	return s.eventRepository.SetSongIDs(eventID, uniqueIDs, setlist)
+}
+
+func (s *EventService) DeleteOneByID(actor *entities.User, ID primitive.ObjectID) error {
+	err := s.permissionService.CheckEvent(actor, ID, false)
+	if err != nil {
+		return err
+	}
+
+	err = s.eventRepository.DeleteOneByID(ID)
 	if err != nil {
 		return err
 	}
@@ -83,20 +160,81 @@ func (s *EventService) DeleteOneByID(ID primitive.ObjectID) error {
 	return nil
 }
 
+// UpdateSetlistEntry replaces the entry of the song with the same ID.
+func (s *EventService) UpdateSetlistEntry(actor *entities.User, eventID primitive.ObjectID, entry entities.SetlistEntry) (*entities.Event, error) {
+	err := s.permissionService.CheckEvent(actor, eventID, true)
+	if err != nil {
+		return nil, err
+	}
+
+	event, err := s.eventRepository.FindOneByID(eventID)
+	if err != nil {
+		return nil, err
+	}
+
+	found := false
+	for i := range event.Setlist {
+		if event.Setlist[i].SongID == entry.SongID {
+			event.Setlist[i] = &entry
+			found = true
+		}
+	}
+	if !found {
+		event.Setlist = append(event.Setlist, &entry)
+	}
+
+	return s.eventRepository.UpdateOne(*event)
+}
+
+// FindReplacements returns band members with the role of the membership who are not at the event and can serve on its day.
+// Those who served less go first.
+func (s *EventService) FindReplacements(event *entities.Event, membership *entities.Membership) ([]*entities.User, error) {
+	usersExtra, err := s.userRepository.FindManyExtraByBandIDAndRoleID(event.BandID, membership.RoleID)
+	if err != nil {
+		return nil, err
+	}
+
+	sort.SliceStable(usersExtra, func(i, j int) bool {
+		return len(usersExtra[i].Events) < len(usersExtra[j].Events)
+	})
+
+	users := make([]*entities.User, 0)
+	for _, userExtra := range usersExtra {
+		if userExtra.User.BlackoutOn(event.Time) != nil {
+			continue
+		}
+
+		atEvent := false
+		for _, m := range event.Memberships {
+			if m.UserID == userExtra.User.ID {
+				atEvent = true
+			}
+		}
+		if !atEvent {
+			users = append(users, userExtra.User)
+		}
+	}
+
+	return users, nil
+}
+
 func (s *EventService) GetSongsAsHTMLStringByID(eventID primitive.ObjectID) (string, []*entities.Song, error) {
 	songs, err := s.eventRepository.GetSongs(eventID)
 	if err != nil {
 		return "", nil, err
 	}
 
+	event, err := s.eventRepository.FindOneByID(eventID)
+	if err != nil {
+		return "", nil, err
+	}
+
 	str := ""
 	if len(songs) > 0 {
 		str = fmt.Sprintf("%s\n\n<b>%s:</b>\n", str, helpers.Setlist)
 
 		for i := range songs {
-			songName := fmt.Sprintf("%d. <a href=\"%s\">%s</a>  (%s)",
-				i+1, songs[i].PDF.WebViewLink, songs[i].PDF.Name, songs[i].Caption())
-			str += songName + "\n"
+			str += setlistEntryHTML(event, i, songs[i], songs[i].PDF.WebViewLink, songs[i].PDF.Name) + "\n"
 		}
 	}
 
@@ -127,7 +265,10 @@ func (s *EventService) ToHtmlStringByEvent(event entities.Event) string {
 			eventString = fmt.Sprintf("%s\n\n<b>%s:</b>", eventString, membership.Role.Name)
 		}
 
-		eventString = fmt.Sprintf("%s\n - <a href=\"tg://user?id=%d\">%s</a>", eventString, membership.User.ID, membership.User.Name)
+		eventString = fmt.Sprintf("%s\n - %s <a href=\"tg://user?id=%d\">%s</a>", eventString, membership.StatusIcon(), membership.User.ID, membership.User.Name)
+		if membership.User.BlackoutOn(event.Time) != nil {
+			eventString = fmt.Sprintf("%s (%s)", eventString, helpers.Unavailable)
+		}
 	}
 
 	if len(event.Songs) > 0 {
@@ -145,9 +286,7 @@ func (s *EventService) ToHtmlStringByEvent(event entities.Event) string {
 					return
 				}
 
-				songName := fmt.Sprintf("%d. <a href=\"%s\">%s</a>  (%s)",
-					i+1, driveFile.WebViewLink, driveFile.Name, event.Songs[i].Caption())
-				songNames[i] = songName
+				songNames[i] = setlistEntryHTML(&event, i, event.Songs[i], driveFile.WebViewLink, driveFile.Name)
 			}(i)
 		}
 		waitGroup.Wait()
@@ -157,3 +296,120 @@ func (s *EventService) ToHtmlStringByEvent(event entities.Event) string {
 
 	return eventString
 }
+
+// bookletWorkers is how many songs of the booklet are fetched at once.
+const bookletWorkers = 4
+
+// RenderBookletByID draws one PDF for the whole event: the cover with the roster, the table of contents
+// and every song of the setlist in the key it is planned to be played in.
+func (s *EventService) RenderBookletByID(ID primitive.ObjectID) (io.Reader, *entities.Event, error) {
+	event, err := s.eventRepository.FindOneByID(ID)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	roster := rosterLines(event)
+
+	var waitGroup sync.WaitGroup
+	waitGroup.Add(len(event.Songs))
+	// Every song is a request to Google Drive, so only a few are made at once.
+	slots := make(chan struct{}, bookletWorkers)
+	songs := make([]BookletSong, len(event.Songs))
+	errs := make([]error, len(event.Songs))
+	for i := range event.Songs {
+		slots <- struct{}{}
+		go func(i int) {
+			defer waitGroup.Done()
+			defer func() { <-slots }()
+
+			song := event.Songs[i]
+			key := event.SongKey(song)
+
+			var sections []SongSection
+			if key == "" || key == "?" {
+				key = ""
+				sections, errs[i] = s.driveFileService.GetSections(song.DriveFileID)
+			} else {
+				sections, errs[i] = s.driveFileService.GetTransposedSections(song.DriveFileID, key)
+			}
+
+			// Every page of the song has the header, so the plan of the song is on each of them.
+			entry := event.SetlistEntry(song.ID)
+			for j := range sections {
+				if entry.BPM != "" {
+					sections[j].Header = setHeaderMetadata(sections[j].Header, "bpm", entry.BPM)
+				}
+				if vocalist := event.Vocalist(entry); vocalist != nil && vocalist.User != nil {
+					sections[j].Header += "\nВокал: " + vocalist.User.Name
+				}
+				if entry.Note != "" {
+					sections[j].Header += "\n" + entry.Note
+				}
+			}
+
+			songs[i] = BookletSong{
+				Name:     song.PDF.Name,
+				Key:      key,
+				Sections: sections,
+			}
+		}(i)
+	}
+	waitGroup.Wait()
+
+	for _, err := range errs {
+		if err != nil {
+			return nil, nil, err
+		}
+	}
+
+	reader, err := s.driveFileService.RenderBooklet(event.Alias(), roster, songs)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	return reader, event, nil
+}
+
+// rosterLines returns every role of the event followed by its members.
+func rosterLines(event *entities.Event) []string {
+	lines := make([]string, 0)
+
+	var currRoleID primitive.ObjectID
+	for _, membership := range event.Memberships {
+		if membership.User == nil {
+			continue
+		}
+
+		if currRoleID != membership.RoleID {
+			currRoleID = membership.RoleID
+			lines = append(lines, "", fmt.Sprintf("%s:", membership.Role.Name))
+		}
+
+		lines = append(lines, fmt.Sprintf(" - %s", membership.User.Name))
+	}
+
+	return lines
+}
+
+// setlistEntryHTML returns the numbered song with the key and BPM planned for the event, the vocalist and the note.
+func setlistEntryHTML(event *entities.Event, i int, song *entities.Song, webViewLink string, name string) string {
+	str := fmt.Sprintf("%d. %s  (%s)", i+1, songLinkHTML(webViewLink, name), event.SongCaption(song))
+
+	entry := event.SetlistEntry(song.ID)
+	if vocalist := event.Vocalist(entry); vocalist != nil && vocalist.User != nil {
+		str += fmt.Sprintf("\n    🎤 %s", html.EscapeString(vocalist.User.Name))
+	}
+	if entry.Note != "" {
+		str += fmt.Sprintf("\n    📝 <i>%s</i>", html.EscapeString(entry.Note))
+	}
+
+	return str
+}
+
+func songLinkHTML(webViewLink string, name string) string {
+	if webViewLink == "" {
+		return name
+	}
+
+	return fmt.Sprintf("<a href=\"%s\">%s</a>", webViewLink, name)
+}
@@ -0,0 +1,124 @@
+package services
+
+import (
+	"bytes"
+	"io/ioutil"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/joeyave/scala-chords-bot/entities"
+	"github.com/joeyave/scala-chords-bot/repositories"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"google.golang.org/api/drive/v3"
+)
+
+func TestReplaceSongIDs(t *testing.T) {
+	store := repositories.NewMemoryStore()
+	eventRepository := repositories.NewEventMemoryRepository(store)
+	service := NewEventService(eventRepository, repositories.NewUserMemoryRepository(store), repositories.NewMembershipMemoryRepository(store), nil, NewPermissionService(repositories.NewPermissionGroupMemoryRepository(store), eventRepository))
+
+	one, two, three, four := primitive.NewObjectID(), primitive.NewObjectID(), primitive.NewObjectID(), primitive.NewObjectID()
+
+	event, err := eventRepository.UpdateOne(entities.Event{
+		Name:    "Sunday",
+		Time:    time.Now().Add(24 * time.Hour),
+		SongIDs: []primitive.ObjectID{one, two, three},
+		Setlist: []*entities.SetlistEntry{
+			{SongID: one, Key: "D"},
+			{SongID: two, Note: "slow"},
+		},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	err = service.ReplaceSongIDs(nil, event.ID, []primitive.ObjectID{four, two, three})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	event, err = service.FindOneByID(event.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if want := []primitive.ObjectID{four, two, three}; !reflect.DeepEqual(event.SongIDs, want) {
+		t.Errorf("songs are %v, want %v", event.SongIDs, want)
+	}
+	if entry := event.SetlistEntry(two); entry.Note != "slow" {
+		t.Errorf("entry of the song that stays is %+v, want the note kept", entry)
+	}
+	if entry := event.SetlistEntry(one); entry.Key != "" {
+		t.Errorf("entry of the removed song is %+v, want it deleted", entry)
+	}
+}
+
+func TestRenderBookletAllSections(t *testing.T) {
+	store := repositories.NewMemoryStore()
+	eventRepository := repositories.NewEventMemoryRepository(store)
+
+	pdfRenderer := NewPDFRenderer("/usr/share/fonts/truetype/dejavu")
+	documentStore, err := NewLocalDocumentStore(t.TempDir(), pdfRenderer)
+	if err != nil {
+		t.Fatal(err)
+	}
+	driveFileService := NewDriveFileService(documentStore, pdfRenderer)
+	service := NewEventService(eventRepository, repositories.NewUserMemoryRepository(store), repositories.NewMembershipMemoryRepository(store), driveFileService, NewPermissionService(repositories.NewPermissionGroupMemoryRepository(store), eventRepository))
+
+	// The chart has two sections: the original and a copy in D.
+	file, err := driveFileService.CreateOne(&drive.File{Name: "Song"}, "C G Am F\nla la", "C", "70", "4/4")
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = driveFileService.TransposeOne(file.Id, "D", 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	song, err := repositories.NewSongMemoryRepository(store).UpdateOne(entities.Song{DriveFileID: file.Id, PDF: entities.PDF{Name: "Song", Key: "C"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, key := range []string{"", "E"} {
+		event, err := eventRepository.UpdateOne(entities.Event{
+			Name:    "Sunday",
+			Time:    time.Now().Add(24 * time.Hour),
+			SongIDs: []primitive.ObjectID{song.ID},
+			Setlist: []*entities.SetlistEntry{{SongID: song.ID, Key: key}},
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		reader, _, err := service.RenderBookletByID(event.ID)
+		if err != nil {
+			t.Fatal(err)
+		}
+		b, err := ioutil.ReadAll(reader)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		// The cover, the contents and both sections of the song.
+		if !bytes.Contains(b, []byte("/Count 4")) {
+			t.Errorf("booklet in %q doesn't have 4 pages", key)
+		}
+	}
+}
+
+func TestSetlistEntryHTML(t *testing.T) {
+	song := &entities.Song{ID: primitive.NewObjectID()}
+	membership := &entities.Membership{ID: primitive.NewObjectID(), User: &entities.User{Name: "<b>Sam</b> & Pat"}}
+	event := &entities.Event{
+		Memberships: []*entities.Membership{membership},
+		Setlist:     []*entities.SetlistEntry{{SongID: song.ID, MembershipID: membership.ID, Note: "<тише>"}},
+	}
+
+	got := setlistEntryHTML(event, 0, song, "", "Song")
+	want := "1. Song  (, , )\n    🎤 &lt;b&gt;Sam&lt;/b&gt; &amp; Pat\n    📝 <i>&lt;тише&gt;</i>"
+	if got != want {
+		t.Errorf("setlistEntryHTML() = %q, want %q", got, want)
+	}
+}
@@ -0,0 +1,278 @@
+package services
+
+import (
+	"errors"
+	"github.com/joeyave/scala-chords-bot/entities"
+	"github.com/joeyave/scala-chords-bot/repositories"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"log"
+	"time"
+)
+
+// How far ahead events of a series are created.
+const seriesHorizon = 8 * 7 * 24 * time.Hour
+
+type EventTemplateService struct {
+	eventTemplateRepository repositories.EventTemplateRepository
+	eventRepository         repositories.EventRepository
+	membershipRepository    repositories.MembershipRepository
+	permissionService       *PermissionService
+}
+
+func NewEventTemplateService(eventTemplateRepository repositories.EventTemplateRepository, eventRepository repositories.EventRepository, membershipRepository repositories.MembershipRepository, permissionService *PermissionService) *EventTemplateService {
+	return &EventTemplateService{
+		eventTemplateRepository: eventTemplateRepository,
+		eventRepository:         eventRepository,
+		membershipRepository:    membershipRepository,
+		permissionService:       permissionService,
+	}
+}
+
+func (s *EventTemplateService) FindManyByBandID(bandID primitive.ObjectID) ([]*entities.EventTemplate, error) {
+	return s.eventTemplateRepository.FindManyByBandID(bandID)
+}
+
+func (s *EventTemplateService) FindOneByID(ID primitive.ObjectID) (*entities.EventTemplate, error) {
+	return s.eventTemplateRepository.FindOneByID(ID)
+}
+
+func (s *EventTemplateService) UpdateOne(actor *entities.User, template entities.EventTemplate) (*entities.EventTemplate, error) {
+	err := s.check(actor, template.ID, template.BandID)
+	if err != nil {
+		return nil, err
+	}
+
+	return s.eventTemplateRepository.UpdateOne(template)
+}
+
+// check returns ErrForbidden if the actor can't manage events of the band or of the band of the saved template.
+func (s *EventTemplateService) check(actor *entities.User, templateID primitive.ObjectID, bandID primitive.ObjectID) error {
+	if actor == nil {
+		return nil
+	}
+
+	if !templateID.IsZero() {
+		oldTemplate, err := s.eventTemplateRepository.FindOneByID(templateID)
+		if err != nil && !errors.Is(err, mongo.ErrNoDocuments) {
+			return err
+		}
+		if err == nil && oldTemplate.BandID != bandID {
+			err = s.permissionService.Check(actor, oldTemplate.BandID, entities.ManageEvents)
+			if err != nil {
+				return err
+			}
+		}
+	}
+
+	return s.permissionService.Check(actor, bandID, entities.ManageEvents)
+}
+
+// CreateEvent creates the event from the template with the default members.
+func (s *EventTemplateService) CreateEvent(actor *entities.User, template *entities.EventTemplate, eventTime time.Time) (*entities.Event, error) {
+	err := s.permissionService.Check(actor, template.BandID, entities.ManageEvents)
+	if err != nil {
+		return nil, err
+	}
+
+	return s.createEvent(template, eventTime)
+}
+
+func (s *EventTemplateService) createEvent(template *entities.EventTemplate, eventTime time.Time) (*entities.Event, error) {
+	event, err := s.eventRepository.UpdateOne(entities.Event{
+		Name:       template.Name,
+		Time:       eventTime,
+		BandID:     template.BandID,
+		TemplateID: template.ID,
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	for _, slot := range template.Slots {
+		for _, userID := range slot.UserIDs {
+			_, err := s.membershipRepository.UpdateOne(entities.Membership{
+				EventID: event.ID,
+				UserID:  userID,
+				RoleID:  slot.RoleID,
+			})
+			if err != nil {
+				return nil, err
+			}
+		}
+	}
+
+	return s.eventRepository.FindOneByID(event.ID)
+}
+
+// GenerateEvents creates events of every series up to the horizon. It is called periodically.
+func (s *EventTemplateService) GenerateEvents(now time.Time) error {
+	templates, err := s.eventTemplateRepository.FindAll()
+	if errors.Is(err, mongo.ErrNoDocuments) {
+		// No templates.
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+
+	// One broken series must not stop the others.
+	for _, template := range templates {
+		err := s.generateEvents(template, now)
+		if err != nil {
+			log.Printf("generating events of template %s: %v", template.ID.Hex(), err)
+		}
+	}
+
+	return nil
+}
+
+func (s *EventTemplateService) generateEvents(template *entities.EventTemplate, now time.Time) error {
+	if template.Recurrence == nil {
+		return nil
+	}
+
+	// Times come from the database in UTC, but the recurrence is in local time.
+	from := template.GeneratedUntil.In(now.Location())
+	if from.Before(now) {
+		from = now
+	}
+	until := now.Add(seriesHorizon)
+
+	events, err := s.findSeriesEvents(template.ID)
+	if err != nil {
+		return err
+	}
+
+	for _, eventTime := range template.Recurrence.Occurrences(from, until) {
+		exists := false
+		for _, event := range events {
+			if event.Time.Equal(eventTime) {
+				exists = true
+				break
+			}
+		}
+		if exists {
+			continue
+		}
+
+		_, err := s.createEvent(template, eventTime)
+		if err != nil {
+			return err
+		}
+	}
+
+	template.GeneratedUntil = until
+	_, err = s.eventTemplateRepository.UpdateOne(*template)
+	return err
+}
+
+// UpdateSeries saves the template and applies the new name and the new recurrence to the future events of the series.
+// If the recurrence is changed, future events that don't match it are deleted and the missing ones are created.
+func (s *EventTemplateService) UpdateSeries(actor *entities.User, template entities.EventTemplate, now time.Time) (*entities.EventTemplate, error) {
+	oldTemplate, err := s.eventTemplateRepository.FindOneByID(template.ID)
+	if err != nil {
+		return nil, err
+	}
+
+	err = s.check(actor, template.ID, template.BandID)
+	if err != nil {
+		return nil, err
+	}
+
+	rescheduled := template.Recurrence != nil &&
+		(oldTemplate.Recurrence == nil || *oldTemplate.Recurrence != *template.Recurrence)
+
+	events, err := s.findSeriesEvents(template.ID)
+	if err != nil {
+		return nil, err
+	}
+
+	for _, event := range events {
+		if event.Time.Before(now) {
+			continue
+		}
+
+		if rescheduled && !template.Recurrence.Matches(event.Time.In(now.Location())) {
+			err := s.deleteEvent(event.ID)
+			if err != nil {
+				return nil, err
+			}
+			continue
+		}
+
+		if event.Name != template.Name {
+			event.Name = template.Name
+			_, err := s.eventRepository.UpdateOne(*event)
+			if err != nil {
+				return nil, err
+			}
+		}
+	}
+
+	if !rescheduled {
+		return s.eventTemplateRepository.UpdateOne(template)
+	}
+
+	template.GeneratedUntil = now
+	newTemplate, err := s.eventTemplateRepository.UpdateOne(template)
+	if err != nil {
+		return nil, err
+	}
+
+	err = s.generateEvents(newTemplate, now)
+	if err != nil {
+		return nil, err
+	}
+
+	return s.eventTemplateRepository.FindOneByID(newTemplate.ID)
+}
+
+// DeleteSeries deletes the template with all future events of the series. Past events are kept.
+func (s *EventTemplateService) DeleteSeries(actor *entities.User, ID primitive.ObjectID, now time.Time) error {
+	template, err := s.eventTemplateRepository.FindOneByID(ID)
+	if err != nil {
+		return err
+	}
+
+	err = s.permissionService.Check(actor, template.BandID, entities.ManageEvents)
+	if err != nil {
+		return err
+	}
+
+	events, err := s.findSeriesEvents(ID)
+	if err != nil {
+		return err
+	}
+
+	for _, event := range events {
+		if event.Time.Before(now) {
+			continue
+		}
+
+		err := s.deleteEvent(event.ID)
+		if err != nil {
+			return err
+		}
+	}
+
+	return s.eventTemplateRepository.DeleteOneByID(ID)
+}
+
+// findSeriesEvents returns events of the series from today. No events is not an error.
+func (s *EventTemplateService) findSeriesEvents(templateID primitive.ObjectID) ([]*entities.Event, error) {
+	events, err := s.eventRepository.FindManyFromTodayByTemplateID(templateID)
+	if errors.Is(err, mongo.ErrNoDocuments) {
+		return nil, nil
+	}
+	return events, err
+}
+
+func (s *EventTemplateService) deleteEvent(ID primitive.ObjectID) error {
+	err := s.eventRepository.DeleteOneByID(ID)
+	if err != nil {
+		return err
+	}
+
+	return s.membershipRepository.DeleteManyByEventID(ID)
+}
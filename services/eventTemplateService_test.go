@@ -0,0 +1,156 @@
+package services
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/joeyave/scala-chords-bot/entities"
+	"github.com/joeyave/scala-chords-bot/repositories"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// failingMembershipRepository can't save the memberships of one user.
+type failingMembershipRepository struct {
+	*repositories.MembershipMemoryRepository
+	userID int64
+}
+
+func (r *failingMembershipRepository) UpdateOne(membership entities.Membership) (*entities.Membership, error) {
+	if membership.UserID == r.userID {
+		return nil, errors.New("can't save membership")
+	}
+	return r.MembershipMemoryRepository.UpdateOne(membership)
+}
+
+func TestGenerateEventsSkipsFailingSeries(t *testing.T) {
+	store := repositories.NewMemoryStore()
+	templateRepository := repositories.NewEventTemplateMemoryRepository(store)
+	eventRepository := repositories.NewEventMemoryRepository(store)
+	membershipRepository := &failingMembershipRepository{repositories.NewMembershipMemoryRepository(store), 13}
+
+	service := NewEventTemplateService(templateRepository, eventRepository, membershipRepository, NewPermissionService(repositories.NewPermissionGroupMemoryRepository(store), eventRepository))
+
+	broken, err := templateRepository.UpdateOne(entities.EventTemplate{
+		Name:       "Broken",
+		Slots:      []*entities.TemplateSlot{{UserIDs: []int64{13}}},
+		Recurrence: &entities.Recurrence{Weekday: time.Sunday, Hour: 10},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	working, err := templateRepository.UpdateOne(entities.EventTemplate{
+		Name:       "Working",
+		Recurrence: &entities.Recurrence{Weekday: time.Friday, Hour: 19},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	now := time.Now()
+	if err := service.GenerateEvents(now); err != nil {
+		t.Fatalf("GenerateEvents() = %v", err)
+	}
+
+	events, err := eventRepository.FindManyFromTodayByTemplateID(working.ID)
+	if err != nil || len(events) == 0 {
+		t.Errorf("working series has no events: %v", err)
+	}
+
+	template, err := templateRepository.FindOneByID(broken.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !template.GeneratedUntil.IsZero() {
+		t.Errorf("broken series is generated until %v, want it to be retried", template.GeneratedUntil)
+	}
+}
+
+// failingTemplateRepository can't read the templates.
+type failingTemplateRepository struct {
+	*repositories.EventTemplateMemoryRepository
+}
+
+func (r *failingTemplateRepository) FindAll() ([]*entities.EventTemplate, error) {
+	return nil, errors.New("connection refused")
+}
+
+func TestGenerateEventsReturnsStorageErrors(t *testing.T) {
+	store := repositories.NewMemoryStore()
+	templateRepository := repositories.NewEventTemplateMemoryRepository(store)
+	eventRepository := repositories.NewEventMemoryRepository(store)
+	membershipRepository := repositories.NewMembershipMemoryRepository(store)
+
+	service := NewEventTemplateService(templateRepository, eventRepository, membershipRepository, NewPermissionService(repositories.NewPermissionGroupMemoryRepository(store), eventRepository))
+	if err := service.GenerateEvents(time.Now()); err != nil {
+		t.Errorf("no templates: GenerateEvents = %v, want nil", err)
+	}
+
+	service = NewEventTemplateService(&failingTemplateRepository{templateRepository}, eventRepository, membershipRepository, NewPermissionService(repositories.NewPermissionGroupMemoryRepository(store), eventRepository))
+	if err := service.GenerateEvents(time.Now()); err == nil {
+		t.Error("failing storage: GenerateEvents = nil, want the error")
+	}
+}
+
+// failingEventRepository can't read events of series.
+type failingEventRepository struct {
+	*repositories.EventMemoryRepository
+}
+
+func (r *failingEventRepository) FindManyFromTodayByTemplateID(templateID primitive.ObjectID) ([]*entities.Event, error) {
+	return nil, errors.New("connection refused")
+}
+
+func TestSeriesKeepEventsOnStorageErrors(t *testing.T) {
+	store := repositories.NewMemoryStore()
+	templateRepository := repositories.NewEventTemplateMemoryRepository(store)
+	eventRepository := repositories.NewEventMemoryRepository(store)
+	membershipRepository := repositories.NewMembershipMemoryRepository(store)
+
+	template, err := templateRepository.UpdateOne(entities.EventTemplate{
+		Name:       "Sunday",
+		Recurrence: &entities.Recurrence{Weekday: time.Sunday, Hour: 10},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	now := time.Now()
+	err = NewEventTemplateService(templateRepository, eventRepository, membershipRepository, NewPermissionService(repositories.NewPermissionGroupMemoryRepository(store), eventRepository)).GenerateEvents(now)
+	if err != nil {
+		t.Fatal(err)
+	}
+	events, err := eventRepository.FindManyFromTodayByTemplateID(template.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	service := NewEventTemplateService(templateRepository, &failingEventRepository{eventRepository}, membershipRepository, NewPermissionService(repositories.NewPermissionGroupMemoryRepository(store), eventRepository))
+
+	// Without events of the series, every occurrence would be created again.
+	template.GeneratedUntil = time.Time{}
+	_, err = templateRepository.UpdateOne(*template)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = service.GenerateEvents(now)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// The template is kept, so its events don't point to a deleted one.
+	if err := service.DeleteSeries(nil, template.ID, now); err == nil {
+		t.Error("DeleteSeries = nil, want the error")
+	}
+	if _, err := templateRepository.FindOneByID(template.ID); err != nil {
+		t.Errorf("template is deleted: %v", err)
+	}
+
+	got, err := eventRepository.FindManyFromTodayByTemplateID(template.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(got) != len(events) {
+		t.Errorf("series has %d events, want %d", len(got), len(events))
+	}
+}
@@ -0,0 +1,175 @@
+package services
+
+import (
+	"context"
+	"flag"
+	"github.com/joeyave/scala-chords-bot/services/googletest"
+	"google.golang.org/api/drive/v3"
+	"io/ioutil"
+	"path/filepath"
+	"testing"
+)
+
+var update = flag.Bool("update", false, "update golden files")
+
+const (
+	testHeader = "Song - Artist\nKEY: C; BPM: 120; TIME: 4/4;\nverse chorus\n"
+	testBody   = "Verse 1\nC        G\nAmazing grace\nAm   F\nHow sweet\n\nChorus\nF  C/E  Dm7  G\nWas blind\n"
+)
+
+func newTestGoogleDocumentStore(t *testing.T) (*GoogleDocumentStore, *googletest.Server) {
+	server := googletest.NewServer()
+	t.Cleanup(server.Close)
+
+	driveService, err := server.DriveService(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	docsService, err := server.DocsService(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return NewGoogleDocumentStore(driveService, docsService), server
+}
+
+// checkGolden compares the dump of the doc with testdata/name.golden, go test -update rewrites it.
+func checkGolden(t *testing.T, server *googletest.Server, ID string, name string) {
+	t.Helper()
+
+	dump, err := server.Dump(ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	path := filepath.Join("testdata", name+".golden")
+	if *update {
+		err = ioutil.WriteFile(path, []byte(dump), 0644)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return
+	}
+
+	want, err := ioutil.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if dump != string(want) {
+		t.Errorf("%s doesn't match the golden file:\n%s\nwant:\n%s", name, dump, want)
+	}
+}
+
+func TestGoogleDocumentStoreCreateOne(t *testing.T) {
+	store, server := newTestGoogleDocumentStore(t)
+
+	folderID := server.AddFolder("Songs")
+
+	file, err := store.CreateOne(&drive.File{Name: "Song - Artist", Parents: []string{folderID}},
+		"C  G\nAmazing grace\n", "C", "120", "4/4")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if file.WebViewLink == "" {
+		t.Error("created file has no web view link")
+	}
+
+	checkGolden(t, server, file.Id, "create")
+}
+
+func TestGoogleDocumentStoreStyleOne(t *testing.T) {
+	store, server := newTestGoogleDocumentStore(t)
+
+	ID, err := server.AddDocument("Song - Artist", nil, testHeader, testBody)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	_, err = store.StyleOne(ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	checkGolden(t, server, ID, "style")
+}
+
+func TestGoogleDocumentStoreStyleOneWithoutHeader(t *testing.T) {
+	store, server := newTestGoogleDocumentStore(t)
+
+	ID, err := server.AddDocument("Song - Artist", nil, "", testBody)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	_, err = store.StyleOne(ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	checkGolden(t, server, ID, "style_without_header")
+}
+
+func TestGoogleDocumentStoreTransposeOne(t *testing.T) {
+	store, server := newTestGoogleDocumentStore(t)
+
+	ID, err := server.AddDocument("Song - Artist", nil, testHeader, testBody)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	_, err = store.TransposeOne(ID, "D", 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	checkGolden(t, server, ID, "transpose")
+}
+
+func TestGoogleDocumentStoreTransposeOneToNewSection(t *testing.T) {
+	store, server := newTestGoogleDocumentStore(t)
+
+	ID, err := server.AddDocument("Song - Artist", nil, testHeader, testBody)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	_, err = store.TransposeOne(ID, "E", -1)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	sectionsNumber, err := store.GetSectionsNumber(ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if sectionsNumber != 2 {
+		t.Errorf("sections number = %d, want 2", sectionsNumber)
+	}
+
+	checkGolden(t, server, ID, "transpose_new_section")
+}
+
+func TestGoogleDocumentStoreAppendSection(t *testing.T) {
+	store, server := newTestGoogleDocumentStore(t)
+
+	ID, err := server.AddDocument("Song - Artist", nil, testHeader, testBody)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	sections, err := store.appendSectionByID(ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(sections) != 2 {
+		t.Fatalf("sections = %d, want 2", len(sections))
+	}
+	if sections[1].SectionBreak.SectionStyle.DefaultHeaderId == "" {
+		t.Error("appended section has no header")
+	}
+
+	checkGolden(t, server, ID, "append_section")
+}
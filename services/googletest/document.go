@@ -0,0 +1,573 @@
+package googletest
+
+import (
+	"encoding/json"
+	"fmt"
+	"google.golang.org/api/docs/v1"
+	"reflect"
+	"strings"
+	"unicode/utf16"
+)
+
+// document is a flat model of a Google Doc: every segment (the body and each header) is a sequence of characters.
+// Indexes are counted in UTF-16 code units, the same way the Docs API does.
+type document struct {
+	body         *segment
+	headers      map[string]*segment
+	style        docs.DocumentStyle
+	nextHeaderID int
+}
+
+type segment struct {
+	chars []char
+}
+
+type char struct {
+	r         rune
+	textStyle docs.TextStyle
+	// paragraphStyle is set on the newline that ends a paragraph.
+	paragraphStyle *docs.ParagraphStyle
+	// sectionStyle is set on section breaks, they take one index and have no rune.
+	sectionStyle *docs.SectionStyle
+}
+
+func newDocument() *document {
+	return &document{
+		body: &segment{
+			chars: []char{
+				{sectionStyle: &docs.SectionStyle{SectionType: "CONTINUOUS"}},
+				newlineChar(docs.TextStyle{}, defaultParagraphStyle()),
+			},
+		},
+		headers: make(map[string]*segment),
+	}
+}
+
+func newHeader() *segment {
+	return &segment{
+		chars: []char{newlineChar(docs.TextStyle{}, defaultParagraphStyle())},
+	}
+}
+
+func defaultParagraphStyle() *docs.ParagraphStyle {
+	return &docs.ParagraphStyle{
+		NamedStyleType: "NORMAL_TEXT",
+		Direction:      "LEFT_TO_RIGHT",
+	}
+}
+
+func newlineChar(textStyle docs.TextStyle, paragraphStyle *docs.ParagraphStyle) char {
+	style := *paragraphStyle
+	return char{r: '\n', textStyle: textStyle, paragraphStyle: &style}
+}
+
+func (c char) isSectionBreak() bool {
+	return c.sectionStyle != nil
+}
+
+func (c char) length() int64 {
+	if c.isSectionBreak() {
+		return 1
+	}
+	return int64(len(utf16.Encode([]rune{c.r})))
+}
+
+func (d *document) clone() *document {
+	clone := &document{
+		body:         d.body.clone(),
+		headers:      make(map[string]*segment),
+		style:        d.style,
+		nextHeaderID: d.nextHeaderID,
+	}
+	for ID, header := range d.headers {
+		clone.headers[ID] = header.clone()
+	}
+	return clone
+}
+
+func (s *segment) clone() *segment {
+	chars := make([]char, len(s.chars))
+	for i, c := range s.chars {
+		chars[i] = c
+		if c.paragraphStyle != nil {
+			style := *c.paragraphStyle
+			chars[i].paragraphStyle = &style
+		}
+		if c.sectionStyle != nil {
+			style := *c.sectionStyle
+			chars[i].sectionStyle = &style
+		}
+	}
+	return &segment{chars: chars}
+}
+
+func (s *segment) length() int64 {
+	var length int64
+	for _, c := range s.chars {
+		length += c.length()
+	}
+	return length
+}
+
+// position converts an index into a position in chars.
+func (s *segment) position(index int64) (int, error) {
+	var current int64
+	for i, c := range s.chars {
+		if current == index {
+			return i, nil
+		}
+		if current > index {
+			break
+		}
+		current += c.length()
+	}
+	if current == index {
+		return len(s.chars), nil
+	}
+	return 0, fmt.Errorf("index %d is out of bounds or splits a surrogate pair", index)
+}
+
+// paragraphEnd returns the position of the newline that ends the paragraph containing pos.
+func (s *segment) paragraphEnd(pos int) int {
+	for i := pos; i < len(s.chars); i++ {
+		if s.chars[i].r == '\n' && !s.chars[i].isSectionBreak() {
+			return i
+		}
+	}
+	return len(s.chars) - 1
+}
+
+func (d *document) segment(segmentID string) (*segment, error) {
+	if segmentID == "" {
+		return d.body, nil
+	}
+
+	header, ok := d.headers[segmentID]
+	if !ok {
+		return nil, fmt.Errorf("segment %q not found", segmentID)
+	}
+	return header, nil
+}
+
+func (d *document) location(location *docs.Location, endOfSegmentLocation *docs.EndOfSegmentLocation) (*segment, int64, error) {
+	if location != nil {
+		segment, err := d.segment(location.SegmentId)
+		return segment, location.Index, err
+	}
+
+	if endOfSegmentLocation != nil {
+		segment, err := d.segment(endOfSegmentLocation.SegmentId)
+		if err != nil {
+			return nil, 0, err
+		}
+		return segment, segment.length() - 1, nil
+	}
+
+	return nil, 0, fmt.Errorf("location is required")
+}
+
+// insertPosition checks that text can be inserted at index: it must be inside an existing paragraph.
+func (d *document) insertPosition(segment *segment, index int64) (int, error) {
+	if index < 0 || index >= segment.length() {
+		return 0, fmt.Errorf("index %d must be less than the end index of the referenced segment, %d", index, segment.length())
+	}
+
+	pos, err := segment.position(index)
+	if err != nil {
+		return 0, err
+	}
+
+	if segment.chars[pos].isSectionBreak() {
+		return 0, fmt.Errorf("index %d must be inside the bounds of an existing paragraph", index)
+	}
+
+	return pos, nil
+}
+
+func (d *document) apply(request *docs.Request) (*docs.Response, error) {
+	switch {
+	case request.InsertText != nil:
+		return &docs.Response{}, d.insertText(request.InsertText)
+	case request.DeleteContentRange != nil:
+		return &docs.Response{}, d.deleteContentRange(request.DeleteContentRange)
+	case request.UpdateTextStyle != nil:
+		return &docs.Response{}, d.updateTextStyle(request.UpdateTextStyle)
+	case request.UpdateParagraphStyle != nil:
+		return &docs.Response{}, d.updateParagraphStyle(request.UpdateParagraphStyle)
+	case request.InsertSectionBreak != nil:
+		return &docs.Response{}, d.insertSectionBreak(request.InsertSectionBreak)
+	case request.CreateHeader != nil:
+		return d.createHeader(request.CreateHeader)
+	case request.UpdateDocumentStyle != nil:
+		return &docs.Response{}, applyFields(&d.style, request.UpdateDocumentStyle.DocumentStyle, request.UpdateDocumentStyle.Fields)
+	default:
+		return nil, fmt.Errorf("request is not supported")
+	}
+}
+
+func (d *document) insertText(request *docs.InsertTextRequest) error {
+	segment, index, err := d.location(request.Location, request.EndOfSegmentLocation)
+	if err != nil {
+		return err
+	}
+
+	pos, err := d.insertPosition(segment, index)
+	if err != nil {
+		return err
+	}
+
+	// Inserted text takes the style of the text before it, or of the text after it at the start of a paragraph.
+	textStyle := segment.chars[pos].textStyle
+	if pos > 0 && !segment.chars[pos-1].isSectionBreak() && segment.chars[pos-1].r != '\n' {
+		textStyle = segment.chars[pos-1].textStyle
+	}
+	paragraphStyle := segment.chars[segment.paragraphEnd(pos)].paragraphStyle
+
+	chars := make([]char, 0)
+	for _, r := range request.Text {
+		if r == '\r' {
+			continue
+		}
+		if r == '\n' {
+			chars = append(chars, newlineChar(textStyle, paragraphStyle))
+		} else {
+			chars = append(chars, char{r: r, textStyle: textStyle})
+		}
+	}
+
+	segment.chars = append(segment.chars[:pos], append(chars, segment.chars[pos:]...)...)
+	return nil
+}
+
+func (d *document) deleteContentRange(request *docs.DeleteContentRangeRequest) error {
+	if request.Range == nil {
+		return fmt.Errorf("range is required")
+	}
+
+	segment, err := d.segment(request.Range.SegmentId)
+	if err != nil {
+		return err
+	}
+
+	start, end := request.Range.StartIndex, request.Range.EndIndex
+	if start >= end {
+		return fmt.Errorf("the range [%d, %d) must not be empty", start, end)
+	}
+	if end > segment.length()-1 {
+		return fmt.Errorf("the range [%d, %d) cannot include the last newline of the segment, %d", start, end, segment.length()-1)
+	}
+
+	startPos, err := segment.position(start)
+	if err != nil {
+		return err
+	}
+	endPos, err := segment.position(end)
+	if err != nil {
+		return err
+	}
+
+	for i := startPos; i < endPos; i++ {
+		if segment.chars[i].isSectionBreak() && (i == 0 || i == startPos) {
+			return fmt.Errorf("the range [%d, %d) cannot start with a section break", start, end)
+		}
+	}
+	if endPos < len(segment.chars) && segment.chars[endPos].isSectionBreak() {
+		return fmt.Errorf("the range [%d, %d) cannot delete the newline before a section break", start, end)
+	}
+
+	segment.chars = append(segment.chars[:startPos], segment.chars[endPos:]...)
+	return nil
+}
+
+func (d *document) updateTextStyle(request *docs.UpdateTextStyleRequest) error {
+	segment, startPos, endPos, err := d.rangePositions(request.Range)
+	if err != nil {
+		return err
+	}
+
+	for i := startPos; i < endPos; i++ {
+		if segment.chars[i].isSectionBreak() {
+			continue
+		}
+
+		err := applyFields(&segment.chars[i].textStyle, request.TextStyle, request.Fields)
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func (d *document) updateParagraphStyle(request *docs.UpdateParagraphStyleRequest) error {
+	segment, startPos, endPos, err := d.rangePositions(request.Range)
+	if err != nil {
+		return err
+	}
+
+	for i := startPos; i < len(segment.chars); i++ {
+		c := segment.chars[i]
+		if c.isSectionBreak() || c.r != '\n' {
+			continue
+		}
+
+		err := applyFields(c.paragraphStyle, request.ParagraphStyle, request.Fields)
+		if err != nil {
+			return err
+		}
+
+		if i+1 >= endPos {
+			break
+		}
+	}
+
+	return nil
+}
+
+func (d *document) rangePositions(r *docs.Range) (*segment, int, int, error) {
+	if r == nil {
+		return nil, 0, 0, fmt.Errorf("range is required")
+	}
+
+	segment, err := d.segment(r.SegmentId)
+	if err != nil {
+		return nil, 0, 0, err
+	}
+
+	if r.StartIndex >= r.EndIndex {
+		return nil, 0, 0, fmt.Errorf("the range [%d, %d) must not be empty", r.StartIndex, r.EndIndex)
+	}
+	if r.StartIndex < 0 || r.EndIndex > segment.length() {
+		return nil, 0, 0, fmt.Errorf("the range [%d, %d) is out of the segment bounds [0, %d)", r.StartIndex, r.EndIndex, segment.length())
+	}
+
+	startPos, err := segment.position(r.StartIndex)
+	if err != nil {
+		return nil, 0, 0, err
+	}
+	endPos, err := segment.position(r.EndIndex)
+	if err != nil {
+		return nil, 0, 0, err
+	}
+
+	return segment, startPos, endPos, nil
+}
+
+func (d *document) insertSectionBreak(request *docs.InsertSectionBreakRequest) error {
+	segment, index, err := d.location(request.Location, request.EndOfSegmentLocation)
+	if err != nil {
+		return err
+	}
+	if segment != d.body {
+		return fmt.Errorf("section breaks can only be inserted into the body")
+	}
+
+	pos, err := d.insertPosition(segment, index)
+	if err != nil {
+		return err
+	}
+
+	newline := newlineChar(segment.chars[pos].textStyle, segment.chars[segment.paragraphEnd(pos)].paragraphStyle)
+	sectionBreak := char{sectionStyle: &docs.SectionStyle{SectionType: request.SectionType}}
+
+	segment.chars = append(segment.chars[:pos], append([]char{newline, sectionBreak}, segment.chars[pos:]...)...)
+	return nil
+}
+
+func (d *document) createHeader(request *docs.CreateHeaderRequest) (*docs.Response, error) {
+	if request.Type != "DEFAULT" {
+		return nil, fmt.Errorf("header type %q is not supported", request.Type)
+	}
+
+	sectionStyle := (*docs.SectionStyle)(nil)
+	if request.SectionBreakLocation != nil && request.SectionBreakLocation.Index > 0 {
+		pos, err := d.body.position(request.SectionBreakLocation.Index)
+		if err != nil {
+			return nil, err
+		}
+		if pos >= len(d.body.chars) || !d.body.chars[pos].isSectionBreak() {
+			return nil, fmt.Errorf("index %d is not a section break", request.SectionBreakLocation.Index)
+		}
+		sectionStyle = d.body.chars[pos].sectionStyle
+	}
+
+	if sectionStyle == nil && d.style.DefaultHeaderId != "" || sectionStyle != nil && sectionStyle.DefaultHeaderId != "" {
+		return nil, fmt.Errorf("a default header already exists")
+	}
+
+	d.nextHeaderID++
+	ID := fmt.Sprintf("kix.header%d", d.nextHeaderID)
+	d.headers[ID] = newHeader()
+
+	if sectionStyle == nil {
+		d.style.DefaultHeaderId = ID
+	} else {
+		sectionStyle.DefaultHeaderId = ID
+	}
+
+	return &docs.Response{CreateHeader: &docs.CreateHeaderResponse{HeaderId: ID}}, nil
+}
+
+// applyFields copies fields of src into dst. Fields are comma separated JSON names, "*" replaces everything.
+func applyFields(dst interface{}, src interface{}, fields string) error {
+	b, err := json.Marshal(src)
+	if err != nil {
+		return err
+	}
+
+	srcMap := make(map[string]interface{})
+	err = json.Unmarshal(b, &srcMap)
+	if err != nil {
+		return err
+	}
+
+	dstMap := make(map[string]interface{})
+	if strings.TrimSpace(fields) == "*" {
+		dstMap = srcMap
+	} else {
+		b, err := json.Marshal(dst)
+		if err != nil {
+			return err
+		}
+		err = json.Unmarshal(b, &dstMap)
+		if err != nil {
+			return err
+		}
+
+		for _, field := range strings.Split(fields, ",") {
+			field = strings.TrimSpace(field)
+			if field == "" {
+				continue
+			}
+
+			if value, ok := srcMap[field]; ok {
+				dstMap[field] = value
+			} else {
+				delete(dstMap, field)
+			}
+		}
+	}
+
+	b, err = json.Marshal(dstMap)
+	if err != nil {
+		return err
+	}
+
+	value := reflect.ValueOf(dst).Elem()
+	value.Set(reflect.Zero(value.Type()))
+	return json.Unmarshal(b, dst)
+}
+
+// toDocs builds the representation returned by documents.get.
+func (d *document) toDocs(ID string, title string) *docs.Document {
+	document := &docs.Document{
+		DocumentId: ID,
+		Title:      title,
+		Body:       &docs.Body{Content: d.body.toDocs()},
+		Headers:    make(map[string]docs.Header),
+	}
+
+	style := d.style
+	document.DocumentStyle = &style
+
+	for headerID, header := range d.headers {
+		document.Headers[headerID] = docs.Header{
+			HeaderId: headerID,
+			Content:  header.toDocs(),
+		}
+	}
+
+	return document
+}
+
+func (s *segment) toDocs() []*docs.StructuralElement {
+	content := make([]*docs.StructuralElement, 0)
+
+	var index int64
+	var paragraph *docs.StructuralElement
+	var run *docs.ParagraphElement
+	for _, c := range s.chars {
+		if c.isSectionBreak() {
+			style := *c.sectionStyle
+			content = append(content, &docs.StructuralElement{
+				StartIndex:   index,
+				EndIndex:     index + 1,
+				SectionBreak: &docs.SectionBreak{SectionStyle: &style},
+			})
+			index++
+			continue
+		}
+
+		if paragraph == nil {
+			paragraph = &docs.StructuralElement{
+				StartIndex: index,
+				Paragraph:  &docs.Paragraph{},
+			}
+			run = nil
+		}
+
+		if run == nil || !reflect.DeepEqual(run.TextRun.TextStyle, &c.textStyle) {
+			style := c.textStyle
+			run = &docs.ParagraphElement{
+				StartIndex: index,
+				EndIndex:   index,
+				TextRun:    &docs.TextRun{TextStyle: &style},
+			}
+			paragraph.Paragraph.Elements = append(paragraph.Paragraph.Elements, run)
+		}
+
+		run.TextRun.Content += string(c.r)
+		index += c.length()
+		run.EndIndex = index
+
+		if c.r == '\n' {
+			style := *c.paragraphStyle
+			paragraph.Paragraph.ParagraphStyle = &style
+			paragraph.EndIndex = index
+			content = append(content, paragraph)
+			paragraph = nil
+		}
+	}
+
+	return content
+}
+
+// text returns the segment text without section breaks.
+func (s *segment) text() string {
+	var b strings.Builder
+	for _, c := range s.chars {
+		if !c.isSectionBreak() {
+			b.WriteRune(c.r)
+		}
+	}
+	return b.String()
+}
+
+// sections splits the body by section breaks, returning the header ID and the text of each section.
+// Sections without their own header show the header of the previous one, like Google Docs does.
+func (d *document) sections() ([]string, []string) {
+	headerIDs := make([]string, 0)
+	texts := make([]string, 0)
+
+	var b strings.Builder
+	headerID := d.style.DefaultHeaderId
+	for i, c := range d.body.chars {
+		if !c.isSectionBreak() {
+			b.WriteRune(c.r)
+			continue
+		}
+
+		if i > 0 {
+			headerIDs = append(headerIDs, headerID)
+			texts = append(texts, b.String())
+			b.Reset()
+		}
+		if i > 0 && c.sectionStyle.DefaultHeaderId != "" {
+			headerID = c.sectionStyle.DefaultHeaderId
+		}
+	}
+	headerIDs = append(headerIDs, headerID)
+	texts = append(texts, b.String())
+
+	return headerIDs, texts
+}
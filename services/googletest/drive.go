@@ -0,0 +1,340 @@
+package googletest
+
+import (
+	"encoding/json"
+	"fmt"
+	"google.golang.org/api/drive/v3"
+	"net/http"
+	"strconv"
+	"strings"
+)
+
+func (s *Server) handleDrive(w http.ResponseWriter, r *http.Request) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	parts := strings.Split(strings.Trim(strings.TrimPrefix(r.URL.Path, "/drive/v3/"), "/"), "/")
+	if parts[0] != "files" {
+		writeError(w, http.StatusNotFound, fmt.Sprintf("%s %s is not supported", r.Method, r.URL.Path))
+		return
+	}
+
+	if len(parts) == 1 {
+		switch r.Method {
+		case http.MethodGet:
+			s.listFiles(w, r)
+		case http.MethodPost:
+			var newFile drive.File
+			err := json.NewDecoder(r.Body).Decode(&newFile)
+			if err != nil {
+				writeError(w, http.StatusBadRequest, err.Error())
+				return
+			}
+			// The store creates song docs with files.create, they are the only files it makes.
+			if newFile.MimeType == "" {
+				newFile.MimeType = DocumentMimeType
+			}
+			writeJSON(w, s.createFile(&newFile))
+		default:
+			writeError(w, http.StatusMethodNotAllowed, r.Method)
+		}
+		return
+	}
+
+	file := s.file(parts[1])
+	if file == nil {
+		writeError(w, http.StatusNotFound, fmt.Sprintf("File not found: %s.", parts[1]))
+		return
+	}
+
+	switch {
+	case len(parts) == 2 && r.Method == http.MethodGet:
+		writeJSON(w, file)
+
+	case len(parts) == 2 && r.Method == http.MethodDelete:
+		s.deleteFile(file.Id)
+		w.WriteHeader(http.StatusNoContent)
+
+	case len(parts) == 3 && parts[2] == "copy" && r.Method == http.MethodPost:
+		var newFile drive.File
+		err := json.NewDecoder(r.Body).Decode(&newFile)
+		if err != nil {
+			writeError(w, http.StatusBadRequest, err.Error())
+			return
+		}
+		writeJSON(w, s.copyFile(file, &newFile))
+
+	case len(parts) == 3 && parts[2] == "export" && r.Method == http.MethodGet:
+		document, ok := s.documents[file.Id]
+		if !ok {
+			writeError(w, http.StatusForbidden, "Export only supports Docs Editors files.")
+			return
+		}
+		if mimeType := r.URL.Query().Get("mimeType"); mimeType != "text/plain" {
+			writeError(w, http.StatusBadRequest, fmt.Sprintf("Export to %s is not supported.", mimeType))
+			return
+		}
+		w.Header().Set("Content-Type", "text/plain")
+		_, _ = w.Write([]byte(exportText(document)))
+
+	case len(parts) == 3 && parts[2] == "permissions" && r.Method == http.MethodGet:
+		writeJSON(w, &drive.PermissionList{Permissions: s.permissions[file.Id]})
+
+	case len(parts) == 3 && parts[2] == "permissions" && r.Method == http.MethodPost:
+		var permission drive.Permission
+		err := json.NewDecoder(r.Body).Decode(&permission)
+		if err != nil {
+			writeError(w, http.StatusBadRequest, err.Error())
+			return
+		}
+		if permission.Role == "owner" && r.URL.Query().Get("transferOwnership") != "true" {
+			writeError(w, http.StatusForbidden, "The transferOwnership parameter must be enabled when the permission role is 'owner'.")
+			return
+		}
+		writeJSON(w, s.addPermission(file.Id, &permission))
+
+	default:
+		writeError(w, http.StatusNotFound, fmt.Sprintf("%s %s is not supported", r.Method, r.URL.Path))
+	}
+}
+
+func (s *Server) listFiles(w http.ResponseWriter, r *http.Request) {
+	query := r.URL.Query()
+
+	clauses, err := parseQuery(query.Get("q"))
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	files := make([]*drive.File, 0)
+	for _, file := range s.files {
+		text := ""
+		if document, ok := s.documents[file.Id]; ok {
+			text = exportText(document)
+		}
+
+		if clauses.match(file, text) {
+			files = append(files, file)
+		}
+	}
+
+	pageSize, err := strconv.Atoi(query.Get("pageSize"))
+	if err != nil || pageSize <= 0 {
+		pageSize = 100
+	}
+	offset, _ := strconv.Atoi(query.Get("pageToken"))
+	if offset < 0 || offset > len(files) {
+		offset = len(files)
+	}
+
+	list := &drive.FileList{Files: files[offset:]}
+	if len(list.Files) > pageSize {
+		list.Files = list.Files[:pageSize]
+		list.NextPageToken = strconv.Itoa(offset + pageSize)
+	}
+
+	writeJSON(w, list)
+}
+
+func (s *Server) copyFile(file *drive.File, newFile *drive.File) *drive.File {
+	name := newFile.Name
+	if name == "" {
+		name = "Copy of " + file.Name
+	}
+	parents := newFile.Parents
+	if parents == nil {
+		parents = file.Parents
+	}
+
+	copied := s.createFile(&drive.File{Name: name, MimeType: file.MimeType, Parents: parents})
+	if document, ok := s.documents[file.Id]; ok {
+		s.documents[copied.Id] = document.clone()
+	}
+
+	return copied
+}
+
+func (s *Server) deleteFile(ID string) {
+	for i, file := range s.files {
+		if file.Id == ID {
+			s.files = append(s.files[:i], s.files[i+1:]...)
+			break
+		}
+	}
+	delete(s.documents, ID)
+	delete(s.permissions, ID)
+}
+
+func (s *Server) addPermission(fileID string, permission *drive.Permission) *drive.Permission {
+	permissions := s.permissions[fileID]
+
+	if permission.Role == "owner" {
+		for _, p := range permissions {
+			if p.Role == "owner" {
+				p.Role = "writer"
+			}
+		}
+	}
+
+	for _, p := range permissions {
+		if p.EmailAddress == permission.EmailAddress && p.Type == permission.Type {
+			p.Role = permission.Role
+			return p
+		}
+	}
+
+	permission.Id = fmt.Sprintf("permission-%d", len(permissions)+1)
+	s.permissions[fileID] = append(permissions, permission)
+
+	return permission
+}
+
+// exportText renders a document as plain text: every section is preceded by its header.
+func exportText(document *document) string {
+	var b strings.Builder
+
+	headerIDs, texts := document.sections()
+	for i := range texts {
+		if header, ok := document.headers[headerIDs[i]]; ok {
+			b.WriteString(header.text())
+		}
+		b.WriteString(texts[i])
+	}
+
+	return b.String()
+}
+
+type clause struct {
+	field    string
+	operator string
+	value    string
+}
+
+type clauses []clause
+
+func (cs clauses) match(file *drive.File, text string) bool {
+	for _, c := range cs {
+		switch {
+		case c.field == "trashed":
+			if c.value != "false" {
+				return false
+			}
+		case c.field == "mimeType":
+			if file.MimeType != c.value {
+				return false
+			}
+		case c.field == "name" && c.operator == "=":
+			if file.Name != c.value {
+				return false
+			}
+		case c.field == "name" && c.operator == "contains":
+			if !strings.Contains(strings.ToLower(file.Name), strings.ToLower(c.value)) {
+				return false
+			}
+		case c.field == "fullText":
+			value := strings.ToLower(c.value)
+			if !strings.Contains(strings.ToLower(file.Name), value) && !strings.Contains(strings.ToLower(text), value) {
+				return false
+			}
+		case c.field == "parents":
+			found := false
+			for _, parent := range file.Parents {
+				if parent == c.value {
+					found = true
+				}
+			}
+			if !found {
+				return false
+			}
+		}
+	}
+	return true
+}
+
+// parseQuery supports the subset of the Drive query language joined by "and":
+// trashed = false, mimeType = '…', name = '…', name contains '…', fullText contains '…' and '…' in parents.
+func parseQuery(q string) (clauses, error) {
+	result := make(clauses, 0)
+
+	rest := strings.TrimSpace(q)
+	for rest != "" {
+		var c clause
+		var err error
+
+		switch {
+		case strings.HasPrefix(rest, "trashed = "):
+			rest = strings.TrimPrefix(rest, "trashed = ")
+			c = clause{field: "trashed", operator: "="}
+			end := strings.Index(rest, " ")
+			if end < 0 {
+				end = len(rest)
+			}
+			c.value, rest = rest[:end], rest[end:]
+		case strings.HasPrefix(rest, "mimeType = '"):
+			c = clause{field: "mimeType", operator: "="}
+			c.value, rest, err = readQuoted(strings.TrimPrefix(rest, "mimeType = "))
+		case strings.HasPrefix(rest, "name = '"):
+			c = clause{field: "name", operator: "="}
+			c.value, rest, err = readQuoted(strings.TrimPrefix(rest, "name = "))
+		case strings.HasPrefix(rest, "name contains '"):
+			c = clause{field: "name", operator: "contains"}
+			c.value, rest, err = readQuoted(strings.TrimPrefix(rest, "name contains "))
+		case strings.HasPrefix(rest, "fullText contains '"):
+			c = clause{field: "fullText", operator: "contains"}
+			c.value, rest, err = readQuoted(strings.TrimPrefix(rest, "fullText contains "))
+		case strings.HasPrefix(rest, "'"):
+			c = clause{field: "parents", operator: "in"}
+			c.value, rest, err = readQuoted(rest)
+			if err == nil && !strings.HasPrefix(rest, " in parents") {
+				err = fmt.Errorf("invalid query: %q", q)
+			}
+			rest = strings.TrimPrefix(rest, " in parents")
+		default:
+			err = fmt.Errorf("invalid query: %q", q)
+		}
+		if err != nil {
+			return nil, err
+		}
+
+		result = append(result, c)
+
+		rest = strings.TrimSpace(rest)
+		if rest != "" {
+			if !strings.HasPrefix(rest, "and ") {
+				return nil, fmt.Errorf("invalid query: %q", q)
+			}
+			rest = strings.TrimPrefix(rest, "and ")
+		}
+	}
+
+	return result, nil
+}
+
+// readQuoted reads a single-quoted string. A quote ends the string only if the clause ends after it,
+// so names with unescaped quotes are still read as a whole.
+func readQuoted(s string) (string, string, error) {
+	if !strings.HasPrefix(s, "'") {
+		return "", "", fmt.Errorf("quoted value expected: %q", s)
+	}
+
+	var b strings.Builder
+	for i := 1; i < len(s); i++ {
+		if s[i] == '\\' && i+1 < len(s) {
+			b.WriteByte(s[i+1])
+			i++
+			continue
+		}
+
+		if s[i] == '\'' {
+			rest := s[i+1:]
+			if rest == "" || strings.HasPrefix(rest, " and ") || strings.HasPrefix(rest, " in parents") {
+				return b.String(), rest, nil
+			}
+		}
+
+		b.WriteByte(s[i])
+	}
+
+	return "", "", fmt.Errorf("unterminated quoted value: %q", s)
+}
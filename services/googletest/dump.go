@@ -0,0 +1,170 @@
+package googletest
+
+import (
+	"fmt"
+	"google.golang.org/api/docs/v1"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// Dump returns a readable representation of the document with its styles, suitable for golden files:
+//
+//	=== document header=kix.header1 marginTop=14pt
+//	=== header kix.header1
+//	[CENTER] "Song name\n"{bold 20pt "Roboto Mono"}
+//	=== body
+//	--- section CONTINUOUS
+//	"C"{bold #cc0000} "  G\n"
+//	--- section NEXT_PAGE header=kix.header2
+//
+// Every paragraph is a line, text runs are quoted and followed by their non-default styles.
+func (s *Server) Dump(ID string) (string, error) {
+	doc, err := s.Document(ID)
+	if err != nil {
+		return "", err
+	}
+
+	var b strings.Builder
+
+	fmt.Fprintf(&b, "=== document %s\n", dumpDocumentStyle(doc.DocumentStyle))
+
+	headerIDs := make([]string, 0)
+	for headerID := range doc.Headers {
+		headerIDs = append(headerIDs, headerID)
+	}
+	sort.Strings(headerIDs)
+
+	for _, headerID := range headerIDs {
+		fmt.Fprintf(&b, "=== header %s\n", headerID)
+		dumpContent(&b, doc.Headers[headerID].Content)
+	}
+
+	b.WriteString("=== body\n")
+	dumpContent(&b, doc.Body.Content)
+
+	return b.String(), nil
+}
+
+func dumpContent(b *strings.Builder, content []*docs.StructuralElement) {
+	for _, element := range content {
+		if element.SectionBreak != nil {
+			fmt.Fprintf(b, "--- section %s", element.SectionBreak.SectionStyle.SectionType)
+			if element.SectionBreak.SectionStyle.DefaultHeaderId != "" {
+				fmt.Fprintf(b, " header=%s", element.SectionBreak.SectionStyle.DefaultHeaderId)
+			}
+			b.WriteString("\n")
+			continue
+		}
+
+		if element.Paragraph == nil {
+			continue
+		}
+
+		if style := dumpParagraphStyle(element.Paragraph.ParagraphStyle); style != "" {
+			fmt.Fprintf(b, "[%s] ", style)
+		}
+
+		runs := make([]string, 0)
+		for _, e := range element.Paragraph.Elements {
+			if e.TextRun == nil {
+				continue
+			}
+
+			run := strconv.Quote(e.TextRun.Content)
+			if style := dumpTextStyle(e.TextRun.TextStyle); style != "" {
+				run += "{" + style + "}"
+			}
+			runs = append(runs, run)
+		}
+		b.WriteString(strings.Join(runs, " "))
+		b.WriteString("\n")
+	}
+}
+
+func dumpTextStyle(style *docs.TextStyle) string {
+	if style == nil {
+		return ""
+	}
+
+	attrs := make([]string, 0)
+	if style.Bold {
+		attrs = append(attrs, "bold")
+	}
+	if style.Italic {
+		attrs = append(attrs, "italic")
+	}
+	if style.Underline {
+		attrs = append(attrs, "underline")
+	}
+	if style.Strikethrough {
+		attrs = append(attrs, "strikethrough")
+	}
+	if style.FontSize != nil {
+		attrs = append(attrs, dumpDimension(style.FontSize))
+	}
+	if style.WeightedFontFamily != nil {
+		attrs = append(attrs, strconv.Quote(style.WeightedFontFamily.FontFamily))
+	}
+	if style.ForegroundColor != nil && style.ForegroundColor.Color != nil && style.ForegroundColor.Color.RgbColor != nil {
+		color := style.ForegroundColor.Color.RgbColor
+		if color.Red != 0 || color.Green != 0 || color.Blue != 0 {
+			attrs = append(attrs, fmt.Sprintf("#%02x%02x%02x", int(color.Red*255), int(color.Green*255), int(color.Blue*255)))
+		}
+	}
+
+	return strings.Join(attrs, " ")
+}
+
+func dumpParagraphStyle(style *docs.ParagraphStyle) string {
+	if style == nil {
+		return ""
+	}
+
+	attrs := make([]string, 0)
+	if style.Alignment != "" && style.Alignment != "START" {
+		attrs = append(attrs, style.Alignment)
+	}
+	if style.LineSpacing != 0 {
+		attrs = append(attrs, fmt.Sprintf("lineSpacing=%g", style.LineSpacing))
+	}
+	if style.SpaceAbove != nil {
+		attrs = append(attrs, "spaceAbove="+dumpDimension(style.SpaceAbove))
+	}
+	if style.SpaceBelow != nil {
+		attrs = append(attrs, "spaceBelow="+dumpDimension(style.SpaceBelow))
+	}
+
+	return strings.Join(attrs, " ")
+}
+
+func dumpDocumentStyle(style *docs.DocumentStyle) string {
+	if style == nil {
+		return ""
+	}
+
+	attrs := make([]string, 0)
+	if style.DefaultHeaderId != "" {
+		attrs = append(attrs, "header="+style.DefaultHeaderId)
+	}
+	for _, margin := range []struct {
+		name      string
+		dimension *docs.Dimension
+	}{
+		{"marginTop", style.MarginTop},
+		{"marginBottom", style.MarginBottom},
+		{"marginLeft", style.MarginLeft},
+		{"marginRight", style.MarginRight},
+		{"marginHeader", style.MarginHeader},
+	} {
+		if margin.dimension != nil {
+			attrs = append(attrs, margin.name+"="+dumpDimension(margin.dimension))
+		}
+	}
+
+	return strings.Join(attrs, " ")
+}
+
+func dumpDimension(dimension *docs.Dimension) string {
+	return fmt.Sprintf("%g%s", dimension.Magnitude, strings.ToLower(dimension.Unit))
+}
@@ -0,0 +1,278 @@
+// Package googletest provides an in-process fake of the Google Docs and Drive REST APIs.
+// Point docs.Service and drive.Service at it with option.WithEndpoint to run the document pipelines offline.
+package googletest
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"google.golang.org/api/docs/v1"
+	"google.golang.org/api/drive/v3"
+	"google.golang.org/api/option"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	DocumentMimeType = "application/vnd.google-apps.document"
+	FolderMimeType   = "application/vnd.google-apps.folder"
+	OwnerEmail       = "owner@example.com"
+)
+
+type Server struct {
+	mu          sync.Mutex
+	server      *httptest.Server
+	files       []*drive.File
+	documents   map[string]*document
+	permissions map[string][]*drive.Permission
+	nextID      int
+	now         time.Time
+}
+
+func NewServer() *Server {
+	s := &Server{
+		documents:   make(map[string]*document),
+		permissions: make(map[string][]*drive.Permission),
+		now:         time.Date(2021, 1, 1, 0, 0, 0, 0, time.UTC),
+	}
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/docs/", s.handleDocs)
+	mux.HandleFunc("/drive/v3/", s.handleDrive)
+	s.server = httptest.NewServer(mux)
+
+	return s
+}
+
+func (s *Server) Close() {
+	s.server.Close()
+}
+
+func (s *Server) DocsEndpoint() string {
+	return s.server.URL + "/docs/"
+}
+
+func (s *Server) DriveEndpoint() string {
+	return s.server.URL + "/drive/v3/"
+}
+
+func (s *Server) DocsService(ctx context.Context) (*docs.Service, error) {
+	return docs.NewService(ctx,
+		option.WithEndpoint(s.DocsEndpoint()),
+		option.WithHTTPClient(s.server.Client()),
+	)
+}
+
+func (s *Server) DriveService(ctx context.Context) (*drive.Service, error) {
+	return drive.NewService(ctx,
+		option.WithEndpoint(s.DriveEndpoint()),
+		option.WithHTTPClient(s.server.Client()),
+	)
+}
+
+// AddFolder creates a folder owned by OwnerEmail and returns its ID.
+func (s *Server) AddFolder(name string) string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	file := s.createFile(&drive.File{Name: name, MimeType: FolderMimeType})
+	return file.Id
+}
+
+// AddDocument creates a Google Doc with the given body text and, if header is not empty, a default header.
+func (s *Server) AddDocument(name string, parents []string, header string, body string) (string, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	file := s.createFile(&drive.File{Name: name, MimeType: DocumentMimeType, Parents: parents})
+	document := s.documents[file.Id]
+
+	requests := make([]*docs.Request, 0)
+	if body != "" {
+		requests = append(requests, &docs.Request{
+			InsertText: &docs.InsertTextRequest{EndOfSegmentLocation: &docs.EndOfSegmentLocation{}, Text: body},
+		})
+	}
+
+	if header != "" {
+		res, err := document.createHeader(&docs.CreateHeaderRequest{Type: "DEFAULT"})
+		if err != nil {
+			return "", err
+		}
+		requests = append(requests, &docs.Request{
+			InsertText: &docs.InsertTextRequest{
+				EndOfSegmentLocation: &docs.EndOfSegmentLocation{SegmentId: res.CreateHeader.HeaderId},
+				Text:                 header,
+			},
+		})
+	}
+
+	for _, request := range requests {
+		_, err := document.apply(request)
+		if err != nil {
+			return "", err
+		}
+	}
+
+	return file.Id, nil
+}
+
+// Document returns the document the same way documents.get does.
+func (s *Server) Document(ID string) (*docs.Document, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	document, file, err := s.document(ID)
+	if err != nil {
+		return nil, err
+	}
+
+	return document.toDocs(ID, file.Name), nil
+}
+
+// Text returns the document the same way files.export to "text/plain" does.
+func (s *Server) Text(ID string) (string, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	document, _, err := s.document(ID)
+	if err != nil {
+		return "", err
+	}
+
+	return exportText(document), nil
+}
+
+func (s *Server) document(ID string) (*document, *drive.File, error) {
+	document, ok := s.documents[ID]
+	if !ok {
+		return nil, nil, fmt.Errorf("document %s not found", ID)
+	}
+
+	return document, s.file(ID), nil
+}
+
+func (s *Server) file(ID string) *drive.File {
+	for _, file := range s.files {
+		if file.Id == ID {
+			return file
+		}
+	}
+	return nil
+}
+
+func (s *Server) createFile(newFile *drive.File) *drive.File {
+	s.nextID++
+
+	file := &drive.File{
+		Id:       fmt.Sprintf("fake-file-%d", s.nextID),
+		Name:     newFile.Name,
+		MimeType: newFile.MimeType,
+		Parents:  newFile.Parents,
+	}
+	if file.Name == "" {
+		file.Name = "Untitled"
+	}
+	if file.MimeType == DocumentMimeType {
+		file.WebViewLink = fmt.Sprintf("https://docs.google.com/document/d/%s/edit", file.Id)
+		s.documents[file.Id] = newDocument()
+	}
+	s.touch(file)
+
+	s.files = append(s.files, file)
+	s.permissions[file.Id] = []*drive.Permission{
+		{Id: "owner", Role: "owner", Type: "user", EmailAddress: OwnerEmail},
+	}
+
+	return file
+}
+
+// touch updates modifiedTime of the file, every change moves the clock forward by a second.
+func (s *Server) touch(file *drive.File) {
+	s.now = s.now.Add(time.Second)
+	file.ModifiedTime = s.now.Format("2006-01-02T15:04:05.000Z")
+}
+
+func (s *Server) handleDocs(w http.ResponseWriter, r *http.Request) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	path := strings.TrimPrefix(r.URL.Path, "/docs/v1/documents")
+	path = strings.TrimPrefix(path, "/")
+
+	switch {
+	case path == "" && r.Method == http.MethodPost:
+		var newDocument docs.Document
+		err := json.NewDecoder(r.Body).Decode(&newDocument)
+		if err != nil {
+			writeError(w, http.StatusBadRequest, err.Error())
+			return
+		}
+
+		file := s.createFile(&drive.File{Name: newDocument.Title, MimeType: DocumentMimeType})
+		writeJSON(w, s.documents[file.Id].toDocs(file.Id, file.Name))
+
+	case strings.HasSuffix(path, ":batchUpdate") && r.Method == http.MethodPost:
+		ID := strings.TrimSuffix(path, ":batchUpdate")
+		document, file, err := s.document(ID)
+		if err != nil {
+			writeError(w, http.StatusNotFound, err.Error())
+			return
+		}
+
+		var batch docs.BatchUpdateDocumentRequest
+		err = json.NewDecoder(r.Body).Decode(&batch)
+		if err != nil {
+			writeError(w, http.StatusBadRequest, err.Error())
+			return
+		}
+
+		// Requests are applied atomically: if one of them fails, none are.
+		updated := document.clone()
+		replies := make([]*docs.Response, 0)
+		for i, request := range batch.Requests {
+			reply, err := updated.apply(request)
+			if err != nil {
+				writeError(w, http.StatusBadRequest, fmt.Sprintf("Invalid requests[%d]: %v", i, err))
+				return
+			}
+			replies = append(replies, reply)
+		}
+
+		s.documents[ID] = updated
+		s.touch(file)
+
+		writeJSON(w, &docs.BatchUpdateDocumentResponse{DocumentId: ID, Replies: replies})
+
+	case r.Method == http.MethodGet:
+		document, file, err := s.document(path)
+		if err != nil {
+			writeError(w, http.StatusNotFound, err.Error())
+			return
+		}
+
+		writeJSON(w, document.toDocs(path, file.Name))
+
+	default:
+		writeError(w, http.StatusNotFound, fmt.Sprintf("%s %s is not supported", r.Method, r.URL.Path))
+	}
+}
+
+func writeJSON(w http.ResponseWriter, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	_ = json.NewEncoder(w).Encode(v)
+}
+
+func writeError(w http.ResponseWriter, code int, message string) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(code)
+	_ = json.NewEncoder(w).Encode(map[string]interface{}{
+		"error": map[string]interface{}{
+			"code":    code,
+			"message": message,
+		},
+	})
+}
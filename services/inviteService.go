@@ -0,0 +1,96 @@
+package services
+
+import (
+	"crypto/rand"
+	"encoding/base64"
+	"errors"
+	"github.com/joeyave/scala-chords-bot/entities"
+	"github.com/joeyave/scala-chords-bot/repositories"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"strings"
+	"time"
+)
+
+// Tokens are passed as the start parameter of the bot, which can be only [A-Za-z0-9_-] up to 64 characters.
+const inviteTokenPrefix = "invite-"
+
+var ErrInvalidInvite = errors.New("invite is expired, used up or doesn't exist")
+
+type InviteService struct {
+	inviteRepository repositories.InviteRepository
+}
+
+func NewInviteService(inviteRepository repositories.InviteRepository) *InviteService {
+	return &InviteService{
+		inviteRepository: inviteRepository,
+	}
+}
+
+// IsInviteToken tells invites from other start parameters.
+func IsInviteToken(payload string) bool {
+	return strings.HasPrefix(payload, inviteTokenPrefix)
+}
+
+// Create makes an invite to the band. Zero ttl or maxUses mean no limit.
+func (s *InviteService) Create(bandID primitive.ObjectID, role string, ttl time.Duration, maxUses int, now time.Time) (*entities.Invite, error) {
+	b := make([]byte, 12)
+	_, err := rand.Read(b)
+	if err != nil {
+		return nil, err
+	}
+
+	invite := entities.Invite{
+		Token:   inviteTokenPrefix + base64.RawURLEncoding.EncodeToString(b),
+		BandID:  bandID,
+		Role:    role,
+		MaxUses: maxUses,
+	}
+	if ttl != 0 {
+		invite.ExpiresAt = now.Add(ttl)
+	}
+
+	return s.inviteRepository.UpdateOne(invite)
+}
+
+// FindManyValidByBandID returns invites of the band that can be used, the others are deleted.
+func (s *InviteService) FindManyValidByBandID(bandID primitive.ObjectID, now time.Time) ([]*entities.Invite, error) {
+	invites, err := s.inviteRepository.FindManyByBandID(bandID)
+	if err != nil {
+		return nil, err
+	}
+
+	var valid []*entities.Invite
+	for _, invite := range invites {
+		if invite.Valid(now) {
+			valid = append(valid, invite)
+		} else {
+			_ = s.inviteRepository.DeleteOneByID(invite.ID)
+		}
+	}
+
+	return valid, nil
+}
+
+// FindOneValidByToken returns the invite if it can be used. It doesn't take a use.
+func (s *InviteService) FindOneValidByToken(token string, now time.Time) (*entities.Invite, error) {
+	invite, err := s.inviteRepository.FindOneByToken(token)
+	if err != nil || !invite.Valid(now) {
+		return nil, ErrInvalidInvite
+	}
+
+	return invite, nil
+}
+
+// Use takes one use of the invite. It fails if the last use has been taken in the meantime.
+func (s *InviteService) Use(invite *entities.Invite) error {
+	err := s.inviteRepository.IncrementUses(invite.ID)
+	if err != nil {
+		return ErrInvalidInvite
+	}
+
+	return nil
+}
+
+func (s *InviteService) DeleteOneByID(ID primitive.ObjectID) error {
+	return s.inviteRepository.DeleteOneByID(ID)
+}
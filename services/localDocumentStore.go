@@ -0,0 +1,388 @@
+package services
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/joeyave/chords-transposer/transposer"
+	"github.com/joeyave/scala-chords-bot/helpers"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"google.golang.org/api/drive/v3"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// LocalDocumentStore keeps every song as a JSON file in a directory on disk.
+// A document consists of sections (one per key, like pages of a Google Doc), each with its own header and body.
+type LocalDocumentStore struct {
+	mu          sync.RWMutex
+	dir         string
+	pdfRenderer *PDFRenderer
+}
+
+type localDocument struct {
+	File     *drive.File   `json:"file"`
+	Sections []SongSection `json:"sections"`
+}
+
+func NewLocalDocumentStore(dir string, pdfRenderer *PDFRenderer) (*LocalDocumentStore, error) {
+	err := os.MkdirAll(dir, 0755)
+	if err != nil {
+		return nil, err
+	}
+
+	return &LocalDocumentStore{
+		dir:         dir,
+		pdfRenderer: pdfRenderer,
+	}, nil
+}
+
+func (s *LocalDocumentStore) FindAllByFolderID(folderID string, nextPageToken string) ([]*drive.File, string, error) {
+	return s.find(func(document *localDocument) bool {
+		return hasParent(document.File, folderID)
+	}, nextPageToken)
+}
+
+func (s *LocalDocumentStore) FindSomeByFullTextAndFolderID(name string, folderID string, pageToken string) ([]*drive.File, string, error) {
+	name = strings.ToLower(name)
+
+	return s.find(func(document *localDocument) bool {
+		if folderID != "" && !hasParent(document.File, folderID) {
+			return false
+		}
+
+		return strings.Contains(strings.ToLower(document.File.Name), name) ||
+			strings.Contains(strings.ToLower(document.text()), name)
+	}, pageToken)
+}
+
+func (s *LocalDocumentStore) FindOneByNameAndFolderID(name string, folderID string) (*drive.File, error) {
+	driveFiles, _, err := s.find(func(document *localDocument) bool {
+		return document.File.Name == name && (folderID == "" || hasParent(document.File, folderID))
+	}, "")
+	if err != nil {
+		return nil, err
+	}
+
+	if len(driveFiles) == 0 {
+		return nil, errors.New("not found")
+	}
+
+	return driveFiles[0], nil
+}
+
+func (s *LocalDocumentStore) FindOneByID(ID string) (*drive.File, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	document, err := s.read(ID)
+	if err != nil {
+		return nil, err
+	}
+
+	return document.File, nil
+}
+
+func (s *LocalDocumentStore) CreateOne(newFile *drive.File, lyrics string, key string, BPM string, time string) (*drive.File, error) {
+	document := &localDocument{
+		File: &drive.File{
+			Id:       primitive.NewObjectID().Hex(),
+			Name:     newFile.Name,
+			MimeType: "application/vnd.google-apps.document",
+			Parents:  newFile.Parents,
+		},
+		Sections: []SongSection{
+			{
+				Header: getDefaultHeaderText(newFile.Name, key, BPM, time),
+				Body:   lyrics,
+			},
+		},
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	err := s.write(document)
+	if err != nil {
+		return nil, err
+	}
+
+	return document.File, nil
+}
+
+func (s *LocalDocumentStore) CloneOne(fileToCloneID string, newFile *drive.File) (*drive.File, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	document, err := s.read(fileToCloneID)
+	if err != nil {
+		return nil, err
+	}
+
+	document.File.Id = primitive.NewObjectID().Hex()
+	if newFile.Name != "" {
+		document.File.Name = newFile.Name
+	}
+	if newFile.Parents != nil {
+		document.File.Parents = newFile.Parents
+	}
+
+	err = s.write(document)
+	if err != nil {
+		return nil, err
+	}
+
+	return document.File, nil
+}
+
+func (s *LocalDocumentStore) DeleteOneByID(ID string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	path, err := s.path(ID)
+	if err != nil {
+		return err
+	}
+
+	return os.Remove(path)
+}
+
+func (s *LocalDocumentStore) Export(ID string, mimeType string) (io.Reader, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	document, err := s.read(ID)
+	if err != nil {
+		return nil, err
+	}
+
+	switch mimeType {
+	case "text/plain":
+		return strings.NewReader(document.text()), nil
+	case "application/pdf":
+		return s.pdfRenderer.Render(document.Sections)
+	default:
+		return nil, fmt.Errorf("export to %s is not supported", mimeType)
+	}
+}
+
+func (s *LocalDocumentStore) TransposeOne(ID string, toKey string, sectionIndex int) (*drive.File, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	document, err := s.read(ID)
+	if err != nil {
+		return nil, err
+	}
+
+	if len(document.Sections) == 0 {
+		document.Sections = append(document.Sections, SongSection{})
+	}
+
+	if len(document.Sections) <= sectionIndex || sectionIndex < 0 {
+		document.Sections = append(document.Sections, SongSection{})
+		sectionIndex = len(document.Sections) - 1
+	}
+
+	// Every transposition is made from the first section, the same way as in Google Docs.
+	header, key := transposeText(document.Sections[0].Header, "", toKey)
+	body, _ := transposeText(document.Sections[0].Body, key, toKey)
+
+	document.Sections[sectionIndex] = SongSection{
+		Header: header,
+		Body:   body,
+	}
+
+	err = s.write(document)
+	if err != nil {
+		return nil, err
+	}
+
+	return document.File, nil
+}
+
+func (s *LocalDocumentStore) StyleOne(ID string) (*drive.File, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	document, err := s.read(ID)
+	if err != nil {
+		return nil, err
+	}
+
+	if len(document.Sections) == 0 {
+		document.Sections = append(document.Sections, SongSection{})
+	}
+
+	if strings.TrimSpace(document.Sections[0].Header) == "" {
+		document.Sections[0].Header = getDefaultHeaderText(document.File.Name, "", "", "")
+	}
+
+	sectionNamesRegex := regexp.MustCompile(`\p{L}+(\s\d*)?:`)
+	for i := range document.Sections {
+		document.Sections[i].Header = sectionNamesRegex.ReplaceAllStringFunc(document.Sections[i].Header, strings.ToUpper)
+		document.Sections[i].Body = sectionNamesRegex.ReplaceAllStringFunc(document.Sections[i].Body, strings.ToUpper)
+	}
+
+	err = s.write(document)
+	if err != nil {
+		return nil, err
+	}
+
+	return document.File, nil
+}
+
+func (s *LocalDocumentStore) GetSectionsNumber(ID string) (int, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	document, err := s.read(ID)
+	if err != nil {
+		return 0, err
+	}
+
+	return len(document.Sections), nil
+}
+
+// Helper functions. -----------------------------------
+
+func (s *LocalDocumentStore) find(filter func(document *localDocument) bool, pageToken string) ([]*drive.File, string, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	paths, err := filepath.Glob(filepath.Join(s.dir, "*.json"))
+	if err != nil {
+		return nil, "", err
+	}
+
+	driveFiles := make([]*drive.File, 0)
+	for _, path := range paths {
+		document, err := s.read(strings.TrimSuffix(filepath.Base(path), ".json"))
+		if err != nil {
+			return nil, "", err
+		}
+
+		if filter(document) {
+			driveFiles = append(driveFiles, document.File)
+		}
+	}
+
+	sort.SliceStable(driveFiles, func(i, j int) bool {
+		return driveFiles[i].Name < driveFiles[j].Name
+	})
+
+	offset, _ := strconv.Atoi(pageToken)
+	if offset < 0 || offset > len(driveFiles) {
+		offset = len(driveFiles)
+	}
+
+	end := offset + helpers.PageSize
+	nextPageToken := ""
+	if end < len(driveFiles) {
+		nextPageToken = strconv.Itoa(end)
+	} else {
+		end = len(driveFiles)
+	}
+
+	return driveFiles[offset:end], nextPageToken, nil
+}
+
+func (s *LocalDocumentStore) path(ID string) (string, error) {
+	// IDs come from callback data, so don't let them point outside of the directory.
+	if ID == "" || ID != filepath.Base(ID) || strings.HasPrefix(ID, ".") {
+		return "", errors.New("not found")
+	}
+
+	return filepath.Join(s.dir, ID+".json"), nil
+}
+
+func (s *LocalDocumentStore) read(ID string) (*localDocument, error) {
+	path, err := s.path(ID)
+	if err != nil {
+		return nil, err
+	}
+
+	b, err := ioutil.ReadFile(path)
+	if os.IsNotExist(err) {
+		return nil, errors.New("not found")
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	var document *localDocument
+	err = json.Unmarshal(b, &document)
+	if err != nil {
+		return nil, err
+	}
+
+	return document, nil
+}
+
+func (s *LocalDocumentStore) write(document *localDocument) error {
+	path, err := s.path(document.File.Id)
+	if err != nil {
+		return err
+	}
+
+	document.File.ModifiedTime = time.Now().UTC().Format(time.RFC3339)
+	document.File.Version++
+
+	b, err := json.MarshalIndent(document, "", "  ")
+	if err != nil {
+		return err
+	}
+
+	return ioutil.WriteFile(path, b, 0644)
+}
+
+// text returns the document as plain text: every section with its header.
+func (d *localDocument) text() string {
+	var buf bytes.Buffer
+	for _, section := range d.Sections {
+		buf.WriteString(section.Header)
+		if section.Header != "" && !strings.HasSuffix(section.Header, "\n") {
+			buf.WriteString("\n")
+		}
+		buf.WriteString(section.Body)
+		if section.Body != "" && !strings.HasSuffix(section.Body, "\n") {
+			buf.WriteString("\n")
+		}
+	}
+	return buf.String()
+}
+
+func hasParent(driveFile *drive.File, folderID string) bool {
+	for _, parent := range driveFile.Parents {
+		if parent == folderID {
+			return true
+		}
+	}
+	return false
+}
+
+// transposeText transposes text to toKey. If key is empty, it is guessed from the text.
+func transposeText(text string, key string, toKey string) (string, string) {
+	if key == "" {
+		guessedKey, err := transposer.GuessKeyFromText(text)
+		if err == nil {
+			key = guessedKey.String()
+		}
+	}
+
+	transposedText, err := transposer.TransposeToKey(text, key, toKey)
+	if err != nil {
+		return text, key
+	}
+
+	return transposedText, key
+}
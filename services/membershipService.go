@@ -7,12 +7,14 @@ import (
 )
 
 type MembershipService struct {
-	membershipRepository *repositories.MembershipRepository
+	membershipRepository repositories.MembershipRepository
+	permissionService    *PermissionService
 }
 
-func NewMembershipService(membershipRepository *repositories.MembershipRepository) *MembershipService {
+func NewMembershipService(membershipRepository repositories.MembershipRepository, permissionService *PermissionService) *MembershipService {
 	return &MembershipService{
 		membershipRepository: membershipRepository,
+		permissionService:    permissionService,
 	}
 }
 
@@ -20,7 +22,17 @@ func (s *MembershipService) FindAll() ([]*entities.Membership, error) {
 	return s.membershipRepository.FindAll()
 }
 
-func (s *MembershipService) UpdateOne(membership entities.Membership) (*entities.Membership, error) {
+func (s *MembershipService) FindOneByID(ID primitive.ObjectID) (*entities.Membership, error) {
+	return s.membershipRepository.FindOneByID(ID)
+}
+
+// UpdateOne saves the membership. The actor needs the permission to manage events of the band.
+func (s *MembershipService) UpdateOne(actor *entities.User, membership entities.Membership) (*entities.Membership, error) {
+	err := s.permissionService.CheckEvent(actor, membership.EventID, false)
+	if err != nil {
+		return nil, err
+	}
+
 	memberships, err := s.membershipRepository.FindMultipleByUserIDAndEventID(membership.UserID, membership.EventID)
 	if err == nil {
 		for _, mb := range memberships {
@@ -33,6 +45,31 @@ func (s *MembershipService) UpdateOne(membership entities.Membership) (*entities
 	return s.membershipRepository.UpdateOne(membership)
 }
 
-func (s *MembershipService) DeleteOneByID(ID primitive.ObjectID) error {
+// UpdateStatus saves the answer of the member whether they can serve. Only the member answers for themselves.
+func (s *MembershipService) UpdateStatus(actor *entities.User, ID primitive.ObjectID, status string) (*entities.Membership, error) {
+	membership, err := s.membershipRepository.FindOneByID(ID)
+	if err != nil {
+		return nil, err
+	}
+
+	if actor != nil && actor.ID != membership.UserID {
+		return nil, ErrForbidden
+	}
+
+	membership.Status = status
+	return s.membershipRepository.UpdateOne(*membership)
+}
+
+func (s *MembershipService) DeleteOneByID(actor *entities.User, ID primitive.ObjectID) error {
+	membership, err := s.membershipRepository.FindOneByID(ID)
+	if err != nil {
+		return err
+	}
+
+	err = s.permissionService.CheckEvent(actor, membership.EventID, false)
+	if err != nil {
+		return err
+	}
+
 	return s.membershipRepository.DeleteOneByID(ID)
 }
@@ -0,0 +1,309 @@
+package services
+
+import (
+	"bytes"
+	"fmt"
+	"github.com/jung-kurt/gofpdf"
+	"io"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// PDFRenderer draws chord charts the same way StyleOne styles the docs:
+// monospace font, red bold chords and repeat markers, bold upper case section names and a header on every page.
+type PDFRenderer struct {
+	fontsDir string
+}
+
+// NewPDFRenderer creates a renderer that takes DejaVuSansMono.ttf and DejaVuSansMono-Bold.ttf from fontsDir.
+func NewPDFRenderer(fontsDir string) *PDFRenderer {
+	return &PDFRenderer{
+		fontsDir: fontsDir,
+	}
+}
+
+const (
+	pdfFont         = "DejaVuSansMono"
+	pdfBodyFontSize = 14
+	pdfLineSpacing  = 1.05
+	pdfMarginTop    = 14
+	pdfMarginBottom = 14
+	pdfMarginLeft   = 30
+	pdfMarginRight  = 30
+	pdfMarginHeader = 18
+)
+
+var (
+	pdfRed   = [3]int{204, 0, 0}
+	pdfBlack = [3]int{0, 0, 0}
+)
+
+type pdfStyle struct {
+	bold  bool
+	color [3]int
+}
+
+// BookletSong is a song of the booklet in the key it is going to be played in.
+type BookletSong struct {
+	Name     string
+	Key      string
+	Sections []SongSection
+}
+
+// Render draws every section on a new page with its header.
+func (r *PDFRenderer) Render(sections []SongSection) (io.Reader, error) {
+	pdf, header := r.newPDF()
+
+	for _, section := range sections {
+		*header = splitLines(section.Header)
+
+		pdf.AddPage()
+		r.drawBody(pdf, splitLines(section.Body))
+	}
+
+	if len(sections) == 0 {
+		pdf.AddPage()
+	}
+
+	return output(pdf)
+}
+
+// RenderBooklet draws the cover with the title and the roster, the table of contents and then every song.
+func (r *PDFRenderer) RenderBooklet(title string, roster []string, songs []BookletSong) (io.Reader, error) {
+	// Pages of the songs are known only after they are drawn, so the first pass is made to count them.
+	pages := make([]int, len(songs))
+	_, err := r.renderBooklet(title, roster, songs, make([]int, len(songs)), pages)
+	if err != nil {
+		return nil, err
+	}
+
+	return r.renderBooklet(title, roster, songs, pages, make([]int, len(songs)))
+}
+
+func (r *PDFRenderer) renderBooklet(title string, roster []string, songs []BookletSong, tocPages []int, pages []int) (io.Reader, error) {
+	pdf, header := r.newPDF()
+
+	pdf.AddPage()
+	pdf.SetY(pdf.GetY() + 120)
+	r.drawLine(pdf, title, 20, "C", true)
+	pdf.Ln(pdfBodyFontSize)
+	for _, line := range roster {
+		r.drawLine(pdf, line, pdfBodyFontSize, "L", false)
+	}
+
+	pdf.AddPage()
+	r.drawLine(pdf, "Содержание", 20, "C", true)
+	pdf.Ln(pdfBodyFontSize)
+	for i, song := range songs {
+		name := fmt.Sprintf("%d. %s", i+1, song.Name)
+		if song.Key != "" {
+			name = fmt.Sprintf("%s (%s)", name, song.Key)
+		}
+
+		link := 0
+		if tocPages[i] != 0 {
+			link = pdf.AddLink()
+			pdf.SetLink(link, 0, tocPages[i])
+		}
+		r.drawTOCLine(pdf, name, strconv.Itoa(tocPages[i]), link)
+	}
+
+	for i, song := range songs {
+		for j, section := range song.Sections {
+			*header = splitLines(section.Header)
+
+			pdf.AddPage()
+			if j == 0 {
+				pages[i] = pdf.PageNo()
+			}
+			r.drawBody(pdf, splitLines(section.Body))
+		}
+	}
+
+	return output(pdf)
+}
+
+func (r *PDFRenderer) newPDF() (*gofpdf.Fpdf, *[]string) {
+	pdf := gofpdf.New("P", "pt", "A4", r.fontsDir)
+	pdf.AddUTF8Font(pdfFont, "", "DejaVuSansMono.ttf")
+	pdf.AddUTF8Font(pdfFont, "B", "DejaVuSansMono-Bold.ttf")
+	pdf.SetMargins(pdfMarginLeft, pdfMarginTop, pdfMarginRight)
+	pdf.SetAutoPageBreak(true, pdfMarginBottom)
+
+	// The header of the page being drawn, set it before adding a page.
+	header := new([]string)
+	pdf.SetHeaderFunc(func() {
+		pdf.SetY(pdfMarginHeader)
+		r.drawHeader(pdf, *header)
+	})
+
+	return pdf, header
+}
+
+func output(pdf *gofpdf.Fpdf) (io.Reader, error) {
+	var buf bytes.Buffer
+	err := pdf.Output(&buf)
+	if err != nil {
+		return nil, err
+	}
+
+	return &buf, nil
+}
+
+func (r *PDFRenderer) drawHeader(pdf *gofpdf.Fpdf, lines []string) {
+	for i, line := range lines {
+		switch i {
+		case 0:
+			r.drawLine(pdf, line, 20, "C", true)
+		case 1:
+			r.drawLine(pdf, line, pdfBodyFontSize, "R", true)
+		case 2:
+			r.drawLine(pdf, line, 11, "C", true)
+		default:
+			r.drawLine(pdf, line, pdfBodyFontSize, "L", false)
+		}
+	}
+	pdf.Ln(pdfBodyFontSize / 2)
+}
+
+func (r *PDFRenderer) drawBody(pdf *gofpdf.Fpdf, lines []string) {
+	// Chords are aligned by spaces, so long lines must not wrap: the font is made smaller instead.
+	width, _ := pdf.GetPageSize()
+	width -= pdfMarginLeft + pdfMarginRight
+
+	fontSize := float64(pdfBodyFontSize)
+	pdf.SetFont(pdfFont, "", fontSize)
+	for _, line := range lines {
+		if lineWidth := pdf.GetStringWidth(line); lineWidth > width {
+			if size := fontSize * width / lineWidth; size < fontSize {
+				fontSize = size
+			}
+		}
+	}
+
+	for _, line := range lines {
+		r.drawLine(pdf, line, fontSize, "L", false)
+	}
+}
+
+// drawTOCLine writes the name on the left and the page on the right, both linking to the page.
+func (r *PDFRenderer) drawTOCLine(pdf *gofpdf.Fpdf, name string, page string, link int) {
+	lineHeight := pdfBodyFontSize * pdfLineSpacing * 1.5
+	pageWidth, _ := pdf.GetPageSize()
+	width := pageWidth - pdfMarginLeft - pdfMarginRight
+
+	pdf.SetFont(pdfFont, "", pdfBodyFontSize)
+	pdf.SetTextColor(pdfBlack[0], pdfBlack[1], pdfBlack[2])
+
+	pageNumberWidth := pdf.GetStringWidth(page) + pdfBodyFontSize
+	for len([]rune(name)) > 1 && pdf.GetStringWidth(name) > width-pageNumberWidth {
+		name = string([]rune(name)[:len([]rune(name))-2]) + "…"
+	}
+
+	pdf.CellFormat(width-pageNumberWidth, lineHeight, name, "", 0, "L", false, link, "")
+	pdf.CellFormat(pageNumberWidth, lineHeight, page, "", 1, "R", false, link, "")
+}
+
+// drawLine writes the line run by run, every run with its own style.
+func (r *PDFRenderer) drawLine(pdf *gofpdf.Fpdf, line string, fontSize float64, align string, bold bool) {
+	runes, styles := styleLine(line, bold)
+	lineHeight := fontSize * pdfLineSpacing
+
+	pdf.SetFont(pdfFont, "", fontSize)
+	pageWidth, _ := pdf.GetPageSize()
+	width := pageWidth - pdfMarginLeft - pdfMarginRight
+	lineWidth := pdf.GetStringWidth(string(runes))
+
+	x := float64(pdfMarginLeft)
+	switch align {
+	case "C":
+		x += (width - lineWidth) / 2
+	case "R":
+		x += width - lineWidth
+	}
+	if x < pdfMarginLeft {
+		x = pdfMarginLeft
+	}
+
+	// Start a new page before the line, not in the middle of it.
+	_, pageHeight := pdf.GetPageSize()
+	if pdf.GetY()+lineHeight > pageHeight-pdfMarginBottom {
+		pdf.AddPage()
+	}
+	y := pdf.GetY()
+
+	for start := 0; start < len(runes); {
+		end := start + 1
+		for end < len(runes) && styles[end] == styles[start] {
+			end++
+		}
+
+		text := string(runes[start:end])
+		if styles[start].bold {
+			pdf.SetFont(pdfFont, "B", fontSize)
+		} else {
+			pdf.SetFont(pdfFont, "", fontSize)
+		}
+		pdf.SetTextColor(styles[start].color[0], styles[start].color[1], styles[start].color[2])
+
+		runWidth := pdf.GetStringWidth(text)
+		pdf.SetXY(x, y)
+		pdf.CellFormat(runWidth, lineHeight, text, "", 0, "L", false, 0, "")
+		x += runWidth
+
+		start = end
+	}
+
+	pdf.SetXY(pdfMarginLeft, y+lineHeight)
+}
+
+// styleLine applies the StyleOne rules to a line, returning its runes (section names are upper cased) and their styles.
+func styleLine(line string, bold bool) ([]rune, []pdfStyle) {
+	runes := []rune(line)
+	styles := make([]pdfStyle, len(runes))
+	for i := range styles {
+		styles[i] = pdfStyle{bold: bold, color: pdfBlack}
+	}
+
+	setStyle := func(start int, end int, style pdfStyle) {
+		for i := start; i < end && i < len(styles); i++ {
+			styles[i] = style
+		}
+	}
+
+	for _, token := range tokenizeLine(line) {
+		if token.Chord != nil {
+			setStyle(int(token.Offset), int(token.Offset)+len([]rune(token.Chord.String())), pdfStyle{bold: true, color: pdfRed})
+		}
+	}
+
+	for _, rule := range []struct {
+		re    *regexp.Regexp
+		style pdfStyle
+	}{
+		{regexp.MustCompile(`[|]`), pdfStyle{bold: true, color: pdfBlack}},
+		{regexp.MustCompile(`(x|х)\d+`), pdfStyle{bold: true, color: pdfRed}},
+		{regexp.MustCompile(`\p{L}+(\s\d*)?:`), pdfStyle{bold: true, color: pdfBlack}},
+	} {
+		for _, match := range rule.re.FindAllStringIndex(line, -1) {
+			setStyle(len([]rune(line[:match[0]])), len([]rune(line[:match[1]])), rule.style)
+		}
+	}
+
+	sectionNamesRegex := regexp.MustCompile(`\p{L}+(\s\d*)?:`)
+	upper := []rune(sectionNamesRegex.ReplaceAllStringFunc(line, strings.ToUpper))
+	if len(upper) == len(runes) {
+		runes = upper
+	}
+
+	return runes, styles
+}
+
+func splitLines(text string) []string {
+	text = strings.TrimRight(strings.ReplaceAll(text, "\r\n", "\n"), "\n")
+	if text == "" {
+		return nil
+	}
+	return strings.Split(text, "\n")
+}
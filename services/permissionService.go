@@ -0,0 +1,131 @@
+package services
+
+import (
+	"errors"
+	"github.com/joeyave/scala-chords-bot/entities"
+	"github.com/joeyave/scala-chords-bot/helpers"
+	"github.com/joeyave/scala-chords-bot/repositories"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// DefaultPermissions are permissions of members who aren't in a permission group.
+var DefaultPermissions = []entities.Permission{entities.EditSongs, entities.UploadVoices}
+
+var ErrForbidden = errors.New("user doesn't have the permission")
+
+// PermissionService resolves permissions of users in bands. Admins have all permissions,
+// other members have ones of their permission group or the default ones.
+//
+// Services that change band data take the acting user and check it here. The bot itself,
+// like the series generator or reminders, acts as a nil user and may do anything.
+type PermissionService struct {
+	permissionGroupRepository repositories.PermissionGroupRepository
+	eventRepository           repositories.EventRepository
+}
+
+func NewPermissionService(permissionGroupRepository repositories.PermissionGroupRepository, eventRepository repositories.EventRepository) *PermissionService {
+	return &PermissionService{
+		permissionGroupRepository: permissionGroupRepository,
+		eventRepository:           eventRepository,
+	}
+}
+
+// Permissions returns permissions of the user in the band. Users outside of the band have none.
+func (s *PermissionService) Permissions(user *entities.User, bandID primitive.ObjectID) []entities.Permission {
+	userBand := user.UserBand(bandID)
+	if userBand == nil {
+		return []entities.Permission{}
+	}
+
+	if s.IsAdmin(user, bandID) {
+		return entities.Permissions
+	}
+
+	if userBand.PermissionGroupID != primitive.NilObjectID {
+		group, err := s.permissionGroupRepository.FindOneByID(userBand.PermissionGroupID)
+		// The group could have been deleted, then the member falls back to the defaults.
+		if err == nil && group.BandID == bandID {
+			return group.Permissions
+		}
+	}
+
+	return DefaultPermissions
+}
+
+// IsAdmin reports whether the user is an admin of the band. Admins have all permissions and only they make admins.
+func (s *PermissionService) IsAdmin(user *entities.User, bandID primitive.ObjectID) bool {
+	return user.RoleIn(bandID) == helpers.Admin
+}
+
+// Load sets permissions of the user in the current band, unless they are already loaded.
+func (s *PermissionService) Load(user *entities.User) {
+	if user.Permissions == nil {
+		user.Permissions = s.Permissions(user, user.BandID)
+	}
+}
+
+// Can reports whether the user has the permission in the band.
+func (s *PermissionService) Can(user *entities.User, bandID primitive.ObjectID, permission entities.Permission) bool {
+	for _, p := range s.Permissions(user, bandID) {
+		if p == permission {
+			return true
+		}
+	}
+	return false
+}
+
+// Check returns ErrForbidden if the user doesn't have the permission in the band.
+func (s *PermissionService) Check(user *entities.User, bandID primitive.ObjectID, permission entities.Permission) error {
+	if user == nil {
+		return nil
+	}
+
+	if !s.Can(user, bandID, permission) {
+		return ErrForbidden
+	}
+	return nil
+}
+
+// CheckEvent returns ErrForbidden if the user can't change the event. Besides those who manage events,
+// members of the event may change its setlist when memberAllowed is true.
+func (s *PermissionService) CheckEvent(user *entities.User, eventID primitive.ObjectID, memberAllowed bool) error {
+	if user == nil {
+		return nil
+	}
+
+	event, err := s.eventRepository.FindOneByID(eventID)
+	if err != nil {
+		return err
+	}
+
+	if s.Can(user, event.BandID, entities.ManageEvents) {
+		return nil
+	}
+
+	if memberAllowed && user.UserBand(event.BandID) != nil {
+		for _, membership := range event.Memberships {
+			if membership.UserID == user.ID {
+				return nil
+			}
+		}
+	}
+
+	return ErrForbidden
+}
+
+func (s *PermissionService) FindManyGroupsByBandID(bandID primitive.ObjectID) ([]*entities.PermissionGroup, error) {
+	return s.permissionGroupRepository.FindManyByBandID(bandID)
+}
+
+func (s *PermissionService) FindOneGroupByID(ID primitive.ObjectID) (*entities.PermissionGroup, error) {
+	return s.permissionGroupRepository.FindOneByID(ID)
+}
+
+func (s *PermissionService) UpdateOneGroup(group entities.PermissionGroup) (*entities.PermissionGroup, error) {
+	return s.permissionGroupRepository.UpdateOne(group)
+}
+
+// DeleteOneGroupByID deletes the group, its members get the default permissions.
+func (s *PermissionService) DeleteOneGroupByID(ID primitive.ObjectID) error {
+	return s.permissionGroupRepository.DeleteOneByID(ID)
+}
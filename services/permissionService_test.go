@@ -0,0 +1,100 @@
+package services
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/joeyave/scala-chords-bot/entities"
+	"github.com/joeyave/scala-chords-bot/helpers"
+	"github.com/joeyave/scala-chords-bot/repositories"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+func TestServicesCheckActor(t *testing.T) {
+	store := repositories.NewMemoryStore()
+	eventRepository := repositories.NewEventMemoryRepository(store)
+	userRepository := repositories.NewUserMemoryRepository(store)
+	membershipRepository := repositories.NewMembershipMemoryRepository(store)
+	templateRepository := repositories.NewEventTemplateMemoryRepository(store)
+	songRepository := repositories.NewSongMemoryRepository(store)
+	bandRepository := repositories.NewBandMemoryRepository(store)
+
+	permissionService := NewPermissionService(repositories.NewPermissionGroupMemoryRepository(store), eventRepository)
+	eventService := NewEventService(eventRepository, userRepository, membershipRepository, nil, permissionService)
+	membershipService := NewMembershipService(membershipRepository, permissionService)
+	templateService := NewEventTemplateService(templateRepository, eventRepository, membershipRepository, permissionService)
+	rotaService := NewRotaService(eventRepository, userRepository, membershipRepository, permissionService)
+	songService := NewSongService(songRepository, nil, bandRepository, nil, nil, permissionService)
+
+	band, err := bandRepository.UpdateOne(entities.Band{Name: "Band"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	admin := &entities.User{ID: 1, BandID: band.ID, Role: helpers.Admin}
+	member := &entities.User{ID: 2, BandID: band.ID}
+	stranger := &entities.User{ID: 3, BandID: primitive.NewObjectID()}
+
+	event, err := eventService.UpdateOne(admin, entities.Event{Name: "Sunday", Time: time.Now().Add(24 * time.Hour), BandID: band.ID})
+	if err != nil {
+		t.Fatal(err)
+	}
+	membership, err := membershipService.UpdateOne(admin, entities.Membership{EventID: event.ID, UserID: member.ID})
+	if err != nil {
+		t.Fatal(err)
+	}
+	song, err := songRepository.UpdateOne(entities.Song{DriveFileID: "doc", BandID: band.ID})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	cases := []struct {
+		name string
+		call func() error
+		// nil if the call is allowed.
+		want error
+	}{
+		{"member changes the event", func() error {
+			_, err := eventService.UpdateOne(member, *event)
+			return err
+		}, ErrForbidden},
+		{"member deletes the event", func() error { return eventService.DeleteOneByID(member, event.ID) }, ErrForbidden},
+		{"member of the event changes its setlist", func() error {
+			_, err := eventService.UpdateSetlistEntry(member, event.ID, entities.SetlistEntry{SongID: song.ID, Key: "D"})
+			return err
+		}, nil},
+		{"stranger changes the setlist", func() error { return eventService.PushSongID(stranger, event.ID, song.ID) }, ErrForbidden},
+		{"member adds a member", func() error {
+			_, err := membershipService.UpdateOne(member, entities.Membership{EventID: event.ID, UserID: admin.ID})
+			return err
+		}, ErrForbidden},
+		{"member removes a member", func() error { return membershipService.DeleteOneByID(member, membership.ID) }, ErrForbidden},
+		{"admin answers for the member", func() error {
+			_, err := membershipService.UpdateStatus(admin, membership.ID, entities.Declined)
+			return err
+		}, ErrForbidden},
+		{"member answers", func() error {
+			_, err := membershipService.UpdateStatus(member, membership.ID, entities.Accepted)
+			return err
+		}, nil},
+		{"member creates a series", func() error {
+			_, err := templateService.UpdateOne(member, entities.EventTemplate{Name: "Series", BandID: band.ID})
+			return err
+		}, ErrForbidden},
+		{"member applies a rota", func() error {
+			return rotaService.Apply(member, []*RotaSlot{{Event: event, Role: &entities.Role{ID: primitive.NewObjectID()}, User: member}})
+		}, ErrForbidden},
+		{"member deletes a song", func() error { return songService.DeleteOneByDriveFileID(member, song.DriveFileID) }, ErrForbidden},
+		{"API token deletes the event", func() error {
+			return eventService.DeleteOneByID(NewAPITokenService("secret", bandRepository).Actor(band), event.ID)
+		}, nil},
+	}
+
+	for _, c := range cases {
+		err := c.call()
+		if c.want == nil && err != nil || c.want != nil && !errors.Is(err, c.want) {
+			t.Errorf("%s: got %v, want %v", c.name, err, c.want)
+		}
+	}
+}
@@ -7,10 +7,10 @@ import (
 )
 
 type RoleService struct {
-	roleRepository *repositories.RoleRepository
+	roleRepository repositories.RoleRepository
 }
 
-func NewRoleService(roleRepository *repositories.RoleRepository) *RoleService {
+func NewRoleService(roleRepository repositories.RoleRepository) *RoleService {
 	return &RoleService{
 		roleRepository: roleRepository,
 	}
@@ -0,0 +1,226 @@
+package services
+
+import (
+	"fmt"
+	"github.com/joeyave/scala-chords-bot/entities"
+	"github.com/joeyave/scala-chords-bot/repositories"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"hash/fnv"
+	"sort"
+	"time"
+)
+
+// RotaService fills empty role slots of the band events.
+type RotaService struct {
+	eventRepository      repositories.EventRepository
+	userRepository       repositories.UserRepository
+	membershipRepository repositories.MembershipRepository
+	permissionService    *PermissionService
+}
+
+func NewRotaService(eventRepository repositories.EventRepository, userRepository repositories.UserRepository, membershipRepository repositories.MembershipRepository, permissionService *PermissionService) *RotaService {
+	return &RotaService{
+		eventRepository:      eventRepository,
+		userRepository:       userRepository,
+		membershipRepository: membershipRepository,
+		permissionService:    permissionService,
+	}
+}
+
+// RotaSlot is an empty role of the event with the member proposed for it. User is nil if nobody can serve.
+type RotaSlot struct {
+	Event *entities.Event
+	Role  *entities.Role
+	User  *entities.User
+
+	// The member served the week before or is going to serve the week after.
+	BackToBack bool
+}
+
+// Generate proposes members for the empty roles of the band events from the first day to the last one.
+// Members who already served in the role go first, and those who served in it less go first among them.
+// Other members of the band are proposed only if none of them can serve. Nobody is proposed
+// on their blackout dates and, if possible, two weeks in a row.
+func (s *RotaService) Generate(bandID primitive.ObjectID, roles []*entities.Role, from time.Time, to time.Time) ([]*RotaSlot, error) {
+	events, err := s.eventRepository.FindManyFromTodayByBandID(bandID)
+	if err != nil {
+		return nil, err
+	}
+
+	lastDay := time.Date(to.Year(), to.Month(), to.Day(), 0, 0, 0, 0, to.Location()).AddDate(0, 0, 1)
+
+	usersExtra, err := s.userRepository.FindManyExtraByBandID(bandID)
+	if err != nil {
+		return nil, err
+	}
+
+	weeks := make(map[int64]map[int64]bool)
+	serveWeek := func(userID int64, t time.Time) {
+		if weeks[userID] == nil {
+			weeks[userID] = make(map[int64]bool)
+		}
+		weeks[userID][weekIndex(t)] = true
+	}
+
+	for _, userExtra := range usersExtra {
+		for _, event := range userExtra.Events {
+			serveWeek(userExtra.User.ID, event.Time)
+		}
+	}
+
+	// Load and the last time are counted in each role separately.
+	load := make(map[primitive.ObjectID]map[int64]int)
+	lastTime := make(map[primitive.ObjectID]map[int64]time.Time)
+	serve := func(roleID primitive.ObjectID, userID int64, t time.Time) {
+		load[roleID][userID]++
+		if t.After(lastTime[roleID][userID]) {
+			lastTime[roleID][userID] = t
+		}
+	}
+
+	regulars := make(map[primitive.ObjectID][]*entities.User)
+	others := make(map[primitive.ObjectID][]*entities.User)
+	for _, role := range roles {
+		load[role.ID] = make(map[int64]int)
+		lastTime[role.ID] = make(map[int64]time.Time)
+
+		roleUsersExtra, err := s.userRepository.FindManyExtraByBandIDAndRoleID(bandID, role.ID)
+		if err != nil {
+			continue
+		}
+
+		for _, userExtra := range roleUsersExtra {
+			if len(userExtra.Events) == 0 {
+				others[role.ID] = append(others[role.ID], userExtra.User)
+				continue
+			}
+
+			regulars[role.ID] = append(regulars[role.ID], userExtra.User)
+			for _, event := range userExtra.Events {
+				serve(role.ID, userExtra.User.ID, event.Time)
+			}
+		}
+	}
+
+	slots := make([]*RotaSlot, 0)
+	for _, event := range events {
+		if event.Time.Before(from) || !event.Time.Before(lastDay) {
+			continue
+		}
+
+		atEvent := make(map[int64]bool)
+		filled := make(map[primitive.ObjectID]bool)
+		for _, membership := range event.Memberships {
+			atEvent[membership.UserID] = true
+			filled[membership.RoleID] = true
+		}
+
+		week := weekIndex(event.Time)
+
+		for _, role := range roles {
+			if filled[role.ID] {
+				continue
+			}
+
+			pick := func(users []*entities.User) (*entities.User, bool) {
+				var free, backToBack []*entities.User
+				for _, user := range users {
+					if atEvent[user.ID] || user.BlackoutOn(event.Time) != nil {
+						continue
+					}
+
+					if weeks[user.ID][week-1] || weeks[user.ID][week+1] {
+						backToBack = append(backToBack, user)
+					} else {
+						free = append(free, user)
+					}
+				}
+
+				isBackToBack := len(free) == 0 && len(backToBack) > 0
+				if isBackToBack {
+					free = backToBack
+				}
+
+				roleLoad, roleLastTime := load[role.ID], lastTime[role.ID]
+				sort.SliceStable(free, func(i, j int) bool {
+					if roleLoad[free[i].ID] != roleLoad[free[j].ID] {
+						return roleLoad[free[i].ID] < roleLoad[free[j].ID]
+					}
+					if !roleLastTime[free[i].ID].Equal(roleLastTime[free[j].ID]) {
+						return roleLastTime[free[i].ID].Before(roleLastTime[free[j].ID])
+					}
+					return free[i].ID < free[j].ID
+				})
+
+				if len(free) == 0 {
+					return nil, false
+				}
+				return free[0], isBackToBack
+			}
+
+			slot := &RotaSlot{Event: event, Role: role}
+			slot.User, slot.BackToBack = pick(regulars[role.ID])
+			if slot.User == nil {
+				slot.User, slot.BackToBack = pick(others[role.ID])
+			}
+
+			if slot.User != nil {
+				atEvent[slot.User.ID] = true
+				serveWeek(slot.User.ID, event.Time)
+				serve(role.ID, slot.User.ID, event.Time)
+			}
+
+			slots = append(slots, slot)
+		}
+	}
+
+	return slots, nil
+}
+
+// Apply adds the proposed members to the events. The actor needs the permission to manage events of every band,
+// nothing is applied otherwise.
+func (s *RotaService) Apply(actor *entities.User, slots []*RotaSlot) error {
+	for _, slot := range slots {
+		err := s.permissionService.Check(actor, slot.Event.BandID, entities.ManageEvents)
+		if err != nil {
+			return err
+		}
+	}
+
+	for _, slot := range slots {
+		if slot.User == nil {
+			continue
+		}
+
+		_, err := s.membershipRepository.UpdateOne(entities.Membership{
+			EventID: slot.Event.ID,
+			UserID:  slot.User.ID,
+			RoleID:  slot.Role.ID,
+		})
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// RotaHash identifies the draft, so it can be checked that the approved draft is the one that is applied.
+func RotaHash(slots []*RotaSlot) string {
+	h := fnv.New32a()
+	for _, slot := range slots {
+		var userID int64
+		if slot.User != nil {
+			userID = slot.User.ID
+		}
+		fmt.Fprintf(h, "%s:%s:%d;", slot.Event.ID.Hex(), slot.Role.ID.Hex(), userID)
+	}
+	return fmt.Sprintf("%x", h.Sum32())
+}
+
+// weekIndex returns the number of the week of t counting from Monday.
+func weekIndex(t time.Time) int64 {
+	t = t.Local()
+	monday := time.Date(t.Year(), t.Month(), t.Day()-(int(t.Weekday())+6)%7, 0, 0, 0, 0, time.UTC)
+	return monday.Unix() / (7 * 24 * 60 * 60)
+}
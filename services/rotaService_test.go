@@ -0,0 +1,185 @@
+package services
+
+import (
+	"testing"
+	"time"
+
+	"github.com/joeyave/scala-chords-bot/entities"
+	"github.com/joeyave/scala-chords-bot/repositories"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+func TestRotaGenerate(t *testing.T) {
+	const (
+		ann int64 = 1
+		bob int64 = 2
+	)
+
+	// Events are on Sundays of the weeks counted from a Monday far enough from today.
+	now := time.Now()
+	monday := time.Date(now.Year(), now.Month(), now.Day()-(int(now.Weekday())+6)%7, 0, 0, 0, 0, time.Local).AddDate(0, 0, 7*4)
+	sunday := func(week int) time.Time {
+		return monday.AddDate(0, 0, 7*week+6).Add(10 * time.Hour)
+	}
+
+	cases := []struct {
+		name string
+		// users of the band with the weeks they served in the role.
+		served map[int64][]int
+		// weeks users served in another role.
+		servedOther map[int64][]int
+		blackouts   map[int64][]int
+		// weeks of events with the empty role.
+		events         []int
+		want           []int64
+		wantBackToBack []bool
+	}{
+		{
+			name:           "new band",
+			served:         map[int64][]int{ann: nil, bob: nil},
+			events:         []int{2, 4},
+			want:           []int64{ann, bob},
+			wantBackToBack: []bool{false, false},
+		},
+		{
+			name:           "member who served in the role goes first",
+			served:         map[int64][]int{ann: {6, 8, 10}, bob: nil},
+			events:         []int{2},
+			want:           []int64{ann},
+			wantBackToBack: []bool{false},
+		},
+		{
+			name:           "new member if nobody who served can",
+			served:         map[int64][]int{ann: {6}, bob: nil},
+			blackouts:      map[int64][]int{ann: {2}},
+			events:         []int{2},
+			want:           []int64{bob},
+			wantBackToBack: []bool{false},
+		},
+		{
+			name:           "load is counted in the role",
+			served:         map[int64][]int{ann: {6}, bob: {14, 16}},
+			servedOther:    map[int64][]int{ann: {8, 10, 12}},
+			events:         []int{2},
+			want:           []int64{ann},
+			wantBackToBack: []bool{false},
+		},
+		{
+			name:           "member who served only in another role is not proposed",
+			served:         map[int64][]int{ann: {6, 8}, bob: nil},
+			servedOther:    map[int64][]int{bob: {10}},
+			events:         []int{2},
+			want:           []int64{ann},
+			wantBackToBack: []bool{false},
+		},
+		{
+			name:           "who served less goes first",
+			served:         map[int64][]int{ann: {6, 8}, bob: {10}},
+			events:         []int{2},
+			want:           []int64{bob},
+			wantBackToBack: []bool{false},
+		},
+		{
+			name:           "nobody on blackout dates",
+			served:         map[int64][]int{ann: {6, 8}, bob: {10}},
+			blackouts:      map[int64][]int{bob: {2}},
+			events:         []int{2},
+			want:           []int64{ann},
+			wantBackToBack: []bool{false},
+		},
+		{
+			name:           "nobody can serve",
+			served:         map[int64][]int{ann: nil, bob: nil},
+			blackouts:      map[int64][]int{ann: {2}, bob: {2}},
+			events:         []int{2},
+			want:           []int64{0},
+			wantBackToBack: []bool{false},
+		},
+		{
+			name:           "no back to back",
+			served:         map[int64][]int{ann: {1}, bob: {6, 8}},
+			events:         []int{2},
+			want:           []int64{bob},
+			wantBackToBack: []bool{false},
+		},
+		{
+			name:           "back to back if nobody else can",
+			served:         map[int64][]int{ann: {1}},
+			events:         []int{2},
+			want:           []int64{ann},
+			wantBackToBack: []bool{true},
+		},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			store := repositories.NewMemoryStore()
+			eventRepository := repositories.NewEventMemoryRepository(store)
+			userRepository := repositories.NewUserMemoryRepository(store)
+			membershipRepository := repositories.NewMembershipMemoryRepository(store)
+			service := NewRotaService(eventRepository, userRepository, membershipRepository, NewPermissionService(repositories.NewPermissionGroupMemoryRepository(store), eventRepository))
+
+			band, err := repositories.NewBandMemoryRepository(store).UpdateOne(entities.Band{Name: "Band"})
+			if err != nil {
+				t.Fatal(err)
+			}
+			role := &entities.Role{ID: primitive.NewObjectID(), Name: "Guitar", BandID: band.ID}
+			otherRole := &entities.Role{ID: primitive.NewObjectID(), Name: "Drums", BandID: band.ID}
+
+			serve := func(userID int64, roleID primitive.ObjectID, week int) {
+				event, err := eventRepository.UpdateOne(entities.Event{Name: "Served", Time: sunday(week), BandID: band.ID})
+				if err != nil {
+					t.Fatal(err)
+				}
+				_, err = membershipRepository.UpdateOne(entities.Membership{EventID: event.ID, UserID: userID, RoleID: roleID})
+				if err != nil {
+					t.Fatal(err)
+				}
+			}
+
+			for userID, weeks := range c.served {
+				user := entities.User{ID: userID, BandID: band.ID}
+				for _, week := range c.blackouts[userID] {
+					user.Blackouts = append(user.Blackouts, &entities.Blackout{From: sunday(week), To: sunday(week)})
+				}
+				_, err := userRepository.UpdateOne(user)
+				if err != nil {
+					t.Fatal(err)
+				}
+
+				for _, week := range weeks {
+					serve(userID, role.ID, week)
+				}
+				for _, week := range c.servedOther[userID] {
+					serve(userID, otherRole.ID, week)
+				}
+			}
+
+			for _, week := range c.events {
+				_, err := eventRepository.UpdateOne(entities.Event{Name: "Empty", Time: sunday(week), BandID: band.ID})
+				if err != nil {
+					t.Fatal(err)
+				}
+			}
+
+			slots, err := service.Generate(band.ID, []*entities.Role{role}, sunday(c.events[0]), sunday(c.events[len(c.events)-1]))
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if len(slots) != len(c.want) {
+				t.Fatalf("got %d slots, want %d", len(slots), len(c.want))
+			}
+			for i, slot := range slots {
+				var userID int64
+				if slot.User != nil {
+					userID = slot.User.ID
+				}
+				if userID != c.want[i] || slot.BackToBack != c.wantBackToBack[i] {
+					t.Errorf("slot %d is user %d, back to back %t, want user %d, back to back %t",
+						i, userID, slot.BackToBack, c.want[i], c.wantBackToBack[i])
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,24 @@
+package services
+
+import (
+	"google.golang.org/api/drive/v3"
+	"io"
+)
+
+// SongDocumentStore is a backend that keeps song documents.
+// GoogleDocumentStore keeps them as Google Docs, LocalDocumentStore as plain files on disk.
+// Documents are described by *drive.File regardless of the backend, so the rest of the bot doesn't care where songs live.
+type SongDocumentStore interface {
+	FindAllByFolderID(folderID string, nextPageToken string) ([]*drive.File, string, error)
+	FindSomeByFullTextAndFolderID(name string, folderID string, pageToken string) ([]*drive.File, string, error)
+	FindOneByNameAndFolderID(name string, folderID string) (*drive.File, error)
+	FindOneByID(ID string) (*drive.File, error)
+	CreateOne(newFile *drive.File, lyrics string, key string, BPM string, time string) (*drive.File, error)
+	CloneOne(fileToCloneID string, newFile *drive.File) (*drive.File, error)
+	DeleteOneByID(ID string) error
+	// Export returns the document in the given format: "text/plain" or "application/pdf".
+	Export(ID string, mimeType string) (io.Reader, error)
+	TransposeOne(ID string, toKey string, sectionIndex int) (*drive.File, error)
+	StyleOne(ID string) (*drive.File, error)
+	GetSectionsNumber(ID string) (int, error)
+}
@@ -1,6 +1,7 @@
 package services
 
 import (
+	"fmt"
 	"github.com/joeyave/scala-chords-bot/entities"
 	"github.com/joeyave/scala-chords-bot/repositories"
 	"github.com/kjk/notionapi"
@@ -11,23 +12,23 @@ import (
 )
 
 type SongService struct {
-	songRepository   *repositories.SongRepository
-	voiceRepository  *repositories.VoiceRepository
-	bandRepository   *repositories.BandRepository
-	driveRepository  *drive.Service
-	notionClient     *notionapi.Client
-	driveFileService *DriveFileService
+	songRepository    repositories.SongRepository
+	voiceRepository   repositories.VoiceRepository
+	bandRepository    repositories.BandRepository
+	notionClient      *notionapi.Client
+	driveFileService  *DriveFileService
+	permissionService *PermissionService
 }
 
-func NewSongService(songRepository *repositories.SongRepository, voiceRepository *repositories.VoiceRepository, bandRepository *repositories.BandRepository,
-	driveClient *drive.Service, notionClient *notionapi.Client, driveFileService *DriveFileService) *SongService {
+func NewSongService(songRepository repositories.SongRepository, voiceRepository repositories.VoiceRepository, bandRepository repositories.BandRepository,
+	notionClient *notionapi.Client, driveFileService *DriveFileService, permissionService *PermissionService) *SongService {
 	return &SongService{
-		songRepository:   songRepository,
-		voiceRepository:  voiceRepository,
-		bandRepository:   bandRepository,
-		driveRepository:  driveClient,
-		notionClient:     notionClient,
-		driveFileService: driveFileService,
+		songRepository:    songRepository,
+		voiceRepository:   voiceRepository,
+		bandRepository:    bandRepository,
+		notionClient:      notionClient,
+		driveFileService:  driveFileService,
+		permissionService: permissionService,
 	}
 }
 
@@ -39,6 +40,10 @@ func (s *SongService) FindOneByID(ID primitive.ObjectID) (*entities.Song, error)
 	return s.songRepository.FindOneByID(ID)
 }
 
+func (s *SongService) FindManyByBandID(bandID primitive.ObjectID) ([]*entities.Song, error) {
+	return s.songRepository.FindManyByBandID(bandID)
+}
+
 func (s *SongService) FindOneByDriveFileID(driveFileID string) (*entities.Song, error) {
 	return s.songRepository.FindOneByDriveFileID(driveFileID)
 }
@@ -48,7 +53,7 @@ func (s *SongService) FindOneByName(driveFileID string) (*entities.Song, error)
 }
 
 func (s *SongService) FindOrCreateOneByDriveFileID(driveFileID string) (*entities.Song, *drive.File, error) {
-	driveFile, err := s.driveRepository.Files.Get(driveFileID).Fields("id, name, modifiedTime, webViewLink, parents").Do()
+	driveFile, err := s.driveFileService.FindOneByID(driveFileID)
 
 	song, err := s.songRepository.FindOneByDriveFileID(driveFileID)
 	if err != nil {
@@ -106,8 +111,44 @@ func (s *SongService) UpdateOne(song entities.Song) (*entities.Song, error) {
 	return s.songRepository.UpdateOne(song)
 }
 
-func (s *SongService) DeleteOneByDriveFileID(driveFileID string) error {
-	err := s.driveRepository.Files.Delete(driveFileID).Do()
+// FindTransposedPDF returns the cached PDF of the song in the key if the doc hasn't been modified since it was made.
+func (s *SongService) FindTransposedPDF(song *entities.Song, key string, driveFile *drive.File) (*entities.TransposedPDF, error) {
+	for _, transposedPDF := range song.PDF.Transposed {
+		if transposedPDF.Key == key && transposedPDF.ModifiedTime == driveFile.ModifiedTime && transposedPDF.Version == driveFile.Version &&
+			transposedPDF.TgFileID != "" {
+			return &transposedPDF, nil
+		}
+	}
+
+	return nil, fmt.Errorf("no PDF in %s", key)
+}
+
+// UpdateTransposedPDF caches the PDF of the song in the key, PDFs made before the doc was modified are dropped.
+func (s *SongService) UpdateTransposedPDF(song *entities.Song, transposedPDF entities.TransposedPDF) (*entities.Song, error) {
+	transposed := []entities.TransposedPDF{transposedPDF}
+	for _, t := range song.PDF.Transposed {
+		if t.Key != transposedPDF.Key && t.ModifiedTime == transposedPDF.ModifiedTime && t.Version == transposedPDF.Version {
+			transposed = append(transposed, t)
+		}
+	}
+	song.PDF.Transposed = transposed
+
+	return s.songRepository.UpdateOne(*song)
+}
+
+// DeleteOneByDriveFileID deletes the song with its doc. The actor needs the permission to delete songs of the band.
+func (s *SongService) DeleteOneByDriveFileID(actor *entities.User, driveFileID string) error {
+	song, err := s.songRepository.FindOneByDriveFileID(driveFileID)
+	if err != nil {
+		return err
+	}
+
+	err = s.permissionService.Check(actor, song.BandID, entities.DeleteSongs)
+	if err != nil {
+		return err
+	}
+
+	err = s.driveFileService.DeleteOneByID(driveFileID)
 	if err != nil {
 		return err
 	}
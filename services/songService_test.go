@@ -0,0 +1,34 @@
+package services
+
+import (
+	"testing"
+
+	"github.com/joeyave/scala-chords-bot/entities"
+	"google.golang.org/api/drive/v3"
+)
+
+func TestFindTransposedPDF(t *testing.T) {
+	service := &SongService{}
+
+	song := &entities.Song{}
+	song.PDF.Transposed = []entities.TransposedPDF{{Key: "D", ModifiedTime: "2021-01-01T00:00:00Z", Version: 3, TgFileID: "file"}}
+
+	cases := []struct {
+		name      string
+		key       string
+		driveFile *drive.File
+		found     bool
+	}{
+		{"same version", "D", &drive.File{ModifiedTime: "2021-01-01T00:00:00Z", Version: 3}, true},
+		{"another key", "E", &drive.File{ModifiedTime: "2021-01-01T00:00:00Z", Version: 3}, false},
+		{"edited in the same second", "D", &drive.File{ModifiedTime: "2021-01-01T00:00:00Z", Version: 4}, false},
+		{"edited later", "D", &drive.File{ModifiedTime: "2021-01-01T00:00:01Z", Version: 3}, false},
+	}
+
+	for _, c := range cases {
+		_, err := service.FindTransposedPDF(song, c.key, c.driveFile)
+		if (err == nil) != c.found {
+			t.Errorf("%s: FindTransposedPDF error is %v, want found %t", c.name, err, c.found)
+		}
+	}
+}
@@ -8,10 +8,10 @@ import (
 )
 
 type UserService struct {
-	userRepository *repositories.UserRepository
+	userRepository repositories.UserRepository
 }
 
-func NewUserService(userRepository *repositories.UserRepository) *UserService {
+func NewUserService(userRepository repositories.UserRepository) *UserService {
 	return &UserService{
 		userRepository: userRepository,
 	}
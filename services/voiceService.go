@@ -8,11 +8,11 @@ import (
 )
 
 type VoiceService struct {
-	voiceRepository *repositories.VoiceRepository
+	voiceRepository repositories.VoiceRepository
 	notionClient    *notionapi.Client
 }
 
-func NewVoiceService(voiceRepository *repositories.VoiceRepository) *VoiceService {
+func NewVoiceService(voiceRepository repositories.VoiceRepository) *VoiceService {
 	return &VoiceService{
 		voiceRepository: voiceRepository,
 	}
@@ -0,0 +1,152 @@
+package simulator
+
+import (
+	"encoding/json"
+	"fmt"
+	"github.com/joeyave/telebot/v3"
+	"net/http"
+	"strconv"
+	"strings"
+)
+
+// newAPI returns the fake Bot API for messages the handlers send with the bot itself. Sent and edited messages
+// are recorded, files are answered with made up IDs.
+func newAPI(s *Simulator) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if strings.HasPrefix(r.URL.Path, "/file/") {
+			w.Write([]byte("file"))
+			return
+		}
+
+		method := r.URL.Path[strings.LastIndex(r.URL.Path, "/")+1:]
+
+		params, err := readParams(r)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+
+		switch method {
+		case "getMe":
+			reply(w, telebot.User{ID: 1, IsBot: true, FirstName: "Simulator", Username: "simulator_bot"})
+
+		case "getFile":
+			reply(w, telebot.File{FileID: params["file_id"], FilePath: "files/" + params["file_id"]})
+
+		case "sendMediaGroup":
+			var media []json.RawMessage
+			json.Unmarshal([]byte(params["media"]), &media)
+
+			chatID, _ := strconv.ParseInt(params["chat_id"], 10, 64)
+			s.record(&Message{Method: method, ChatID: chatID, Media: "album"})
+
+			messages := make([]map[string]interface{}, len(media))
+			for i := range messages {
+				messages[i] = sentMessage(s.nextMessageID(), chatID)
+			}
+			reply(w, messages)
+
+		case "answerCallbackQuery", "deleteMessage", "sendChatAction", "setMyCommands":
+			reply(w, true)
+
+		default:
+			m := apiMessage(method, params)
+			s.record(m)
+			reply(w, sentMessage(m.MessageID, m.ChatID))
+		}
+	})
+}
+
+// readParams reads params of the request, which are JSON or a multipart form with files.
+func readParams(r *http.Request) (map[string]string, error) {
+	params := make(map[string]string)
+
+	if strings.HasPrefix(r.Header.Get("Content-Type"), "multipart/form-data") {
+		err := r.ParseMultipartForm(32 << 20)
+		if err != nil {
+			return nil, err
+		}
+		for key, values := range r.MultipartForm.Value {
+			params[key] = values[0]
+		}
+		return params, nil
+	}
+
+	var raw map[string]interface{}
+	if r.ContentLength != 0 {
+		err := json.NewDecoder(r.Body).Decode(&raw)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	for key, value := range raw {
+		switch v := value.(type) {
+		case string:
+			params[key] = v
+		default:
+			b, _ := json.Marshal(v)
+			params[key] = string(b)
+		}
+	}
+
+	return params, nil
+}
+
+func apiMessage(method string, params map[string]string) *Message {
+	chatID, _ := strconv.ParseInt(params["chat_id"], 10, 64)
+	messageID, _ := strconv.Atoi(params["message_id"])
+
+	m := &Message{
+		Method:    method,
+		ChatID:    chatID,
+		MessageID: messageID,
+		Text:      params["text"],
+	}
+
+	if caption, ok := params["caption"]; ok {
+		m.Text = caption
+	}
+
+	switch method {
+	case "sendDocument", "sendAudio", "sendPhoto", "sendVoice":
+		m.Media = strings.ToLower(strings.TrimPrefix(method, "send"))
+	case "editMessageMedia":
+		var media struct {
+			Type    string `json:"type"`
+			Caption string `json:"caption"`
+		}
+		json.Unmarshal([]byte(params["media"]), &media)
+		m.Text, m.Media = media.Caption, media.Type
+	}
+
+	if params["reply_markup"] != "" {
+		markup := &telebot.ReplyMarkup{}
+		json.Unmarshal([]byte(params["reply_markup"]), markup)
+		setMarkup(m, markup)
+	}
+
+	return m
+}
+
+// sentMessage is the message Telegram returns for sent messages. It has files of every kind,
+// since handlers keep the file IDs of what they have uploaded.
+func sentMessage(messageID int, chatID int64) map[string]interface{} {
+	fileID := fmt.Sprintf("file-%d-%d", chatID, messageID)
+
+	return map[string]interface{}{
+		"message_id": messageID,
+		"date":       0,
+		"chat":       map[string]interface{}{"id": chatID, "type": telebot.ChatPrivate},
+		"document":   map[string]interface{}{"file_id": fileID},
+		"audio":      map[string]interface{}{"file_id": fileID},
+	}
+}
+
+func reply(w http.ResponseWriter, result interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"ok":     true,
+		"result": result,
+	})
+}
@@ -0,0 +1,149 @@
+package simulator
+
+import (
+	"github.com/joeyave/telebot/v3"
+)
+
+// context is the telebot.Context handlers get from the simulator. Updates are read from the native context,
+// everything sent with the context is recorded instead of going to Telegram.
+type context struct {
+	telebot.Context
+	s *Simulator
+}
+
+func (c *context) Send(what interface{}, opts ...interface{}) error {
+	c.s.record(message("send", c.Chat().ID, 0, what, opts))
+	return nil
+}
+
+func (c *context) Reply(what interface{}, opts ...interface{}) error {
+	return c.Send(what, opts...)
+}
+
+func (c *context) SendAlbum(a telebot.Album, opts ...interface{}) error {
+	c.s.record(&Message{Method: "sendMediaGroup", ChatID: c.Chat().ID, Media: "album"})
+	return nil
+}
+
+func (c *context) Forward(msg telebot.Editable, opts ...interface{}) error {
+	c.s.record(&Message{Method: "forwardMessage", ChatID: c.Chat().ID})
+	return nil
+}
+
+func (c *context) ForwardTo(to telebot.Recipient, opts ...interface{}) error {
+	return nil
+}
+
+func (c *context) Edit(what interface{}, opts ...interface{}) error {
+	c.s.record(message("edit", c.Chat().ID, c.messageID(), what, opts))
+	return nil
+}
+
+func (c *context) EditCaption(caption string, opts ...interface{}) error {
+	m := message("edit", c.Chat().ID, c.messageID(), caption, opts)
+	m.Method = "editMessageCaption"
+	c.s.record(m)
+	return nil
+}
+
+func (c *context) Delete() error {
+	c.s.record(&Message{Method: "deleteMessage", ChatID: c.Chat().ID, MessageID: c.messageID()})
+	return nil
+}
+
+func (c *context) Notify(action telebot.ChatAction) error {
+	c.s.record(&Message{Method: "sendChatAction", ChatID: c.Chat().ID, Text: string(action)})
+	return nil
+}
+
+func (c *context) Ship(what ...interface{}) error {
+	return nil
+}
+
+func (c *context) Accept(errorMessage ...string) error {
+	return nil
+}
+
+func (c *context) Answer(resp *telebot.QueryResponse) error {
+	c.s.record(&Message{Method: "answerInlineQuery"})
+	return nil
+}
+
+func (c *context) Respond(resp ...*telebot.CallbackResponse) error {
+	m := &Message{Method: "answerCallbackQuery", ChatID: c.Chat().ID}
+	if len(resp) > 0 && resp[0] != nil {
+		m.Text = resp[0].Text
+	}
+	c.s.record(m)
+	return nil
+}
+
+func (c *context) messageID() int {
+	if c.Message() == nil {
+		return 0
+	}
+	return c.Message().ID
+}
+
+// message makes a Message of what is sent or edited, like telebot does with its arguments.
+func message(kind string, chatID int64, messageID int, what interface{}, opts []interface{}) *Message {
+	m := &Message{ChatID: chatID, MessageID: messageID}
+
+	var method string
+	switch v := what.(type) {
+	case string:
+		m.Text = v
+		method = "Message"
+	case *telebot.ReplyMarkup:
+		opts = append(opts, v)
+		method = "ReplyMarkup"
+	case *telebot.Document:
+		m.Text, m.Media, method = v.Caption, "document", "Document"
+	case *telebot.Audio:
+		m.Text, m.Media, method = v.Caption, "audio", "Audio"
+	case *telebot.Photo:
+		m.Text, m.Media, method = v.Caption, "photo", "Photo"
+	case *telebot.Voice:
+		m.Text, m.Media, method = v.Caption, "voice", "Voice"
+	}
+
+	switch {
+	case kind == "send":
+		m.Method = "send" + method
+	case method == "Message":
+		m.Method = "editMessageText"
+	case method == "ReplyMarkup":
+		m.Method = "editMessageReplyMarkup"
+	default:
+		m.Method = "editMessageMedia"
+	}
+
+	for _, opt := range opts {
+		switch v := opt.(type) {
+		case *telebot.ReplyMarkup:
+			setMarkup(m, v)
+		case *telebot.SendOptions:
+			setMarkup(m, v.ReplyMarkup)
+		}
+	}
+
+	return m
+}
+
+func setMarkup(m *Message, markup *telebot.ReplyMarkup) {
+	if markup == nil {
+		return
+	}
+
+	if len(markup.InlineKeyboard) > 0 {
+		m.Buttons = markup.InlineKeyboard
+	}
+
+	for _, row := range markup.ReplyKeyboard {
+		var texts []string
+		for _, button := range row {
+			texts = append(texts, button.Text)
+		}
+		m.Keyboard = append(m.Keyboard, texts)
+	}
+}
@@ -0,0 +1,85 @@
+package simulator
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/joeyave/scala-chords-bot/helpers"
+)
+
+func TestCreateRoleConversation(t *testing.T) {
+	s, band := newBand(t)
+
+	step(t, s, s.Text(adminID, helpers.Menu))
+	step(t, s, s.Text(adminID, helpers.Settings))
+	step(t, s, s.Text(adminID, helpers.BandSettings))
+
+	messages := step(t, s, s.Text(adminID, helpers.CreateRole))
+	expectKeyboard(t, expect(t, messages, 0, "sendMessage", "Отправь название новой роли."), []string{helpers.Cancel})
+
+	messages = step(t, s, s.Text(adminID, "Bass"))
+	m := expect(t, messages, 0, "sendMessage", "После какой роли должна быть эта роль?")
+	expectKeyboard(t, m, []string{"Guitar"}, []string{helpers.Back, helpers.Cancel})
+
+	// An unknown role asks again, Back returns to the name.
+	messages = step(t, s, s.Text(adminID, "Drums"))
+	expect(t, messages, 0, "sendMessage", "После какой роли должна быть эта роль?")
+	messages = step(t, s, s.Text(adminID, helpers.Back))
+	expect(t, messages, 0, "sendMessage", "Отправь название новой роли.")
+
+	step(t, s, s.Text(adminID, "Keys"))
+	messages = step(t, s, s.Text(adminID, "Guitar"))
+	expect(t, messages, 0, "sendMessage", "Добавлена новая роль: Keys.")
+	expect(t, messages, 1, "sendMessage", "Основное меню:")
+
+	roles, err := s.Roles.FindAll()
+	if err != nil {
+		t.Fatal(err)
+	}
+	var names []string
+	for _, role := range roles {
+		if role.BandID == band.ID {
+			names = append(names, role.Name)
+		}
+	}
+	if !reflect.DeepEqual(names, []string{"Guitar", "Keys"}) {
+		t.Errorf("roles are %q, want Guitar and Keys", names)
+	}
+}
+
+func TestCreateBandConversation(t *testing.T) {
+	s, _ := newBand(t)
+
+	const userID int64 = 20
+
+	messages := step(t, s, s.Text(userID, "/start"))
+	m := expect(t, messages, 0, "sendMessage", "Чтобы присоединиться к группе")
+	expectKeyboard(t, m, []string{helpers.CreateBand}, []string{"Band"})
+
+	messages = step(t, s, s.Text(userID, helpers.CreateBand))
+	expectKeyboard(t, expect(t, messages, 0, "sendMessage", "Введи название своей группы:"), []string{helpers.Cancel})
+
+	messages = step(t, s, s.Text(userID, "New Band"))
+	m = expect(t, messages, 0, "sendMessage", "отправь мне ссылку на эту папку")
+	expectKeyboard(t, m, []string{helpers.Back, helpers.Cancel})
+
+	// Anything but a link to a folder asks again.
+	messages = step(t, s, s.Text(userID, "hello"))
+	expect(t, messages, 0, "sendMessage", "отправь мне ссылку на эту папку")
+
+	messages = step(t, s, s.Text(userID, "https://drive.google.com/drive/folders/abc123?usp=sharing"))
+	expect(t, messages, 0, "sendMessage", `Ты добавлен в группу "New Band" как администратор.`)
+	expect(t, messages, 1, "sendMessage", "Основное меню:")
+
+	user, err := s.Users.FindOneByID(userID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	band, err := s.Bands.FindOneByID(user.BandID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if band.Name != "New Band" || band.DriveFolderID != "abc123" || user.RoleIn(band.ID) != helpers.Admin {
+		t.Errorf("user is %q in band %q with folder %q, want the admin of New Band in abc123", user.RoleIn(band.ID), band.Name, band.DriveFolderID)
+	}
+}
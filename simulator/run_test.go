@@ -0,0 +1,85 @@
+package simulator
+
+import (
+	stdcontext "context"
+	"testing"
+	"time"
+
+	"github.com/joeyave/scala-chords-bot/helpers"
+	"github.com/joeyave/telebot/v3"
+)
+
+// scriptedPoller sends the updates and waits to be stopped, like a poller that has received them just before.
+type scriptedPoller struct {
+	updates []telebot.Update
+}
+
+func (p *scriptedPoller) Poll(b *telebot.Bot, dest chan telebot.Update, stop chan struct{}) {
+	for _, update := range p.updates {
+		dest <- update
+	}
+	<-stop
+}
+
+func TestRunHandlesReceivedUpdatesOnShutdown(t *testing.T) {
+	s, _ := newBand(t)
+
+	const users = 20
+
+	poller := &scriptedPoller{}
+	for i := 0; i < users; i++ {
+		userID := int64(100 + i)
+		poller.updates = append(poller.updates, telebot.Update{
+			ID: i + 1,
+			Message: &telebot.Message{
+				ID:     i + 1,
+				Sender: sender(userID),
+				Chat:   chat(userID),
+				Text:   helpers.Menu,
+			},
+		})
+	}
+
+	s.bot.Poller = poller
+	s.bot.Use(s.Handler.Middleware()...)
+	s.bot.Handle(telebot.OnText, s.Handler.OnText)
+
+	// Stopped before it starts, everything the poller has received must still be handled.
+	ctx, cancel := stdcontext.WithCancel(stdcontext.Background())
+	cancel()
+
+	s.Handler.Run(ctx, 4)
+	if !s.Handler.Wait(10 * time.Second) {
+		t.Fatal("handlers are still running")
+	}
+
+	answered := make(map[int64]bool)
+	for _, m := range s.Transcript() {
+		if m.Method == "sendMessage" {
+			answered[m.ChatID] = true
+		}
+	}
+	if len(answered) != users {
+		t.Errorf("%d users got an answer, want %d", len(answered), users)
+	}
+}
+
+func TestBackgroundLoopsStop(t *testing.T) {
+	s, _ := newBand(t)
+
+	ctx, cancel := stdcontext.WithCancel(stdcontext.Background())
+
+	done := make(chan struct{})
+	go func() {
+		s.Handler.NotifyUser(ctx)
+		s.Handler.GenerateEvents(ctx)
+		close(done)
+	}()
+	cancel()
+
+	select {
+	case <-done:
+	case <-time.After(10 * time.Second):
+		t.Fatal("background loops don't stop")
+	}
+}
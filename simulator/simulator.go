@@ -0,0 +1,348 @@
+// Package simulator drives the handlers of the bot with scripted updates against in-memory storage,
+// so flows like create event → add member → add song can be played and checked as conversations.
+//
+// Updates go through a fake telebot.Context and the middleware of the bot, messages the handlers send with
+// the bot itself go to a fake Bot API. Both are recorded as one transcript, callback data in it is signed
+// like Telegram would get it.
+package simulator
+
+import (
+	"fmt"
+	"github.com/joeyave/scala-chords-bot/handlers"
+	"github.com/joeyave/scala-chords-bot/repositories"
+	"github.com/joeyave/scala-chords-bot/services"
+	"github.com/joeyave/telebot/v3"
+	"github.com/kjk/notionapi"
+	"io/ioutil"
+	"net/http/httptest"
+	"os"
+	"regexp"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Message is a message the bot has sent or edited, or an answer to a callback.
+type Message struct {
+	// Method is the Bot API method, like sendMessage, editMessageText or answerCallbackQuery.
+	Method    string
+	ChatID    int64
+	MessageID int
+	// Text is the text or the caption of the message.
+	Text string
+	// Media is the kind of the media of the message, like document or audio, if it has one.
+	Media    string
+	Keyboard [][]string
+	Buttons  [][]telebot.InlineButton
+}
+
+// Button returns the inline button with the text, or nil.
+func (m *Message) Button(text string) *telebot.InlineButton {
+	for _, row := range m.Buttons {
+		for i := range row {
+			if row[i].Text == text {
+				return &row[i]
+			}
+		}
+	}
+	return nil
+}
+
+type Simulator struct {
+	Handler *handlers.Handler
+
+	Users       *services.UserService
+	Bands       *services.BandService
+	Roles       *services.RoleService
+	Events      *services.EventService
+	Memberships *services.MembershipService
+	Songs       *services.SongService
+	DriveFiles  *services.DriveFileService
+	Invites     *services.InviteService
+	Permissions *services.PermissionService
+
+	bot          *telebot.Bot
+	api          *httptest.Server
+	callbacks    *services.CallbackService
+	documentsDir string
+
+	mu            sync.Mutex
+	transcript    []*Message
+	messages      map[int64]map[int]*Message
+	lastMessageID int
+	lastUpdateID  int
+}
+
+// New returns a simulator with empty storage. Close it when done.
+func New() (*Simulator, error) {
+	documentsDir, err := ioutil.TempDir("", "simulator")
+	if err != nil {
+		return nil, err
+	}
+
+	s := &Simulator{
+		documentsDir: documentsDir,
+		messages:     make(map[int64]map[int]*Message),
+	}
+	s.api = httptest.NewServer(newAPI(s))
+
+	s.bot, err = telebot.NewBot(telebot.Settings{
+		Token:       "simulator",
+		URL:         s.api.URL,
+		Poller:      &telebot.LongPoller{},
+		Synchronous: true,
+	})
+	if err != nil {
+		s.Close()
+		return nil, err
+	}
+
+	store := repositories.NewMemoryStore()
+	voiceRepository := repositories.NewVoiceMemoryRepository(store)
+	bandRepository := repositories.NewBandMemoryRepository(store)
+	songRepository := repositories.NewSongMemoryRepository(store)
+	userRepository := repositories.NewUserMemoryRepository(store)
+	membershipRepository := repositories.NewMembershipMemoryRepository(store)
+	eventRepository := repositories.NewEventMemoryRepository(store)
+	roleRepository := repositories.NewRoleMemoryRepository(store)
+	templateRepository := repositories.NewEventTemplateMemoryRepository(store)
+	inviteRepository := repositories.NewInviteMemoryRepository(store)
+	permissionRepository := repositories.NewPermissionGroupMemoryRepository(store)
+
+	fontsDir := os.Getenv("PDF_FONTS_DIR")
+	if fontsDir == "" {
+		fontsDir = "/usr/share/fonts/truetype/dejavu"
+	}
+	pdfRenderer := services.NewPDFRenderer(fontsDir)
+
+	documentStore, err := services.NewLocalDocumentStore(documentsDir, pdfRenderer)
+	if err != nil {
+		s.Close()
+		return nil, err
+	}
+
+	notionClient := &notionapi.Client{}
+
+	s.DriveFiles = services.NewDriveFileService(documentStore, pdfRenderer)
+	s.Permissions = services.NewPermissionService(permissionRepository, eventRepository)
+	s.Bands = services.NewBandService(bandRepository, notionClient)
+	s.Songs = services.NewSongService(songRepository, voiceRepository, bandRepository, notionClient, s.DriveFiles, s.Permissions)
+	s.Users = services.NewUserService(userRepository)
+	s.Memberships = services.NewMembershipService(membershipRepository, s.Permissions)
+	s.Events = services.NewEventService(eventRepository, userRepository, membershipRepository, s.DriveFiles, s.Permissions)
+	s.Roles = services.NewRoleService(roleRepository)
+	s.Invites = services.NewInviteService(inviteRepository)
+	s.callbacks = services.NewCallbackService("simulator", time.Hour)
+
+	s.Handler = handlers.NewHandler(
+		s.bot,
+		s.Users,
+		s.DriveFiles,
+		s.Songs,
+		services.NewVoiceService(voiceRepository),
+		s.Bands,
+		s.Memberships,
+		s.Events,
+		s.Roles,
+		services.NewEventTemplateService(templateRepository, eventRepository, membershipRepository, s.Permissions),
+		services.NewRotaService(eventRepository, userRepository, membershipRepository, s.Permissions),
+		services.NewCalendarService(eventRepository, userRepository, bandRepository, "simulator"),
+		services.NewAPITokenService("simulator", bandRepository),
+		s.Invites,
+		s.Permissions,
+		s.callbacks,
+	)
+
+	return s, nil
+}
+
+func (s *Simulator) Close() {
+	if s.api != nil {
+		s.api.Close()
+	}
+	os.RemoveAll(s.documentsDir)
+}
+
+// Text sends the text from the user in a private chat.
+func (s *Simulator) Text(userID int64, text string) error {
+	return s.run(s.Handler.OnText, telebot.Update{
+		Message: &telebot.Message{
+			ID:       s.nextMessageID(),
+			Sender:   sender(userID),
+			Chat:     chat(userID),
+			Unixtime: time.Now().Unix(),
+			Text:     text,
+		},
+	})
+}
+
+// Voice sends a voice message with the file ID from the user.
+func (s *Simulator) Voice(userID int64, fileID string) error {
+	return s.run(s.Handler.OnVoice, telebot.Update{
+		Message: &telebot.Message{
+			ID:       s.nextMessageID(),
+			Sender:   sender(userID),
+			Chat:     chat(userID),
+			Unixtime: time.Now().Unix(),
+			Voice:    &telebot.Voice{File: telebot.File{FileID: fileID}},
+		},
+	})
+}
+
+// Press presses the inline button with the text on the latest message of the user's chat that has it.
+func (s *Simulator) Press(userID int64, text string) error {
+	message := s.latest(userID, func(m *Message) bool { return m.Button(text) != nil })
+	if message == nil {
+		return fmt.Errorf("no button %q in the chat with %d", text, userID)
+	}
+
+	return s.callback(userID, message, message.Button(text).Data)
+}
+
+// Callback sends the callback data from the user as if a button of their latest message was pressed.
+// The data is signed for the user.
+func (s *Simulator) Callback(userID int64, data string) error {
+	signed, err := s.callbacks.Sign(userID, data)
+	if err != nil {
+		return err
+	}
+	return s.callback(userID, s.Last(userID), signed)
+}
+
+func (s *Simulator) callback(userID int64, message *Message, data string) error {
+	callbackMessage := &telebot.Message{
+		ID:   s.nextMessageID(),
+		Chat: chat(userID),
+	}
+
+	if message != nil {
+		callbackMessage.ID = message.MessageID
+		if message.Media != "" {
+			callbackMessage.Caption = message.Text
+			callbackMessage.CaptionEntities = callbackEntities(message.Text)
+		} else {
+			callbackMessage.Text = message.Text
+			callbackMessage.Entities = callbackEntities(message.Text)
+		}
+	}
+
+	s.mu.Lock()
+	s.lastUpdateID++
+	id := fmt.Sprint(s.lastUpdateID)
+	s.mu.Unlock()
+
+	return s.run(s.Handler.OnCallback, telebot.Update{
+		Callback: &telebot.Callback{
+			ID:      id,
+			Sender:  sender(userID),
+			Message: callbackMessage,
+			Data:    data,
+		},
+	})
+}
+
+func (s *Simulator) run(handler telebot.HandlerFunc, update telebot.Update) error {
+	c := &context{Context: s.bot.NewContext(update), s: s}
+
+	// The same chain as the bot applies.
+	middleware := s.Handler.Middleware()
+	for i := len(middleware) - 1; i >= 0; i-- {
+		handler = middleware[i](handler)
+	}
+	return handler(c)
+}
+
+// Transcript returns everything the bot has sent so far.
+func (s *Simulator) Transcript() []*Message {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return append([]*Message(nil), s.transcript...)
+}
+
+// Last returns the latest version of the last message sent to the user, or nil.
+func (s *Simulator) Last(userID int64) *Message {
+	return s.latest(userID, func(m *Message) bool { return true })
+}
+
+func (s *Simulator) latest(userID int64, match func(m *Message) bool) *Message {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	var latest *Message
+	for _, m := range s.messages[userID] {
+		if match(m) && (latest == nil || m.MessageID > latest.MessageID) {
+			latest = m
+		}
+	}
+	return latest
+}
+
+// Reset forgets the transcript, the storage and messages in chats are kept.
+func (s *Simulator) Reset() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.transcript = nil
+}
+
+// record adds the message to the transcript. Sent messages get a new ID, edits update the message they edit.
+func (s *Simulator) record(m *Message) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if strings.HasPrefix(m.Method, "send") {
+		s.lastMessageID++
+		m.MessageID = s.lastMessageID
+	}
+
+	s.transcript = append(s.transcript, m)
+
+	if m.Method == "answerCallbackQuery" || m.Method == "deleteMessage" || m.Method == "sendChatAction" {
+		return
+	}
+
+	if s.messages[m.ChatID] == nil {
+		s.messages[m.ChatID] = make(map[int]*Message)
+	}
+
+	// Editing the keyboard keeps the text. Editing the text without a keyboard drops it, like Telegram does.
+	latest := *m
+	if prev := s.messages[m.ChatID][m.MessageID]; prev != nil && strings.HasPrefix(m.Method, "edit") {
+		if m.Method == "editMessageReplyMarkup" {
+			latest.Text = prev.Text
+		}
+		if latest.Media == "" && m.Method != "editMessageText" {
+			latest.Media = prev.Media
+		}
+	}
+	s.messages[m.ChatID][m.MessageID] = &latest
+}
+
+func (s *Simulator) nextMessageID() int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.lastMessageID++
+	return s.lastMessageID
+}
+
+func sender(userID int64) *telebot.User {
+	return &telebot.User{ID: int(userID), FirstName: fmt.Sprintf("User%d", userID)}
+}
+
+func chat(userID int64) *telebot.Chat {
+	return &telebot.Chat{ID: userID, Type: telebot.ChatPrivate, FirstName: fmt.Sprintf("User%d", userID)}
+}
+
+var callbackURLRegex = regexp.MustCompile(`<a href="(t\.me/callbackData[^"]*)">`)
+
+// callbackEntities returns the text link Telegram makes of the callback URL hidden in the message.
+func callbackEntities(text string) []telebot.MessageEntity {
+	matches := callbackURLRegex.FindStringSubmatch(text)
+	if matches == nil {
+		return nil
+	}
+
+	return []telebot.MessageEntity{{Type: telebot.EntityTextLink, URL: "http://" + matches[1]}}
+}
@@ -0,0 +1,574 @@
+package simulator
+
+import (
+	"fmt"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/joeyave/scala-chords-bot/entities"
+	"github.com/joeyave/scala-chords-bot/helpers"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"google.golang.org/api/drive/v3"
+)
+
+const (
+	adminID  int64 = 7
+	memberID int64 = 8
+)
+
+// newBand returns a simulator with a band of an admin and a member, the Guitar role and two songs in the folder.
+func newBand(t *testing.T) (*Simulator, *entities.Band) {
+	t.Helper()
+
+	s, err := New()
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(s.Close)
+
+	band, err := s.Bands.UpdateOne(entities.Band{Name: "Band", DriveFolderID: "folder"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	_, err = s.Roles.UpdateOne(entities.Role{Name: "Guitar", BandID: band.ID, Priority: 1})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, user := range []entities.User{
+		{ID: adminID, Name: "Sam", BandID: band.ID, Role: helpers.Admin},
+		{ID: memberID, Name: "Pat", BandID: band.ID},
+	} {
+		user.State = &entities.State{Name: helpers.MainMenuState}
+		_, err := s.Users.UpdateOne(user)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	for _, name := range []string{"Amazing Grace", "How Great"} {
+		_, err := s.DriveFiles.CreateOne(&drive.File{Name: name, Parents: []string{"folder"}}, "la la", "C", "70", "4/4")
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	return s, band
+}
+
+// step runs the update and returns the messages it produced, without answers to callbacks and chat actions.
+func step(t *testing.T, s *Simulator, err error) []*Message {
+	t.Helper()
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var messages []*Message
+	for _, m := range s.Transcript() {
+		if m.Method != "answerCallbackQuery" && m.Method != "sendChatAction" {
+			messages = append(messages, m)
+		}
+	}
+	s.Reset()
+
+	return messages
+}
+
+// expect checks the method and the text of the message with the index.
+func expect(t *testing.T, messages []*Message, i int, method string, text string) *Message {
+	t.Helper()
+
+	if i >= len(messages) {
+		t.Fatalf("got %d messages, want message %d %s %q", len(messages), i, method, text)
+	}
+
+	m := messages[i]
+	if m.Method != method || !strings.Contains(m.Text, text) {
+		t.Fatalf("message %d is %s %q, want %s with %q", i, m.Method, m.Text, method, text)
+	}
+	return m
+}
+
+func expectKeyboard(t *testing.T, m *Message, want ...[]string) {
+	t.Helper()
+
+	if !reflect.DeepEqual(m.Keyboard, want) {
+		t.Fatalf("keyboard is %q, want %q", m.Keyboard, want)
+	}
+}
+
+func expectButtons(t *testing.T, m *Message, want ...string) {
+	t.Helper()
+
+	var buttons []string
+	for _, row := range m.Buttons {
+		for _, button := range row {
+			buttons = append(buttons, button.Text)
+		}
+	}
+
+	if !reflect.DeepEqual(buttons, want) {
+		t.Fatalf("buttons are %q, want %q", buttons, want)
+	}
+}
+
+var eventButtons = []string{
+	helpers.FindChords, helpers.Booklet, helpers.DeleteMember, helpers.AddMember, helpers.DeleteSong, helpers.AddSong,
+	helpers.ChangeSongsOrder, helpers.ChangeEventDate, helpers.Arrangement,
+}
+
+func TestEventFlow(t *testing.T) {
+	s, band := newBand(t)
+
+	step(t, s, s.Text(adminID, helpers.Menu))
+	step(t, s, s.Text(adminID, helpers.Schedule))
+
+	messages := step(t, s, s.Text(adminID, helpers.CreateEvent))
+	m := expect(t, messages, 0, "sendMessage", "Введи название этого собрания:")
+	expectKeyboard(t, m, []string{helpers.Cancel})
+
+	messages = step(t, s, s.Text(adminID, "Sunday"))
+	m = expect(t, messages, 0, "sendMessage", "Выбери дату:")
+	if m.Button(helpers.Today) == nil {
+		t.Fatalf("no %q button in the date picker", helpers.Today)
+	}
+
+	messages = step(t, s, s.Press(adminID, helpers.Today))
+	date := time.Now().Format("02.01.2006")
+	m = expect(t, messages, 0, "editMessageText", "<b>Sunday | "+date)
+	expectButtons(t, m, eventButtons...)
+	expect(t, messages, 1, "sendMessage", "Выбери собрание:")
+
+	events, err := s.Events.FindManyFromTodayByBandID(band.ID)
+	if err != nil || len(events) != 1 {
+		t.Fatalf("band has %d events (%v), want 1", len(events), err)
+	}
+	eventID := events[0].ID
+
+	// Add a member.
+	messages = step(t, s, s.Press(adminID, helpers.AddMember))
+	expectButtons(t, expect(t, messages, 0, "editMessageReplyMarkup", ""), "Guitar", helpers.Back)
+
+	messages = step(t, s, s.Press(adminID, "Guitar"))
+	expectButtons(t, expect(t, messages, 0, "editMessageReplyMarkup", ""), "Sam", "Pat", helpers.Cancel)
+
+	messages = step(t, s, s.Press(adminID, "Pat"))
+	m = expect(t, messages, 0, "editMessageText", "<b>Guitar:</b>")
+	if !strings.Contains(m.Text, `<a href="tg://user?id=8">Pat</a>`) {
+		t.Fatalf("event doesn't show the new member:\n%s", m.Text)
+	}
+	expectButtons(t, m, eventButtons...)
+
+	// Add songs.
+	messages = step(t, s, s.Press(adminID, helpers.AddSong))
+	expectKeyboard(t, expect(t, messages, 0, "sendMessage", "Введи название песни:"), []string{helpers.End})
+
+	for _, name := range []string{"Amazing Grace", "How Great"} {
+		messages = step(t, s, s.Text(adminID, name))
+		m = expect(t, messages, 0, "sendMessage", "Выбери песню по запросу")
+		expectKeyboard(t, m, []string{name}, []string{helpers.End})
+
+		messages = step(t, s, s.Text(adminID, name))
+		expect(t, messages, 0, "sendMessage", "Введи название песни:")
+	}
+
+	messages = step(t, s, s.Text(adminID, helpers.End))
+	m = expect(t, messages, 0, "sendMessage", "1. Amazing Grace  (C, 70, 4/4)\n2. How Great  (C, 70, 4/4)")
+	expectButtons(t, m, eventButtons...)
+
+	// Swap the songs.
+	messages = step(t, s, s.Press(adminID, helpers.ChangeSongsOrder))
+	m = expect(t, messages, 0, "editMessageText", "Выбери песню номер 1:")
+	expectButtons(t, m, "Amazing Grace (C, 70, 4/4)", "How Great (C, 70, 4/4)", helpers.End)
+
+	messages = step(t, s, s.Press(adminID, "How Great (C, 70, 4/4)"))
+	m = expect(t, messages, 0, "editMessageText", "Выбери песню номер 2:")
+	expectButtons(t, m, "Amazing Grace (C, 70, 4/4)", helpers.End)
+
+	messages = step(t, s, s.Press(adminID, "Amazing Grace (C, 70, 4/4)"))
+	m = expect(t, messages, 0, "editMessageText", "1. How Great  (C, 70, 4/4)\n2. Amazing Grace  (C, 70, 4/4)")
+	expectButtons(t, m, eventButtons...)
+
+	event, err := s.Events.FindOneByID(eventID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := songNames(t, s, event.SongIDs); !reflect.DeepEqual(got, []string{"How Great", "Amazing Grace"}) {
+		t.Errorf("songs of the event are %q, want How Great and Amazing Grace", got)
+	}
+	if len(event.Memberships) != 1 || event.Memberships[0].UserID != memberID {
+		t.Errorf("event has memberships %+v, want Pat", event.Memberships)
+	}
+}
+
+func TestCreateSongFlow(t *testing.T) {
+	s, band := newBand(t)
+
+	step(t, s, s.Text(adminID, helpers.Menu))
+
+	messages := step(t, s, s.Text(adminID, helpers.CreateDoc))
+	expectKeyboard(t, expect(t, messages, 0, "sendMessage", "Отправь название:"), []string{helpers.Cancel})
+
+	// Back returns to the previous step.
+	step(t, s, s.Text(adminID, "Old Name"))
+	messages = step(t, s, s.Text(adminID, helpers.Back))
+	expect(t, messages, 0, "sendMessage", "Отправь название:")
+
+	messages = step(t, s, s.Text(adminID, "New Song"))
+	expectKeyboard(t, expect(t, messages, 0, "sendMessage", "Отправь слова:"), []string{helpers.Cancel, helpers.Skip})
+
+	messages = step(t, s, s.Text(adminID, "G\nLa la"))
+	m := expect(t, messages, 0, "sendMessage", "Выбери или отправь тональность:")
+	if got := m.Keyboard[len(m.Keyboard)-1]; !reflect.DeepEqual(got, []string{helpers.Cancel, helpers.Skip}) {
+		t.Fatalf("last row of the keys is %q", got)
+	}
+
+	messages = step(t, s, s.Text(adminID, "G"))
+	expect(t, messages, 0, "sendMessage", "Отправь темп:")
+
+	messages = step(t, s, s.Text(adminID, "72"))
+	m = expect(t, messages, 0, "sendMessage", "Выбери или отправь размер:")
+	expectKeyboard(t, m, []string{"2/4", "3/4", "4/4"}, []string{helpers.Cancel, helpers.Skip})
+
+	messages = step(t, s, s.Text(adminID, "3/4"))
+	m = expect(t, messages, 0, "sendDocument", "G, 72, 3/4")
+	if m.ChatID != adminID || m.Media != "document" {
+		t.Fatalf("song is sent as %s to %d", m.Media, m.ChatID)
+	}
+	expectButtons(t, m, "Кнопочки")
+	expect(t, messages, len(messages)-1, "sendMessage", "Основное меню:")
+
+	file, err := s.DriveFiles.FindOneByNameAndFolderID("New Song", band.DriveFolderID)
+	if err != nil {
+		t.Fatalf("song is not created: %v", err)
+	}
+
+	// The buttons of the song open its menu.
+	messages = step(t, s, s.Press(adminID, "Кнопочки"))
+	m = expect(t, messages, 0, "editMessageReplyMarkup", "")
+	if m.MessageID == 0 || m.Button(helpers.Voices) == nil {
+		t.Fatalf("song menu has no %q button: %+v", helpers.Voices, m.Buttons)
+	}
+
+	song, err := s.Songs.FindOneByDriveFileID(file.Id)
+	if err != nil {
+		t.Fatalf("song is not saved: %v", err)
+	}
+	if song.BandID != band.ID {
+		t.Errorf("song is in band %s, want %s", song.BandID.Hex(), band.ID.Hex())
+	}
+}
+
+func songNames(t *testing.T, s *Simulator, IDs []primitive.ObjectID) []string {
+	t.Helper()
+
+	var names []string
+	for _, ID := range IDs {
+		song, err := s.Songs.FindOneByID(ID)
+		if err != nil {
+			t.Fatal(err)
+		}
+		names = append(names, song.PDF.Name)
+	}
+	return names
+}
+
+func TestInviteUsedOnlyByNewMembers(t *testing.T) {
+	s, band := newBand(t)
+
+	invite, err := s.Invites.Create(band.ID, "", 0, 1, time.Now())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// A member opening the link again doesn't take the only use.
+	messages := step(t, s, s.Text(memberID, "/start "+invite.Token))
+	expect(t, messages, 0, "sendMessage", "Ты уже в группе Band.")
+
+	const newcomerID int64 = 9
+	messages = step(t, s, s.Text(newcomerID, "/start "+invite.Token))
+	expect(t, messages, 0, "sendMessage", "Теперь ты в группе Band.")
+
+	user, err := s.Users.FindOneByID(newcomerID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if user.BandID != band.ID || user.RoleIn(band.ID) != "" {
+		t.Errorf("newcomer is in band %s as %q", user.BandID.Hex(), user.RoleIn(band.ID))
+	}
+
+	messages = step(t, s, s.Text(10, "/start "+invite.Token))
+	expect(t, messages, 0, "sendMessage", "Ссылка-приглашение недействительна")
+
+	// Text that only looks like a token isn't an invite.
+	messages = step(t, s, s.Text(memberID, invite.Token))
+	for _, m := range messages {
+		if strings.Contains(m.Text, "Ссылка-приглашение") || strings.Contains(m.Text, "в группе Band") {
+			t.Errorf("plain text %q is taken as an invite: %q", invite.Token, m.Text)
+		}
+	}
+}
+
+func TestReplaceDeclinedMember(t *testing.T) {
+	s, band := newBand(t)
+
+	roles, err := s.Roles.FindAll()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	event, err := s.Events.UpdateOne(nil, entities.Event{Name: "Sunday", Time: time.Now().Add(24 * time.Hour), BandID: band.ID})
+	if err != nil {
+		t.Fatal(err)
+	}
+	membership, err := s.Memberships.UpdateOne(nil, entities.Membership{EventID: event.ID, UserID: memberID, RoleID: roles[0].ID, Status: entities.Declined})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	const (
+		otherMemberID int64 = 9
+		strangerID    int64 = 10
+	)
+	_, err = s.Users.UpdateOne(entities.User{ID: otherMemberID, Name: "Lee", BandID: band.ID, State: &entities.State{Name: helpers.MainMenuState}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = s.Users.UpdateOne(entities.User{ID: strangerID, Name: "Max", State: &entities.State{Name: helpers.MainMenuState}})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	replace := func(userID int64) string {
+		return helpers.AggregateCallbackData(helpers.MembershipStatusState, 2, fmt.Sprintf("%s:%d", membership.ID.Hex(), userID))
+	}
+
+	// Only those who manage events may replace members.
+	if got := answers(t, s, s.Callback(otherMemberID, replace(otherMemberID))); len(got) != 1 || got[0] != "У тебя нет прав на это. Их может выдать администратор группы." {
+		t.Errorf("member got %q, want no permission", got)
+	}
+
+	// The replacement must be in the band.
+	if got := answers(t, s, s.Callback(adminID, replace(strangerID))); len(got) != 1 || got[0] != "Этого человека уже нет в группе." {
+		t.Errorf("admin got %q, want the stranger refused", got)
+	}
+
+	event, err = s.Events.FindOneByID(event.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(event.Memberships) != 1 || event.Memberships[0].UserID != memberID {
+		t.Fatalf("event has memberships %+v, want only the declined one", event.Memberships)
+	}
+
+	messages := step(t, s, s.Callback(adminID, replace(otherMemberID)))
+	expect(t, messages, 0, "sendMessage", "Sunday")
+	if messages[0].ChatID != otherMemberID {
+		t.Errorf("notification is sent to %d, want %d", messages[0].ChatID, otherMemberID)
+	}
+
+	event, err = s.Events.FindOneByID(event.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(event.Memberships) != 1 || event.Memberships[0].UserID != otherMemberID {
+		t.Errorf("event has memberships %+v, want Lee", event.Memberships)
+	}
+}
+
+// answers is step for callbacks, it returns texts of the answers to them.
+func answers(t *testing.T, s *Simulator, err error) []string {
+	t.Helper()
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var texts []string
+	for _, m := range s.Transcript() {
+		if m.Method == "answerCallbackQuery" {
+			texts = append(texts, m.Text)
+		}
+	}
+	s.Reset()
+
+	return texts
+}
+
+func TestSetlistEntryStateExpires(t *testing.T) {
+	s, band := newBand(t)
+
+	songID := primitive.NewObjectID()
+	event, err := s.Events.UpdateOne(nil, entities.Event{Name: "Sunday", Time: time.Now().Add(24 * time.Hour), BandID: band.ID, SongIDs: []primitive.ObjectID{songID}})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// The admin was asked for the BPM two hours ago and left.
+	_, err = s.Users.UpdateOne(entities.User{ID: adminID, Name: "Sam", BandID: band.ID, Role: helpers.Admin, State: &entities.State{
+		Index:     5,
+		Name:      helpers.SetlistEntryState,
+		Context:   entities.Context{EventID: event.ID, Query: songID.Hex(), QueryType: "bpm"},
+		EnteredAt: time.Now().Add(-2 * time.Hour),
+	}})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	messages := step(t, s, s.Text(adminID, "120"))
+	expect(t, messages, 0, "sendMessage", "Предыдущее действие устарело, начни заново.")
+	expect(t, messages, 1, "sendMessage", "Основное меню:")
+
+	event, err = s.Events.FindOneByID(event.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if entry := event.SetlistEntry(songID); entry.BPM != "" {
+		t.Errorf("BPM is %q, want the answer ignored", entry.BPM)
+	}
+
+	user, err := s.Users.FindOneByID(adminID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if user.State.Name != helpers.MainMenuState {
+		t.Errorf("user is in state %d, want the main menu", user.State.Name)
+	}
+}
+
+func TestAddAdminOnlyFromBand(t *testing.T) {
+	s, band := newBand(t)
+
+	const strangerID int64 = 10
+	_, err := s.Users.UpdateOne(entities.User{ID: strangerID, Name: "Max", State: &entities.State{Name: helpers.MainMenuState}})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	step(t, s, s.Text(adminID, helpers.Menu))
+	step(t, s, s.Text(adminID, helpers.Settings))
+	step(t, s, s.Text(adminID, helpers.BandSettings))
+	messages := step(t, s, s.Text(adminID, helpers.AddAdmin))
+	m := expect(t, messages, 0, "sendMessage", "Выбери пользователя")
+	expectKeyboard(t, m, []string{"Sam"}, []string{"Pat"}, []string{helpers.Cancel})
+
+	messages = step(t, s, s.Text(adminID, "Max"))
+	expect(t, messages, 0, "sendMessage", "В группе нет участника с таким именем")
+	expect(t, messages, 1, "sendMessage", "Выбери пользователя")
+
+	messages = step(t, s, s.Text(adminID, "Pat"))
+	expect(t, messages, 0, "sendMessage", "Пользователь Pat повышен до администратора.")
+
+	for userID, want := range map[int64]string{memberID: helpers.Admin, strangerID: ""} {
+		user, err := s.Users.FindOneByID(userID)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got := user.RoleIn(band.ID); got != want {
+			t.Errorf("user %d has role %q in the band, want %q", userID, got, want)
+		}
+	}
+}
+
+func TestSetlistEntryRejectsNonNumericBPM(t *testing.T) {
+	s, band := newBand(t)
+
+	songID := primitive.NewObjectID()
+	event, err := s.Events.UpdateOne(nil, entities.Event{Name: "Sunday", Time: time.Now().Add(24 * time.Hour), BandID: band.ID, SongIDs: []primitive.ObjectID{songID}})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	_, err = s.Users.UpdateOne(entities.User{ID: adminID, Name: "Sam", BandID: band.ID, Role: helpers.Admin, State: &entities.State{
+		Index:     5,
+		Name:      helpers.SetlistEntryState,
+		Context:   entities.Context{EventID: event.ID, Query: songID.Hex(), QueryType: "bpm"},
+		EnteredAt: time.Now(),
+		Prev:      &entities.State{Name: helpers.MainMenuState},
+	}})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	messages := step(t, s, s.Text(adminID, "fast"))
+	expect(t, messages, 0, "sendMessage", "BPM должен быть числом")
+
+	step(t, s, s.Text(adminID, "120"))
+
+	event, err = s.Events.FindOneByID(event.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if entry := event.SetlistEntry(songID); entry.BPM != "120" {
+		t.Errorf("BPM is %q, want 120", entry.BPM)
+	}
+}
+
+func TestStatesWithoutPermission(t *testing.T) {
+	s, band := newBand(t)
+
+	const newcomerID int64 = 9
+	_, err := s.Users.UpdateOne(entities.User{ID: newcomerID, Name: "Max", State: &entities.State{Name: helpers.MainMenuState}})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Members without a permission group edit songs, but can't delete them.
+	texts := answers(t, s, s.Callback(memberID, helpers.AggregateCallbackData(helpers.DeleteSongState, 0, "")))
+	if len(texts) == 0 || !strings.Contains(texts[0], "У тебя нет прав на это.") {
+		t.Errorf("delete song answers are %q, want no permission", texts)
+	}
+	if _, err := s.DriveFiles.FindOneByNameAndFolderID("Amazing Grace", "folder"); err != nil {
+		t.Errorf("song is deleted: %v", err)
+	}
+
+	// Pat can't edit songs.
+	group, err := s.Permissions.UpdateOneGroup(entities.PermissionGroup{BandID: band.ID, Name: "Guests", Permissions: []entities.Permission{}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	member, err := s.Users.FindOneByID(memberID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	member.SetPermissionGroupIn(band.ID, group.ID)
+	member.State = &entities.State{Name: helpers.AddBandAdminState, Index: 1, EnteredAt: time.Now()}
+	_, err = s.Users.UpdateOne(*member)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Only admins make admins.
+	messages := step(t, s, s.Text(memberID, "Pat"))
+	expect(t, messages, 0, "sendMessage", "У тебя нет прав на это.")
+
+	member, err = s.Users.FindOneByID(memberID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if role := member.RoleIn(band.ID); role != "" {
+		t.Errorf("member made themselves %q", role)
+	}
+
+	texts = answers(t, s, s.Callback(memberID, helpers.AggregateCallbackData(helpers.JoinRequestState, 0, fmt.Sprintf("%d:%s", newcomerID, band.ID.Hex()))))
+	if len(texts) == 0 || !strings.Contains(texts[0], "У тебя нет прав на это.") {
+		t.Errorf("join request answers are %q, want no permission", texts)
+	}
+
+	newcomer, err := s.Users.FindOneByID(newcomerID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if newcomer.UserBand(band.ID) != nil {
+		t.Errorf("member without the permission approved the join request")
+	}
+
+	texts = answers(t, s, s.Callback(memberID, helpers.AggregateCallbackData(helpers.TransposeSongState, 2, "0")))
+	if len(texts) == 0 || !strings.Contains(texts[0], "У тебя нет прав на это.") {
+		t.Errorf("transpose answers are %q, want no permission", texts)
+	}
+}
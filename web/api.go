@@ -0,0 +1,505 @@
+package web
+
+import (
+	"encoding/json"
+	"fmt"
+	"github.com/joeyave/scala-chords-bot/entities"
+	"github.com/joeyave/scala-chords-bot/services"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"net/http"
+	"strings"
+	"time"
+)
+
+// APIHandler is a JSON API over the data of a band. Requests need the header "Authorization: Bearer {token}",
+// the band is the one the token was issued for. The token acts as an admin of the band in the services,
+// so only admins who can manage the band get it.
+//
+//	GET    /api/band
+//	GET    /api/users
+//	GET    /api/songs
+//	GET    /api/songs/{songId}
+//	GET    /api/events
+//	POST   /api/events
+//	GET    /api/events/{eventId}
+//	PATCH  /api/events/{eventId}
+//	DELETE /api/events/{eventId}
+//	POST   /api/events/{eventId}/memberships
+//	DELETE /api/events/{eventId}/memberships/{membershipId}
+type APIHandler struct {
+	apiTokenService   *services.APITokenService
+	bandService       *services.BandService
+	userService       *services.UserService
+	songService       *services.SongService
+	eventService      *services.EventService
+	membershipService *services.MembershipService
+	roleService       *services.RoleService
+	permissionService *services.PermissionService
+}
+
+func NewAPIHandler(
+	apiTokenService *services.APITokenService,
+	bandService *services.BandService,
+	userService *services.UserService,
+	songService *services.SongService,
+	eventService *services.EventService,
+	membershipService *services.MembershipService,
+	roleService *services.RoleService,
+	permissionService *services.PermissionService,
+) *APIHandler {
+	return &APIHandler{
+		apiTokenService:   apiTokenService,
+		bandService:       bandService,
+		userService:       userService,
+		songService:       songService,
+		eventService:      eventService,
+		membershipService: membershipService,
+		roleService:       roleService,
+		permissionService: permissionService,
+	}
+}
+
+// apiError is written as {"error": "..."} with the status.
+type apiError struct {
+	status  int
+	message string
+}
+
+func (e *apiError) Error() string {
+	return e.message
+}
+
+func errorf(status int, format string, a ...interface{}) *apiError {
+	return &apiError{status: status, message: fmt.Sprintf(format, a...)}
+}
+
+func (h *APIHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	result, err := h.serve(r)
+	if err != nil {
+		status := http.StatusInternalServerError
+		if apiErr, ok := err.(*apiError); ok {
+			status = apiErr.status
+		}
+		writeJSON(w, status, map[string]string{"error": err.Error()})
+		return
+	}
+
+	if result == nil {
+		w.WriteHeader(http.StatusNoContent)
+		return
+	}
+
+	status := http.StatusOK
+	if r.Method == http.MethodPost {
+		status = http.StatusCreated
+	}
+	writeJSON(w, status, result)
+}
+
+func (h *APIHandler) serve(r *http.Request) (interface{}, error) {
+	token := strings.TrimPrefix(r.Header.Get("Authorization"), "Bearer ")
+	band, err := h.apiTokenService.Band(token)
+	if err != nil {
+		return nil, errorf(http.StatusUnauthorized, "invalid token")
+	}
+
+	route, parts := apiRoute(r)
+
+	switch route {
+	case "GET band":
+		return newBandView(band), nil
+	case "GET users":
+		return h.users(band)
+	case "GET songs":
+		return h.songs(band)
+	case "GET songs/{id}":
+		return h.song(band, parts[1])
+	case "GET events":
+		return h.events(band)
+	case "POST events":
+		return h.createEvent(band, r)
+	case "GET events/{id}":
+		return h.event(band, parts[1])
+	case "PATCH events/{id}":
+		return h.updateEvent(band, parts[1], r)
+	case "DELETE events/{id}":
+		return nil, h.deleteEvent(band, parts[1])
+	case "POST events/{id}/memberships":
+		return h.createMembership(band, parts[1], r)
+	case "DELETE events/{id}/memberships/{id}":
+		return nil, h.deleteMembership(band, parts[1], parts[3])
+	}
+
+	return nil, errorf(http.StatusNotFound, "not found")
+}
+
+// apiRoute returns the method with the path where every second segment is "{id}", like "GET events/{id}",
+// and the segments of the path. The whole path is in the route, so longer paths match nothing.
+func apiRoute(r *http.Request) (string, []string) {
+	parts := strings.Split(strings.Trim(strings.TrimPrefix(r.URL.Path, "/api"), "/"), "/")
+
+	segments := make([]string, len(parts))
+	for i, part := range parts {
+		if i%2 == 1 {
+			segments[i] = "{id}"
+		} else {
+			segments[i] = part
+		}
+	}
+
+	return r.Method + " " + strings.Join(segments, "/"), parts
+}
+
+func (h *APIHandler) users(band *entities.Band) (interface{}, error) {
+	views := []*userView{}
+
+	// Not found means there are no users.
+	users, _ := h.userService.FindMultipleByBandID(band.ID)
+	for _, user := range users {
+		views = append(views, newUserView(user, h.permissionService.IsAdmin(user, band.ID)))
+	}
+
+	return views, nil
+}
+
+func (h *APIHandler) songs(band *entities.Band) (interface{}, error) {
+	views := []*songView{}
+
+	songs, _ := h.songService.FindManyByBandID(band.ID)
+	for _, song := range songs {
+		views = append(views, newSongView(song))
+	}
+
+	return views, nil
+}
+
+func (h *APIHandler) song(band *entities.Band, hex string) (interface{}, error) {
+	ID, err := primitive.ObjectIDFromHex(hex)
+	if err != nil {
+		return nil, errorf(http.StatusNotFound, "song not found")
+	}
+
+	song, err := h.songService.FindOneByID(ID)
+	if err != nil || song.BandID != band.ID {
+		return nil, errorf(http.StatusNotFound, "song not found")
+	}
+
+	return newSongView(song), nil
+}
+
+func (h *APIHandler) events(band *entities.Band) (interface{}, error) {
+	views := []*eventView{}
+
+	events, _ := h.eventService.FindManyFromTodayByBandID(band.ID)
+	for _, event := range events {
+		views = append(views, newEventView(event))
+	}
+
+	return views, nil
+}
+
+func (h *APIHandler) findEvent(band *entities.Band, hex string) (*entities.Event, error) {
+	ID, err := primitive.ObjectIDFromHex(hex)
+	if err != nil {
+		return nil, errorf(http.StatusNotFound, "event not found")
+	}
+
+	event, err := h.eventService.FindOneByID(ID)
+	if err != nil || event.BandID != band.ID {
+		return nil, errorf(http.StatusNotFound, "event not found")
+	}
+
+	return event, nil
+}
+
+func (h *APIHandler) event(band *entities.Band, hex string) (interface{}, error) {
+	event, err := h.findEvent(band, hex)
+	if err != nil {
+		return nil, err
+	}
+
+	return newEventView(event), nil
+}
+
+// eventRequest is the body of POST and PATCH. Fields that are not set are not changed.
+// songIds replace the songs of the event, setlist entries replace the entries of their songs.
+type eventRequest struct {
+	Name    *string                `json:"name"`
+	Time    *time.Time             `json:"time"`
+	SongIDs *[]string              `json:"songIds"`
+	Setlist []*setlistEntryRequest `json:"setlist"`
+}
+
+type setlistEntryRequest struct {
+	SongID               string `json:"songId"`
+	Key                  string `json:"key"`
+	BPM                  string `json:"bpm"`
+	Note                 string `json:"note"`
+	VocalistMembershipID string `json:"vocalistMembershipId"`
+}
+
+func (h *APIHandler) createEvent(band *entities.Band, r *http.Request) (interface{}, error) {
+	var req eventRequest
+	err := decodeJSON(r, &req)
+	if err != nil {
+		return nil, err
+	}
+
+	if req.Name == nil || strings.TrimSpace(*req.Name) == "" || req.Time == nil {
+		return nil, errorf(http.StatusBadRequest, "name and time are required")
+	}
+
+	songIDs, err := h.parseSongIDs(band, &req)
+	if err != nil {
+		return nil, err
+	}
+
+	// A new event has no members, so there are no vocalists yet.
+	setlist, err := parseSetlist(&entities.Event{}, songIDs, &req)
+	if err != nil {
+		return nil, err
+	}
+
+	event, err := h.eventService.UpdateOne(h.apiTokenService.Actor(band), entities.Event{
+		Name:   strings.TrimSpace(*req.Name),
+		Time:   req.Time.Local(),
+		BandID: band.ID,
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return h.applyEventRequest(band, event, songIDs, setlist)
+}
+
+func (h *APIHandler) updateEvent(band *entities.Band, hex string, r *http.Request) (interface{}, error) {
+	event, err := h.findEvent(band, hex)
+	if err != nil {
+		return nil, err
+	}
+
+	var req eventRequest
+	err = decodeJSON(r, &req)
+	if err != nil {
+		return nil, err
+	}
+
+	songIDs, err := h.parseSongIDs(band, &req)
+	if err != nil {
+		return nil, err
+	}
+
+	setlist, err := parseSetlist(event, songIDs, &req)
+	if err != nil {
+		return nil, err
+	}
+
+	if req.Name != nil || req.Time != nil {
+		if req.Name != nil {
+			if strings.TrimSpace(*req.Name) == "" {
+				return nil, errorf(http.StatusBadRequest, "name can't be empty")
+			}
+			event.Name = strings.TrimSpace(*req.Name)
+		}
+		if req.Time != nil {
+			event.Time = req.Time.Local()
+			event.ChatReminded = false
+		}
+
+		event, err = h.eventService.UpdateOne(h.apiTokenService.Actor(band), *event)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	return h.applyEventRequest(band, event, songIDs, setlist)
+}
+
+// parseSongIDs checks that the songs of the request are songs of the band.
+func (h *APIHandler) parseSongIDs(band *entities.Band, req *eventRequest) ([]primitive.ObjectID, error) {
+	if req.SongIDs == nil {
+		return nil, nil
+	}
+
+	songIDs := []primitive.ObjectID{}
+	for _, hex := range *req.SongIDs {
+		ID, err := primitive.ObjectIDFromHex(hex)
+		if err != nil {
+			return nil, errorf(http.StatusBadRequest, "invalid song id %q", hex)
+		}
+
+		song, err := h.songService.FindOneByID(ID)
+		if err != nil || song.BandID != band.ID {
+			return nil, errorf(http.StatusBadRequest, "song %s not found", hex)
+		}
+		songIDs = append(songIDs, ID)
+	}
+
+	return songIDs, nil
+}
+
+// parseSetlist checks the setlist of the request against the event: songs of the entries must be songs of the event
+// and vocalists must be members of the event. songIDs are the new songs of the event, nil if they are not changed.
+func parseSetlist(event *entities.Event, songIDs []primitive.ObjectID, req *eventRequest) ([]entities.SetlistEntry, error) {
+	eventSongIDs := event.SongIDs
+	if songIDs != nil {
+		eventSongIDs = songIDs
+	}
+
+	setlist := make([]entities.SetlistEntry, 0, len(req.Setlist))
+	for _, entryReq := range req.Setlist {
+		songID, err := primitive.ObjectIDFromHex(entryReq.SongID)
+		if err != nil {
+			return nil, errorf(http.StatusBadRequest, "invalid song id %q", entryReq.SongID)
+		}
+		if !containsObjectID(eventSongIDs, songID) {
+			return nil, errorf(http.StatusBadRequest, "song %s is not in the event", entryReq.SongID)
+		}
+
+		entry := entities.SetlistEntry{
+			SongID: songID,
+			Key:    entryReq.Key,
+			BPM:    entryReq.BPM,
+			Note:   entryReq.Note,
+		}
+		if entryReq.VocalistMembershipID != "" {
+			entry.MembershipID, err = primitive.ObjectIDFromHex(entryReq.VocalistMembershipID)
+			if err != nil {
+				return nil, errorf(http.StatusBadRequest, "invalid membership id %q", entryReq.VocalistMembershipID)
+			}
+			if event.Vocalist(entry) == nil {
+				return nil, errorf(http.StatusBadRequest, "membership %s is not in the event", entryReq.VocalistMembershipID)
+			}
+		}
+
+		setlist = append(setlist, entry)
+	}
+
+	return setlist, nil
+}
+
+// applyEventRequest changes the songs and the setlist of the event and returns it as it is now.
+// songIDs are nil if the songs are not changed.
+func (h *APIHandler) applyEventRequest(band *entities.Band, event *entities.Event, songIDs []primitive.ObjectID, setlist []entities.SetlistEntry) (interface{}, error) {
+	actor := h.apiTokenService.Actor(band)
+
+	if songIDs != nil {
+		err := h.eventService.ReplaceSongIDs(actor, event.ID, songIDs)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	for _, entry := range setlist {
+		_, err := h.eventService.UpdateSetlistEntry(actor, event.ID, entry)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	event, err := h.eventService.FindOneByID(event.ID)
+	if err != nil {
+		return nil, err
+	}
+
+	return newEventView(event), nil
+}
+
+func containsObjectID(IDs []primitive.ObjectID, ID primitive.ObjectID) bool {
+	for _, i := range IDs {
+		if i == ID {
+			return true
+		}
+	}
+	return false
+}
+
+func (h *APIHandler) deleteEvent(band *entities.Band, hex string) error {
+	event, err := h.findEvent(band, hex)
+	if err != nil {
+		return err
+	}
+
+	return h.eventService.DeleteOneByID(h.apiTokenService.Actor(band), event.ID)
+}
+
+type membershipRequest struct {
+	UserID int64  `json:"userId"`
+	RoleID string `json:"roleId"`
+}
+
+func (h *APIHandler) createMembership(band *entities.Band, hex string, r *http.Request) (interface{}, error) {
+	event, err := h.findEvent(band, hex)
+	if err != nil {
+		return nil, err
+	}
+
+	var req membershipRequest
+	err = decodeJSON(r, &req)
+	if err != nil {
+		return nil, err
+	}
+
+	user, err := h.userService.FindOneByID(req.UserID)
+	if err != nil || user.UserBand(band.ID) == nil {
+		return nil, errorf(http.StatusBadRequest, "user %d not found", req.UserID)
+	}
+
+	roleID, err := primitive.ObjectIDFromHex(req.RoleID)
+	if err != nil {
+		return nil, errorf(http.StatusBadRequest, "invalid role id %q", req.RoleID)
+	}
+	role, err := h.roleService.FindOneByID(roleID)
+	if err != nil || role.BandID != band.ID {
+		return nil, errorf(http.StatusBadRequest, "role %s not found", req.RoleID)
+	}
+
+	// The user is notified by the bot like with members added in the chat.
+	_, err = h.membershipService.UpdateOne(h.apiTokenService.Actor(band), entities.Membership{
+		EventID: event.ID,
+		UserID:  user.ID,
+		RoleID:  role.ID,
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	event, err = h.eventService.FindOneByID(event.ID)
+	if err != nil {
+		return nil, err
+	}
+
+	return newEventView(event), nil
+}
+
+func (h *APIHandler) deleteMembership(band *entities.Band, eventHex string, hex string) error {
+	event, err := h.findEvent(band, eventHex)
+	if err != nil {
+		return err
+	}
+
+	for _, membership := range event.Memberships {
+		if membership.ID.Hex() == hex {
+			return h.membershipService.DeleteOneByID(h.apiTokenService.Actor(band), membership.ID)
+		}
+	}
+
+	return errorf(http.StatusNotFound, "membership not found")
+}
+
+func decodeJSON(r *http.Request, v interface{}) error {
+	decoder := json.NewDecoder(http.MaxBytesReader(nil, r.Body, 1<<20))
+	decoder.DisallowUnknownFields()
+
+	err := decoder.Decode(v)
+	if err != nil {
+		return errorf(http.StatusBadRequest, "invalid body: %v", err)
+	}
+	return nil
+}
+
+func writeJSON(w http.ResponseWriter, status int, v interface{}) {
+	w.Header().Set("Content-Type", "application/json; charset=utf-8")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(v)
+}
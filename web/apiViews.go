@@ -0,0 +1,168 @@
+package web
+
+import (
+	"github.com/joeyave/scala-chords-bot/entities"
+	"time"
+)
+
+// JSON representations of the entities. They leave out the bot internals like the conversation state.
+
+type bandView struct {
+	ID    string      `json:"id"`
+	Name  string      `json:"name"`
+	Roles []*roleView `json:"roles"`
+}
+
+type roleView struct {
+	ID       string `json:"id"`
+	Name     string `json:"name"`
+	Priority int    `json:"priority"`
+}
+
+type userView struct {
+	ID        int64           `json:"id"`
+	Name      string          `json:"name"`
+	Admin     bool            `json:"admin"`
+	Blackouts []*blackoutView `json:"blackouts"`
+}
+
+type blackoutView struct {
+	From time.Time `json:"from"`
+	To   time.Time `json:"to"`
+}
+
+type songView struct {
+	ID     string       `json:"id"`
+	Name   string       `json:"name"`
+	Key    string       `json:"key"`
+	BPM    string       `json:"bpm"`
+	Time   string       `json:"time"`
+	Link   string       `json:"link,omitempty"`
+	Voices []*voiceView `json:"voices"`
+}
+
+type voiceView struct {
+	ID   string `json:"id"`
+	Name string `json:"name"`
+}
+
+type eventView struct {
+	ID          string            `json:"id"`
+	Name        string            `json:"name"`
+	Time        time.Time         `json:"time"`
+	Memberships []*membershipView `json:"memberships"`
+	Setlist     []*setlistView    `json:"setlist"`
+}
+
+type membershipView struct {
+	ID       string `json:"id"`
+	UserID   int64  `json:"userId"`
+	UserName string `json:"userName"`
+	RoleID   string `json:"roleId"`
+	RoleName string `json:"roleName"`
+	// pending, accepted or declined.
+	Status string `json:"status"`
+}
+
+// setlistView is a song of the event with the key and BPM it is going to be played in.
+type setlistView struct {
+	Song                 *songView `json:"song"`
+	Key                  string    `json:"key"`
+	BPM                  string    `json:"bpm"`
+	Note                 string    `json:"note,omitempty"`
+	VocalistMembershipID string    `json:"vocalistMembershipId,omitempty"`
+}
+
+func newBandView(band *entities.Band) *bandView {
+	view := &bandView{
+		ID:    band.ID.Hex(),
+		Name:  band.Name,
+		Roles: []*roleView{},
+	}
+	for _, role := range band.Roles {
+		view.Roles = append(view.Roles, newRoleView(role))
+	}
+	return view
+}
+
+func newRoleView(role *entities.Role) *roleView {
+	return &roleView{
+		ID:       role.ID.Hex(),
+		Name:     role.Name,
+		Priority: role.Priority,
+	}
+}
+
+func newUserView(user *entities.User, admin bool) *userView {
+	view := &userView{
+		ID:        user.ID,
+		Name:      user.Name,
+		Admin:     admin,
+		Blackouts: []*blackoutView{},
+	}
+	for _, blackout := range user.Blackouts {
+		view.Blackouts = append(view.Blackouts, &blackoutView{From: blackout.From, To: blackout.To})
+	}
+	return view
+}
+
+func newSongView(song *entities.Song) *songView {
+	view := &songView{
+		ID:     song.ID.Hex(),
+		Name:   song.PDF.Name,
+		Key:    song.PDF.Key,
+		BPM:    song.PDF.BPM,
+		Time:   song.PDF.Time,
+		Link:   song.PDF.WebViewLink,
+		Voices: []*voiceView{},
+	}
+	for _, voice := range song.Voices {
+		view.Voices = append(view.Voices, &voiceView{ID: voice.ID.Hex(), Name: voice.Name})
+	}
+	return view
+}
+
+func newEventView(event *entities.Event) *eventView {
+	view := &eventView{
+		ID:          event.ID.Hex(),
+		Name:        event.Name,
+		Time:        event.Time,
+		Memberships: []*membershipView{},
+		Setlist:     []*setlistView{},
+	}
+
+	for _, membership := range event.Memberships {
+		membershipView := &membershipView{
+			ID:     membership.ID.Hex(),
+			UserID: membership.UserID,
+			RoleID: membership.RoleID.Hex(),
+			Status: membership.Status,
+		}
+		if membershipView.Status == "" {
+			membershipView.Status = "pending"
+		}
+		if membership.User != nil {
+			membershipView.UserName = membership.User.Name
+		}
+		if membership.Role != nil {
+			membershipView.RoleName = membership.Role.Name
+		}
+		view.Memberships = append(view.Memberships, membershipView)
+	}
+
+	for _, song := range event.Songs {
+		entry := event.SetlistEntry(song.ID)
+		setlistView := &setlistView{
+			Song: newSongView(song),
+			Key:  event.SongKey(song),
+			BPM:  event.SongBPM(song),
+			Note: entry.Note,
+		}
+		if !entry.MembershipID.IsZero() {
+			setlistView.VocalistMembershipID = entry.MembershipID.Hex()
+		}
+		view.Setlist = append(view.Setlist, setlistView)
+	}
+
+	return view
+}
@@ -0,0 +1,75 @@
+package web
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/joeyave/scala-chords-bot/entities"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+func TestParseSetlist(t *testing.T) {
+	one, two, other := primitive.NewObjectID(), primitive.NewObjectID(), primitive.NewObjectID()
+	vocalist, stranger := primitive.NewObjectID(), primitive.NewObjectID()
+
+	event := &entities.Event{
+		SongIDs:     []primitive.ObjectID{one},
+		Memberships: []*entities.Membership{{ID: vocalist}},
+	}
+
+	cases := []struct {
+		name    string
+		songIDs []primitive.ObjectID
+		entry   setlistEntryRequest
+		status  int
+	}{
+		{name: "song of the event", entry: setlistEntryRequest{SongID: one.Hex(), Key: "D"}},
+		{name: "song added by the request", songIDs: []primitive.ObjectID{one, two}, entry: setlistEntryRequest{SongID: two.Hex()}},
+		{name: "song not in the event", entry: setlistEntryRequest{SongID: other.Hex()}, status: http.StatusBadRequest},
+		{name: "song removed by the request", songIDs: []primitive.ObjectID{two}, entry: setlistEntryRequest{SongID: one.Hex()}, status: http.StatusBadRequest},
+		{name: "vocalist of the event", entry: setlistEntryRequest{SongID: one.Hex(), VocalistMembershipID: vocalist.Hex()}},
+		{name: "vocalist not in the event", entry: setlistEntryRequest{SongID: one.Hex(), VocalistMembershipID: stranger.Hex()}, status: http.StatusBadRequest},
+		{name: "invalid song id", entry: setlistEntryRequest{SongID: "one"}, status: http.StatusBadRequest},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			entry := c.entry
+			setlist, err := parseSetlist(event, c.songIDs, &eventRequest{Setlist: []*setlistEntryRequest{&entry}})
+
+			if c.status == 0 {
+				if err != nil || len(setlist) != 1 {
+					t.Errorf("parseSetlist = %v, %v, want the entry", setlist, err)
+				}
+				return
+			}
+
+			apiErr, ok := err.(*apiError)
+			if !ok || apiErr.status != c.status {
+				t.Errorf("parseSetlist error is %v, want status %d", err, c.status)
+			}
+		})
+	}
+}
+
+func TestAPIRoute(t *testing.T) {
+	cases := []struct {
+		method string
+		path   string
+		want   string
+	}{
+		{http.MethodGet, "/api/band", "GET band"},
+		{http.MethodGet, "/api/songs/abc/", "GET songs/{id}"},
+		{http.MethodDelete, "/api/events/abc/memberships/def", "DELETE events/{id}/memberships/{id}"},
+		{http.MethodDelete, "/api/events/abc/memberships/def/junk", "DELETE events/{id}/memberships/{id}/junk"},
+		{http.MethodGet, "/api/songs/abc/x/y", "GET songs/{id}/x/{id}"},
+	}
+
+	for _, c := range cases {
+		route, _ := apiRoute(httptest.NewRequest(c.method, c.path, nil))
+		if route != c.want {
+			t.Errorf("route of %s %s is %q, want %q", c.method, c.path, route, c.want)
+		}
+	}
+}
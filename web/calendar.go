@@ -0,0 +1,104 @@
+package web
+
+import (
+	"crypto/subtle"
+	"github.com/joeyave/scala-chords-bot/services"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"net/http"
+	"strconv"
+	"strings"
+)
+
+// CalendarHandler serves iCalendar feeds:
+//
+//	/calendar/users/{userId}.ics?token={token}
+//	/calendar/bands/{bandId}.ics?user={userId}&token={token}
+type CalendarHandler struct {
+	calendarService *services.CalendarService
+	userService     *services.UserService
+	bandService     *services.BandService
+}
+
+func NewCalendarHandler(calendarService *services.CalendarService, userService *services.UserService, bandService *services.BandService) *CalendarHandler {
+	return &CalendarHandler{
+		calendarService: calendarService,
+		userService:     userService,
+		bandService:     bandService,
+	}
+}
+
+func (h *CalendarHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet && r.Method != http.MethodHead {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	parts := strings.Split(strings.Trim(r.URL.Path, "/"), "/")
+	if len(parts) != 3 || parts[0] != "calendar" || !strings.HasSuffix(parts[2], ".ics") {
+		http.NotFound(w, r)
+		return
+	}
+	ID := strings.TrimSuffix(parts[2], ".ics")
+	token := r.URL.Query().Get("token")
+
+	var calendar string
+	switch parts[1] {
+	case "users":
+		userID, err := strconv.ParseInt(ID, 10, 64)
+		if err != nil {
+			http.NotFound(w, r)
+			return
+		}
+
+		user, err := h.userService.FindOneByID(userID)
+		if err != nil || !validToken(token, h.calendarService.UserToken(user)) {
+			http.NotFound(w, r)
+			return
+		}
+
+		calendar = h.calendarService.UserCalendar(user)
+
+	case "bands":
+		bandID, err := primitive.ObjectIDFromHex(ID)
+		if err != nil {
+			http.NotFound(w, r)
+			return
+		}
+		userID, err := strconv.ParseInt(r.URL.Query().Get("user"), 10, 64)
+		if err != nil {
+			http.NotFound(w, r)
+			return
+		}
+
+		band, err := h.bandService.FindOneByID(bandID)
+		if err != nil {
+			http.NotFound(w, r)
+			return
+		}
+		user, err := h.userService.FindOneByID(userID)
+		if err != nil || !validToken(token, h.calendarService.BandToken(band, user)) {
+			http.NotFound(w, r)
+			return
+		}
+
+		// Links of those who have left the band stop working.
+		if user.UserBand(band.ID) == nil {
+			http.NotFound(w, r)
+			return
+		}
+
+		calendar = h.calendarService.BandCalendar(band)
+
+	default:
+		http.NotFound(w, r)
+		return
+	}
+
+	w.Header().Set("Content-Type", "text/calendar; charset=utf-8")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.Write([]byte(calendar))
+}
+
+func validToken(token string, expected string) bool {
+	return subtle.ConstantTimeCompare([]byte(token), []byte(expected)) == 1
+}
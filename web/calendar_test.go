@@ -0,0 +1,58 @@
+package web
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/joeyave/scala-chords-bot/entities"
+	"github.com/joeyave/scala-chords-bot/repositories"
+	"github.com/joeyave/scala-chords-bot/services"
+)
+
+func TestBandCalendarMembership(t *testing.T) {
+	store := repositories.NewMemoryStore()
+	userRepository := repositories.NewUserMemoryRepository(store)
+	bandRepository := repositories.NewBandMemoryRepository(store)
+	calendarService := services.NewCalendarService(repositories.NewEventMemoryRepository(store), userRepository, bandRepository, "secret")
+	handler := NewCalendarHandler(calendarService, services.NewUserService(userRepository), services.NewBandService(bandRepository, nil))
+
+	band, err := bandRepository.UpdateOne(entities.Band{Name: "Band"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	user, err := userRepository.UpdateOne(entities.User{ID: 1, Name: "Sam", BandID: band.ID})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	get := func(token string) int {
+		rec := httptest.NewRecorder()
+		handler.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, fmt.Sprintf("/calendar/bands/%s.ics?user=%d&token=%s", band.ID.Hex(), user.ID, token), nil))
+		return rec.Code
+	}
+
+	token := calendarService.BandToken(band, user)
+	if code := get(token); code != http.StatusOK {
+		t.Fatalf("member got %d, want 200", code)
+	}
+	if code := get(calendarService.UserToken(user)); code != http.StatusNotFound {
+		t.Errorf("token of another feed got %d, want 404", code)
+	}
+
+	// The user leaves the band for another one.
+	other, err := bandRepository.UpdateOne(entities.Band{Name: "Other"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	user.BandID = other.ID
+	user.Bands = []*entities.UserBand{{BandID: other.ID}}
+	_, err = userRepository.UpdateOne(*user)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if code := get(token); code != http.StatusNotFound {
+		t.Errorf("former member got %d, want 404", code)
+	}
+}
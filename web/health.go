@@ -0,0 +1,32 @@
+package web
+
+import (
+	"net/http"
+	"sync/atomic"
+)
+
+// HealthHandler answers liveness checks of the platform until the shutdown begins.
+type HealthHandler struct {
+	shuttingDown int32
+}
+
+func NewHealthHandler() *HealthHandler {
+	return &HealthHandler{}
+}
+
+// ShutDown makes the checks fail, so the platform stops routing requests here.
+func (h *HealthHandler) ShutDown() {
+	atomic.StoreInt32(&h.shuttingDown, 1)
+}
+
+func (h *HealthHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+
+	if atomic.LoadInt32(&h.shuttingDown) == 1 {
+		w.WriteHeader(http.StatusServiceUnavailable)
+		w.Write([]byte(`{"status":"shutting down"}`))
+		return
+	}
+
+	w.Write([]byte(`{"status":"ok"}`))
+}
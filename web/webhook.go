@@ -0,0 +1,84 @@
+package web
+
+import (
+	"crypto/subtle"
+	"encoding/json"
+	"fmt"
+	"github.com/joeyave/telebot/v3"
+	"net/http"
+	"sync"
+)
+
+// WebhookPoller receives updates from Telegram over HTTP instead of long polling.
+// Telegram sends the secret token with every update, so requests from anyone else are rejected.
+type WebhookPoller struct {
+	PublicURL   string
+	SecretToken string
+
+	mu   sync.RWMutex
+	dest chan<- telebot.Update
+	err  error
+}
+
+// Poll registers the webhook and waits for the bot to stop, updates come to ServeHTTP meanwhile.
+// If the webhook can't be registered, Poll returns at once and Err tells why.
+func (p *WebhookPoller) Poll(b *telebot.Bot, dest chan telebot.Update, stop chan struct{}) {
+	_, err := b.Raw("setWebhook", map[string]string{
+		"url":          p.PublicURL,
+		"secret_token": p.SecretToken,
+	})
+	if err != nil {
+		p.mu.Lock()
+		p.err = fmt.Errorf("setting webhook: %w", err)
+		p.mu.Unlock()
+		return
+	}
+
+	p.mu.Lock()
+	p.dest = dest
+	p.mu.Unlock()
+
+	<-stop
+
+	p.mu.Lock()
+	p.dest = nil
+	p.mu.Unlock()
+}
+
+// Err returns the error that stopped Poll, nil if it was stopped by the bot.
+func (p *WebhookPoller) Err() error {
+	p.mu.RLock()
+	defer p.mu.RUnlock()
+
+	return p.err
+}
+
+func (p *WebhookPoller) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	if subtle.ConstantTimeCompare([]byte(r.Header.Get("X-Telegram-Bot-Api-Secret-Token")), []byte(p.SecretToken)) != 1 {
+		http.Error(w, "forbidden", http.StatusForbidden)
+		return
+	}
+
+	var update telebot.Update
+	err := json.NewDecoder(r.Body).Decode(&update)
+	if err != nil {
+		http.Error(w, "bad request", http.StatusBadRequest)
+		return
+	}
+
+	p.mu.RLock()
+	defer p.mu.RUnlock()
+
+	// Not started yet or stopping: Telegram will send the update again.
+	if p.dest == nil {
+		http.Error(w, "unavailable", http.StatusServiceUnavailable)
+		return
+	}
+
+	p.dest <- update
+}
@@ -0,0 +1,44 @@
+package web
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/joeyave/telebot/v3"
+)
+
+func TestWebhookPollReturnsError(t *testing.T) {
+	api := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if strings.HasSuffix(r.URL.Path, "/getMe") {
+			w.Write([]byte(`{"ok":true,"result":{"id":1,"is_bot":true,"first_name":"Bot"}}`))
+			return
+		}
+		w.Write([]byte(`{"ok":false,"error_code":400,"description":"Bad Request: bad webhook"}`))
+	}))
+	defer api.Close()
+
+	poller := &WebhookPoller{PublicURL: "https://example.com/telegram/webhook", SecretToken: "secret"}
+	bot, err := telebot.NewBot(telebot.Settings{URL: api.URL, Token: "token", Poller: poller, Synchronous: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	polled := make(chan struct{})
+	go func() {
+		poller.Poll(bot, bot.Updates, make(chan struct{}))
+		close(polled)
+	}()
+
+	select {
+	case <-polled:
+	case <-time.After(5 * time.Second):
+		t.Fatal("Poll didn't return after setWebhook failed")
+	}
+
+	if err := poller.Err(); err == nil || !strings.Contains(err.Error(), "bad webhook") {
+		t.Errorf("Err() = %v, want the error of setWebhook", err)
+	}
+}